@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/internal/ratelimit"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetAbuseEvents handles the querying of abuse events recorded by the rate limiter.
+func (a *App) GetAbuseEvents(c echo.Context) error {
+	var (
+		qp = c.Request().URL.Query()
+		pg = a.pg.NewFromURL(qp)
+	)
+
+	res, total, err := a.core.QueryAbuseEvents(strings.TrimSpace(qp.Get("type")),
+		strings.TrimSpace(qp.Get("scope")), strings.TrimSpace(qp.Get("value")), pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetRateLimitBlocks handles the retrieval of active rate limit blocks.
+func (a *App) GetRateLimitBlocks(c echo.Context) error {
+	out, err := a.core.GetRateLimitBlocks()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteRateLimitBlock handles the removal of a rate limit block.
+func (a *App) DeleteRateLimitBlock(c echo.Context) error {
+	b, err := a.core.DeleteRateLimitBlock(getID(c))
+	if err != nil {
+		return err
+	}
+
+	if a.limiter != nil {
+		a.limiter.Unblock(b.Scope, b.Value)
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// limitPublic is a middleware that rate limits requests to public subscription
+// endpoints by the IP of the requester. The IP is that of the connection, or
+// from X-Forwarded-For only when set by a trusted proxy (app.trusted_proxies).
+func (a *App) limitPublic(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := a.checkRateLimit(c, ratelimit.ScopeIP, c.RealIP()); err != nil {
+			// Public API endpoints get a JSON error and the rest, an HTML page.
+			if strings.HasPrefix(c.Path(), "/api/") {
+				return err
+			}
+
+			return c.Render(http.StatusTooManyRequests, tplMessage,
+				makeMsgTpl(a.i18n.T("public.errorTitle"), "", fmt.Sprintf("%s", err.Message)))
+		}
+
+		return next(c)
+	}
+}
+
+// checkRateLimit checks the given key, eg: an IP or e-mail domain, against the
+// rate limiter and returns an error if the key is rate limited or blocked.
+func (a *App) checkRateLimit(c echo.Context, scope, value string) *echo.HTTPError {
+	if a.limiter == nil {
+		return nil
+	}
+
+	retry, err := a.limiter.Check(scope, value, c.RealIP(), c.Path())
+	if err == nil {
+		return nil
+	}
+
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	return echo.NewHTTPError(http.StatusTooManyRequests, a.i18n.T("public.tooManyRequests"))
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/knadh/listmonk/internal/captcha"
+	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 	null "gopkg.in/volatiletech/null.v6"
 )
@@ -16,11 +17,12 @@ type serverConfig struct {
 	RootURL            string `json:"root_url"`
 	FromEmail          string `json:"from_email"`
 	PublicSubscription struct {
-		Enabled          bool        `json:"enabled"`
-		CaptchaEnabled   bool        `json:"captcha_enabled"`
-		CaptchaProvider  null.String `json:"captcha_provider"`
-		CaptchaKey       null.String `json:"captcha_key"`
-		AltchaComplexity int         `json:"altcha_complexity"`
+		Enabled          bool               `json:"enabled"`
+		CaptchaEnabled   bool               `json:"captcha_enabled"`
+		CaptchaProvider  null.String        `json:"captcha_provider"`
+		CaptchaKey       null.String        `json:"captcha_key"`
+		AltchaComplexity int                `json:"altcha_complexity"`
+		Fields           []models.FormField `json:"fields"`
 	} `json:"public_subscription"`
 	Messengers    []string        `json:"messengers"`
 	Langs         []i18nLang      `json:"langs"`
@@ -42,6 +44,7 @@ func (a *App) GetServerConfig(c echo.Context) error {
 		HasLegacyUser: a.cfg.HasLegacyUser,
 	}
 	out.PublicSubscription.Enabled = a.cfg.EnablePublicSubPage
+	out.PublicSubscription.Fields = a.cfg.PublicFormFields
 
 	// CAPTCHA.
 	if a.cfg.Security.Captcha.Altcha.Enabled {
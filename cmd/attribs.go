@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetSubscriberAttribs handles the retrieval of the subscriber attribute schema.
+func (a *App) GetSubscriberAttribs(c echo.Context) error {
+	out, err := a.core.GetSubscriberAttribs()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateSubscriberAttrib handles the creation of a subscriber attribute definition.
+func (a *App) CreateSubscriberAttrib(c echo.Context) error {
+	var o models.SubscriberAttrib
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateSubscriberAttrib(o)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.CreateSubscriberAttrib(o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateSubscriberAttrib handles the modification of a subscriber attribute definition.
+func (a *App) UpdateSubscriberAttrib(c echo.Context) error {
+	var o models.SubscriberAttrib
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateSubscriberAttrib(o)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.UpdateSubscriberAttrib(getID(c), o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteSubscriberAttrib handles the deletion of a subscriber attribute definition.
+func (a *App) DeleteSubscriberAttrib(c echo.Context) error {
+	if err := a.core.DeleteSubscriberAttrib(getID(c)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateSubscriberAttrib validates a subscriber attribute definition and
+// converts its enum and default values to the attribute's type.
+func (a *App) validateSubscriberAttrib(o models.SubscriberAttrib) (models.SubscriberAttrib, error) {
+	o.Key = strings.TrimSpace(o.Key)
+	if !models.IsValidAttribKey(o.Key) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "key"))
+	}
+
+	o.Name = strings.TrimSpace(o.Name)
+	if !strHasLen(o.Name, 0, stdInputMaxLen) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	if !slices.Contains(models.AttribTypes, o.Type) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "type"))
+	}
+
+	// Enum values should be valid values of the type.
+	enum := pq.StringArray{}
+	for _, e := range o.Enum {
+		e = strings.TrimSpace(e)
+		if e == "" || slices.Contains(enum, e) {
+			continue
+		}
+
+		if o.Type != models.AttribTypeList {
+			if _, err := (models.SubscriberAttrib{Key: o.Key, Type: o.Type}).Convert(e); err != nil {
+				return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "enum"))
+			}
+		}
+		enum = append(enum, e)
+	}
+	o.Enum = enum
+
+	// The default value should be a valid value of the attribute.
+	if len(o.Default) > 0 && string(o.Default) != "null" {
+		var v any
+		if err := json.Unmarshal(o.Default, &v); err != nil {
+			return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "default"))
+		}
+
+		if v == "" {
+			o.Default = nil
+		} else {
+			v, err := o.Convert(v)
+			if err != nil {
+				return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "default"))
+			}
+
+			b, _ := json.Marshal(v)
+			o.Default = b
+		}
+	}
+
+	o.Description = strings.TrimSpace(o.Description)
+	if !strHasLen(o.Description, 0, 2000) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "description"))
+	}
+
+	return o, nil
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	// auditMaxBody is the maximum size of a response body that's captured
+	// to extract the created or updated record for the audit log.
+	auditMaxBody = 256 * 1024
+
+	auditRedacted = "********"
+
+	ctxAuditBefore = "audit_before"
+	ctxAuditAfter  = "audit_after"
+	ctxAuditMeta   = "audit_meta"
+)
+
+// auditSkipRoutes is the list of non-GET API routes that don't mutate any
+// state and aren't recorded in the audit log.
+var auditSkipRoutes = map[string]bool{
+	"/api/campaigns/:id/preview":         true,
+	"/api/campaigns/:id/preview/archive": true,
+	"/api/campaigns/:id/text":            true,
+	"/api/campaigns/:id/content":         true,
+	"/api/templates/preview":             true,
+	"/api/tx":                            true,
+	"/api/tx/batch":                      true,
+	"/webhooks/bounce":                   true,
+}
+
+// auditWriter wraps a response writer and captures the response body.
+type auditWriter struct {
+	http.ResponseWriter
+
+	buf      bytes.Buffer
+	overflow bool
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if !w.overflow {
+		if w.buf.Len()+len(b) > auditMaxBody {
+			w.overflow = true
+			w.buf.Reset()
+		} else {
+			w.buf.Write(b)
+		}
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// GetAuditLog handles the querying of the audit log.
+func (a *App) GetAuditLog(c echo.Context) error {
+	var (
+		qp = c.Request().URL.Query()
+		pg = a.pg.NewFromURL(qp)
+
+		q = models.AuditLogQuery{
+			TargetType: strings.TrimSpace(qp.Get("target_type")),
+			Action:     strings.TrimSpace(qp.Get("action")),
+			IP:         strings.TrimSpace(qp.Get("ip")),
+		}
+	)
+
+	// Optional numeric filters.
+	for _, f := range []struct {
+		name string
+		val  *int
+	}{{"user_id", &q.UserID}, {"target_id", &q.TargetID}} {
+		if v := qp.Get(f.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", f.name))
+			}
+			*f.val = n
+		}
+	}
+
+	// Optional date range.
+	for _, f := range []struct {
+		name string
+		val  *null.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		v := qp.Get(f.name)
+		if v == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, v); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", f.name))
+			}
+		}
+		*f.val = null.TimeFrom(t)
+	}
+
+	res, total, err := a.core.QueryAuditLog(q, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// auditLog is a middleware that records successful mutating (non-GET) requests
+// on authenticated API endpoints in the audit log. Handlers can attach the
+// before/after state of the target record with setAuditDiff(). For new records,
+// the ID and state are picked up from the response.
+func (a *App) auditLog(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+		if auditSkipRoutes[c.Path()] {
+			return next(c)
+		}
+
+		w := &auditWriter{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = w
+
+		if err := next(c); err != nil {
+			return err
+		}
+		if c.Response().Status >= http.StatusBadRequest {
+			return nil
+		}
+
+		user, ok := c.Get(auth.UserHTTPCtxKey).(auth.User)
+		if !ok {
+			return nil
+		}
+
+		// Derive the target type from the route, eg: /api/campaigns/:id/status => campaigns.
+		// The profile endpoints act on the user's own account.
+		var (
+			typ      = strings.SplitN(strings.TrimPrefix(c.Path(), "/api/"), "/", 2)[0]
+			targetID = 0
+		)
+		if typ == "profile" {
+			typ = "users"
+			targetID = user.ID
+		} else if id, ok := c.Get("id").(int); ok {
+			targetID = id
+		} else if id, err := strconv.Atoi(c.Param("id")); err == nil {
+			targetID = id
+		}
+
+		// Response data of the request.
+		var data json.RawMessage
+		if !w.overflow {
+			var resp struct {
+				Data json.RawMessage `json:"data"`
+			}
+			if err := json.Unmarshal(w.buf.Bytes(), &resp); err == nil {
+				data = resp.Data
+			}
+		}
+
+		// Before and after state of the target.
+		var before, after json.RawMessage
+		if b := c.Get(ctxAuditBefore); b != nil {
+			var af any = data
+			if v := c.Get(ctxAuditAfter); v != nil {
+				af = v
+			}
+			before, after = auditDiff(b, af)
+		} else if c.Request().Method == http.MethodPost && targetID == 0 {
+			// A new record. Pick up its ID and state from the response.
+			var rec struct {
+				ID int `json:"id"`
+			}
+			if err := json.Unmarshal(data, &rec); err == nil && rec.ID > 0 {
+				targetID = rec.ID
+				_, after = auditDiff(nil, data)
+			}
+		}
+
+		// Record the request details or query params. eg: IDs in bulk delete requests.
+		var meta json.RawMessage
+		if m := c.Get(ctxAuditMeta); m != nil {
+			meta, _ = json.Marshal(redactAudit("", toAuditJSON(m)))
+		} else if qp := c.QueryParams(); len(qp) > 0 {
+			meta, _ = json.Marshal(qp)
+		}
+
+		a.recordAudit(c, user, typ, targetID, before, after, meta)
+		return nil
+	}
+}
+
+// recordAudit records an action on the current route by the given user in the audit log.
+// Errors are logged and not returned as the action has already been performed.
+func (a *App) recordAudit(c echo.Context, user auth.User, targetType string, targetID int, before, after, meta json.RawMessage) {
+	e := models.AuditLog{
+		UserID:     null.IntFrom(user.ID),
+		Username:   user.Username,
+		Action:     c.Request().Method + " " + c.Path(),
+		TargetType: targetType,
+		Before:     before,
+		After:      after,
+		Meta:       meta,
+		IP:         c.RealIP(),
+	}
+	if targetID > 0 {
+		e.TargetID = null.IntFrom(targetID)
+	}
+
+	_ = a.core.InsertAuditLog(e)
+}
+
+// auditLogin records a user's login in the audit log.
+func (a *App) auditLogin(c echo.Context, user auth.User, method string) {
+	meta, _ := json.Marshal(map[string]string{"method": method})
+	a.recordAudit(c, user, "users", user.ID, nil, nil, meta)
+}
+
+// setAuditDiff attaches the state of the target record before a change to the request
+// for the audit log. If after is nil, the response data of the request is used.
+func setAuditDiff(c echo.Context, before, after any) {
+	// Take a snapshot of the states as the handler may modify them later.
+	c.Set(ctxAuditBefore, toAuditJSON(before))
+	if after != nil {
+		c.Set(ctxAuditAfter, toAuditJSON(after))
+	}
+}
+
+// setAuditMeta attaches details of a request, eg: the query of a bulk action,
+// to be recorded in the audit log in place of its query params.
+func setAuditMeta(c echo.Context, meta any) {
+	c.Set(ctxAuditMeta, meta)
+}
+
+// auditDiff returns the JSON of the fields that differ between two records with
+// sensitive fields such as passwords and secrets redacted. If before is nil,
+// the whole of after is returned.
+func auditDiff(before, after any) (json.RawMessage, json.RawMessage) {
+	var b, af any
+	if before != nil {
+		b = toAuditJSON(before)
+	}
+	af = toAuditJSON(after)
+
+	bm, ok1 := b.(map[string]any)
+	am, ok2 := af.(map[string]any)
+	if ok1 && ok2 {
+		var (
+			outB = map[string]any{}
+			outA = map[string]any{}
+		)
+		for k, v := range am {
+			if old, ok := bm[k]; !ok || !reflect.DeepEqual(old, v) {
+				outB[k] = old
+				outA[k] = v
+			}
+		}
+		for k, v := range bm {
+			if _, ok := am[k]; !ok {
+				outB[k] = v
+			}
+		}
+
+		b, af = outB, outA
+	}
+
+	var outB, outA json.RawMessage
+	if b != nil {
+		outB, _ = json.Marshal(redactAudit("", b))
+	}
+	if af != nil {
+		outA, _ = json.Marshal(redactAudit("", af))
+	}
+
+	return outB, outA
+}
+
+// toAuditJSON converts a value to its generic JSON representation.
+func toAuditJSON(v any) any {
+	var (
+		b   []byte
+		err error
+	)
+	if raw, ok := v.(json.RawMessage); ok {
+		b = raw
+	} else if b, err = json.Marshal(v); err != nil {
+		return nil
+	}
+
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil
+	}
+
+	return out
+}
+
+// redactAudit recursively masks the values of sensitive keys in a JSON value.
+func redactAudit(key string, v any) any {
+	k := strings.ToLower(key)
+	if strings.Contains(k, "password") || strings.Contains(k, "secret") || strings.Contains(k, "token") ||
+		k == "key" || strings.HasSuffix(k, "_key") {
+		if v == nil || v == "" {
+			return v
+		}
+		return auditRedacted
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		for mk, mv := range val {
+			val[mk] = redactAudit(mk, mv)
+		}
+	case []any:
+		for i, mv := range val {
+			val[i] = redactAudit("", mv)
+		}
+	}
+
+	return v
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/mail"
 	"net/url"
@@ -27,6 +28,12 @@ type loginTpl struct {
 	OIDCProvider     string
 	OIDCProviderLogo string
 	Error            string
+
+	// TOTP 2FA step of the login. If the user is yet to enrol, the secret
+	// and its provisioning URI are set. Recovery codes are shown post enrolment.
+	TOTPSecret    string
+	TOTPURI       string
+	RecoveryCodes []string
 }
 
 type oidcState struct {
@@ -55,10 +62,19 @@ func (a *App) LoginPage(c echo.Context) error {
 	// Process POST login request.
 	var loginErr error
 	if c.Request().Method == http.MethodPost {
-		loginErr = a.doLogin(c)
-		if loginErr == nil {
+		// The second (TOTP) step of the login.
+		if c.FormValue("step") == "totp" {
+			return a.doLoginTOTP(c)
+		}
+
+		user, pending, err := a.doLogin(c)
+		if err == nil {
+			if pending {
+				return a.renderLoginTOTPPage(c, user, c.FormValue("next"), nil)
+			}
 			return c.Redirect(http.StatusFound, utils.SanitizeURI(c.FormValue("next")))
 		}
+		loginErr = err
 	}
 
 	// Render the page, with or without POST.
@@ -181,10 +197,15 @@ func (a *App) OIDCFinish(c echo.Context) error {
 		return a.renderLoginPage(c, err)
 	}
 
-	// Set the session in the DB and cookie.
-	if err := a.auth.SaveSession(user, oidcToken, c); err != nil {
+	// Set the session in the DB and cookie, or if the user has to pass TOTP 2FA,
+	// a pending session and render the TOTP step.
+	pending, err := a.saveLoginSession(c, user, oidcToken, "oidc")
+	if err != nil {
 		return a.renderLoginPage(c, err)
 	}
+	if pending {
+		return a.renderLoginTOTPPage(c, user, state.Next, nil)
+	}
 
 	// Redirect to the next page.
 	return c.Redirect(http.StatusFound, utils.SanitizeURI(state.Next))
@@ -320,8 +341,9 @@ func (a *App) createOIDCUser(claims auth.OIDCclaim, c echo.Context) (auth.User,
 	return user, err
 }
 
-// doLogin logs a user in with a username and password.
-func (a *App) doLogin(c echo.Context) error {
+// doLogin logs a user in with a username and password. If the user has to
+// pass TOTP 2FA, a pending session is created and true is returned.
+func (a *App) doLogin(c echo.Context) (auth.User, bool, error) {
 	var (
 		startTime = time.Now()
 		username = strings.TrimSpace(c.FormValue("username"))
@@ -336,24 +358,149 @@ func (a *App) doLogin(c echo.Context) error {
 	}()
 
 	if !strHasLen(username, 3, stdInputMaxLen) {
-		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "username"))
+		return auth.User{}, false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "username"))
 	}
 	if !strHasLen(password, 8, stdInputMaxLen) {
-		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "password"))
+		return auth.User{}, false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "password"))
 	}
 
 	// Log the user in by fetching and verifying credentials from the DB.
 	user, err := a.core.LoginUser(username, password)
 	if err != nil {
-		return err
+		return auth.User{}, false, err
+	}
+
+	pending, err := a.saveLoginSession(c, user, "", "password")
+	if err != nil {
+		return auth.User{}, false, err
+	}
+
+	return user, pending, nil
+}
+
+// saveLoginSession issues a session to a user who has passed the first factor
+// of a login (password or OIDC). If the user has to pass TOTP 2FA, a pending
+// session is created instead and true is returned.
+func (a *App) saveLoginSession(c echo.Context, user auth.User, oidcToken, method string) (bool, error) {
+	// The user has to pass TOTP 2FA before a session is issued.
+	if user.Needs2FA() {
+		if err := a.auth.SavePendingSession(user, oidcToken, c); err != nil {
+			return false, err
+		}
+		return true, nil
 	}
 
 	// Set the session in the DB and cookie.
-	if err := a.auth.SaveSession(user, "", c); err != nil {
-		return err
+	if err := a.auth.SaveSession(user, oidcToken, c); err != nil {
+		return false, err
 	}
+	a.auditLogin(c, user, method)
 
-	return nil
+	return false, nil
+}
+
+// doLoginTOTP verifies the TOTP code (or a recovery code) of a pending login session
+// and on success, replaces it with a session. Users enrolling on login are shown
+// their recovery codes.
+func (a *App) doLoginTOTP(c echo.Context) error {
+	sess, userID, oidcToken, err := a.auth.GetPendingSession(c)
+	if err != nil {
+		return a.renderLoginPage(c, echo.NewHTTPError(http.StatusForbidden, a.i18n.T("users.totpSessionExpired")))
+	}
+
+	user, err := a.core.GetUser(userID, "", "")
+	if err != nil {
+		return a.renderLoginPage(c, err)
+	}
+	if user.Status != auth.UserStatusEnabled {
+		_ = sess.Destroy()
+		return a.renderLoginPage(c, echo.NewHTTPError(http.StatusForbidden, a.i18n.T("users.invalidLogin")))
+	}
+
+	if err := a.core.VerifyUserTOTP(user, c.FormValue("code")); err != nil {
+		a.auth.FailPendingSession(sess)
+		return a.renderLoginTOTPPage(c, user, c.FormValue("next"), err)
+	}
+
+	// The user enrolled on login. Enable 2FA and generate recovery codes.
+	var codes []string
+	if !user.TOTPEnabled {
+		rc, hashes, err := makeRecoveryCodes()
+		if err != nil {
+			a.log.Printf("error generating recovery codes: %v", err)
+			return a.renderLoginPage(c, echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError")))
+		}
+
+		if err := a.core.SetUserTOTP(user.ID, user.TOTPSecret, true, hashes); err != nil {
+			return a.renderLoginPage(c, err)
+		}
+		codes = rc
+	}
+
+	// Replace the pending session with a full session.
+	_ = sess.Destroy()
+	if err := a.auth.SaveSession(user, oidcToken, c); err != nil {
+		return a.renderLoginPage(c, err)
+	}
+	a.auditLogin(c, user, "totp")
+
+	if len(codes) == 0 {
+		return c.Redirect(http.StatusFound, utils.SanitizeURI(c.FormValue("next")))
+	}
+
+	next := utils.SanitizeURI(c.FormValue("next"))
+	if next == "/" {
+		next = uriAdmin
+	}
+
+	return c.Render(http.StatusOK, "admin-login-totp", loginTpl{
+		Title:         a.i18n.T("users.totp"),
+		NextURI:       next,
+		RecoveryCodes: codes,
+	})
+}
+
+// renderLoginTOTPPage renders the TOTP step of the login. Users who are yet to
+// enrol (required by their role) are shown a new secret to add to their app.
+func (a *App) renderLoginTOTPPage(c echo.Context, user auth.User, next string, loginErr error) error {
+	next = utils.SanitizeURI(next)
+	if next == "/" {
+		next = uriAdmin
+	}
+
+	out := loginTpl{
+		Title:   a.i18n.T("users.totp"),
+		NextURI: next,
+	}
+
+	if !user.TOTPEnabled {
+		secret := user.TOTPSecret.String
+		if secret == "" {
+			s, err := auth.NewTOTPSecret()
+			if err != nil {
+				a.log.Printf("error generating TOTP secret: %v", err)
+				return a.renderLoginPage(c, echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError")))
+			}
+
+			if err := a.core.SetUserTOTP(user.ID, null.NewString(s, true), false, nil); err != nil {
+				return a.renderLoginPage(c, err)
+			}
+			secret = s
+		}
+
+		out.TOTPSecret = secret
+		out.TOTPURI = a.makeTOTPURI(user, secret)
+	}
+
+	if loginErr != nil {
+		if e, ok := loginErr.(*echo.HTTPError); ok {
+			out.Error = fmt.Sprint(e.Message)
+		} else {
+			out.Error = loginErr.Error()
+		}
+	}
+
+	return c.Render(http.StatusOK, "admin-login-totp", out)
 }
 
 // doFirstTimeSetup sets a user up for the first time.
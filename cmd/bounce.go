@@ -243,6 +243,10 @@ func (a *App) validateBounceFields(b models.Bounce) (models.Bounce, error) {
 		return b, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "subscriber_uuid"))
 	}
 
+	if b.TxUUID != "" && !reUUID.MatchString(b.TxUUID) {
+		return b, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "tx_uuid"))
+	}
+
 	if b.Email != "" {
 		em, err := a.importer.SanitizeEmail(b.Email)
 		if err != nil {
@@ -34,6 +34,10 @@ type campReq struct {
 
 	MediaIDs []int `json:"media"`
 
+	// A/B test variants. Campaign.Variants is JSONText with
+	// per-variant stats for sending to the outside world.
+	Variants []models.CampaignVariant `json:"variants"`
+
 	// This is only relevant to campaign test requests.
 	SubscriberEmails pq.StringArray `json:"subscribers"`
 }
@@ -233,6 +237,68 @@ func (a *App) PreviewCampaignArchive(c echo.Context) error {
 	return c.HTML(http.StatusOK, string(msg.Body()))
 }
 
+// GetCampaignDeliveries retrieves the paginated per-message delivery log of a campaign.
+func (a *App) GetCampaignDeliveries(c echo.Context) error {
+	// Get the campaign ID.
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
+		return err
+	}
+
+	var (
+		subID, _ = strconv.Atoi(c.QueryParam("subscriber_id"))
+		email    = strings.TrimSpace(c.QueryParam("email"))
+		status   = c.QueryParam("status")
+
+		pg = a.pg.NewFromURL(c.Request().URL.Query())
+	)
+
+	switch status {
+	case "", models.DeliveryStatusSent, models.DeliveryStatusFailed, models.DeliveryStatusSkipped:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+	}
+
+	res, total, err := a.core.QueryCampaignDeliveries(id, subID, email, status, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.CampaignDelivery{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetCampaignVariants retrieves the A/B test variants of a campaign with per-variant stats.
+func (a *App) GetCampaignVariants(c echo.Context) error {
+	// Get the campaign ID.
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
+		return err
+	}
+
+	out, err := a.core.GetCampaignVariants(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // CampaignContent handles campaign content (body) format conversions.
 func (a *App) CampaignContent(c echo.Context) error {
 	var camp campContentReq
@@ -283,7 +349,7 @@ func (a *App) CreateCampaign(c echo.Context) error {
 		o.ArchiveTemplateID = o.TemplateID
 	}
 
-	out, err := a.core.CreateCampaign(o.Campaign, o.ListIDs, o.MediaIDs)
+	out, err := a.core.CreateCampaign(o.Campaign, o.ListIDs, o.MediaIDs, o.Variants)
 	if err != nil {
 		return err
 	}
@@ -316,6 +382,12 @@ func (a *App) UpdateCampaign(c echo.Context) error {
 	// This allows updating of values that have been sent whereas fields
 	// that are not in the request retain the old values.
 	o := campReq{Campaign: cm}
+
+	// Load the existing variants so that they're retained if the request doesn't have them.
+	if o.Variants, err = a.core.GetCampaignVariants(id); err != nil {
+		return err
+	}
+
 	if err := c.Bind(&o); err != nil {
 		return err
 	}
@@ -326,10 +398,11 @@ func (a *App) UpdateCampaign(c echo.Context) error {
 		o = c
 	}
 
-	out, err := a.core.UpdateCampaign(id, o.Campaign, o.ListIDs, o.MediaIDs)
+	out, err := a.core.UpdateCampaign(id, o.Campaign, o.ListIDs, o.MediaIDs, o.Variants)
 	if err != nil {
 		return err
 	}
+	setAuditDiff(c, cm, nil)
 
 	return c.JSON(http.StatusOK, okResp{out})
 }
@@ -351,11 +424,17 @@ func (a *App) UpdateCampaignStatus(c echo.Context) error {
 		return err
 	}
 
+	cm, err := a.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+
 	// Update the campaign status in the DB.
 	out, err := a.core.UpdateCampaignStatus(id, req.Status)
 	if err != nil {
 		return err
 	}
+	setAuditDiff(c, cm, nil)
 
 	// If the campaign is being stopped, send the signal to the manager to stop it in flight.
 	if req.Status == models.CampaignStatusPaused || req.Status == models.CampaignStatusCancelled {
@@ -624,6 +703,22 @@ func (a *App) validateCampaignFields(c campReq) (campReq, error) {
 		}
 	}
 
+	// If the campaign targets a segment, default to the segment's lists.
+	if c.SegmentID.Valid && c.SegmentID.Int > 0 {
+		seg, err := a.core.GetSegment(c.SegmentID.Int)
+		if err != nil {
+			return c, errors.New(a.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.segment}"))
+		}
+
+		if len(c.ListIDs) == 0 {
+			for _, id := range seg.ListIDs {
+				c.ListIDs = append(c.ListIDs, int(id))
+			}
+		}
+	} else {
+		c.SegmentID.Valid = false
+	}
+
 	if len(c.ListIDs) == 0 {
 		return c, errors.New(a.i18n.T("campaigns.fieldInvalidListIDs"))
 	}
@@ -637,6 +732,32 @@ func (a *App) validateCampaignFields(c campReq) (campReq, error) {
 		return c, errors.New(a.i18n.Ts("campaigns.fieldInvalidBody", "error", err.Error()))
 	}
 
+	if err := a.validateCampaignABTest(&c); err != nil {
+		return c, err
+	}
+
+	// Delivery at the subscribers' local time needs a schedule and the timezone
+	// in which the schedule's wall clock time is to be read.
+	if c.SendLocalTime {
+		if !c.SendAt.Valid {
+			return c, errors.New(a.i18n.T("campaigns.fieldInvalidLocalTime"))
+		}
+		if c.ABTestPercent > 0 {
+			return c, errors.New(a.i18n.T("campaigns.fieldInvalidLocalTimeABTest"))
+		}
+
+		tz := strings.TrimSpace(c.SendTimezone.String)
+		if tz == "" || tz == "Local" {
+			return c, errors.New(a.i18n.Ts("campaigns.fieldInvalidTimezone", "name", tz))
+		}
+		if _, err := time.LoadLocation(tz); err != nil {
+			return c, errors.New(a.i18n.Ts("campaigns.fieldInvalidTimezone", "name", tz))
+		}
+		c.SendTimezone = null.NewString(tz, true)
+	} else {
+		c.SendTimezone = null.String{}
+	}
+
 	if len(c.Headers) == 0 {
 		c.Headers = make([]map[string]string, 0)
 	}
@@ -660,6 +781,56 @@ func (a *App) validateCampaignFields(c campReq) (campReq, error) {
 	return c, nil
 }
 
+// validateCampaignABTest validates and sanitizes the A/B test settings and variants of a campaign.
+func (a *App) validateCampaignABTest(c *campReq) error {
+	if c.ABTestPercent < 0 || c.ABTestPercent > 100 {
+		return errors.New(a.i18n.T("campaigns.fieldInvalidABTest"))
+	}
+
+	if c.ABTestMetric != models.CampaignABMetricClicks {
+		c.ABTestMetric = models.CampaignABMetricViews
+	}
+
+	if c.ABTestWait == "" {
+		c.ABTestWait = "4h"
+	}
+	if d, err := time.ParseDuration(c.ABTestWait); err != nil || d < time.Minute {
+		return errors.New(a.i18n.T("campaigns.fieldInvalidABTest"))
+	}
+
+	if c.Variants == nil {
+		c.Variants = []models.CampaignVariant{}
+	}
+	if c.ABTestPercent > 0 && len(c.Variants) < 2 {
+		return errors.New(a.i18n.T("campaigns.fieldInvalidVariants"))
+	}
+
+	names := make(map[string]struct{}, len(c.Variants))
+	for i, v := range c.Variants {
+		v.Name = strings.TrimSpace(v.Name)
+		if !strHasLen(v.Name, 1, stdInputMaxLen) || !strHasLen(v.Subject, 1, 5000) || strings.TrimSpace(v.Body) == "" {
+			return errors.New(a.i18n.T("campaigns.fieldInvalidVariants"))
+		}
+		if _, ok := names[v.Name]; ok {
+			return errors.New(a.i18n.T("campaigns.fieldInvalidVariants"))
+		}
+		names[v.Name] = struct{}{}
+
+		// Compile the variant's subject and body with the campaign's settings.
+		camp := c.Campaign
+		camp.Subject = v.Subject
+		camp.Body = v.Body
+		camp.AltBody = v.AltBody
+		if err := camp.CompileTemplate(a.manager.TemplateFuncs(&camp)); err != nil {
+			return errors.New(a.i18n.Ts("campaigns.fieldInvalidBody", "error", v.Name+": "+err.Error()))
+		}
+
+		c.Variants[i] = v
+	}
+
+	return nil
+}
+
 // makeOptinCampaignMessage makes a default opt-in campaign message body.
 func (a *App) makeOptinCampaignMessage(o campReq) (campReq, error) {
 	if len(o.ListIDs) == 0 {
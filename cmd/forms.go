@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetSubscriptionForms handles the retrieval of named subscription forms.
+func (a *App) GetSubscriptionForms(c echo.Context) error {
+	pg := a.pg.NewFromURL(c.Request().URL.Query())
+
+	res, total, err := a.core.GetSubscriptionForms(pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.SubscriptionForm{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetSubscriptionForm handles the retrieval of a named subscription form.
+func (a *App) GetSubscriptionForm(c echo.Context) error {
+	out, err := a.core.GetSubscriptionForm(getID(c), "")
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateSubscriptionForm handles named subscription form creation.
+func (a *App) CreateSubscriptionForm(c echo.Context) error {
+	var o models.SubscriptionForm
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateSubscriptionForm(o)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.CreateSubscriptionForm(o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateSubscriptionForm handles named subscription form modification.
+func (a *App) UpdateSubscriptionForm(c echo.Context) error {
+	var o models.SubscriptionForm
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateSubscriptionForm(o)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.UpdateSubscriptionForm(getID(c), o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteSubscriptionForm handles named subscription form deletion.
+func (a *App) DeleteSubscriptionForm(c echo.Context) error {
+	if err := a.core.DeleteSubscriptionForm(getID(c)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateSubscriptionForm validates named subscription form fields.
+func (a *App) validateSubscriptionForm(o models.SubscriptionForm) (models.SubscriptionForm, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.fieldInvalidName"))
+	}
+
+	if len(o.Description) > stdInputMaxLen {
+		return o, echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("globals.messages.invalidFields", "name", "description"))
+	}
+
+	// The form's lists should exist.
+	if o.ListIDs == nil {
+		o.ListIDs = pq.Int64Array{}
+	}
+	if len(o.ListIDs) == 0 {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("forms.fieldInvalidLists"))
+	}
+	lists, err := a.core.GetLists("", false, formListIDs(&o))
+	if err != nil {
+		return o, err
+	}
+	if len(lists) != len(o.ListIDs) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("forms.fieldInvalidLists"))
+	}
+
+	// Redirect URLs, if set, should be absolute http(s) URLs.
+	o.SuccessURL = strings.TrimSpace(o.SuccessURL)
+	if o.SuccessURL != "" && !isHTTPURL(o.SuccessURL) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "success_url"))
+	}
+
+	o.FailureURL = strings.TrimSpace(o.FailureURL)
+	if o.FailureURL != "" && !isHTTPURL(o.FailureURL) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "failure_url"))
+	}
+
+	// The opt-in template should be a tx template.
+	if o.OptinTemplateID.Valid {
+		tpl, err := a.core.GetTemplate(o.OptinTemplateID.Int, true)
+		if err != nil {
+			return o, err
+		}
+
+		if tpl.Type != models.TemplateTypeTx {
+			return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("forms.fieldInvalidOptinTemplate"))
+		}
+	}
+
+	return o, nil
+}
+
+// isHTTPURL checks if the given string is an absolute http(s) URL.
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
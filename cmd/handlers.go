@@ -95,7 +95,7 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 
 					return next(c)
 				}
-			})
+			}, a.auditLog)
 		)
 
 		// API endpoints.
@@ -112,8 +112,17 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.GET("/api/logs", pm(a.GetLogs, "settings:get"))
 		g.GET("/api/events", pm(a.EventStream, "settings:get"))
 		g.GET("/api/about", a.GetAboutInfo)
+		g.GET("/metrics", pm(a.GetMetrics, "settings:metrics"))
+		g.GET("/api/audit", pm(a.GetAuditLog, "audit:get"))
+		g.GET("/api/abuse/events", pm(a.GetAbuseEvents, "settings:get"))
+		g.GET("/api/abuse/blocks", pm(a.GetRateLimitBlocks, "settings:get"))
+		g.DELETE("/api/abuse/blocks/:id", pm(hasID(a.DeleteRateLimitBlock), "settings:manage"))
 
 		g.GET("/api/subscribers", pm(a.QuerySubscribers, "subscribers:get_all", "subscribers:get"))
+		g.GET("/api/subscribers/attribs", pm(a.GetSubscriberAttribs, "subscribers:get_all", "subscribers:get"))
+		g.POST("/api/subscribers/attribs", pm(a.CreateSubscriberAttrib, "subscribers:manage"))
+		g.PUT("/api/subscribers/attribs/:id", pm(hasID(a.UpdateSubscriberAttrib), "subscribers:manage"))
+		g.DELETE("/api/subscribers/attribs/:id", pm(hasID(a.DeleteSubscriberAttrib), "subscribers:manage"))
 		g.GET("/api/subscribers/:id", pm(hasID(a.GetSubscriber), "subscribers:get_all", "subscribers:get"))
 		g.GET("/api/subscribers/:id/activity", pm(hasID(a.GetSubscriberActivity), "subscribers:get_all", "subscribers:get"))
 		g.GET("/api/subscribers/:id/export", pm(hasID(a.ExportSubscriberData), "subscribers:get_all", "subscribers:get"))
@@ -143,10 +152,12 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.GET("/api/subscribers/export",
 			pm(middleware.GzipWithConfig(middleware.GzipConfig{Level: 9})(a.ExportSubscribers), "subscribers:get_all", "subscribers:get"))
 
-		g.GET("/api/import/subscribers", pm(a.GetImportSubscribers, "subscribers:import"))
-		g.GET("/api/import/subscribers/logs", pm(a.GetImportSubscriberStats, "subscribers:import"))
+		g.GET("/api/import/subscribers", pm(a.GetImportJobs, "subscribers:import"))
+		g.GET("/api/import/subscribers/:id", pm(hasID(a.GetImportJob), "subscribers:import"))
+		g.GET("/api/import/subscribers/:id/logs", pm(hasID(a.GetImportJobLogs), "subscribers:import"))
+		g.GET("/api/import/subscribers/:id/rejected", pm(hasID(a.GetImportRejected), "subscribers:import"))
 		g.POST("/api/import/subscribers", pm(a.ImportSubscribers, "subscribers:import"))
-		g.DELETE("/api/import/subscribers", pm(a.StopImportSubscribers, "subscribers:import"))
+		g.DELETE("/api/import/subscribers/:id", pm(hasID(a.StopImportJob), "subscribers:import"))
 
 		// Individual list permissions are applied directly within handleGetLists.
 		g.GET("/api/lists", a.GetLists)
@@ -159,6 +170,8 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.GET("/api/campaigns/running/stats", pm(a.GetRunningCampaignStats, "campaigns:get_all", "campaigns:get"))
 		g.GET("/api/campaigns/:id", pm(hasID(a.GetCampaign), "campaigns:get_all", "campaigns:get"))
 		g.GET("/api/campaigns/analytics/:type", pm(a.GetCampaignViewAnalytics, "campaigns:get_analytics"))
+		g.GET("/api/campaigns/:id/deliveries", pm(hasID(a.GetCampaignDeliveries), "campaigns:get_all", "campaigns:get"))
+		g.GET("/api/campaigns/:id/variants", pm(hasID(a.GetCampaignVariants), "campaigns:get_all", "campaigns:get"))
 		g.GET("/api/campaigns/:id/preview", pm(hasID(a.PreviewCampaign), "campaigns:get_all", "campaigns:get"))
 		g.POST("/api/campaigns/:id/preview/archive", pm(hasID(a.PreviewCampaignArchive), "campaigns:get_all", "campaigns:get"))
 		g.POST("/api/campaigns/:id/preview", pm(hasID(a.PreviewCampaign), "campaigns:get_all", "campaigns:get"))
@@ -171,6 +184,39 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.PUT("/api/campaigns/:id/archive", pm(hasID(a.UpdateCampaignArchive), "campaigns:manage_all", "campaigns:manage"))
 		g.DELETE("/api/campaigns/:id", pm(hasID(a.DeleteCampaign), "campaigns:manage_all", "campaigns:manage"))
 
+		g.GET("/api/recurring-campaigns", pm(a.GetRecurringCampaigns, "campaigns:get_all"))
+		g.GET("/api/recurring-campaigns/:id", pm(hasID(a.GetRecurringCampaign), "campaigns:get_all"))
+		g.POST("/api/recurring-campaigns", pm(a.CreateRecurringCampaign, "campaigns:manage_all"))
+		g.PUT("/api/recurring-campaigns/:id", pm(hasID(a.UpdateRecurringCampaign), "campaigns:manage_all"))
+		g.PUT("/api/recurring-campaigns/:id/run", pm(hasID(a.RunRecurringCampaign), "campaigns:manage_all"))
+		g.DELETE("/api/recurring-campaigns/:id", pm(hasID(a.DeleteRecurringCampaign), "campaigns:manage_all"))
+
+		g.GET("/api/segments", pm(a.GetSegments, "segments:get"))
+		g.GET("/api/segments/:id", pm(hasID(a.GetSegment), "segments:get"))
+		g.POST("/api/segments", pm(a.CreateSegment, "segments:manage"))
+		g.PUT("/api/segments/:id", pm(hasID(a.UpdateSegment), "segments:manage"))
+		g.DELETE("/api/segments/:id", pm(hasID(a.DeleteSegment), "segments:manage"))
+
+		g.GET("/api/forms", pm(a.GetSubscriptionForms, "forms:get"))
+		g.GET("/api/forms/:id", pm(hasID(a.GetSubscriptionForm), "forms:get"))
+		g.POST("/api/forms", pm(a.CreateSubscriptionForm, "forms:manage"))
+		g.PUT("/api/forms/:id", pm(hasID(a.UpdateSubscriptionForm), "forms:manage"))
+		g.DELETE("/api/forms/:id", pm(hasID(a.DeleteSubscriptionForm), "forms:manage"))
+
+		g.GET("/api/sequences", pm(a.GetSequences, "sequences:get"))
+		g.GET("/api/sequences/:id", pm(hasID(a.GetSequence), "sequences:get"))
+		g.POST("/api/sequences", pm(a.CreateSequence, "sequences:manage"))
+		g.PUT("/api/sequences/:id", pm(hasID(a.UpdateSequence), "sequences:manage"))
+		g.DELETE("/api/sequences/:id", pm(hasID(a.DeleteSequence), "sequences:manage"))
+
+		g.GET("/api/webhooks", pm(a.GetWebhooks, "webhooks:get"))
+		g.GET("/api/webhooks/events", pm(a.GetWebhookEvents, "webhooks:get"))
+		g.GET("/api/webhooks/:id", pm(hasID(a.GetWebhook), "webhooks:get"))
+		g.GET("/api/webhooks/:id/deliveries", pm(hasID(a.GetWebhookDeliveries), "webhooks:get"))
+		g.POST("/api/webhooks", pm(a.CreateWebhook, "webhooks:manage"))
+		g.PUT("/api/webhooks/:id", pm(hasID(a.UpdateWebhook), "webhooks:manage"))
+		g.DELETE("/api/webhooks/:id", pm(hasID(a.DeleteWebhook), "webhooks:manage"))
+
 		g.GET("/api/media", pm(a.GetAllMedia, "media:get"))
 		g.GET("/api/media/:id", pm(hasID(a.GetMedia), "media:get"))
 		g.POST("/api/media", pm(a.UploadMedia, "media:manage"))
@@ -184,21 +230,38 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.PUT("/api/templates/:id", pm(hasID(a.UpdateTemplate), "templates:manage"))
 		g.PUT("/api/templates/:id/default", pm(hasID(a.TemplateSetDefault), "templates:manage"))
 		g.DELETE("/api/templates/:id", pm(hasID(a.DeleteTemplate), "templates:manage"))
+		g.GET("/api/templates/:id/versions", pm(hasID(a.GetTemplateVersions), "templates:get"))
+		g.GET("/api/templates/:id/versions/:version", pm(hasID(a.GetTemplateVersion), "templates:get"))
+		g.GET("/api/templates/:id/versions/:version/diff", pm(hasID(a.DiffTemplateVersions), "templates:get"))
+		g.PUT("/api/templates/:id/versions/:version/rollback", pm(hasID(a.RollbackTemplate), "templates:manage"))
 
 		g.DELETE("/api/maintenance/subscribers/:type", pm(a.GCSubscribers, "settings:maintain"))
 		g.DELETE("/api/maintenance/analytics/:type", pm(a.GCCampaignAnalytics, "settings:maintain"))
 		g.DELETE("/api/maintenance/subscriptions/unconfirmed", pm(a.GCSubscriptions, "settings:maintain"))
+		g.DELETE("/api/maintenance/logs/:type", pm(a.GCLogs, "settings:maintain"))
 
 		g.POST("/api/tx", pm(a.SendTxMessage, "tx:send"))
+		g.GET("/api/tx/:id", pm(a.GetTxMessage, "tx:send"))
+		g.POST("/api/tx/batch", pm(a.SendTxBatch, "tx:send"))
+		g.GET("/api/tx/batch/:id", pm(a.GetTxBatch, "tx:send"))
+		g.GET("/api/tx/batch/:id/messages", pm(a.GetTxBatchMessages, "tx:send"))
 
 		g.GET("/api/profile", a.GetUserProfile)
 		g.PUT("/api/profile", a.UpdateUserProfile)
+		g.POST("/api/profile/2fa", a.SetupUserTOTP)
+		g.PUT("/api/profile/2fa", a.EnableUserTOTP)
+		g.DELETE("/api/profile/2fa", a.DisableUserTOTP)
+		g.PUT("/api/profile/2fa/recovery-codes", a.RegenerateUserRecoveryCodes)
 		g.GET("/api/users", pm(a.GetUsers, "users:get"))
 		g.GET("/api/users/:id", pm(hasID(a.GetUser), "users:get"))
 		g.POST("/api/users", pm(a.CreateUser, "users:manage"))
 		g.PUT("/api/users/:id", pm(hasID(a.UpdateUser), "users:manage"))
 		g.DELETE("/api/users", pm(a.DeleteUsers, "users:manage"))
 		g.DELETE("/api/users/:id", pm(hasID(a.DeleteUser), "users:manage"))
+		g.DELETE("/api/users/:id/2fa", pm(hasID(a.ResetUserTOTP), "users:manage"))
+		g.GET("/api/users/:id/tokens", pm(hasID(a.GetAPITokens), "users:get"))
+		g.POST("/api/users/:id/tokens", pm(hasID(a.CreateAPIToken), "users:manage"))
+		g.DELETE("/api/users/:id/tokens/:tokenID", pm(hasID(a.DeleteAPIToken), "users:manage"))
 		g.POST("/api/logout", a.Logout)
 
 		g.GET("/api/roles/users", pm(a.GetUserRoles, "roles:get"))
@@ -242,7 +305,7 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 
 		// Public APIs.
 		g.GET("/api/public/lists", a.GetPublicLists)
-		g.POST("/api/public/subscription", a.PublicSubscription)
+		g.POST("/api/public/subscription", a.limitPublic(a.PublicSubscription))
 		g.GET("/api/public/captcha/altcha", a.AltchaChallenge)
 		if a.cfg.EnablePublicArchive {
 			g.GET("/api/public/archive", a.GetCampaignArchives)
@@ -251,11 +314,14 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		// /public/static/* file server is registered in initHTTPServer().
 		// Public subscriber facing views.
 		g.GET("/subscription/form", a.SubscriptionFormPage)
-		g.POST("/subscription/form", a.SubscriptionForm)
+		g.POST("/subscription/form", a.limitPublic(a.SubscriptionForm))
+		g.GET("/subscription/form/:formUUID", a.hasUUID(a.SubscriptionFormPage, "formUUID"))
+		g.POST("/subscription/form/:formUUID", a.limitPublic(a.hasUUID(a.SubscriptionForm, "formUUID")))
+		g.GET("/subscription/form/:formUUID/embed", a.hasUUID(a.SubscriptionFormEmbed, "formUUID"))
 		g.GET("/subscription/:campUUID/:subUUID", noIndex(a.hasUUID(a.hasSub(a.SubscriptionPage), "campUUID", "subUUID")))
 		g.POST("/subscription/:campUUID/:subUUID", a.hasUUID(a.hasSub(a.SubscriptionPrefs), "campUUID", "subUUID"))
-		g.GET("/subscription/optin/:subUUID", noIndex(a.hasUUID(a.hasSub(a.OptinPage), "subUUID")))
-		g.POST("/subscription/optin/:subUUID", a.hasUUID(a.hasSub(a.OptinPage), "subUUID"))
+		g.GET("/subscription/optin/:subUUID", noIndex(a.limitPublic(a.hasUUID(a.hasSub(a.OptinPage), "subUUID"))))
+		g.POST("/subscription/optin/:subUUID", a.limitPublic(a.hasUUID(a.hasSub(a.OptinPage), "subUUID")))
 		g.POST("/subscription/export/:subUUID", a.hasUUID(a.hasSub(a.SelfExportSubscriberData), "subUUID"))
 		g.POST("/subscription/wipe/:subUUID", a.hasUUID(a.hasSub(a.WipeSubscriberData), "subUUID"))
 		g.GET("/link/:linkUUID/:campUUID/:subUUID", noIndex(a.hasUUID(a.LinkRedirect, "linkUUID", "campUUID", "subUUID")))
@@ -2,24 +2,17 @@ package main
 
 import (
 	"encoding/json"
-	"io"
+	"fmt"
 	"net/http"
-	"os"
-	"strings"
 
 	"github.com/knadh/listmonk/internal/subimporter"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 )
 
-// ImportSubscribers handles the uploading and bulk importing of
-// a ZIP file of one or more CSV files.
+// ImportSubscribers handles the uploading of a CSV, JSONL, or XLSX file, or a
+// ZIP file of one of them, and queues it as an import job.
 func (a *App) ImportSubscribers(c echo.Context) error {
-	// Is an import already running?
-	if a.importer.GetStats().Status == subimporter.StatusImporting {
-		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("import.alreadyRunning"))
-	}
-
 	// Unmarshal the JSON params.
 	var opt subimporter.SessionOpt
 	if err := json.Unmarshal([]byte(c.FormValue("params")), &opt); err != nil {
@@ -48,10 +41,29 @@ func (a *App) ImportSubscribers(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("import.invalidSubStatus"))
 	}
 
+	// The delimiter is only relevant to CSV files.
+	if opt.Delim == "" {
+		opt.Delim = ","
+	}
 	if len(opt.Delim) != 1 {
 		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("import.invalidDelim"))
 	}
 
+	if err := subimporter.ValidateMapping(opt.Mapping); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("import.invalidMapping", "error", err.Error()))
+	}
+
+	// Validate list IDs.
+	if len(opt.ListIDs) > 0 {
+		lists, err := a.core.GetLists("", false, opt.ListIDs)
+		if err != nil {
+			return err
+		}
+		if len(lists) != len(opt.ListIDs) {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("import.invalidLists"))
+		}
+	}
+
 	// Open the HTTP file.
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -59,70 +71,102 @@ func (a *App) ImportSubscribers(c echo.Context) error {
 			a.i18n.Ts("import.invalidFile", "error", err.Error()))
 	}
 
+	if subimporter.GetFormat(file.Filename) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("import.invalidFile", "error", file.Filename))
+	}
+
 	src, err := file.Open()
 	if err != nil {
 		return err
 	}
 	defer src.Close()
 
-	// Copy it to a temp location.
-	out, err := os.CreateTemp("", "listmonk")
+	// Copy the file and queue the import job.
+	opt.Filename = file.Filename
+	out, err := a.importer.Enqueue(opt, src)
 	if err != nil {
+		a.log.Printf("error queueing import: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError,
-			a.i18n.Ts("import.errorCopyingFile", "error", err.Error()))
+			a.i18n.Ts("import.errorStarting", "error", err.Error()))
 	}
-	defer out.Close()
 
-	if _, err = io.Copy(out, src); err != nil {
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetImportJobs returns import jobs, newest first.
+func (a *App) GetImportJobs(c echo.Context) error {
+	pg := a.pg.NewFromURL(c.Request().URL.Query())
+
+	res, total, err := a.importer.GetJobs(pg.Offset, pg.Limit)
+	if err != nil {
+		a.log.Printf("error fetching import jobs: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError,
-			a.i18n.Ts("import.errorCopyingFile", "error", err.Error()))
+			a.i18n.Ts("globals.messages.errorFetching", "name", "{import.jobs}", "error", err.Error()))
 	}
 
-	// Start the importer session.
-	opt.Filename = file.Filename
-	sess, err := a.importer.NewSession(opt)
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetImportJob returns the status and statistics of an import job.
+func (a *App) GetImportJob(c echo.Context) error {
+	out, err := a.importer.GetJob(getID(c))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError,
-			a.i18n.Ts("import.errorStarting", "error", err.Error()))
+		return a.importJobErr(err)
 	}
-	go sess.Start()
-
-	if strings.HasSuffix(strings.ToLower(file.Filename), ".csv") {
-		go sess.LoadCSV(out.Name(), rune(opt.Delim[0]))
-	} else {
-		// Only 1 CSV from the ZIP is considered. If multiple files have
-		// to be processed, counting the net number of lines (to track progress),
-		// keeping the global import state (failed / successful) etc. across
-		// multiple files becomes complex. Instead, it's just easier for the
-		// end user to concat multiple CSVs (if there are multiple in the first)
-		// place and upload as one in the first place.
-		dir, files, err := sess.ExtractZIP(out.Name(), 1)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError,
-				a.i18n.Ts("import.errorProcessingZIP", "error", err.Error()))
-		}
 
-		go sess.LoadCSV(dir+"/"+files[0], rune(opt.Delim[0]))
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetImportJobLogs returns the logs of an import job.
+func (a *App) GetImportJobLogs(c echo.Context) error {
+	out, err := a.importer.GetLogs(getID(c))
+	if err != nil {
+		return a.importJobErr(err)
 	}
 
-	return c.JSON(http.StatusOK, okResp{a.importer.GetStats()})
+	return c.JSON(http.StatusOK, okResp{string(out)})
 }
 
-// GetImportSubscribers returns import statistics.
-func (a *App) GetImportSubscribers(c echo.Context) error {
-	s := a.importer.GetStats()
-	return c.JSON(http.StatusOK, okResp{s})
+// GetImportRejected returns the CSV report of the rows rejected in an import job.
+func (a *App) GetImportRejected(c echo.Context) error {
+	out, err := a.importer.GetRejected(getID(c))
+	if err != nil {
+		return a.importJobErr(err)
+	}
+
+	hdr := c.Response().Header()
+	hdr.Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=rejected-%d.csv", getID(c)))
+	hdr.Set("Cache-Control", "no-cache")
+
+	return c.Blob(http.StatusOK, "text/csv", out)
 }
 
-// GetImportSubscriberStats returns import statistics.
-func (a *App) GetImportSubscriberStats(c echo.Context) error {
-	return c.JSON(http.StatusOK, okResp{string(a.importer.GetLogs())})
+// StopImportJob stops a running or queued import job. If the job is
+// already done, it's deleted.
+func (a *App) StopImportJob(c echo.Context) error {
+	if err := a.importer.StopJob(getID(c)); err != nil {
+		return a.importJobErr(err)
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
 }
 
-// StopImportSubscribers sends a stop signal to the importer.
-// If there's an ongoing import, it'll be stopped, and if an import
-// is finished, it's state is cleared.
-func (a *App) StopImportSubscribers(c echo.Context) error {
-	a.importer.Stop()
-	return c.JSON(http.StatusOK, okResp{a.importer.GetStats()})
+// importJobErr returns the HTTP error for an import job error.
+func (a *App) importJobErr(err error) error {
+	if err == subimporter.ErrJobNotFound {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("globals.messages.notFound", "name", "{import.job}"))
+	}
+
+	a.log.Printf("error fetching import job: %v", err)
+	return echo.NewHTTPError(http.StatusInternalServerError,
+		a.i18n.Ts("globals.messages.errorFetching", "name", "{import.job}", "error", err.Error()))
 }
@@ -44,7 +44,9 @@ import (
 	"github.com/knadh/listmonk/internal/messenger/email"
 	"github.com/knadh/listmonk/internal/messenger/postback"
 	"github.com/knadh/listmonk/internal/notifs"
+	"github.com/knadh/listmonk/internal/ratelimit"
 	"github.com/knadh/listmonk/internal/subimporter"
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/knadh/stuffbin"
 	"github.com/labstack/echo/v4"
@@ -128,6 +130,9 @@ type Config struct {
 		PublicJS  []byte `koanf:"public.custom_js"`
 	}
 
+	// Custom fields on the public subscription form.
+	PublicFormFields []models.FormField
+
 	HasLegacyUser bool
 	AssetVersion  string
 
@@ -142,6 +147,9 @@ type Config struct {
 	BouncePostmarkEnabled     bool
 	BounceForwardemailEnabled bool
 
+	// Window within which tx messages with the same idempotency key are deduped.
+	TxIdempotencyWindow time.Duration
+
 	PermissionsRaw json.RawMessage
 	Permissions    map[string]struct{}
 }
@@ -459,11 +467,16 @@ func initConstConfig(ko *koanf.Koanf) *Config {
 	c.Privacy.DomainBlocklist = ko.Strings("privacy.domain_blocklist")
 	c.Privacy.DomainAllowlist = ko.Strings("privacy.domain_allowlist")
 
+	if err := ko.Unmarshal("app.public_form_fields", &c.PublicFormFields); err != nil {
+		lo.Fatalf("error loading app.public_form_fields config: %v", err)
+	}
+
 	c.BounceWebhooksEnabled = ko.Bool("bounce.webhooks_enabled")
 	c.BounceSESEnabled = ko.Bool("bounce.ses_enabled")
 	c.BounceSendgridEnabled = ko.Bool("bounce.sendgrid_enabled")
 	c.BouncePostmarkEnabled = ko.Bool("bounce.postmark.enabled")
 	c.BounceForwardemailEnabled = ko.Bool("bounce.forwardemail.enabled")
+	c.TxIdempotencyWindow = ko.Duration("app.tx_idempotency_window")
 	c.HasLegacyUser = ko.Exists("app.admin_username") || ko.Exists("app.admin_password")
 
 	b := md5.Sum([]byte(time.Now().String()))
@@ -511,7 +524,7 @@ func initI18n(lang string, fs stuffbin.FileSystem) *i18n.I18n {
 }
 
 // initCore initializes the CRUD DB core .
-func initCore(fnNotify func(sub models.Subscriber, listIDs []int) (int, error), queries *models.Queries, db *sqlx.DB, i *i18n.I18n, ko *koanf.Koanf) *core.Core {
+func initCore(fnNotify func(sub models.Subscriber, listIDs []int, tplID int) (int, error), fnWebhook func(string, any), queries *models.Queries, db *sqlx.DB, i *i18n.I18n, ko *koanf.Koanf) *core.Core {
 	opt := &core.Opt{
 		Constants: core.Constants{
 			SendOptinConfirmation: ko.Bool("app.send_optin_confirmation"),
@@ -529,13 +542,21 @@ func initCore(fnNotify func(sub models.Subscriber, listIDs []int) (int, error),
 	}
 
 	// Initialize the CRUD core.
-	return core.New(opt, &core.Hooks{
+	co := core.New(opt, &core.Hooks{
 		SendOptinConfirmation: fnNotify,
+		TriggerWebhook:        fnWebhook,
 	})
+
+	// Load the subscriber attribute schema.
+	if err := co.LoadAttribSchema(); err != nil {
+		lo.Fatalf("error loading subscriber attribute schema: %v", err)
+	}
+
+	return co
 }
 
 // initCampaignManager initializes the campaign manager.
-func initCampaignManager(msgrs []manager.Messenger, q *models.Queries, u *UrlConfig, co *core.Core, md media.Store, i *i18n.I18n, ko *koanf.Koanf) *manager.Manager {
+func initCampaignManager(msgrs []manager.Messenger, q *models.Queries, u *UrlConfig, co *core.Core, md media.Store, wh *webhooks.Manager, i *i18n.I18n, ko *koanf.Koanf) *manager.Manager {
 	if ko.Bool("passive") {
 		lo.Println("running in passive mode. won't process campaigns.")
 	}
@@ -558,9 +579,10 @@ func initCampaignManager(msgrs []manager.Messenger, q *models.Queries, u *UrlCon
 		SlidingWindow:         ko.Bool("app.message_sliding_window"),
 		SlidingWindowDuration: ko.Duration("app.message_sliding_window_duration"),
 		SlidingWindowRate:     ko.Int("app.message_sliding_window_rate"),
+		DeliveryLog:           ko.Bool("app.delivery_log"),
 		ScanInterval:          time.Second * 5,
 		ScanCampaigns:         !ko.Bool("passive"),
-	}, newManagerStore(q, co, md), i, lo)
+	}, newManagerStore(q, co, md, wh.Trigger, lo), i, lo)
 
 	// Attach all messengers to the campaign manager.
 	for _, m := range msgrs {
@@ -589,6 +611,13 @@ func initTxTemplates(m *manager.Manager, co *core.Core) {
 
 // initImporter initializes the bulk subscriber importer.
 func initImporter(q *models.Queries, db *sqlx.DB, core *core.Core, i *i18n.I18n, ko *koanf.Koanf) *subimporter.Importer {
+	// Directory where uploaded files are stored until they're imported. When running
+	// multiple instances, it should be on storage that's shared by all of them.
+	importDir := ko.String("app.import_dir")
+	if importDir == "" {
+		importDir = "imports"
+	}
+
 	return subimporter.New(
 		subimporter.Options{
 			DomainBlocklist:    ko.Strings("privacy.domain_blocklist"),
@@ -596,6 +625,28 @@ func initImporter(q *models.Queries, db *sqlx.DB, core *core.Core, i *i18n.I18n,
 			UpsertStmt:         q.UpsertSubscriber.Stmt,
 			BlocklistStmt:      q.UpsertBlocklistSubscriber.Stmt,
 			UpdateListDateStmt: q.UpdateListsDate.Stmt,
+			GetStatusesStmt:    q.GetSubscriberStatusesByEmails.Stmt,
+
+			Queries: subimporter.JobQueries{
+				Insert:  q.InsertImportJob.Stmt,
+				GetAll:  q.GetImportJobs.Stmt,
+				Get:     q.GetImportJob.Stmt,
+				GetLogs: q.GetImportJobLogs.Stmt,
+				Next:    q.NextImportJob.Stmt,
+				Update:  q.UpdateImportJob.Stmt,
+				Touch:   q.TouchImportJobs.Stmt,
+				Reset:   q.ResetImportJobs.Stmt,
+				Stop:    q.StopImportJob.Stmt,
+				Delete:  q.DeleteImportJob.Stmt,
+			},
+			Concurrency:  ko.Int("app.import_concurrency"),
+			ScanInterval: time.Second * 10,
+
+			// Uploaded files are retained until they're imported, including across restarts.
+			Dir: importDir,
+
+			// Validate attributes against the subscriber attribute schema.
+			ValidateAttribs: core.ValidateAttribs,
 
 			// Hook for triggering admin notifications and refreshing stats materialized
 			// views after a successful import.
@@ -607,7 +658,7 @@ func initImporter(q *models.Queries, db *sqlx.DB, core *core.Core, i *i18n.I18n,
 				notifs.NotifySystem(subject, notifs.TplImport, data, nil)
 				return nil
 			},
-		}, db.DB, i)
+		}, db.DB, i, lo)
 }
 
 // initSMTPMessenger initializes the combined and individual SMTP messengers.
@@ -815,6 +866,29 @@ func initBounceManager(cb func(models.Bounce) error, stmt *sqlx.Stmt, lo *log.Lo
 	return b
 }
 
+// initWebhooks initializes the outbound event webhook manager.
+func initWebhooks(q *models.Queries) *webhooks.Manager {
+	wh := webhooks.New(webhooks.Opt{
+		Concurrency:  4,
+		MaxAttempts:  8,
+		Backoff:      time.Minute,
+		MaxBackoff:   time.Hour * 6,
+		Timeout:      time.Second * 10,
+		ScanInterval: time.Second * 30,
+	}, &webhooks.Queries{
+		GetEvents:       q.GetWebhookEvents,
+		QueueDeliveries: q.QueueWebhookDeliveries,
+		NextDeliveries:  q.NextWebhookDeliveries,
+		UpdateDelivery:  q.UpdateWebhookDelivery,
+	}, lo)
+
+	if err := wh.Load(); err != nil {
+		lo.Fatalf("error loading webhooks: %v", err)
+	}
+
+	return wh
+}
+
 // initAbout initializes the app's /about API endpoint with the app and system info.
 func initAbout(q *models.Queries, db *sqlx.DB) about {
 	var (
@@ -858,6 +932,19 @@ func initHTTPServer(cfg *Config, urlCfg *UrlConfig, i *i18n.I18n, fs stuffbin.Fi
 	var srv = echo.New()
 	srv.HideBanner = true
 
+	// Client IPs (API token IP allowlists, rate limits, audit logs) are taken from
+	// the connection, or from X-Forwarded-For only if the request came via a trusted proxy.
+	// The list is a comma separated string when set as an environment variable.
+	proxies := ko.Strings("app.trusted_proxies")
+	if len(proxies) == 0 && ko.String("app.trusted_proxies") != "" {
+		proxies = strings.Split(ko.String("app.trusted_proxies"), ",")
+	}
+	ipx, err := auth.NewIPExtractor(proxies)
+	if err != nil {
+		lo.Fatalf("error parsing app.trusted_proxies: %v", err)
+	}
+	srv.IPExtractor = ipx
+
 	// Register app (*App) to be injected into all HTTP handlers.
 	srv.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -923,6 +1010,36 @@ func initCaptcha() *captcha.Captcha {
 	return captcha.New(opt)
 }
 
+// initRateLimiter initializes the rate limiter of the public subscription endpoints.
+// It returns nil if rate limiting is disabled.
+func initRateLimiter(q *models.Queries) *ratelimit.Limiter {
+	if !ko.Bool("security.rate_limit.enabled") {
+		return nil
+	}
+
+	l := ratelimit.New(ratelimit.Opt{
+		Backend:        ko.String("security.rate_limit.backend"),
+		Window:         ko.Duration("security.rate_limit.window"),
+		IPRate:         ko.Int("security.rate_limit.ip_rate"),
+		DomainRate:     ko.Int("security.rate_limit.domain_rate"),
+		BlockThreshold: ko.Int("security.rate_limit.block_threshold"),
+		BlockDuration:  ko.Duration("security.rate_limit.block_duration"),
+	}, &ratelimit.Queries{
+		IncrCounter:   q.IncrRateLimitCounter,
+		PruneCounters: q.PruneRateLimitCounters,
+		GetBlock:      q.GetRateLimitBlock,
+		GetBlocks:     q.GetRateLimitBlocks,
+		UpsertBlock:   q.UpsertRateLimitBlock,
+		InsertEvent:   q.InsertAbuseEvent,
+	}, lo)
+
+	if err := l.Load(); err != nil {
+		lo.Printf("error loading rate limit blocks: %v", err)
+	}
+
+	return l
+}
+
 // initCron initializes the cron job for refreshing slow query cache.
 func initCron(co *core.Core) {
 	intval := ko.String("app.cache_slow_queries_interval")
@@ -1048,6 +1165,7 @@ func initAuth(co *core.Core, db *sql.DB, ko *koanf.Koanf) (bool, *auth.Auth) {
 		GetUser: func(id int) (auth.User, error) {
 			return co.GetUser(id, "", "")
 		},
+		TouchAPIToken: co.TouchAPIToken,
 	}
 
 	// Initiaize the auth module.
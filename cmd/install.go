@@ -9,7 +9,6 @@ import (
 	"github.com/gofrs/uuid/v5"
 	"github.com/jmoiron/sqlx"
 	"github.com/knadh/listmonk/internal/auth"
-	"github.com/knadh/listmonk/internal/utils"
 	"github.com/knadh/listmonk/models"
 	"github.com/knadh/stuffbin"
 	"github.com/lib/pq"
@@ -193,7 +192,7 @@ func installTemplates(q *models.Queries) (int, int) {
 	}
 
 	var campTplID int
-	if err := q.CreateTemplate.Get(&campTplID, "Default campaign template", models.TemplateTypeCampaign, "", campTpl.ReadBytes(), nil); err != nil {
+	if err := q.CreateTemplate.Get(&campTplID, "Default campaign template", models.TemplateTypeCampaign, "", campTpl.ReadBytes(), nil, 0, ""); err != nil {
 		lo.Fatalf("error creating default campaign template: %v", err)
 	}
 	if _, err := q.SetDefaultTemplate.Exec(campTplID); err != nil {
@@ -207,7 +206,7 @@ func installTemplates(q *models.Queries) (int, int) {
 	}
 
 	var archiveTplID int
-	if err := q.CreateTemplate.Get(&archiveTplID, "Default archive template", models.TemplateTypeCampaign, "", archiveTpl.ReadBytes(), nil); err != nil {
+	if err := q.CreateTemplate.Get(&archiveTplID, "Default archive template", models.TemplateTypeCampaign, "", archiveTpl.ReadBytes(), nil, 0, ""); err != nil {
 		lo.Fatalf("error creating default campaign template: %v", err)
 	}
 
@@ -217,7 +216,7 @@ func installTemplates(q *models.Queries) (int, int) {
 		lo.Fatalf("error reading default e-mail template: %v", err)
 	}
 
-	if _, err := q.CreateTemplate.Exec("Sample transactional template", models.TemplateTypeTx, "Welcome {{ .Subscriber.Name }}", txTpl.ReadBytes(), nil); err != nil {
+	if _, err := q.CreateTemplate.Exec("Sample transactional template", models.TemplateTypeTx, "Welcome {{ .Subscriber.Name }}", txTpl.ReadBytes(), nil, 0, ""); err != nil {
 		lo.Fatalf("error creating sample transactional template: %v", err)
 	}
 
@@ -231,7 +230,7 @@ func installTemplates(q *models.Queries) (int, int) {
 		lo.Fatalf("error reading default visual template json: %v", err)
 	}
 
-	if _, err := q.CreateTemplate.Exec("Sample visual template", models.TemplateTypeCampaignVisual, "", visualTpl.ReadBytes(), visualSrc.ReadBytes()); err != nil {
+	if _, err := q.CreateTemplate.Exec("Sample visual template", models.TemplateTypeCampaignVisual, "", visualTpl.ReadBytes(), visualSrc.ReadBytes(), 0, ""); err != nil {
 		lo.Fatalf("error creating default campaign template: %v", err)
 	}
 
@@ -320,7 +319,7 @@ func installUser(username, password, apiUsername string, q *models.Queries) {
 
 	// Create the Super Admin role in the DB.
 	var role auth.Role
-	if err := q.CreateRole.Get(&role, "Super Admin", auth.RoleTypeUser, pq.Array(perms)); err != nil {
+	if err := q.CreateRole.Get(&role, "Super Admin", auth.RoleTypeUser, pq.Array(perms), false); err != nil {
 		lo.Fatalf("error creating super admin role: %v", err)
 	}
 
@@ -332,20 +331,23 @@ func installUser(username, password, apiUsername string, q *models.Queries) {
 	// Create the admin API user.
 	if apiUsername != "" {
 		// Generate a random API token.
-		tk, err := utils.GenerateRandomString(32)
+		tk, hash, prefix, err := auth.NewAPIToken()
 		if err != nil {
 			lo.Fatalf("error generating API token: %v", err)
 		}
 
 		var (
-			email    = null.String{String: apiUsername + "@api", Valid: true}
-			password = null.String{String: tk, Valid: true}
+			id    int
+			email = null.String{String: apiUsername + "@api", Valid: true}
 		)
-
-		if _, err := q.CreateUser.Exec(apiUsername, false, password, email, apiUsername, auth.UserTypeAPI, role.ID, nil, auth.UserStatusEnabled); err != nil {
+		if err := q.CreateUser.Get(&id, apiUsername, false, nil, email, apiUsername, auth.UserTypeAPI, role.ID, nil, auth.UserStatusEnabled); err != nil {
 			lo.Fatalf("error creating superadmin API user: %v", err)
 		}
 
+		if _, err := q.CreateAPIToken.Exec(id, "default", hash, prefix, pq.StringArray{}, pq.StringArray{}, nil); err != nil {
+			lo.Fatalf("error creating API token: %v", err)
+		}
+
 		// Print the token to stdout so that it can be grepped out.
 		lo.Println("writing API token LISTMONK_ADMIN_API_TOKEN to stderr")
 		fmt.Fprintf(os.Stderr, "export LISTMONK_ADMIN_API_TOKEN=\"%s\"\n", tk)
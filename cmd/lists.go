@@ -132,11 +132,17 @@ func (a *App) UpdateList(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("lists.invalidName"))
 	}
 
+	cur, err := a.core.GetList(id, "")
+	if err != nil {
+		return err
+	}
+
 	// Update the list in the DB.
 	out, err := a.core.UpdateList(id, l)
 	if err != nil {
 		return err
 	}
+	setAuditDiff(c, cur, out)
 
 	return c.JSON(http.StatusOK, okResp{out})
 }
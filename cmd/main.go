@@ -25,7 +25,10 @@ import (
 	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/internal/media"
 	"github.com/knadh/listmonk/internal/messenger/email"
+	"github.com/knadh/listmonk/internal/metrics"
+	"github.com/knadh/listmonk/internal/ratelimit"
 	"github.com/knadh/listmonk/internal/subimporter"
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/knadh/paginator"
 	"github.com/knadh/stuffbin"
@@ -47,18 +50,26 @@ type App struct {
 	media      media.Store
 	bounce     *bounce.Manager
 	captcha    *captcha.Captcha
+	limiter    *ratelimit.Limiter
 	i18n       *i18n.I18n
 	pg         *paginator.Paginator
 	events     *events.Events
+	webhooks   *webhooks.Manager
+	metrics    *metrics.Set
 	log        *log.Logger
 	bufLog     *buflog.BufLog
 
 	about         about
-	fnOptinNotify func(models.Subscriber, []int) (int, error)
+	fnOptinNotify func(models.Subscriber, []int, int) (int, error)
 
 	// Channel for passing reload signals.
 	chReload chan os.Signal
 
+	// Running tx batches, and the channel that's closed to stop them on shutdown.
+	txBatches sync.WaitGroup
+	txMut     sync.Mutex
+	chTxClose chan struct{}
+
 	// Global variable that stores the state indicating that a restart is required
 	// after a settings update.
 	needsRestart bool
@@ -183,14 +194,17 @@ func main() {
 
 		fbOptinNotify = makeOptinNotifyHook(ko.Bool("privacy.unsubscribe_header"), urlCfg, queries, i18n)
 
+		// Outbound event webhooks.
+		wh = initWebhooks(queries)
+
 		// Crud core.
-		core = initCore(fbOptinNotify, queries, db, i18n, ko)
+		core = initCore(fbOptinNotify, wh.Trigger, queries, db, i18n, ko)
 
 		// Initialize all messengers, SMTP and postback.
 		msgrs = append(initSMTPMessengers(), initPostbackMessengers(ko)...)
 
 		// Campaign manager.
-		mgr = initCampaignManager(msgrs, queries, urlCfg, core, media, i18n, ko)
+		mgr = initCampaignManager(msgrs, queries, urlCfg, core, media, wh, i18n, ko)
 
 		// Bulk importer.
 		importer = initImporter(queries, db, core, i18n, ko)
@@ -198,6 +212,9 @@ func main() {
 		// Initialize the auth manager.
 		hasUsers, auth = initAuth(core, db.DB, ko)
 
+		// Prometheus metrics.
+		mt = initMetrics(mgr, importer, msgrs)
+
 		// Initialize the webhook/POP3 bounce processor.
 		bounce *bounce.Manager
 
@@ -209,7 +226,7 @@ func main() {
 	// Initialize the bounce manager that processes bounces from webhooks and
 	// POP3 mailbox scanning.
 	if ko.Bool("bounce.enabled") {
-		bounce = initBounceManager(core.RecordBounce, queries.RecordBounce, lo, ko)
+		bounce = initBounceManager(countBounces(core.RecordBounce, mt), queries.RecordBounce, lo, ko)
 	}
 
 	// Assign the default `email` messenger to the app.
@@ -240,6 +257,12 @@ func main() {
 	// messages) get processed at the specified interval.
 	go mgr.Run()
 
+	// Start the webhook delivery worker and the import job workers.
+	if !ko.Bool("passive") {
+		go wh.Run()
+		go importer.Run()
+	}
+
 	// =========================================================================
 	// Initialize the App{} with all the global shared components, controllers and fields.
 	app := &App{
@@ -257,9 +280,12 @@ func main() {
 		media:      media,
 		bounce:     bounce,
 		captcha:    initCaptcha(),
+		limiter:    initRateLimiter(queries),
 		i18n:       i18n,
 		log:        lo,
 		events:     evStream,
+		webhooks:   wh,
+		metrics:    mt,
 		bufLog:     bufLog,
 
 		pg: paginator.New(paginator.Opt{
@@ -274,11 +300,17 @@ func main() {
 		fnOptinNotify: fbOptinNotify,
 		about:         initAbout(queries, db),
 		chReload:      chReload,
+		chTxClose:     make(chan struct{}),
 
 		// If there are no users, then the app needs to prompt for new user setup.
 		needsUserSetup: !hasUsers,
 	}
 
+	// Start the worker that resumes interrupted tx batches.
+	if !ko.Bool("passive") {
+		go app.resumeTxBatches()
+	}
+
 	// Star the update checker.
 	if ko.Bool("app.check_updates") {
 		go app.checkUpdates(versionString, time.Hour*24)
@@ -300,9 +332,18 @@ func main() {
 		defer cancel()
 		srv.Shutdown(ctx)
 
+		// Stop the running tx batches and wait for them.
+		app.closeTxBatches()
+
 		// Close the campaign manager.
 		mgr.Close()
 
+		// Stop the webhook delivery worker.
+		wh.Close()
+
+		// Stop the import job workers.
+		importer.Close()
+
 		// Close the DB pool.
 		db.Close()
 
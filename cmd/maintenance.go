@@ -66,11 +66,16 @@ func (a *App) GCCampaignAnalytics(c echo.Context) error {
 		if err := a.core.DeleteCampaignViews(t); err != nil {
 			return err
 		}
-		err = a.core.DeleteCampaignLinkClicks(t)
+		if err := a.core.DeleteCampaignLinkClicks(t); err != nil {
+			return err
+		}
+		err = a.core.DeleteCampaignDeliveries(t)
 	case "views":
 		err = a.core.DeleteCampaignViews(t)
 	case "clicks":
 		err = a.core.DeleteCampaignLinkClicks(t)
+	case "deliveries":
+		err = a.core.DeleteCampaignDeliveries(t)
 	default:
 		err = echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidData"))
 	}
@@ -81,3 +86,29 @@ func (a *App) GCCampaignAnalytics(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, okResp{true})
 }
+
+// GCLogs garbage collects (deletes) processed log entries older than a given date.
+func (a *App) GCLogs(c echo.Context) error {
+	t, err := time.Parse(time.RFC3339, c.FormValue("before_date"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidData"))
+	}
+
+	var n int
+	switch c.Param("type") {
+	case "webhooks":
+		n, err = a.core.DeleteWebhookDeliveries(t)
+	case "tx":
+		n, err = a.core.DeleteTxLogs(t)
+	default:
+		err = echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidData"))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Count int `json:"count"`
+	}{n}})
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"database/sql"
+	"log"
+	"time"
+
 	"github.com/gofrs/uuid/v5"
 	"github.com/knadh/listmonk/internal/core"
 	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/internal/media"
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/lib/pq"
+	"gopkg.in/volatiletech/null.v6"
 )
 
 // store implements DataSource over the primary
@@ -15,6 +21,10 @@ type store struct {
 	queries *models.Queries
 	core    *core.Core
 	media   media.Store
+	log     *log.Logger
+
+	// Fires outbound webhook events.
+	fnWebhook func(event string, data any)
 }
 
 type runningCamp struct {
@@ -23,13 +33,20 @@ type runningCamp struct {
 	LastSubscriberID int    `db:"last_subscriber_id"`
 	MaxSubscriberID  int    `db:"max_subscriber_id"`
 	ListID           int    `db:"list_id"`
+
+	// Optional segment that filters the campaign's subscribers.
+	SegmentID      null.Int      `db:"segment_id"`
+	SegmentListIDs pq.Int64Array `db:"segment_list_ids"`
+	SegmentQuery   string        `db:"segment_query"`
 }
 
-func newManagerStore(q *models.Queries, c *core.Core, m media.Store) *store {
+func newManagerStore(q *models.Queries, c *core.Core, m media.Store, fnWebhook func(string, any), lo *log.Logger) *store {
 	return &store{
-		queries: q,
-		core:    c,
-		media:   m,
+		queries:   q,
+		core:      c,
+		media:     m,
+		log:       lo,
+		fnWebhook: fnWebhook,
 	}
 }
 
@@ -38,8 +55,46 @@ func newManagerStore(q *models.Queries, c *core.Core, m media.Store) *store {
 // of campaigns that are being processed and updates them in the DB.
 func (s *store) NextCampaigns(currentIDs []int64, sentCounts []int64) ([]*models.Campaign, error) {
 	var out []*models.Campaign
-	err := s.queries.NextCampaigns.Select(&out, pq.Int64Array(currentIDs), pq.Int64Array(sentCounts))
-	return out, err
+	if err := s.queries.NextCampaigns.Select(&out, pq.Int64Array(currentIDs), pq.Int64Array(sentCounts)); err != nil {
+		return nil, err
+	}
+
+	// The to_send counts of campaigns that target segments are narrowed
+	// down by the segments' filters. If a segment fails, eg: its query no longer
+	// runs, only its campaign is paused and the rest are processed.
+	camps := make([]*models.Campaign, 0, len(out))
+	for _, c := range out {
+		if c.SegmentID.Valid {
+			if err := s.updateSegmentCounts(c); err != nil {
+				s.log.Printf("error counting segment %d of campaign (%s). Pausing campaign: %v", c.SegmentID.Int, c.Name, err)
+				if err := s.UpdateCampaignStatus(c.ID, models.CampaignStatusPaused); err != nil {
+					s.log.Printf("error pausing campaign (%s): %v", c.Name, err)
+				}
+				continue
+			}
+		}
+
+		camps = append(camps, c)
+	}
+
+	return camps, nil
+}
+
+// updateSegmentCounts narrows down the to_send count of a campaign that
+// targets a segment by the segment's filter.
+func (s *store) updateSegmentCounts(c *models.Campaign) error {
+	seg, err := s.core.GetSegment(c.SegmentID.Int)
+	if err != nil {
+		return err
+	}
+
+	n, err := s.core.UpdateCampaignSegmentCounts(c.ID, seg)
+	if err != nil {
+		return err
+	}
+	c.ToSend = n
+
+	return nil
 }
 
 // NextSubscribers retrieves a subset of subscribers of a given campaign.
@@ -61,6 +116,12 @@ func (s *store) NextSubscribers(campID, limit int) ([]models.Subscriber, error)
 		return nil, nil
 	}
 
+	// The campaign targets a segment. Apply its filter.
+	if c := camps[0]; c.SegmentID.Valid {
+		seg := models.Segment{ListIDs: c.SegmentListIDs, Query: c.SegmentQuery}
+		return s.core.NextCampaignSegmentSubscribers(c.CampaignID, c.CampaignType, c.LastSubscriberID, c.MaxSubscriberID, listIDs, seg, limit)
+	}
+
 	var out []models.Subscriber
 	err := s.queries.NextCampaignSubscribers.Select(&out, camps[0].CampaignID, camps[0].CampaignType, camps[0].LastSubscriberID, camps[0].MaxSubscriberID, pq.Array(listIDs), limit)
 	return out, err
@@ -75,8 +136,24 @@ func (s *store) GetCampaign(campID int) (*models.Campaign, error) {
 
 // UpdateCampaignStatus updates a campaign's status.
 func (s *store) UpdateCampaignStatus(campID int, status string) error {
-	_, err := s.queries.UpdateCampaignStatus.Exec(campID, status)
-	return err
+	c, err := s.GetCampaign(campID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.queries.UpdateCampaignStatus.Exec(campID, status); err != nil {
+		return err
+	}
+
+	s.fnWebhook(webhooks.EventCampaignStatus, webhooks.CampaignStatus{
+		ID:             c.ID,
+		UUID:           c.UUID,
+		Name:           c.Name,
+		Status:         status,
+		PreviousStatus: c.Status,
+	})
+
+	return nil
 }
 
 // UpdateCampaignCounts updates a campaign's status.
@@ -145,6 +222,145 @@ func (s *store) BlocklistSubscriber(id int64) error {
 	return err
 }
 
+// RecordDeliveries records a batch of campaign message delivery log entries.
+func (s *store) RecordDeliveries(d []models.CampaignDelivery) error {
+	var (
+		campIDs  = make(pq.Int64Array, len(d))
+		subIDs   = make(pq.Int64Array, len(d))
+		msgrs    = make(pq.StringArray, len(d))
+		statuses = make(pq.StringArray, len(d))
+		errs     = make(pq.StringArray, len(d))
+		dates    = make(pq.StringArray, len(d))
+	)
+	for i, r := range d {
+		campIDs[i] = int64(r.CampaignID)
+		subIDs[i] = int64(r.SubscriberID)
+		msgrs[i] = r.Messenger
+		statuses[i] = r.Status
+		errs[i] = r.Error
+		dates[i] = r.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	_, err := s.queries.InsertCampaignDeliveries.Exec(campIDs, subIDs, msgrs, statuses, errs, dates)
+	return err
+}
+
+// UpdateTxMessageStatus updates the delivery status of a transactional message.
+func (s *store) UpdateTxMessageStatus(id int64, status, errMsg string) error {
+	_, err := s.queries.UpdateTxMessageStatus.Exec(id, status, errMsg)
+	return err
+}
+
+// GetCampaignVariants fetches the A/B test variants of a campaign.
+func (s *store) GetCampaignVariants(campID int) ([]models.CampaignVariant, error) {
+	var out []models.CampaignVariant
+	err := s.queries.GetCampaignVariants.Select(&out, campID)
+	return out, err
+}
+
+// RecordCampaignVariants records the variants sent to subscribers in a campaign's A/B test.
+func (s *store) RecordCampaignVariants(campID int, subIDs []int64, variantIDs []int64) error {
+	_, err := s.queries.RecordCampaignVariantSubscribers.Exec(campID, pq.Int64Array(subIDs), pq.Int64Array(variantIDs))
+	return err
+}
+
+// UpdateCampaignABTest updates the A/B test audience size and end time of a campaign.
+func (s *store) UpdateCampaignABTest(campID int, size int, endsAt null.Time) error {
+	_, err := s.queries.UpdateCampaignABTest.Exec(campID, size, endsAt)
+	return err
+}
+
+// PickCampaignABWinner picks the winning variant of a campaign's A/B test and returns its ID.
+func (s *store) PickCampaignABWinner(campID int) (int, error) {
+	var id int
+	err := s.queries.PickCampaignABWinner.Get(&id, campID)
+	return id, err
+}
+
+// NextCampaignLocalWindow moves a campaign that's sent at subscribers' local time
+// to its next window and returns the time at which the window opens. An invalid
+// time is returned if all timezones have been reached.
+func (s *store) NextCampaignLocalWindow(campID int) (null.Time, error) {
+	var out null.Time
+	if err := s.queries.NextCampaignLocalWindow.Get(&out, campID); err != nil && err != sql.ErrNoRows {
+		return null.Time{}, err
+	}
+
+	return out, nil
+}
+
+// NextSequenceMessages retrieves a batch of subscribers who are due for
+// the next step in automation sequences.
+func (s *store) NextSequenceMessages(limit int) ([]models.SequenceMessage, error) {
+	var out []models.SequenceMessage
+	err := s.queries.NextSequenceMessages.Select(&out, limit)
+	return out, err
+}
+
+// RevertSequenceProgress restores a subscriber's previous progress in a sequence
+// whose step couldn't be sent.
+func (s *store) RevertSequenceProgress(m models.SequenceMessage) error {
+	_, err := s.queries.RevertSequenceProgress.Exec(m.SequenceID, m.Subscriber.ID, m.Position,
+		m.PrevPosition, m.PrevDelayHours, m.PrevUpdatedAt)
+	return err
+}
+
+// GetSequenceStep fetches a sequence step in the shape of a campaign.
+func (s *store) GetSequenceStep(id int) (*models.Campaign, error) {
+	var out = &models.Campaign{}
+	err := s.queries.GetSequenceStep.Get(out, id)
+	return out, err
+}
+
+// GetDueRecurringCampaigns retrieves active recurring campaigns whose next run is due.
+func (s *store) GetDueRecurringCampaigns() ([]models.RecurringCampaign, error) {
+	var out []models.RecurringCampaign
+	err := s.queries.GetDueRecurringCampaigns.Select(&out)
+	return out, err
+}
+
+// ClaimRecurringCampaign moves a due recurring campaign to its next run. It returns
+// false if the run has already been claimed.
+func (s *store) ClaimRecurringCampaign(id int, nextRunAt, newNextRunAt null.Time) (bool, error) {
+	var out int
+	if err := s.queries.ClaimRecurringCampaign.Get(&out, id, nextRunAt, newNextRunAt); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReleaseRecurringCampaign reschedules a claimed run of a recurring campaign to
+// be retried at the given time.
+func (s *store) ReleaseRecurringCampaign(id int, nextRunAt, retryAt null.Time) error {
+	_, err := s.queries.ReleaseRecurringCampaign.Exec(id, nextRunAt, retryAt)
+	return err
+}
+
+// CreateRecurringCampaignInstance clones the campaign of a recurring campaign into a
+// new campaign that's sent right away and records the run along with the feed items
+// that have been seen.
+func (s *store) CreateRecurringCampaignInstance(id, campID int, name string, items models.FeedItems, lastItemAt null.Time, seen []string) (int, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+	if err := s.queries.CreateRecurringCampaignInstance.Get(&newID, campID, uu, name, items); err != nil {
+		return 0, err
+	}
+
+	if _, err := s.queries.UpdateRecurringCampaignRun.Exec(id, newID, lastItemAt, pq.StringArray(seen)); err != nil {
+		return newID, err
+	}
+
+	return newID, nil
+}
+
 // DeleteSubscriber deletes a subscriber from the DB.
 func (s *store) DeleteSubscriber(id int64) error {
 	_, err := s.queries.DeleteSubscribers.Exec(pq.Int64Array{id})
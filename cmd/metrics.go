@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/knadh/listmonk/internal/manager"
+	"github.com/knadh/listmonk/internal/messenger/email"
+	"github.com/knadh/listmonk/internal/metrics"
+	"github.com/knadh/listmonk/internal/subimporter"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	metricBounces = "listmonk_bounces_total"
+)
+
+// GetMetrics handles the exposition of metrics in the Prometheus text format.
+func (a *App) GetMetrics(c echo.Context) error {
+	var b bytes.Buffer
+	if err := a.metrics.WritePrometheus(&b); err != nil {
+		a.log.Printf("error writing metrics: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, a.i18n.Ts("globals.messages.internalError"))
+	}
+
+	return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", b.Bytes())
+}
+
+// initMetrics initializes the metrics set and registers collectors that read
+// the internals of the campaign manager, importer, and SMTP messengers on scrape.
+func initMetrics(mgr *manager.Manager, im *subimporter.Importer, msgrs []manager.Messenger) *metrics.Set {
+	m := metrics.New()
+
+	m.Describe("listmonk_queue_messages", metrics.TypeGauge, "Number of messages waiting in the manager's queues.")
+	m.Describe("listmonk_queue_capacity", metrics.TypeGauge, "Capacity of the manager's queues.")
+	m.Describe("listmonk_messenger_pushes_total", metrics.TypeCounter, "Number of messages pushed to messengers by status.")
+	m.Describe("listmonk_messenger_push_duration_seconds", metrics.TypeHistogram, "Latency of messenger pushes.")
+	m.Describe("listmonk_campaigns_running", metrics.TypeGauge, "Number of campaigns being processed.")
+	m.Describe("listmonk_campaign_sent_total", metrics.TypeCounter, "Number of messages sent by a running campaign since it was picked up.")
+	m.Describe("listmonk_campaign_errors_total", metrics.TypeCounter, "Number of send errors of a running campaign since it was picked up.")
+	m.Describe("listmonk_campaign_send_rate", metrics.TypeGauge, "Messages sent by a running campaign in the last minute.")
+	m.Describe("listmonk_sliding_window_waits_total", metrics.TypeCounter, "Number of times sending paused on hitting the sliding window limit.")
+	m.Describe("listmonk_sliding_window_wait_seconds_total", metrics.TypeCounter, "Total time spent waiting on the sliding window limit.")
+	m.Describe("listmonk_delivery_log_dropped_total", metrics.TypeCounter, "Number of campaign delivery log entries dropped as the queue was full.")
+	m.Describe("listmonk_import_total", metrics.TypeGauge, "Number of records in the running imports.")
+	m.Describe("listmonk_import_imported", metrics.TypeGauge, "Number of records imported in the running imports.")
+	m.Describe("listmonk_import_jobs", metrics.TypeGauge, "Number of running imports by status.")
+	m.Describe(metricBounces, metrics.TypeCounter, "Number of bounces recorded by source and type.")
+	m.Describe("listmonk_smtp_conns_max", metrics.TypeGauge, "Max number of connections of an SMTP server.")
+	m.Describe("listmonk_smtp_conns_busy", metrics.TypeGauge, "Number of connections of an SMTP server that are sending messages.")
+
+	// Campaign manager.
+	m.Collect(func(w *metrics.Writer) {
+		s := mgr.GetStats()
+
+		w.Gauge("listmonk_queue_messages", float64(s.CampMsgQueue), "queue", "campaign")
+		w.Gauge("listmonk_queue_messages", float64(s.MsgQueue), "queue", "message")
+		w.Gauge("listmonk_queue_capacity", float64(s.CampMsgQueueCap), "queue", "campaign")
+		w.Gauge("listmonk_queue_capacity", float64(s.MsgQueueCap), "queue", "message")
+
+		for _, ms := range s.Messengers {
+			w.Counter("listmonk_messenger_pushes_total", float64(ms.Success), "messenger", ms.Name, "status", "success")
+			w.Counter("listmonk_messenger_pushes_total", float64(ms.Errors), "messenger", ms.Name, "status", "error")
+			w.Histogram("listmonk_messenger_push_duration_seconds", ms.Latency, "messenger", ms.Name)
+		}
+
+		w.Gauge("listmonk_campaigns_running", float64(len(s.Campaigns)))
+		for _, c := range s.Campaigns {
+			id := strconv.Itoa(c.ID)
+			w.Counter("listmonk_campaign_sent_total", float64(c.Sent), "campaign_id", id, "campaign", c.Name)
+			w.Counter("listmonk_campaign_errors_total", float64(c.Errors), "campaign_id", id, "campaign", c.Name)
+			w.Gauge("listmonk_campaign_send_rate", float64(c.SendRate), "campaign_id", id, "campaign", c.Name)
+		}
+
+		w.Counter("listmonk_sliding_window_waits_total", float64(s.SlidingWaits))
+		w.Counter("listmonk_sliding_window_wait_seconds_total", s.SlidingWaitSeconds)
+		w.Counter("listmonk_delivery_log_dropped_total", float64(s.DeliveriesDropped))
+	})
+
+	// Importer.
+	m.Collect(func(w *metrics.Writer) {
+		var (
+			total, imported int
+			statuses        = map[string]int{subimporter.StatusImporting: 0, subimporter.StatusStopping: 0}
+		)
+		for _, s := range im.GetRunning() {
+			total += s.Total
+			imported += s.Imported
+			statuses[s.Status]++
+		}
+
+		w.Gauge("listmonk_import_total", float64(total))
+		w.Gauge("listmonk_import_imported", float64(imported))
+		for st, n := range statuses {
+			w.Gauge("listmonk_import_jobs", float64(n), "status", st)
+		}
+	})
+
+	// SMTP connection usage.
+	m.Collect(func(w *metrics.Writer) {
+		for _, msgr := range msgrs {
+			e, ok := msgr.(*email.Emailer)
+			if !ok {
+				continue
+			}
+
+			for _, s := range e.Stats() {
+				w.Gauge("listmonk_smtp_conns_max", float64(s.MaxConns), "messenger", e.Name(), "host", s.Host)
+				w.Gauge("listmonk_smtp_conns_busy", float64(s.Busy), "messenger", e.Name(), "host", s.Host)
+			}
+		}
+	})
+
+	return m
+}
+
+// countBounces wraps a bounce record callback to count the recorded bounces.
+func countBounces(cb func(models.Bounce) error, m *metrics.Set) func(models.Bounce) error {
+	return func(b models.Bounce) error {
+		if err := cb(b); err != nil {
+			return err
+		}
+
+		m.Counter(metricBounces, "source", b.Source, "type", b.Type).Inc()
+		return nil
+	}
+}
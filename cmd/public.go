@@ -9,6 +9,8 @@ import (
 	"image/png"
 	"io"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -16,6 +18,7 @@ import (
 	"github.com/knadh/listmonk/internal/i18n"
 	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/internal/notifs"
+	"github.com/knadh/listmonk/internal/ratelimit"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
@@ -89,7 +92,10 @@ type msgTpl struct {
 
 type subFormTpl struct {
 	publicTpl
+	Form    *models.SubscriptionForm
+	Action  string
 	Lists   []models.List
+	Fields  []subFormField
 	Captcha struct {
 		Enabled    bool
 		Provider   string
@@ -98,6 +104,18 @@ type subFormTpl struct {
 	}
 }
 
+// subFormField is a custom field on the public subscription form along with
+// its prefilled value.
+type subFormField struct {
+	models.FormField
+	Name  string
+	Value string
+}
+
+// formFieldPrefix is the prefix of the names of custom fields in HTML subscription forms,
+// eg: attribs.source, to not collide with the standard fields.
+const formFieldPrefix = "attribs."
+
 var (
 	pixelPNG = drawTransparentImage(3, 14)
 )
@@ -409,50 +427,113 @@ func (a *App) OptinPage(c echo.Context) error {
 }
 
 // SubscriptionFormPage handles subscription requests coming from public
-// HTML subscription forms.
+// HTML subscription forms. If a named form's UUID is in the URL, only
+// the form's lists are shown.
 func (a *App) SubscriptionFormPage(c echo.Context) error {
-	if !a.cfg.EnablePublicSubPage {
+	form, err := a.getNamedSubForm(c)
+	if err != nil {
 		return c.Render(http.StatusNotFound, tplMessage,
 			makeMsgTpl(a.i18n.T("public.errorTitle"), "", a.i18n.Ts("public.invalidFeature")))
 	}
 
-	// Get all public lists from the DB.
-	lists, err := a.core.GetLists(models.ListTypePublic, true, nil)
+	out, err := a.makeSubFormTpl(c, form)
 	if err != nil {
-		return c.Render(http.StatusInternalServerError, tplMessage,
-			makeMsgTpl(a.i18n.T("public.errorTitle"), "", a.i18n.Ts("public.errorFetchingLists")))
+		e := err.(*echo.HTTPError)
+		return c.Render(e.Code, tplMessage, makeMsgTpl(a.i18n.T("public.errorTitle"), "", fmt.Sprintf("%s", e.Message)))
+	}
+
+	return c.Render(http.StatusOK, "subscription-form", out)
+}
+
+// SubscriptionFormEmbed renders the HTML snippet of a named subscription form
+// that can be embedded in external web pages.
+func (a *App) SubscriptionFormEmbed(c echo.Context) error {
+	form, err := a.getNamedSubForm(c)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.makeSubFormTpl(c, form)
+	if err != nil {
+		return err
 	}
+	out.Action = fmt.Sprintf("%s/subscription/form/%s", a.urlCfg.RootURL, form.UUID)
+
+	return c.Render(http.StatusOK, "subscription-form-embed", out)
+}
 
-	// There are no public lists available for subscription.
+// makeSubFormTpl prepares the template data of a public subscription form.
+// If form is nil, all public lists are shown.
+func (a *App) makeSubFormTpl(c echo.Context, form *models.SubscriptionForm) (subFormTpl, error) {
+	if form == nil && !a.cfg.EnablePublicSubPage {
+		return subFormTpl{}, echo.NewHTTPError(http.StatusNotFound, a.i18n.Ts("public.invalidFeature"))
+	}
+
+	var (
+		lists []models.List
+		err   error
+	)
+	if form == nil {
+		// Get all public lists from the DB.
+		lists, err = a.core.GetLists(models.ListTypePublic, true, nil)
+	} else {
+		// Get the form's lists from the DB.
+		lists, err = a.core.GetLists("", false, formListIDs(form))
+	}
+	if err != nil {
+		return subFormTpl{}, echo.NewHTTPError(http.StatusInternalServerError, a.i18n.Ts("public.errorFetchingLists"))
+	}
+
+	// There are no lists available for subscription.
 	if len(lists) == 0 {
-		return c.Render(http.StatusInternalServerError, tplMessage,
-			makeMsgTpl(a.i18n.T("public.errorTitle"), "", a.i18n.Ts("public.noListsAvailable")))
+		return subFormTpl{}, echo.NewHTTPError(http.StatusInternalServerError, a.i18n.Ts("public.noListsAvailable"))
 	}
 
 	out := subFormTpl{}
 	out.Title = a.i18n.T("public.sub")
 	out.Lists = lists
+	if form != nil {
+		out.Title = form.Name
+		out.Form = form
+	}
 
-	// Captcha configuration for template rendering.
-	if a.cfg.Security.Captcha.Altcha.Enabled {
-		out.Captcha.Enabled = true
-		out.Captcha.Provider = "altcha"
-		out.Captcha.Complexity = a.cfg.Security.Captcha.Altcha.Complexity
-	} else if a.cfg.Security.Captcha.HCaptcha.Enabled {
-		out.Captcha.Enabled = true
-		out.Captcha.Provider = "hcaptcha"
-		out.Captcha.Key = a.cfg.Security.Captcha.HCaptcha.Key
+	// Custom fields. Hidden fields, eg: utm_source, can be prefilled from the URL.
+	out.Fields = make([]subFormField, 0, len(a.cfg.PublicFormFields))
+	for _, f := range a.cfg.PublicFormFields {
+		v := c.QueryParam(f.Key)
+		if v == "" && f.Type == models.FormFieldHidden {
+			v = f.Default
+		}
+		out.Fields = append(out.Fields, subFormField{FormField: f, Name: formFieldPrefix + f.Key, Value: v})
 	}
 
-	return c.Render(http.StatusOK, "subscription-form", out)
+	// Captcha configuration for template rendering. Named forms may not require a captcha.
+	if form == nil || form.Captcha {
+		if a.cfg.Security.Captcha.Altcha.Enabled {
+			out.Captcha.Enabled = true
+			out.Captcha.Provider = "altcha"
+			out.Captcha.Complexity = a.cfg.Security.Captcha.Altcha.Complexity
+		} else if a.cfg.Security.Captcha.HCaptcha.Enabled {
+			out.Captcha.Enabled = true
+			out.Captcha.Provider = "hcaptcha"
+			out.Captcha.Key = a.cfg.Security.Captcha.HCaptcha.Key
+		}
+	}
+
+	return out, nil
 }
 
 // SubscriptionForm handles subscription requests coming from public
-// HTML subscription forms.
+// HTML subscription forms. Named forms redirect to their success and
+// failure URLs, if they're set.
 func (a *App) SubscriptionForm(c echo.Context) error {
-	if !a.cfg.EnablePublicSubPage {
+	form, err := a.getNamedSubForm(c)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, a.i18n.T("public.invalidFeature"))
+	}
 
+	if form == nil && !a.cfg.EnablePublicSubPage {
+		return echo.NewHTTPError(http.StatusNotFound, a.i18n.T("public.invalidFeature"))
 	}
 
 	// If there's a nonce value, a bot could've filled the form.
@@ -460,8 +541,17 @@ func (a *App) SubscriptionForm(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadGateway, a.i18n.T("public.invalidFeature"))
 	}
 
+	// fail renders the error message or redirects to the form's failure URL.
+	fail := func(code int, msg string) error {
+		if form != nil && form.FailureURL != "" {
+			return c.Redirect(http.StatusSeeOther, addURLParam(form.FailureURL, "error", msg))
+		}
+		return c.Render(code, tplMessage, makeMsgTpl(a.i18n.T("public.errorTitle"), "", msg))
+	}
+
 	// Process CAPTCHA.
-	if a.captcha.IsEnabled() {
+	hasCaptcha := a.captcha.IsEnabled() && (form == nil || form.Captcha)
+	if hasCaptcha {
 		var val string
 
 		// Get the appropriate captcha response field based on provider.
@@ -471,13 +561,11 @@ func (a *App) SubscriptionForm(c echo.Context) error {
 		case captcha.ProviderAltcha:
 			val = c.FormValue("altcha")
 		default:
-			return c.Render(http.StatusBadRequest, tplMessage,
-				makeMsgTpl(a.i18n.T("public.errorTitle"), "", a.i18n.T("public.invalidCaptcha")))
+			return fail(http.StatusBadRequest, a.i18n.T("public.invalidCaptcha"))
 		}
 
 		if val == "" {
-			return c.Render(http.StatusBadRequest, tplMessage,
-				makeMsgTpl(a.i18n.T("public.errorTitle"), "", a.i18n.T("public.invalidCaptcha")))
+			return fail(http.StatusBadRequest, a.i18n.T("public.invalidCaptcha"))
 		}
 
 		err, ok := a.captcha.Verify(val)
@@ -486,19 +574,22 @@ func (a *App) SubscriptionForm(c echo.Context) error {
 		}
 
 		if !ok {
-			return c.Render(http.StatusBadRequest, tplMessage,
-				makeMsgTpl(a.i18n.T("public.errorTitle"), "", a.i18n.T("public.invalidCaptcha")))
+			return fail(http.StatusBadRequest, a.i18n.T("public.invalidCaptcha"))
 		}
 	}
 
-	hasOptin, err := a.processSubForm(c)
+	hasOptin, err := a.processSubForm(c, form, hasCaptcha)
 	if err != nil {
 		e, ok := err.(*echo.HTTPError)
 		if !ok {
 			return err
 		}
 
-		return c.Render(e.Code, tplMessage, makeMsgTpl(a.i18n.T("public.errorTitle"), "", fmt.Sprintf("%s", e.Message)))
+		return fail(e.Code, fmt.Sprintf("%s", e.Message))
+	}
+
+	if form != nil && form.SuccessURL != "" {
+		return c.Redirect(http.StatusSeeOther, form.SuccessURL)
 	}
 
 	// If there were double optin lists, show the opt-in pending message instead of
@@ -512,13 +603,10 @@ func (a *App) SubscriptionForm(c echo.Context) error {
 }
 
 // PublicSubscription handles subscription requests coming from public
-// API calls.
+// API calls. Requests with a form_uuid subscribe via the named form, unless
+// the form requires a CAPTCHA, which can't be verified over the API.
 func (a *App) PublicSubscription(c echo.Context) error {
-	if !a.cfg.EnablePublicSubPage {
-		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("public.invalidFeature"))
-	}
-
-	hasOptin, err := a.processSubForm(c)
+	hasOptin, err := a.processSubForm(c, nil, false)
 	if err != nil {
 		return err
 	}
@@ -528,6 +616,91 @@ func (a *App) PublicSubscription(c echo.Context) error {
 	}{hasOptin}})
 }
 
+// getFormFieldValues validates the values of the custom fields in a public subscription
+// request and returns them as subscriber attributes. Values are read from the
+// attribs map in JSON requests and from prefixed form fields in HTML form posts.
+// Only the fields that are in the request are returned.
+func (a *App) getFormFieldValues(c echo.Context, vals map[string]any) (models.JSON, error) {
+	isJSON := strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+
+	var params url.Values
+	if !isJSON {
+		p, err := c.FormParams()
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		params = p
+	}
+
+	out := models.JSON{}
+	for _, f := range a.cfg.PublicFormFields {
+		var (
+			val    string
+			posted bool
+		)
+		if isJSON {
+			var v any
+			v, posted = vals[f.Key]
+			switch v := v.(type) {
+			case string:
+				val = v
+			case bool:
+				val = strconv.FormatBool(v)
+			case float64:
+				val = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		} else {
+			_, posted = params[formFieldPrefix+f.Key]
+			val = params.Get(formFieldPrefix + f.Key)
+		}
+		val = strings.TrimSpace(val)
+
+		label := f.Label
+		if label == "" {
+			label = f.Key
+		}
+
+		if len(val) > stdInputMaxLen {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", label))
+		}
+
+		switch f.Type {
+		case models.FormFieldCheckbox:
+			checked := val != "" && val != "false" && val != "0" && val != "off"
+			if f.Required && !checked {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("public.fieldRequired", "name", label))
+			}
+
+			// Unchecked checkboxes aren't posted by browsers.
+			if posted {
+				out[f.Key] = checked
+			}
+			continue
+
+		case models.FormFieldSelect:
+			if val != "" && !slices.Contains(f.Options, val) {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", label))
+			}
+
+		case models.FormFieldHidden:
+			if val == "" {
+				val = f.Default
+			}
+		}
+
+		if val == "" {
+			if f.Required {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("public.fieldRequired", "name", label))
+			}
+			continue
+		}
+
+		out[f.Key] = val
+	}
+
+	return out, nil
+}
+
 // LinkRedirect redirects a link UUID to its original underlying link
 // after recording the link click for a particular subscriber in the particular
 // campaign. These links are generated by {{ TrackLink }} tags in campaigns.
@@ -686,18 +859,60 @@ func drawTransparentImage(h, w int) []byte {
 
 // processSubForm processes an incoming form/public API subscription request.
 // The bool indicates whether there was subscription to an optin list so that
-// an appropriate message can be shown.
-func (a *App) processSubForm(c echo.Context) (bool, error) {
+// an appropriate message can be shown. If form is nil and the request has
+// a form_uuid, the named form is loaded. hasCaptcha indicates whether the
+// request's CAPTCHA has been verified, which the form may require.
+func (a *App) processSubForm(c echo.Context, form *models.SubscriptionForm, hasCaptcha bool) (bool, error) {
 	// Get and validate fields.
 	var req struct {
 		Name          string   `form:"name" json:"name"`
 		Email         string   `form:"email" json:"email"`
 		FormListUUIDs []string `form:"l" json:"list_uuids"`
+		FormUUID      string   `form:"form_uuid" json:"form_uuid"`
+
+		// Values of custom form fields in JSON requests.
+		Attribs map[string]any `json:"attribs"`
 	}
 	if err := c.Bind(&req); err != nil {
 		return false, err
 	}
 
+	if form == nil && req.FormUUID != "" {
+		if !reUUID.MatchString(req.FormUUID) {
+			return false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidUUID"))
+		}
+
+		f, err := a.core.GetSubscriptionForm(0, req.FormUUID)
+		if err != nil {
+			return false, err
+		}
+
+		if f.Captcha && a.captcha.IsEnabled() && !hasCaptcha {
+			return false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("public.formCaptchaRequired"))
+		}
+		form = &f
+	}
+
+	if form == nil && !a.cfg.EnablePublicSubPage {
+		return false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("public.invalidFeature"))
+	}
+
+	// If no lists are selected on a named form, subscribe to all its lists.
+	var formLists []models.List
+	if form != nil {
+		lists, err := a.core.GetLists("", false, formListIDs(form))
+		if err != nil {
+			return false, err
+		}
+		formLists = lists
+
+		if len(req.FormListUUIDs) == 0 {
+			for _, l := range formLists {
+				req.FormListUUIDs = append(req.FormListUUIDs, l.UUID)
+			}
+		}
+	}
+
 	if len(req.FormListUUIDs) == 0 {
 		return false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("public.noListsSelected"))
 	}
@@ -713,6 +928,11 @@ func (a *App) processSubForm(c echo.Context) (bool, error) {
 	}
 	req.Email = em
 
+	// Rate limit subscriptions by the e-mail domain.
+	if err := a.checkRateLimit(c, ratelimit.ScopeDomain, em[strings.LastIndex(em, "@")+1:]); err != nil {
+		return false, err
+	}
+
 	req.Name = strings.TrimSpace(req.Name)
 	if len(req.Name) == 0 {
 		// If there's no name, use the name bit from the e-mail.
@@ -721,26 +941,44 @@ func (a *App) processSubForm(c echo.Context) (bool, error) {
 		return false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("subscribers.invalidName"))
 	}
 
-	listUUIDs := pq.StringArray(req.FormListUUIDs)
-
-	// Fetch the list types and ensure that they are not private.
-	listTypes, err := a.core.GetListTypes(nil, req.FormListUUIDs)
+	// Validate custom form fields.
+	attribs, err := a.getFormFieldValues(c, req.Attribs)
 	if err != nil {
-		return false, echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("%s", err.(*echo.HTTPError).Message))
+		return false, err
 	}
 
-	for _, t := range listTypes {
-		if t == models.ListTypePrivate {
-			return false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidUUID"))
+	listUUIDs := pq.StringArray(req.FormListUUIDs)
+
+	optinTplID := 0
+	if form != nil {
+		// Named forms may only subscribe to their own lists, which can be private.
+		for _, u := range req.FormListUUIDs {
+			if !slices.ContainsFunc(formLists, func(l models.List) bool { return l.UUID == u }) {
+				return false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidUUID"))
+			}
+		}
+		optinTplID = form.OptinTemplateID.Int
+	} else {
+		// Fetch the list types and ensure that they are not private.
+		listTypes, err := a.core.GetListTypes(nil, req.FormListUUIDs)
+		if err != nil {
+			return false, echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("%s", err.(*echo.HTTPError).Message))
+		}
+
+		for _, t := range listTypes {
+			if t == models.ListTypePrivate {
+				return false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidUUID"))
+			}
 		}
 	}
 
 	// Insert the subscriber into the DB.
 	_, hasOptin, err := a.core.InsertSubscriber(models.Subscriber{
-		Name:   req.Name,
-		Email:  req.Email,
-		Status: models.SubscriberStatusEnabled,
-	}, nil, listUUIDs, false, true)
+		Name:    req.Name,
+		Email:   req.Email,
+		Status:  models.SubscriberStatusEnabled,
+		Attribs: attribs,
+	}, nil, listUUIDs, false, true, optinTplID)
 	if err == nil {
 		return hasOptin, nil
 	}
@@ -756,8 +994,9 @@ func (a *App) processSubForm(c echo.Context) (bool, error) {
 			return false, err
 		}
 
-		// Update the subscriber's subscriptions in the DB.
-		_, hasOptin, err := a.core.UpdateSubscriberWithLists(sub.ID, sub, nil, listUUIDs, false, false, true)
+		// Update the subscriber's subscriptions in the DB. The attributes of an existing
+		// subscriber are never modified by a public form, which anyone can post to.
+		_, hasOptin, err := a.core.UpdateSubscriberWithLists(sub.ID, sub, nil, listUUIDs, false, false, true, optinTplID)
 		if err == nil {
 			return hasOptin, nil
 		}
@@ -770,3 +1009,46 @@ func (a *App) processSubForm(c echo.Context) (bool, error) {
 	}
 	return false, echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("public.errorProcessingRequest"))
 }
+
+// getNamedSubForm returns the named subscription form in the :formUUID URL param.
+// If there's no param, nil is returned.
+func (a *App) getNamedSubForm(c echo.Context) (*models.SubscriptionForm, error) {
+	uu := c.Param("formUUID")
+	if uu == "" {
+		return nil, nil
+	}
+	if !reUUID.MatchString(uu) {
+		return nil, echo.NewHTTPError(http.StatusNotFound, a.i18n.T("public.invalidFeature"))
+	}
+
+	form, err := a.core.GetSubscriptionForm(0, uu)
+	if err != nil {
+		return nil, err
+	}
+
+	return &form, nil
+}
+
+// formListIDs returns the list IDs of a named subscription form.
+func formListIDs(form *models.SubscriptionForm) []int {
+	out := make([]int, 0, len(form.ListIDs))
+	for _, id := range form.ListIDs {
+		out = append(out, int(id))
+	}
+
+	return out
+}
+
+// addURLParam adds a query param to the given URL.
+func addURLParam(u, key, val string) string {
+	p, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+
+	q := p.Query()
+	q.Set(key, val)
+	p.RawQuery = q.Encode()
+
+	return p.String()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gdgvda/cron"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetRecurringCampaigns handles the retrieval of recurring campaigns.
+func (a *App) GetRecurringCampaigns(c echo.Context) error {
+	pg := a.pg.NewFromURL(c.Request().URL.Query())
+
+	res, total, err := a.core.GetRecurringCampaigns(pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.RecurringCampaign{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetRecurringCampaign handles the retrieval of a recurring campaign.
+func (a *App) GetRecurringCampaign(c echo.Context) error {
+	out, err := a.core.GetRecurringCampaign(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateRecurringCampaign handles recurring campaign creation.
+func (a *App) CreateRecurringCampaign(c echo.Context) error {
+	var o models.RecurringCampaign
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateRecurringCampaign(o)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := a.core.CreateRecurringCampaign(o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateRecurringCampaign handles recurring campaign modification.
+func (a *App) UpdateRecurringCampaign(c echo.Context) error {
+	var o models.RecurringCampaign
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateRecurringCampaign(o)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := a.core.UpdateRecurringCampaign(getID(c), o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// RunRecurringCampaign handles running a recurring campaign right away
+// instead of waiting for its schedule.
+func (a *App) RunRecurringCampaign(c echo.Context) error {
+	out, err := a.core.RunRecurringCampaign(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteRecurringCampaign handles recurring campaign deletion.
+func (a *App) DeleteRecurringCampaign(c echo.Context) error {
+	if err := a.core.DeleteRecurringCampaign(getID(c)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateRecurringCampaign validates recurring campaign fields.
+func (a *App) validateRecurringCampaign(o models.RecurringCampaign) (models.RecurringCampaign, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return o, errors.New(a.i18n.T("campaigns.fieldInvalidName"))
+	}
+
+	// The campaign that's cloned on every run should exist.
+	if _, err := a.core.GetCampaign(o.CampaignID, "", ""); err != nil {
+		return o, errors.New(a.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.campaign}"))
+	}
+
+	if o.Status != models.RecurringStatusDisabled {
+		o.Status = models.RecurringStatusActive
+	}
+
+	o.Cron = strings.TrimSpace(o.Cron)
+	if _, err := cron.ParseStandard(o.Cron); err != nil {
+		return o, errors.New(a.i18n.Ts("recurring.fieldInvalidCron", "error", err.Error()))
+	}
+
+	switch o.Type {
+	case models.RecurringTypeRSS:
+		o.FeedURL = strings.TrimSpace(o.FeedURL)
+		if u, err := url.Parse(o.FeedURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return o, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "feed_url"))
+		}
+	default:
+		o.Type = models.RecurringTypeCron
+		o.FeedURL = ""
+	}
+
+	return o, nil
+}
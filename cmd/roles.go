@@ -73,16 +73,31 @@ func (a *App) CreateListRole(c echo.Context) error {
 func (a *App) UpdateUserRole(c echo.Context) error {
 	id := getID(c)
 
-	// ID 1 is reserved for the Super Admin user role.
-	if id == auth.SuperAdminRoleID {
-		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidID"))
-	}
-
 	// Incoming params.
 	var r auth.Role
 	if err := c.Bind(&r); err != nil {
 		return err
 	}
+
+	cur, err := a.core.GetRole(id)
+	if err != nil {
+		return err
+	}
+
+	// ID 1 is reserved for the Super Admin user role. Only its 2FA requirement can be changed.
+	if id == auth.SuperAdminRoleID {
+		sa := cur
+		sa.Require2FA = r.Require2FA
+
+		out, err := a.core.UpdateUserRole(id, sa)
+		if err != nil {
+			return err
+		}
+		setAuditDiff(c, cur, out)
+
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
 	if err := a.validateUserRole(r); err != nil {
 		return err
 	}
@@ -95,6 +110,7 @@ func (a *App) UpdateUserRole(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	setAuditDiff(c, cur, out)
 
 	// Cache API tokens for in-memory, off-DB /api/* request auth.
 	if _, err := cacheUsers(a.core, a.auth); err != nil {
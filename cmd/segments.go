@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetSegments handles the retrieval of saved segments.
+func (a *App) GetSegments(c echo.Context) error {
+	pg := a.pg.NewFromURL(c.Request().URL.Query())
+
+	res, total, err := a.core.GetSegments(pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.Segment{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetSegment handles the retrieval of a segment.
+func (a *App) GetSegment(c echo.Context) error {
+	out, err := a.core.GetSegment(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateSegment handles segment creation.
+func (a *App) CreateSegment(c echo.Context) error {
+	var o models.Segment
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateSegment(o, auth.GetUser(c))
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.CreateSegment(o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateSegment handles segment modification.
+func (a *App) UpdateSegment(c echo.Context) error {
+	var o models.Segment
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateSegment(o, auth.GetUser(c))
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.UpdateSegment(getID(c), o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteSegment handles segment deletion.
+func (a *App) DeleteSegment(c echo.Context) error {
+	if err := a.core.DeleteSegment(getID(c)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateSegment validates segment fields.
+func (a *App) validateSegment(o models.Segment, user auth.User) (models.Segment, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.fieldInvalidName"))
+	}
+
+	if len(o.Description) > stdInputMaxLen {
+		return o, echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("globals.messages.invalidFields", "name", "description"))
+	}
+
+	if o.ListIDs == nil {
+		o.ListIDs = pq.Int64Array{}
+	}
+
+	// Arbitrary SQL expressions require the subscribers:sql_query permission.
+	o.Query = formatSQLExp(o.Query)
+	if o.Query != "" && !user.HasPerm(auth.PermSubscribersSqlQuery) {
+		return o, echo.NewHTTPError(http.StatusForbidden,
+			a.i18n.Ts("globals.messages.permissionDenied", "name", auth.PermSubscribersSqlQuery))
+	}
+
+	if len(o.ListIDs) == 0 && o.Query == "" {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("segments.fieldInvalidFilter"))
+	}
+
+	return o, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetSequences handles the retrieval of automation sequences.
+func (a *App) GetSequences(c echo.Context) error {
+	pg := a.pg.NewFromURL(c.Request().URL.Query())
+
+	res, total, err := a.core.GetSequences(pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.Sequence{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetSequence handles the retrieval of a sequence.
+func (a *App) GetSequence(c echo.Context) error {
+	out, err := a.core.GetSequence(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateSequence handles sequence creation.
+func (a *App) CreateSequence(c echo.Context) error {
+	var o models.Sequence
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateSequence(o)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := a.core.CreateSequence(o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateSequence handles sequence modification.
+func (a *App) UpdateSequence(c echo.Context) error {
+	var o models.Sequence
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateSequence(o)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := a.core.UpdateSequence(getID(c), o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteSequence handles sequence deletion.
+func (a *App) DeleteSequence(c echo.Context) error {
+	if err := a.core.DeleteSequence(getID(c)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateSequence validates sequence fields and its steps.
+func (a *App) validateSequence(o models.Sequence) (models.Sequence, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return o, errors.New(a.i18n.T("campaigns.fieldInvalidName"))
+	}
+
+	if o.ListID < 1 {
+		return o, errors.New(a.i18n.T("campaigns.fieldInvalidListIDs"))
+	}
+
+	if o.Status != models.SequenceStatusDisabled {
+		o.Status = models.SequenceStatusActive
+	}
+
+	if o.FromEmail == "" {
+		o.FromEmail = a.cfg.FromEmail
+	} else if !reFromAddress.Match([]byte(o.FromEmail)) {
+		if _, err := a.importer.SanitizeEmail(o.FromEmail); err != nil {
+			return o, errors.New(a.i18n.T("campaigns.fieldInvalidFromEmail"))
+		}
+	}
+
+	if o.Messenger == "" {
+		o.Messenger = "email"
+	}
+	if !a.manager.HasMessenger(o.Messenger) {
+		return o, errors.New(a.i18n.Ts("campaigns.fieldInvalidMessenger", "name", o.Messenger))
+	}
+
+	if len(o.Headers) == 0 {
+		o.Headers = make([]map[string]string, 0)
+	}
+
+	if len(o.Steps) == 0 {
+		return o, errors.New(a.i18n.T("sequences.fieldInvalidSteps"))
+	}
+
+	// Steps are sent in the order of their delays.
+	lastDelay := 0
+	for i, s := range o.Steps {
+		if s.DelayHours < lastDelay {
+			return o, errors.New(a.i18n.T("sequences.fieldInvalidDelays"))
+		}
+		lastDelay = s.DelayHours
+
+		if !strHasLen(s.Subject, 1, 5000) {
+			return o, errors.New(a.i18n.T("campaigns.fieldInvalidSubject"))
+		}
+
+		// The visual editor isn't supported in sequences.
+		if s.ContentType != models.CampaignContentTypeRichtext &&
+			s.ContentType != models.CampaignContentTypeHTML &&
+			s.ContentType != models.CampaignContentTypePlain &&
+			s.ContentType != models.CampaignContentTypeMarkdown {
+			s.ContentType = models.CampaignContentTypeRichtext
+		}
+
+		camp := models.Campaign{Subject: s.Subject, Body: s.Body, AltBody: s.AltBody, ContentType: s.ContentType, TemplateBody: tplTag}
+		if err := camp.CompileTemplate(a.manager.TemplateFuncs(&camp)); err != nil {
+			return o, errors.New(a.i18n.Ts("campaigns.fieldInvalidBody", "error", err.Error()))
+		}
+
+		o.Steps[i] = s
+	}
+
+	return o, nil
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
@@ -21,6 +22,7 @@ import (
 	"github.com/knadh/listmonk/internal/auth"
 	"github.com/knadh/listmonk/internal/messenger/email"
 	"github.com/knadh/listmonk/internal/notifs"
+	"github.com/knadh/listmonk/internal/ratelimit"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 )
@@ -63,6 +65,9 @@ func (a *App) GetSettings(c echo.Context) error {
 	// Empty out passwords.
 	for i := range s.SMTP {
 		s.SMTP[i].Password = strings.Repeat(pwdMask, utf8.RuneCountInString(s.SMTP[i].Password))
+		if s.SMTP[i].DKIM.PrivateKey != "" {
+			s.SMTP[i].DKIM.PrivateKey = strings.Repeat(pwdMask, 8)
+		}
 	}
 	for i := range s.BounceBoxes {
 		s.BounceBoxes[i].Password = strings.Repeat(pwdMask, utf8.RuneCountInString(s.BounceBoxes[i].Password))
@@ -144,6 +149,25 @@ func (a *App) UpdateSettings(c echo.Context) error {
 				}
 			}
 		}
+
+		// Similarly, copy the existing DKIM private key if it's not changed.
+		if s.DKIM.PrivateKey == "" {
+			for _, c := range cur.SMTP {
+				if s.UUID == c.UUID {
+					set.SMTP[i].DKIM.PrivateKey = c.DKIM.PrivateKey
+				}
+			}
+		}
+
+		// Validate the DKIM config.
+		if s.Enabled && s.DKIM.Enabled {
+			d := set.SMTP[i].DKIM
+			if err := email.ValidateDKIM(email.DKIM{Enabled: true, Domain: d.Domain, Selector: d.Selector,
+				PrivateKey: d.PrivateKey, Headers: d.Headers, Canonicalization: d.Canonicalization}); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest,
+					a.i18n.Ts("settings.smtp.dkimError", "name", s.Host, "error", err.Error()))
+			}
+		}
 	}
 	if !has {
 		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("settings.errorNoSMTP"))
@@ -257,6 +281,38 @@ func (a *App) UpdateSettings(c echo.Context) error {
 	}
 	set.DomainAllowlist = doms
 
+	// Custom fields on the public subscription form.
+	fields := make([]models.FormField, 0, len(set.PublicFormFields))
+	for _, f := range set.PublicFormFields {
+		f.Key = strings.TrimSpace(f.Key)
+		f.Label = strings.TrimSpace(f.Label)
+		if !models.IsValidAttribKey(f.Key) || !slices.Contains(models.FormFieldTypes, f.Type) {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				a.i18n.Ts("globals.messages.invalidFields", "name", a.i18n.T("settings.general.formFields")))
+		}
+		for _, e := range fields {
+			if e.Key == f.Key {
+				return echo.NewHTTPError(http.StatusBadRequest,
+					a.i18n.Ts("settings.general.formFieldDuplicate", "name", f.Key))
+			}
+		}
+
+		opts := []string{}
+		for _, o := range f.Options {
+			if o = strings.TrimSpace(o); o != "" && !slices.Contains(opts, o) {
+				opts = append(opts, o)
+			}
+		}
+		if f.Type == models.FormFieldSelect && len(opts) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				a.i18n.Ts("settings.general.formFieldNoOptions", "name", f.Key))
+		}
+		f.Options = opts
+
+		fields = append(fields, f)
+	}
+	set.PublicFormFields = fields
+
 	// Validate and clean CORS domains.
 	cors := make([]string, 0, len(set.SecurityCORSOrigins))
 	for _, d := range set.SecurityCORSOrigins {
@@ -278,6 +334,38 @@ func (a *App) UpdateSettings(c echo.Context) error {
 	}
 	set.SecurityCORSOrigins = cors
 
+	// Validate the rate limits of public subscription endpoints.
+	if rl := set.SecurityRateLimit; rl.Enabled {
+		if rl.Backend != ratelimit.BackendMemory && rl.Backend != ratelimit.BackendPostgres {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				a.i18n.Ts("globals.messages.invalidFields", "name", a.i18n.T("settings.security.rateLimitBackend")))
+		}
+		if d, err := time.ParseDuration(rl.Window); err != nil || d < time.Second {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				a.i18n.Ts("globals.messages.invalidFields", "name", a.i18n.T("settings.security.rateLimitWindow")))
+		}
+		if rl.IPRate < 0 || rl.DomainRate < 0 || rl.BlockThreshold < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				a.i18n.Ts("globals.messages.invalidFields", "name", a.i18n.T("settings.security.rateLimit")))
+		}
+		if d, err := time.ParseDuration(rl.BlockDuration); rl.BlockThreshold > 0 && (err != nil || d < time.Second) {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				a.i18n.Ts("globals.messages.invalidFields", "name", a.i18n.T("settings.security.rateLimitBlockDuration")))
+		}
+	}
+
+	// Validate the number of concurrent import jobs.
+	if set.AppImportConcurrency < 1 || set.AppImportConcurrency > 20 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("globals.messages.invalidFields", "name", a.i18n.T("settings.performance.importConcurrency")))
+	}
+
+	// Validate the idempotency window of tx messages.
+	if d, err := time.ParseDuration(set.AppTxIdempotencyWindow); err != nil || d < time.Minute {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("globals.messages.invalidFields", "name", a.i18n.T("settings.performance.txIdempotencyWindow")))
+	}
+
 	// Validate slow query caching cron.
 	if set.CacheSlowQueries {
 		if _, err := cron.ParseStandard(set.CacheSlowQueriesInterval); err != nil {
@@ -289,10 +377,11 @@ func (a *App) UpdateSettings(c echo.Context) error {
 	if err := a.core.UpdateSettings(set); err != nil {
 		return err
 	}
+	setAuditDiff(c, cur, set)
 
-	// If there are any active campaigns, don't do an auto reload and
+	// If there are any active campaigns or imports, don't do an auto reload and
 	// warn the user on the frontend.
-	if a.manager.HasRunningCampaigns() {
+	if a.manager.HasRunningCampaigns() || a.importer.HasRunningJobs() {
 		a.Lock()
 		a.needsRestart = true
 		a.Unlock()
@@ -338,6 +427,22 @@ func (a *App) TestSMTPSettings(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.internalError"))
 	}
 
+	// If the DKIM private key isn't sent (masked in the UI), use the saved key.
+	if req.DKIM.Enabled && (req.DKIM.PrivateKey == "" || strings.Contains(req.DKIM.PrivateKey, pwdMask)) {
+		req.DKIM.PrivateKey = ""
+		if id := ko.String("uuid"); id != "" {
+			cur, err := a.core.GetSettings()
+			if err != nil {
+				return err
+			}
+			for _, s := range cur.SMTP {
+				if s.UUID == id {
+					req.DKIM.PrivateKey = s.DKIM.PrivateKey
+				}
+			}
+		}
+	}
+
 	to := ko.String("email")
 	if to == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.missingFields", "name", "email"))
@@ -369,6 +474,15 @@ func (a *App) TestSMTPSettings(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
+	// The message is signed and sent. Check whether the DKIM DNS record matches
+	// the key so that the signature actually verifies at the receiving end.
+	if req.DKIM.Enabled {
+		if err := email.CheckDKIM(req.DKIM); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				a.i18n.Ts("settings.smtp.dkimError", "name", req.Host, "error", err.Error()))
+		}
+	}
+
 	return c.JSON(http.StatusOK, okResp{a.bufLog.Lines()})
 }
 
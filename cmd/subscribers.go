@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -236,7 +237,7 @@ func (a *App) CreateSubscriber(c echo.Context) error {
 	listIDs := user.FilterListsByPerm(auth.PermTypeManage, req.Lists)
 
 	// Insert the subscriber into the DB.
-	sub, _, err := a.core.InsertSubscriber(req.Subscriber, listIDs, nil, req.PreconfirmSubs, false)
+	sub, _, err := a.core.InsertSubscriber(req.Subscriber, listIDs, nil, req.PreconfirmSubs, false, 0)
 	if err != nil {
 		return err
 	}
@@ -275,11 +276,17 @@ func (a *App) UpdateSubscriber(c echo.Context) error {
 
 	// Update the subscriber in the DB.
 	id := getID(c)
-	out, _, err := a.core.UpdateSubscriberWithLists(id, req.Subscriber, listIDs, nil, req.PreconfirmSubs, true, false)
+	cur, err := a.core.GetSubscriber(id, "", "")
 	if err != nil {
 		return err
 	}
 
+	out, _, err := a.core.UpdateSubscriberWithLists(id, req.Subscriber, listIDs, nil, req.PreconfirmSubs, true, false, 0)
+	if err != nil {
+		return err
+	}
+	setAuditDiff(c, cur, out)
+
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
@@ -293,7 +300,7 @@ func (a *App) SubscriberSendOptin(c echo.Context) error {
 	}
 
 	// Trigger the opt-in confirmation e-mail hook.
-	if _, err := a.fnOptinNotify(out, nil); err != nil {
+	if _, err := a.fnOptinNotify(out, nil, 0); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("subscribers.errorSendingOptin"))
 	}
 
@@ -460,6 +467,7 @@ func (a *App) DeleteSubscribersByQuery(c echo.Context) error {
 	if err := a.core.DeleteSubscribersByQuery(req.Search, req.Query, req.ListIDs, req.SubscriptionStatus); err != nil {
 		return err
 	}
+	setAuditMeta(c, req)
 
 	return c.JSON(http.StatusOK, okResp{true})
 }
@@ -496,6 +504,7 @@ func (a *App) BlocklistSubscribersByQuery(c echo.Context) error {
 	if err := a.core.BlocklistSubscribersByQuery(req.Search, req.Query, req.ListIDs, req.SubscriptionStatus); err != nil {
 		return err
 	}
+	setAuditMeta(c, req)
 
 	return c.JSON(http.StatusOK, okResp{true})
 }
@@ -546,6 +555,7 @@ func (a *App) ManageSubscriberListsByQuery(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	setAuditMeta(c, req)
 
 	return c.JSON(http.StatusOK, okResp{true})
 }
@@ -689,9 +699,10 @@ func formatSQLExp(q string) string {
 
 // makeOptinNotifyHook returns an enclosed callback that sends optin confirmation e-mails.
 // This is plugged into the 'core' package to send optin confirmations when a new subscriber is
-// created via `core.CreateSubscriber()`.
-func makeOptinNotifyHook(unsubHeader bool, u *UrlConfig, q *models.Queries, i *i18n.I18n) func(sub models.Subscriber, listIDs []int) (int, error) {
-	return func(sub models.Subscriber, listIDs []int) (int, error) {
+// created via `core.CreateSubscriber()`. If tplID is set, the given tx template is used
+// instead of the default system template.
+func makeOptinNotifyHook(unsubHeader bool, u *UrlConfig, q *models.Queries, i *i18n.I18n) func(sub models.Subscriber, listIDs []int, tplID int) (int, error) {
+	return func(sub models.Subscriber, listIDs []int, tplID int) (int, error) {
 		// Fetch double opt-in lists from the given list IDs.
 		// Get the list of subscription lists where the subscriber hasn't confirmed.
 		var lists = []models.List{}
@@ -728,6 +739,22 @@ func makeOptinNotifyHook(unsubHeader bool, u *UrlConfig, q *models.Queries, i *i
 			hdr.Set("List-Unsubscribe", `<`+unsubURL+`>`)
 		}
 
+		// Send the e-mail with the custom template.
+		if tplID > 0 {
+			subject, body, err := renderOptinTpl(tplID, out, u, q, i)
+			if err != nil {
+				lo.Printf("error rendering opt-in template %d for subscriber %d (%s): %s", tplID, sub.ID, sub.UUID, err)
+				return 0, err
+			}
+
+			if err := notifs.NotifyRaw([]string{sub.Email}, subject, body, hdr); err != nil {
+				lo.Printf("error sending opt-in e-mail for subscriber %d (%s): %s", sub.ID, sub.UUID, err)
+				return 0, err
+			}
+
+			return len(lists), nil
+		}
+
 		// Send the e-mail.
 		if err := notifs.Notify([]string{sub.Email}, i.T("subscribers.optinSubject"), notifs.TplSubscriberOptin, out, hdr); err != nil {
 			lo.Printf("error sending opt-in e-mail for subscriber %d (%s): %s", sub.ID, sub.UUID, err)
@@ -737,3 +764,36 @@ func makeOptinNotifyHook(unsubHeader bool, u *UrlConfig, q *models.Queries, i *i
 		return len(lists), nil
 	}
 }
+
+// renderOptinTpl renders the subject and body of an opt-in confirmation e-mail
+// using the given tx template.
+func renderOptinTpl(tplID int, data subOptin, u *UrlConfig, q *models.Queries, i *i18n.I18n) (string, []byte, error) {
+	var tpl models.Template
+	if err := q.GetTemplates.Get(&tpl, tplID, false, models.TemplateTypeTx); err != nil {
+		return "", nil, err
+	}
+
+	if err := tpl.Compile(initTplFuncs(i, u)); err != nil {
+		return "", nil, err
+	}
+
+	// Render the body.
+	b := bytes.Buffer{}
+	if err := tpl.Tpl.ExecuteTemplate(&b, models.BaseTpl, data); err != nil {
+		return "", nil, err
+	}
+	body := make([]byte, b.Len())
+	copy(body, b.Bytes())
+
+	// Render the subject if it's a template.
+	subject := tpl.Subject
+	if tpl.SubjectTpl != nil {
+		b.Reset()
+		if err := tpl.SubjectTpl.ExecuteTemplate(&b, models.BaseTpl, data); err != nil {
+			return "", nil, err
+		}
+		subject = b.String()
+	}
+
+	return subject, body, nil
+}
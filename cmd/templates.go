@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/utils"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 )
@@ -27,6 +29,9 @@ const (
 		<p>Here is a link to <a href="https://listmonk.app" target="_blank">listmonk</a>.</p>`
 )
 
+// tplDiffContext is the number of unchanged lines around the changes in template diffs.
+const tplDiffContext = 3
+
 var (
 	regexpTplTag = regexp.MustCompile(`{{(\s+)?template\s+?"content"(\s+)?\.(\s+)?}}`)
 )
@@ -130,7 +135,7 @@ func (a *App) CreateTemplate(c echo.Context) error {
 	}
 
 	// Create the template the in the DB.
-	out, err := a.core.CreateTemplate(o.Name, o.Type, o.Subject, []byte(o.Body), o.BodySource)
+	out, err := a.core.CreateTemplate(o.Name, o.Type, o.Subject, []byte(o.Body), o.BodySource, auth.GetUser(c))
 	if err != nil {
 		return err
 	}
@@ -138,6 +143,7 @@ func (a *App) CreateTemplate(c echo.Context) error {
 	// If it's a transactional template, cache it in the manager
 	// to be used for arbitrary incoming tx message pushes.
 	if o.Type == models.TemplateTypeTx {
+		o.ID, o.Version = out.ID, out.Version
 		a.manager.CacheTpl(out.ID, &o)
 	}
 
@@ -171,13 +177,20 @@ func (a *App) UpdateTemplate(c echo.Context) error {
 
 	// Update the template in the DB.
 	id := getID(c)
-	out, err := a.core.UpdateTemplate(id, o.Name, o.Subject, []byte(o.Body), o.BodySource)
+	cur, err := a.core.GetTemplate(id, false)
 	if err != nil {
 		return err
 	}
 
+	out, err := a.core.UpdateTemplate(id, o.Name, o.Subject, []byte(o.Body), o.BodySource, auth.GetUser(c))
+	if err != nil {
+		return err
+	}
+	setAuditDiff(c, cur, out)
+
 	// If it's a transactional template, cache it.
 	if out.Type == models.TemplateTypeTx {
+		o.ID, o.Version = out.ID, out.Version
 		a.manager.CacheTpl(out.ID, &o)
 	}
 
@@ -210,6 +223,159 @@ func (a *App) DeleteTemplate(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
+// GetTemplateVersions handles the retrieval of the versions of a template, latest first.
+func (a *App) GetTemplateVersions(c echo.Context) error {
+	id := getID(c)
+	if _, err := a.core.GetTemplate(id, true); err != nil {
+		return err
+	}
+
+	pg := a.pg.NewFromURL(c.Request().URL.Query())
+	res, total, err := a.core.GetTemplateVersions(id, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.TemplateVersion{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetTemplateVersion handles the retrieval of a version of a template.
+func (a *App) GetTemplateVersion(c echo.Context) error {
+	ver, err := a.getTplVersion(c.Param("version"))
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.GetTemplateVersion(getID(c), ver)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DiffTemplateVersions handles the line diff between a version of a template and
+// another version (?to=), which defaults to the current version of the template.
+func (a *App) DiffTemplateVersions(c echo.Context) error {
+	id := getID(c)
+	from, err := a.getTplVersion(c.Param("version"))
+	if err != nil {
+		return err
+	}
+
+	to := 0
+	if v := c.QueryParam("to"); v != "" {
+		if to, err = a.getTplVersion(v); err != nil {
+			return err
+		}
+	} else {
+		tpl, err := a.core.GetTemplate(id, true)
+		if err != nil {
+			return err
+		}
+		to = tpl.Version
+	}
+
+	fromVer, err := a.core.GetTemplateVersion(id, from)
+	if err != nil {
+		return err
+	}
+	toVer, err := a.core.GetTemplateVersion(id, to)
+	if err != nil {
+		return err
+	}
+
+	out := models.TemplateDiff{
+		TemplateID: id,
+		From:       from,
+		To:         to,
+		Name:       utils.DiffLines(fromVer.Name, toVer.Name, tplDiffContext),
+		Subject:    utils.DiffLines(fromVer.Subject, toVer.Subject, tplDiffContext),
+		Body:       utils.DiffLines(fromVer.Body, toVer.Body, tplDiffContext),
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// RollbackTemplate handles the restoration of a template to one of its versions.
+// The restored template is saved as a new version.
+func (a *App) RollbackTemplate(c echo.Context) error {
+	id := getID(c)
+	ver, err := a.getTplVersion(c.Param("version"))
+	if err != nil {
+		return err
+	}
+
+	cur, err := a.core.GetTemplate(id, false)
+	if err != nil {
+		return err
+	}
+
+	v, err := a.core.GetTemplateVersion(id, ver)
+	if err != nil {
+		return err
+	}
+
+	// Compile the version and validate as the template functions
+	// may have changed since the version was saved.
+	o := models.Template{
+		Name:       v.Name,
+		Type:       cur.Type,
+		Subject:    v.Subject,
+		Body:       v.Body,
+		BodySource: v.BodySource,
+	}
+	if err := a.validateTemplate(o); err != nil {
+		return err
+	}
+
+	var funcs template.FuncMap
+	if o.Type == models.TemplateTypeCampaign || o.Type == models.TemplateTypeCampaignVisual {
+		funcs = a.manager.TemplateFuncs(nil)
+	} else {
+		funcs = a.manager.GenericTemplateFuncs()
+	}
+	if err := o.Compile(funcs); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := a.core.RollbackTemplate(id, ver, auth.GetUser(c))
+	if err != nil {
+		return err
+	}
+	setAuditDiff(c, cur, out)
+
+	// If it's a transactional template, cache it.
+	if out.Type == models.TemplateTypeTx {
+		o.ID, o.Version = out.ID, out.Version
+		a.manager.CacheTpl(out.ID, &o)
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// getTplVersion parses and validates a template version number.
+func (a *App) getTplVersion(v string) (int, error) {
+	ver, _ := strconv.Atoi(v)
+	if ver < 1 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("globals.messages.invalidFields", "name", "version"))
+	}
+
+	return ver, nil
+}
+
 // compileTemplate validates template fields.
 func (a *App) validateTemplate(o models.Template) error {
 	if !strHasLen(o.Name, 1, stdInputMaxLen) {
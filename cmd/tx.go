@@ -6,11 +6,28 @@ import (
 	"io"
 	"net/http"
 	"net/textproto"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// maxTxBatchSize is the maximum number of entries in a batch of tx messages.
+const maxTxBatchSize = 10000
+
+const (
+	// txBatchLease is the duration after which a running tx batch whose lease hasn't
+	// been renewed is considered to be interrupted, eg: by a crash or a restart, and is
+	// resumed by the next available instance.
+	txBatchLease = time.Minute
+
+	// txBatchLeaseRenew is the interval at which the lease of a batch that's being
+	// sent is renewed.
+	txBatchLeaseRenew = time.Second * 10
 )
 
 // SendTxMessage handles the sending of a transactional message.
@@ -62,6 +79,11 @@ func (a *App) SendTxMessage(c echo.Context) error {
 		return err
 	}
 
+	// The idempotency key can also be sent as a header.
+	if m.IdempotencyKey == "" {
+		m.IdempotencyKey = c.Request().Header.Get("Idempotency-Key")
+	}
+
 	// Validate fields.
 	if r, err := a.validateTxMessage(m); err != nil {
 		return err
@@ -69,37 +91,38 @@ func (a *App) SendTxMessage(c echo.Context) error {
 		m = r
 	}
 
-	// Get the cached tx template.
-	tpl, err := a.manager.GetTpl(m.TemplateID)
+	// Get the tx template.
+	tpl, err := a.getTxTemplate(m.TemplateID, m.TemplateVersion)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest,
-			a.i18n.Ts("globals.messages.notFound", "name", fmt.Sprintf("template %d", m.TemplateID)))
-	}
-
-	var (
-		num      = len(m.SubscriberEmails)
-		isEmails = true
-	)
-	if len(m.SubscriberIDs) > 0 {
-		num = len(m.SubscriberIDs)
-		isEmails = false
+		return err
 	}
 
-	notFound := []string{}
-	for n := range num {
-		var (
-			subID    int
-			subEmail string
-		)
+	// For backwards compatibility, the response is `true` unless the logged messages
+	// with their statuses are requested, or an idempotency key is sent.
+	withStatuses := m.IdempotencyKey != "" || c.QueryParam("statuses") == "true"
 
-		if !isEmails {
-			subID = m.SubscriberIDs[n]
-		} else {
-			subEmail = m.SubscriberEmails[n]
+	// If messages have already been sent with the idempotency key within the window,
+	// return them instead of sending the messages again.
+	if m.IdempotencyKey != "" {
+		out, err := a.core.GetTxMessagesByKey(m.IdempotencyKey, "", a.cfg.TxIdempotencyWindow)
+		if err != nil {
+			return err
+		}
+		if len(out) > 0 {
+			return c.JSON(http.StatusOK, okResp{out})
 		}
+	}
+
+	// Only one of the recipient lists is set.
+	num := len(m.SubscriberEmails) + len(m.SubscriberIDs) + len(m.Recipients)
 
+	var (
+		out      = make([]models.TxMessageLog, 0, num)
+		notFound = []string{}
+	)
+	for n := range num {
 		// Get the subscriber.
-		sub, err := a.core.GetSubscriber(subID, "", subEmail)
+		sub, err := a.getTxSubscriber(m, n)
 		if err != nil {
 			// If the subscriber is not found, log that error and move on without halting on the list.
 			if er, ok := err.(*echo.HTTPError); ok && er.Code == http.StatusBadRequest {
@@ -110,50 +133,489 @@ func (a *App) SendTxMessage(c echo.Context) error {
 			return err
 		}
 
-		// Render the message.
-		if err := m.Render(sub, tpl); err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest,
-				a.i18n.Ts("globals.messages.errorFetching", "name"))
-		}
-
-		// Prepare the final message.
-		msg := models.Message{}
-		msg.Subscriber = sub
-		msg.To = []string{sub.Email}
-		msg.From = m.FromEmail
-		msg.Subject = m.Subject
-		msg.ContentType = m.ContentType
-		msg.Messenger = m.Messenger
-		msg.Body = m.Body
-		for _, a := range m.Attachments {
-			msg.Attachments = append(msg.Attachments, models.Attachment{
-				Name:    a.Name,
-				Header:  a.Header,
-				Content: a.Content,
-			})
+		res, err := a.pushTxMessage(m, sub, tpl, models.TxMessageLog{
+			IdempotencyKey: null.NewString(m.IdempotencyKey, m.IdempotencyKey != ""),
+		})
+		if err != nil {
+			return err
 		}
+		out = append(out, res...)
+	}
 
-		// Optional headers.
-		if len(m.Headers) != 0 {
-			msg.Headers = make(textproto.MIMEHeader, len(m.Headers))
-			for _, set := range m.Headers {
-				for hdr, val := range set {
-					msg.Headers.Add(hdr, val)
-				}
-			}
+	if len(notFound) > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, strings.Join(notFound, "; "))
+	}
+
+	if !withStatuses {
+		return c.JSON(http.StatusOK, okResp{true})
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// pushTxMessage renders a tx message for a subscriber, logs it, and pushes it to the
+// messenger. l carries the optional idempotency key and batch of the log entry. If a
+// message with the same idempotency key has already been sent to the subscriber, the
+// logged messages are returned without sending it again.
+func (a *App) pushTxMessage(m models.TxMessage, sub models.Subscriber, tpl *models.Template, l models.TxMessageLog) ([]models.TxMessageLog, error) {
+	// Render the message.
+	if err := m.Render(sub, tpl); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("templates.errorRendering", "error", err.Error()))
+	}
+
+	// Log the message. If a concurrent request with the same idempotency key
+	// has already sent it to the subscriber, don't send it again.
+	l.TemplateID = null.IntFrom(m.TemplateID)
+	l.TemplateVersion = null.NewInt(tpl.Version, tpl.Version > 0)
+	l.SubscriberID = null.NewInt(sub.ID, sub.ID > 0)
+	l.Email = sub.Email
+	l.Subject = m.Subject
+	l.Messenger = m.Messenger
+	txMsg, ok, err := a.core.CreateTxMessage(l)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return a.core.GetTxMessagesByKey(m.IdempotencyKey, sub.Email, a.cfg.TxIdempotencyWindow)
+	}
+
+	// Prepare the final message.
+	msg := models.Message{}
+	msg.TxID = txMsg.ID
+	msg.Subscriber = sub
+	msg.To = []string{sub.Email}
+	msg.From = m.FromEmail
+	msg.Subject = m.Subject
+	msg.ContentType = m.ContentType
+	msg.Messenger = m.Messenger
+	msg.Body = m.Body
+	for _, a := range m.Attachments {
+		msg.Attachments = append(msg.Attachments, models.Attachment{
+			Name:    a.Name,
+			Header:  a.Header,
+			Content: a.Content,
+		})
+	}
+
+	// The tx message's UUID is attached for tracking bounces, followed by optional headers.
+	msg.Headers = make(textproto.MIMEHeader, len(m.Headers)+1)
+	msg.Headers.Set(models.EmailHeaderTxUUID, txMsg.UUID)
+	for _, set := range m.Headers {
+		for hdr, val := range set {
+			msg.Headers.Add(hdr, val)
 		}
+	}
+
+	// The failed message is returned along with the error.
+	if err := a.manager.PushMessage(msg); err != nil {
+		a.log.Printf("error sending message (%s): %v", msg.Subject, err)
+		a.core.UpdateTxMessageStatus(txMsg.ID, models.TxStatusFailed, err.Error())
+
+		txMsg.Status, txMsg.Error = models.TxStatusFailed, err.Error()
+		return []models.TxMessageLog{txMsg}, err
+	}
+
+	return []models.TxMessageLog{txMsg}, nil
+}
+
+// getTxTemplate returns the compiled tx template to render messages with. By default, it's
+// the cached current version of the template. If a version is given, that version of the
+// template is loaded from the DB and compiled.
+func (a *App) getTxTemplate(id, version int) (*models.Template, error) {
+	if version == 0 {
+		tpl, err := a.manager.GetTpl(id)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest,
+				a.i18n.Ts("globals.messages.notFound", "name", fmt.Sprintf("template %d", id)))
+		}
+		return tpl, nil
+	}
+
+	// Only tx templates can be used for tx messages.
+	cur, err := a.core.GetTemplate(id, true)
+	if err != nil {
+		return nil, err
+	}
+	if cur.Type != models.TemplateTypeTx {
+		return nil, echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("globals.messages.notFound", "name", fmt.Sprintf("template %d", id)))
+	}
+
+	v, err := a.core.GetTemplateVersion(id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl := &models.Template{
+		Base:    models.Base{ID: id},
+		Name:    v.Name,
+		Type:    cur.Type,
+		Subject: v.Subject,
+		Body:    v.Body,
+		Version: v.Version,
+	}
+	if err := tpl.Compile(a.manager.GenericTemplateFuncs()); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return tpl, nil
+}
+
+// getTxSubscriber returns the nth recipient of a tx message. Subscribers are looked up
+// by their IDs or e-mails while raw recipients are returned as-is, without being
+// recorded as subscribers.
+func (a *App) getTxSubscriber(m models.TxMessage, n int) (models.Subscriber, error) {
+	switch {
+	case len(m.Recipients) > 0:
+		r := m.Recipients[n]
+		return models.Subscriber{
+			UUID:    dummyUUID,
+			Email:   r.Email,
+			Name:    r.Name,
+			Attribs: r.Attribs,
+			Status:  models.SubscriberStatusEnabled,
+		}, nil
+	case len(m.SubscriberIDs) > 0:
+		return a.core.GetSubscriber(m.SubscriberIDs[n], "", "")
+	default:
+		return a.core.GetSubscriber(0, "", m.SubscriberEmails[n])
+	}
+}
+
+// GetTxMessage handles the retrieval of a transactional message and its
+// delivery status by its ID or UUID.
+func (a *App) GetTxMessage(c echo.Context) error {
+	id, uu, err := getTxID(c)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.GetTxMessage(id, uu)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// SendTxBatch handles the sending of a batch of transactional messages with
+// per-recipient data. The batch is sent asynchronously and is returned right away.
+func (a *App) SendTxBatch(c echo.Context) error {
+	var b models.TxBatchMessage
+	if err := c.Bind(&b); err != nil {
+		return err
+	}
 
-		if err := a.manager.PushMessage(msg); err != nil {
-			a.log.Printf("error sending message (%s): %v", msg.Subject, err)
+	// The idempotency key can also be sent as a header.
+	if b.IdempotencyKey == "" {
+		b.IdempotencyKey = c.Request().Header.Get("Idempotency-Key")
+	}
+
+	b.IdempotencyKey = strings.TrimSpace(b.IdempotencyKey)
+	if len(b.IdempotencyKey) > stdInputMaxLen {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("globals.messages.invalidFields", "name", "idempotency_key"))
+	}
+
+	if len(b.Entries) == 0 || len(b.Entries) > maxTxBatchSize {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("globals.messages.invalidFields", "name", fmt.Sprintf("entries (1 - %d)", maxTxBatchSize)))
+	}
+
+	if b.Messenger == "" {
+		b.Messenger = emailMsgr
+	} else if !a.manager.HasMessenger(b.Messenger) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("campaigns.fieldInvalidMessenger", "name", b.Messenger))
+	}
+
+	// Get the tx template.
+	tpl, err := a.getTxTemplate(b.TemplateID, b.TemplateVersion)
+	if err != nil {
+		return err
+	}
+
+	// Pin the template version so that an interrupted batch is resumed with the
+	// same version even if the template has been updated since.
+	if tpl.Version > 0 {
+		b.TemplateVersion = tpl.Version
+	}
+
+	// If a batch has already been created with the idempotency key within the window,
+	// return it instead of sending the messages again.
+	if b.IdempotencyKey != "" {
+		out, ok, err := a.core.GetTxBatchByKey(b.IdempotencyKey, a.cfg.TxIdempotencyWindow)
+		if err != nil {
 			return err
 		}
+		if ok {
+			return c.JSON(http.StatusOK, okResp{out})
+		}
 	}
 
-	if len(notFound) > 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, strings.Join(notFound, "; "))
+	out, ok, err := a.core.CreateTxBatch(b)
+	if err != nil {
+		return err
+	}
+
+	// A concurrent request with the same idempotency key has created the batch.
+	if !ok {
+		out, _, err := a.core.GetTxBatchByKey(b.IdempotencyKey, a.cfg.TxIdempotencyWindow)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, okResp{out})
 	}
 
-	return c.JSON(http.StatusOK, okResp{true})
+	a.startTxBatch(out, b, tpl, nil, nil)
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetTxBatch handles the retrieval of a transactional message batch by its ID or UUID.
+func (a *App) GetTxBatch(c echo.Context) error {
+	id, uu, err := getTxID(c)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.GetTxBatch(id, uu)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetTxBatchMessages handles the retrieval of the messages in a transactional
+// message batch, which are the results of the batch's entries.
+func (a *App) GetTxBatchMessages(c echo.Context) error {
+	id, uu, err := getTxID(c)
+	if err != nil {
+		return err
+	}
+
+	batch, err := a.core.GetTxBatch(id, uu)
+	if err != nil {
+		return err
+	}
+
+	pg := a.pg.NewFromURL(c.Request().URL.Query())
+	res, total, err := a.core.GetTxBatchMessages(batch.ID, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.TxMessageLog{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// startTxBatch runs a batch in the background. Running batches are tracked so that
+// shutdown can stop and wait for them. Once the app is shutting down, no new batches
+// are started and the batch is left to be resumed later.
+func (a *App) startTxBatch(batch models.TxBatch, b models.TxBatchMessage, tpl *models.Template, tplErr error, done map[int]bool) {
+	a.txMut.Lock()
+	defer a.txMut.Unlock()
+
+	select {
+	case <-a.chTxClose:
+		return
+	default:
+	}
+
+	a.txBatches.Add(1)
+	go func() {
+		defer a.txBatches.Done()
+		a.runTxBatch(batch, b, tpl, tplErr, done)
+	}()
+}
+
+// closeTxBatches stops the running batches after their current entries and waits
+// for them to stop. The unfinished batches are resumed after a restart.
+func (a *App) closeTxBatches() {
+	a.txMut.Lock()
+	close(a.chTxClose)
+	a.txMut.Unlock()
+
+	a.txBatches.Wait()
+}
+
+// resumeTxBatches is a blocking function that periodically picks up running batches
+// whose leases have expired, ie: batches that were interrupted by a crash or a restart,
+// and resumes them from where they stopped.
+func (a *App) resumeTxBatches() {
+	t := time.NewTicker(txBatchLease)
+	defer t.Stop()
+
+	for {
+		for a.resumeTxBatch() {
+		}
+
+		select {
+		case <-a.chTxClose:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// resumeTxBatch claims an interrupted batch and resumes it, skipping the entries that
+// have already been processed. It returns false if there's no batch to resume.
+func (a *App) resumeTxBatch() bool {
+	select {
+	case <-a.chTxClose:
+		return false
+	default:
+	}
+
+	batch, b, ok, err := a.core.NextTxBatch(txBatchLease)
+	if err != nil || !ok {
+		return false
+	}
+
+	done, err := a.core.GetTxBatchDone(batch.ID)
+	if err != nil {
+		// The batch's lease has been renewed. It's retried once it expires.
+		return true
+	}
+
+	// If the template can't be loaded, eg: if it's been deleted, the remaining
+	// entries are logged as failed.
+	tpl, tplErr := a.getTxTemplate(b.TemplateID, b.TemplateVersion)
+
+	a.log.Printf("resuming tx batch %s (%d of %d messages processed)", batch.UUID, len(done), len(b.Entries))
+	a.startTxBatch(batch, b, tpl, tplErr, done)
+
+	return true
+}
+
+// runTxBatch sends the messages of a batch one by one and logs the result of every
+// entry against the batch, including the entries that couldn't be sent. Entries in
+// done, which have already been processed, are skipped. If tplErr is set, all entries
+// are logged as failed with it. The batch's lease is renewed periodically.
+func (a *App) runTxBatch(batch models.TxBatch, b models.TxBatchMessage, tpl *models.Template, tplErr error, done map[int]bool) {
+	renewed := time.Now()
+	for n, e := range b.Entries {
+		if done[n] {
+			continue
+		}
+
+		// Stop on shutdown. The batch is resumed from here after the restart.
+		select {
+		case <-a.chTxClose:
+			a.log.Printf("stopping tx batch %s at message %d of %d", batch.UUID, n, len(b.Entries))
+			return
+		default:
+		}
+
+		if time.Since(renewed) >= txBatchLeaseRenew {
+			a.core.TouchTxBatch(batch.ID)
+			renewed = time.Now()
+		}
+
+		l := models.TxMessageLog{
+			BatchID:    null.IntFrom(int(batch.ID)),
+			BatchIndex: null.IntFrom(n),
+		}
+
+		err := tplErr
+		if err == nil {
+			err = a.sendTxBatchEntry(b, e, tpl, l)
+		}
+		if err == nil {
+			continue
+		}
+
+		// Log the entry as failed.
+		l.TemplateID = null.IntFrom(b.TemplateID)
+		l.TemplateVersion = null.NewInt(b.TemplateVersion, b.TemplateVersion > 0)
+		l.Email = e.SubscriberEmail
+		if e.Recipient != nil {
+			l.Email = e.Recipient.Email
+		}
+		l.Messenger = b.Messenger
+		l.Status = models.TxStatusFailed
+		l.Error = err.Error()
+		if er, ok := err.(*echo.HTTPError); ok {
+			l.Error = fmt.Sprintf("%v", er.Message)
+		}
+		if _, _, err := a.core.CreateTxMessage(l); err != nil {
+			a.log.Printf("error logging failed entry %d of tx batch %s: %v", n, batch.UUID, err)
+		}
+	}
+
+	// If the batch can't be marked as finished, it's left running and is picked up
+	// and skipped through once its lease expires.
+	if err := a.core.FinishTxBatch(batch.ID); err != nil {
+		a.log.Printf("error finishing tx batch %s: %v", batch.UUID, err)
+		return
+	}
+
+	a.log.Printf("finished sending tx batch %s (%d messages)", batch.UUID, len(b.Entries))
+}
+
+// sendTxBatchEntry renders and sends the message of an entry in a batch. An error is
+// returned if the entry couldn't be logged, eg: if the recipient is invalid. Messages
+// that are logged but fail to be pushed to the messenger are logged as failed already.
+func (a *App) sendTxBatchEntry(b models.TxBatchMessage, e models.TxBatchEntry, tpl *models.Template, l models.TxMessageLog) error {
+	m := models.TxMessage{
+		SubscriberEmail: e.SubscriberEmail,
+		SubscriberID:    e.SubscriberID,
+		TemplateID:      b.TemplateID,
+		Data:            e.Data,
+		FromEmail:       b.FromEmail,
+		ContentType:     b.ContentType,
+		Messenger:       b.Messenger,
+		Subject:         b.Subject,
+
+		// Entry headers are added to the batch's headers.
+		Headers: append(append(models.Headers{}, b.Headers...), e.Headers...),
+	}
+	if e.Recipient != nil {
+		m.Recipients = []models.TxRecipient{*e.Recipient}
+	}
+
+	m, err := a.validateTxMessage(m)
+	if err != nil {
+		return err
+	}
+
+	sub, err := a.getTxSubscriber(m, 0)
+	if err != nil {
+		return err
+	}
+
+	if res, err := a.pushTxMessage(m, sub, tpl, l); err != nil && len(res) == 0 {
+		return err
+	}
+
+	return nil
+}
+
+// getTxID returns the numeric ID or the UUID in the :id param of tx message
+// and batch requests.
+func getTxID(c echo.Context) (int64, string, error) {
+	idStr := c.Param("id")
+	if reUUID.MatchString(idStr) {
+		return 0, idStr, nil
+	}
+
+	id, _ := strconv.ParseInt(idStr, 10, 64)
+	if id < 1 {
+		return 0, "", echo.NewHTTPError(http.StatusBadRequest, "invalid ID")
+	}
+
+	return id, "", nil
 }
 
 // validateTxMessage validates the tx message fields.
@@ -175,9 +637,16 @@ func (a *App) validateTxMessage(m models.TxMessage) (models.TxMessage, error) {
 		m.SubscriberIDs = append(m.SubscriberIDs, m.SubscriberID)
 	}
 
-	if (len(m.SubscriberEmails) == 0 && len(m.SubscriberIDs) == 0) || (len(m.SubscriberEmails) > 0 && len(m.SubscriberIDs) > 0) {
+	// Exactly one of the recipient lists should be set.
+	n := 0
+	for _, l := range []int{len(m.SubscriberEmails), len(m.SubscriberIDs), len(m.Recipients)} {
+		if l > 0 {
+			n++
+		}
+	}
+	if n != 1 {
 		return m, echo.NewHTTPError(http.StatusBadRequest,
-			a.i18n.Ts("globals.messages.invalidFields", "name", "send subscriber_emails OR subscriber_ids"))
+			a.i18n.Ts("globals.messages.invalidFields", "name", "send subscriber_emails OR subscriber_ids OR recipients"))
 	}
 
 	for n, email := range m.SubscriberEmails {
@@ -190,6 +659,22 @@ func (a *App) validateTxMessage(m models.TxMessage) (models.TxMessage, error) {
 		}
 	}
 
+	// Raw recipients are validated like subscribers, including the domain block and
+	// allow lists. As they are not subscribers, the attribute schema doesn't apply.
+	for n, r := range m.Recipients {
+		s, err := a.importer.ValidateRecipient(r)
+		if err != nil {
+			return m, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s: %v", r.Email, err))
+		}
+		m.Recipients[n] = s
+	}
+
+	m.IdempotencyKey = strings.TrimSpace(m.IdempotencyKey)
+	if len(m.IdempotencyKey) > stdInputMaxLen {
+		return m, echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("globals.messages.invalidFields", "name", "idempotency_key"))
+	}
+
 	if m.FromEmail == "" {
 		m.FromEmail = a.cfg.FromEmail
 	}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/knadh/listmonk/internal/auth"
 	"github.com/knadh/listmonk/internal/core"
@@ -162,11 +166,17 @@ func (a *App) UpdateUser(c echo.Context) error {
 		u.Name = u.Username
 	}
 
+	cur, err := a.core.GetUser(id, "", "")
+	if err != nil {
+		return err
+	}
+
 	// Update the user in the DB.
 	user, err := a.core.UpdateUser(id, u)
 	if err != nil {
 		return err
 	}
+	setAuditDiff(c, cur, user)
 
 	// Blank out the password hash in the response.
 	user.Password = null.String{}
@@ -260,6 +270,7 @@ func (a *App) UpdateUserProfile(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	setAuditDiff(c, user, out)
 
 	// Blank out the password hash in the response.
 	out.Password = null.String{}
@@ -267,6 +278,267 @@ func (a *App) UpdateUserProfile(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// SetupUserTOTP starts the TOTP 2FA enrolment of the current user by generating a
+// new secret that has to be verified with a code (EnableUserTOTP) to enable 2FA.
+func (a *App) SetupUserTOTP(c echo.Context) error {
+	user := auth.GetUser(c)
+	if user.Type != auth.UserTypeUser {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.invalidRequest"))
+	}
+	if user.TOTPEnabled {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.totpAlreadyEnabled"))
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		a.log.Printf("error generating TOTP secret: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+	}
+
+	if err := a.core.SetUserTOTP(user.ID, null.NewString(secret, true), false, nil); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}{secret, a.makeTOTPURI(user, secret)}})
+}
+
+// EnableUserTOTP verifies a code against the secret generated by SetupUserTOTP,
+// enables 2FA for the current user, and returns a new set of recovery codes.
+func (a *App) EnableUserTOTP(c echo.Context) error {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	user := auth.GetUser(c)
+	if user.TOTPEnabled {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.totpAlreadyEnabled"))
+	}
+	if !user.TOTPSecret.Valid {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.totpNotEnabled"))
+	}
+
+	if err := a.core.VerifyUserTOTP(user, req.Code); err != nil {
+		return err
+	}
+
+	codes, hashes, err := makeRecoveryCodes()
+	if err != nil {
+		a.log.Printf("error generating recovery codes: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+	}
+
+	if err := a.core.SetUserTOTP(user.ID, user.TOTPSecret, true, hashes); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{codes}})
+}
+
+// DisableUserTOTP disables 2FA for the current user after verifying a code.
+// Users whose role requires 2FA cannot disable it.
+func (a *App) DisableUserTOTP(c echo.Context) error {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	user := auth.GetUser(c)
+	if !user.TOTPEnabled {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.totpNotEnabled"))
+	}
+	if user.UserRoleRequire2FA {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.totpRequired"))
+	}
+
+	if err := a.core.VerifyUserTOTP(user, req.Code); err != nil {
+		return err
+	}
+
+	if err := a.core.SetUserTOTP(user.ID, null.String{}, false, nil); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// RegenerateUserRecoveryCodes replaces the current user's recovery codes with
+// a new set after verifying a code.
+func (a *App) RegenerateUserRecoveryCodes(c echo.Context) error {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	user := auth.GetUser(c)
+	if !user.TOTPEnabled {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.totpNotEnabled"))
+	}
+
+	if err := a.core.VerifyUserTOTP(user, req.Code); err != nil {
+		return err
+	}
+
+	codes, hashes, err := makeRecoveryCodes()
+	if err != nil {
+		a.log.Printf("error generating recovery codes: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+	}
+
+	if err := a.core.SetUserTOTPRecoveryCodes(user.ID, hashes); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{codes}})
+}
+
+// ResetUserTOTP removes 2FA from a user, for instance, one who has lost their device
+// and recovery codes. If the user's role requires 2FA, they enrol again on the next login.
+func (a *App) ResetUserTOTP(c echo.Context) error {
+	id := getID(c)
+	if err := a.core.SetUserTOTP(id, null.String{}, false, nil); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// GetAPITokens handles the retrieval of an API user's tokens.
+func (a *App) GetAPITokens(c echo.Context) error {
+	out, err := a.core.GetAPITokens(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateAPIToken handles the creation of a new token for an API user. The plaintext
+// token is returned in the response just once.
+func (a *App) CreateAPIToken(c echo.Context) error {
+	var t auth.APIToken
+	if err := c.Bind(&t); err != nil {
+		return err
+	}
+
+	id := getID(c)
+	user, err := a.core.GetUser(id, "", "")
+	if err != nil {
+		return err
+	}
+	if user.Type != auth.UserTypeAPI {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.apiTokenNotAPIUser"))
+	}
+
+	t.UserID = id
+	t.Name = strings.TrimSpace(t.Name)
+	if !strHasLen(t.Name, 1, stdInputMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	// The token's permissions can only narrow down the user's role permissions.
+	// list:get and list:manage narrow down the per-list permissions of the user's list role.
+	for _, p := range t.Permissions {
+		if p == auth.PermListGet || p == auth.PermListManage {
+			if (p == auth.PermListGet && len(user.GetListIDs) == 0) || (p == auth.PermListManage && len(user.ManageListIDs) == 0) {
+				if user.UserRole.ID != auth.SuperAdminRoleID {
+					return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("users.apiTokenPermNotInRole", "name", p))
+				}
+			}
+			continue
+		}
+
+		if _, ok := a.cfg.Permissions[p]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", fmt.Sprintf("permission: %s", p)))
+		}
+		if _, ok := user.PermissionsMap[p]; !ok && user.UserRole.ID != auth.SuperAdminRoleID {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("users.apiTokenPermNotInRole", "name", p))
+		}
+	}
+
+	for n, ip := range t.IPAllowlist {
+		t.IPAllowlist[n] = strings.TrimSpace(ip)
+	}
+	if _, err := auth.ParseIPAllowlist(t.IPAllowlist); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", err.Error()))
+	}
+
+	if t.ExpiresAt.Valid && !t.ExpiresAt.Time.After(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "expires_at"))
+	}
+
+	out, err := a.core.CreateAPIToken(t)
+	if err != nil {
+		return err
+	}
+
+	// Cache the API tokens for in-memory, off-DB /api/* request auth.
+	if _, err := cacheUsers(a.core, a.auth); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteAPIToken handles the deletion of an API user's token.
+func (a *App) DeleteAPIToken(c echo.Context) error {
+	tokenID, _ := strconv.Atoi(c.Param("tokenID"))
+	if tokenID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := a.core.DeleteAPIToken(getID(c), tokenID); err != nil {
+		return err
+	}
+
+	// Remove the token from the cache.
+	if _, err := cacheUsers(a.core, a.auth); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// makeTOTPURI returns the otpauth:// provisioning URI of a user's TOTP secret.
+// The instance's hostname is added to the issuer to distinguish multiple instances
+// in authenticator apps.
+func (a *App) makeTOTPURI(user auth.User, secret string) string {
+	issuer := "listmonk"
+	if u, err := url.Parse(a.urlCfg.RootURL); err == nil && u.Hostname() != "" {
+		issuer += " (" + u.Hostname() + ")"
+	}
+
+	return auth.TOTPURI(issuer, user.Username, secret)
+}
+
+// makeRecoveryCodes generates a set of 2FA recovery codes and their hashes.
+func makeRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for n, c := range codes {
+		hashes[n] = auth.HashRecoveryCode(c)
+	}
+
+	return codes, hashes, nil
+}
+
 // cacheUsers fetches (API) users and caches them in the auth module.
 // It also returns a bool indicating whether there are any actual users in the DB at all,
 // which if there aren't, the first time user setup needs to be run.
@@ -276,6 +548,11 @@ func cacheUsers(co *core.Core, a *auth.Auth) (bool, error) {
 		return false, err
 	}
 
+	tokens, err := co.GetAPITokens(0)
+	if err != nil {
+		return false, err
+	}
+
 	hasUser := false
 	apiUsers := make([]auth.User, 0, len(users))
 	for _, u := range users {
@@ -288,6 +565,6 @@ func cacheUsers(co *core.Core, a *auth.Auth) (bool, error) {
 		}
 	}
 
-	a.CacheAPIUsers(apiUsers)
+	a.CacheAPIUsers(apiUsers, tokens)
 	return hasUser, nil
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/knadh/listmonk/internal/webhooks"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetWebhooks handles the retrieval of outbound webhooks.
+func (a *App) GetWebhooks(c echo.Context) error {
+	pg := a.pg.NewFromURL(c.Request().URL.Query())
+
+	res, total, err := a.core.GetWebhooks(pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.Webhook{}}})
+	}
+
+	for i := range res {
+		res[i] = maskWebhookSecret(res[i])
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetWebhook handles the retrieval of a webhook.
+func (a *App) GetWebhook(c echo.Context) error {
+	out, err := a.core.GetWebhook(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{maskWebhookSecret(out)})
+}
+
+// GetWebhookEvents returns the list of events that webhooks can subscribe to.
+func (a *App) GetWebhookEvents(c echo.Context) error {
+	return c.JSON(http.StatusOK, okResp{webhooks.Events})
+}
+
+// CreateWebhook handles webhook creation.
+func (a *App) CreateWebhook(c echo.Context) error {
+	var o models.Webhook
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateWebhook(o, true)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.CreateWebhook(o)
+	if err != nil {
+		return err
+	}
+
+	a.reloadWebhooks()
+
+	return c.JSON(http.StatusOK, okResp{maskWebhookSecret(out)})
+}
+
+// UpdateWebhook handles webhook modification.
+func (a *App) UpdateWebhook(c echo.Context) error {
+	var o models.Webhook
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := a.validateWebhook(o, false)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.UpdateWebhook(getID(c), o)
+	if err != nil {
+		return err
+	}
+
+	a.reloadWebhooks()
+
+	return c.JSON(http.StatusOK, okResp{maskWebhookSecret(out)})
+}
+
+// DeleteWebhook handles webhook deletion.
+func (a *App) DeleteWebhook(c echo.Context) error {
+	if err := a.core.DeleteWebhook(getID(c)); err != nil {
+		return err
+	}
+
+	a.reloadWebhooks()
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// GetWebhookDeliveries handles the retrieval of the delivery log of a webhook.
+func (a *App) GetWebhookDeliveries(c echo.Context) error {
+	var (
+		id     = getID(c)
+		status = c.QueryParam("status")
+
+		pg = a.pg.NewFromURL(c.Request().URL.Query())
+	)
+
+	switch status {
+	case "", models.WebhookDeliveryStatusPending, models.WebhookDeliveryStatusSuccess, models.WebhookDeliveryStatusFailed:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+	}
+
+	if _, err := a.core.GetWebhook(id); err != nil {
+		return err
+	}
+
+	res, total, err := a.core.QueryWebhookDeliveries(id, status, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.WebhookDelivery{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// validateWebhook validates webhook fields. A secret is required only when
+// creating a webhook. On updates, an empty secret retains the existing one.
+func (a *App) validateWebhook(o models.Webhook, isNew bool) (models.Webhook, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	o.URL = strings.TrimSpace(o.URL)
+	if u, err := url.Parse(o.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "url"))
+	}
+
+	// The masked secret from the GET response is sent back as-is if it's unchanged.
+	if strings.Trim(o.Secret, pwdMask) == "" {
+		o.Secret = ""
+	}
+	if (isNew || o.Secret != "") && !strHasLen(o.Secret, 16, stdInputMaxLen) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("webhooks.invalidSecret"))
+	}
+
+	if len(o.Events) == 0 {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "events"))
+	}
+	ev := pq.StringArray{}
+	for _, e := range o.Events {
+		if !slices.Contains(webhooks.Events, e) {
+			return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("webhooks.invalidEvent", "name", e))
+		}
+		if !slices.Contains(ev, e) {
+			ev = append(ev, e)
+		}
+	}
+	o.Events = ev
+
+	return o, nil
+}
+
+// reloadWebhooks reloads the events that webhooks are subscribed to.
+func (a *App) reloadWebhooks() {
+	if err := a.webhooks.Load(); err != nil {
+		a.log.Printf("error reloading webhooks: %v", err)
+	}
+}
+
+// maskWebhookSecret masks the secret of a webhook for API responses.
+func maskWebhookSecret(w models.Webhook) models.Webhook {
+	w.Secret = strings.Repeat(pwdMask, utf8.RuneCountInString(w.Secret))
+	return w
+}
@@ -211,6 +211,29 @@ export const updateSubscriber = (data) => http.put(
   { loading: models.subscribers },
 );
 
+// Subscriber attribute schema.
+export const getSubscriberAttribs = async () => http.get(
+  '/api/subscribers/attribs',
+  { loading: models.attribs, store: models.attribs },
+);
+
+export const createSubscriberAttrib = async (data) => http.post(
+  '/api/subscribers/attribs',
+  data,
+  { loading: models.attribs },
+);
+
+export const updateSubscriberAttrib = async (id, data) => http.put(
+  `/api/subscribers/attribs/${id}`,
+  data,
+  { loading: models.attribs },
+);
+
+export const deleteSubscriberAttrib = async (id) => http.delete(
+  `/api/subscribers/attribs/${id}`,
+  { loading: models.attribs },
+);
+
 export const sendSubscriberOptin = (id) => http.post(
   `/api/subscribers/${id}/optin`,
   {},
@@ -261,14 +284,16 @@ export const deleteSubscribersByQuery = (data) => http.post(
 // Subscriber import.
 export const importSubscribers = (data) => http.post('/api/import/subscribers', data);
 
-export const getImportStatus = () => http.get('/api/import/subscribers');
+export const getImportJobs = (params) => http.get('/api/import/subscribers', { params });
+
+export const getImportJob = (id) => http.get(`/api/import/subscribers/${id}`);
 
-export const getImportLogs = async () => http.get(
-  '/api/import/subscribers/logs',
+export const getImportLogs = async (id) => http.get(
+  `/api/import/subscribers/${id}/logs`,
   { camelCase: false },
 );
 
-export const stopImport = () => http.delete('/api/import/subscribers');
+export const stopImport = (id) => http.delete(`/api/import/subscribers/${id}`);
 
 // Bounces.
 export const getBounces = async (params) => http.get(
@@ -404,6 +429,147 @@ export const deleteTemplate = async (id) => http.delete(
   { loading: models.templates },
 );
 
+// Segments.
+export const getSegments = async (params) => http.get(
+  '/api/segments',
+  { params, loading: models.segments, store: models.segments },
+);
+
+export const getSegment = async (id) => http.get(
+  `/api/segments/${id}`,
+  { loading: models.segments },
+);
+
+export const createSegment = async (data) => http.post(
+  '/api/segments',
+  data,
+  { loading: models.segments },
+);
+
+export const updateSegment = async (id, data) => http.put(
+  `/api/segments/${id}`,
+  data,
+  { loading: models.segments },
+);
+
+export const deleteSegment = async (id) => http.delete(
+  `/api/segments/${id}`,
+  { loading: models.segments },
+);
+
+// Named subscription forms.
+export const getSubscriptionForms = async (params) => http.get(
+  '/api/forms',
+  { params, loading: models.forms, store: models.forms },
+);
+
+export const createSubscriptionForm = async (data) => http.post(
+  '/api/forms',
+  data,
+  { loading: models.forms },
+);
+
+export const updateSubscriptionForm = async (id, data) => http.put(
+  `/api/forms/${id}`,
+  data,
+  { loading: models.forms },
+);
+
+export const deleteSubscriptionForm = async (id) => http.delete(
+  `/api/forms/${id}`,
+  { loading: models.forms },
+);
+
+// Sequences.
+export const getSequences = async (params) => http.get(
+  '/api/sequences',
+  { params, loading: models.sequences, store: models.sequences },
+);
+
+export const getSequence = async (id) => http.get(
+  `/api/sequences/${id}`,
+  { loading: models.sequences },
+);
+
+export const createSequence = async (data) => http.post(
+  '/api/sequences',
+  data,
+  { loading: models.sequences },
+);
+
+export const updateSequence = async (id, data) => http.put(
+  `/api/sequences/${id}`,
+  data,
+  { loading: models.sequences },
+);
+
+export const deleteSequence = async (id) => http.delete(
+  `/api/sequences/${id}`,
+  { loading: models.sequences },
+);
+
+// Recurring campaigns.
+export const getRecurringCampaigns = async (params) => http.get(
+  '/api/recurring-campaigns',
+  { params, loading: models.recurringCampaigns, store: models.recurringCampaigns },
+);
+
+export const createRecurringCampaign = async (data) => http.post(
+  '/api/recurring-campaigns',
+  data,
+  { loading: models.recurringCampaigns },
+);
+
+export const updateRecurringCampaign = async (id, data) => http.put(
+  `/api/recurring-campaigns/${id}`,
+  data,
+  { loading: models.recurringCampaigns },
+);
+
+export const runRecurringCampaign = async (id) => http.put(
+  `/api/recurring-campaigns/${id}/run`,
+  {},
+  { loading: models.recurringCampaigns },
+);
+
+export const deleteRecurringCampaign = async (id) => http.delete(
+  `/api/recurring-campaigns/${id}`,
+  { loading: models.recurringCampaigns },
+);
+
+// Webhooks.
+export const getWebhooks = async (params) => http.get(
+  '/api/webhooks',
+  { params, loading: models.webhooks, store: models.webhooks },
+);
+
+export const getWebhookEvents = async () => http.get(
+  '/api/webhooks/events',
+  { camelCase: false },
+);
+
+export const getWebhookDeliveries = async (id, params) => http.get(
+  `/api/webhooks/${id}/deliveries`,
+  { params, loading: models.webhooks, camelCase: (keyPath) => !keyPath.startsWith('.results.*.payload') },
+);
+
+export const createWebhook = async (data) => http.post(
+  '/api/webhooks',
+  data,
+  { loading: models.webhooks },
+);
+
+export const updateWebhook = async (id, data) => http.put(
+  `/api/webhooks/${id}`,
+  data,
+  { loading: models.webhooks },
+);
+
+export const deleteWebhook = async (id) => http.delete(
+  `/api/webhooks/${id}`,
+  { loading: models.webhooks },
+);
+
 // Settings.
 export const getServerConfig = async () => http.get(
   '/api/config',
@@ -432,6 +598,30 @@ export const getLogs = async () => http.get(
   { loading: models.logs, camelCase: false },
 );
 
+export const getAuditLog = async (params) => http.get(
+  '/api/audit',
+  {
+    params,
+    loading: models.audit,
+    camelCase: (keyPath) => !keyPath.match(/^\.results\.\*\.(before|after|meta)/),
+  },
+);
+
+export const getAbuseEvents = async (params) => http.get(
+  '/api/abuse/events',
+  { params, loading: models.abuse },
+);
+
+export const getRateLimitBlocks = async () => http.get(
+  '/api/abuse/blocks',
+  { loading: models.abuse },
+);
+
+export const deleteRateLimitBlock = async (id) => http.delete(
+  `/api/abuse/blocks/${id}`,
+  { loading: models.abuse },
+);
+
 export const getLang = async (lang) => http.get(
   `/api/lang/${lang}`,
   { loading: models.lang, camelCase: false },
@@ -454,6 +644,11 @@ export const deleteGCSubscriptions = async (beforeDate) => http.delete(
   { loading: models.maintenance, params: { before_date: beforeDate } },
 );
 
+export const deleteGCLogs = async (typ, beforeDate) => http.delete(
+  `/api/maintenance/logs/${typ}`,
+  { loading: models.maintenance, params: { before_date: beforeDate } },
+);
+
 // Users.
 export const getUsers = () => http.get(
   '/api/users',
@@ -504,6 +699,50 @@ export const updateUserProfile = (data) => http.put(
   { loading: models.users, store: models.profile },
 );
 
+export const setupUserTOTP = () => http.post(
+  '/api/profile/2fa',
+  {},
+  { loading: models.users },
+);
+
+export const enableUserTOTP = (code) => http.put(
+  '/api/profile/2fa',
+  { code },
+  { loading: models.users },
+);
+
+export const disableUserTOTP = (code) => http.delete(
+  '/api/profile/2fa',
+  { data: { code }, loading: models.users },
+);
+
+export const regenerateUserRecoveryCodes = (code) => http.put(
+  '/api/profile/2fa/recovery-codes',
+  { code },
+  { loading: models.users },
+);
+
+export const resetUserTOTP = (id) => http.delete(
+  `/api/users/${id}/2fa`,
+  { loading: models.users },
+);
+
+export const getAPITokens = async (id) => http.get(
+  `/api/users/${id}/tokens`,
+  { loading: models.users },
+);
+
+export const createAPIToken = async (id, data) => http.post(
+  `/api/users/${id}/tokens`,
+  data,
+  { loading: models.users },
+);
+
+export const deleteAPIToken = async (id, tokenID) => http.delete(
+  `/api/users/${id}/tokens/${tokenID}`,
+  { loading: models.users },
+);
+
 export const getUserRoles = async () => http.get(
   '/api/roles/users',
   { loading: models.userRoles, store: models.userRoles },
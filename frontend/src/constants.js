@@ -9,8 +9,14 @@ export const models = Object.freeze({
   // context (subscriber counts), which can be slow and expensive.
   listsFull: 'listsFull',
   subscribers: 'subscribers',
+  attribs: 'attribs',
+  segments: 'segments',
+  forms: 'forms',
   campaigns: 'campaigns',
   templates: 'templates',
+  sequences: 'sequences',
+  recurringCampaigns: 'recurringCampaigns',
+  webhooks: 'webhooks',
   media: 'media',
   bounces: 'bounces',
   users: 'users',
@@ -19,6 +25,8 @@ export const models = Object.freeze({
   listRoles: 'listRoles',
   settings: 'settings',
   logs: 'logs',
+  audit: 'audit',
+  abuse: 'abuse',
   maintenance: 'maintenance',
 });
 
@@ -32,6 +40,7 @@ export const uris = Object.freeze({
   previewTemplate: '/api/templates/:id/preview',
   previewRawTemplate: '/api/templates/preview',
   exportSubscribers: '/api/subscribers/export',
+  importRejected: '/api/import/subscribers/:id/rejected',
   errorEvents: '/api/events?type=error',
   base: `${baseURL}/static`,
   root: rootURL,
@@ -53,6 +53,18 @@ const routes = [
     meta: { title: 'globals.terms.bounces', group: 'subscribers' },
     component: () => import('../views/Bounces.vue'),
   },
+  {
+    path: '/subscribers/attribs',
+    name: 'attribs',
+    meta: { title: 'subscribers.attribs', group: 'subscribers' },
+    component: () => import('../views/SubscriberAttribs.vue'),
+  },
+  {
+    path: '/subscribers/segments',
+    name: 'segments',
+    meta: { title: 'globals.terms.segments', group: 'subscribers' },
+    component: () => import('../views/Segments.vue'),
+  },
   {
     path: '/subscribers/lists/:listID',
     name: 'subscribers_list',
@@ -83,6 +95,18 @@ const routes = [
     meta: { title: 'globals.terms.templates', group: 'campaigns' },
     component: () => import('../views/Templates.vue'),
   },
+  {
+    path: '/campaigns/sequences',
+    name: 'sequences',
+    meta: { title: 'globals.terms.sequences', group: 'campaigns' },
+    component: () => import('../views/Sequences.vue'),
+  },
+  {
+    path: '/campaigns/recurring',
+    name: 'recurringCampaigns',
+    meta: { title: 'globals.terms.recurringCampaigns', group: 'campaigns' },
+    component: () => import('../views/RecurringCampaigns.vue'),
+  },
   {
     path: '/campaigns/analytics',
     name: 'campaignAnalytics',
@@ -107,12 +131,30 @@ const routes = [
     meta: { title: 'globals.terms.settings', group: 'settings' },
     component: () => import('../views/Settings.vue'),
   },
+  {
+    path: '/settings/webhooks',
+    name: 'webhooks',
+    meta: { title: 'globals.terms.webhooks', group: 'settings' },
+    component: () => import('../views/Webhooks.vue'),
+  },
   {
     path: '/settings/logs',
     name: 'logs',
     meta: { title: 'logs.title', group: 'settings' },
     component: () => import('../views/Logs.vue'),
   },
+  {
+    path: '/settings/audit',
+    name: 'audit',
+    meta: { title: 'audit.title', group: 'settings' },
+    component: () => import('../views/AuditLog.vue'),
+  },
+  {
+    path: '/settings/abuse',
+    name: 'abuse',
+    meta: { title: 'abuse.title', group: 'settings' },
+    component: () => import('../views/Abuse.vue'),
+  },
   {
     path: '/users',
     name: 'users',
@@ -56,10 +56,14 @@ type Callbacks struct {
 	SetCookie func(cookie *http.Cookie, w any) error
 	GetCookie func(name string, r any) (*http.Cookie, error)
 	GetUser   func(id int) (User, error)
+
+	// TouchAPIToken updates the last used timestamp of an API token.
+	TouchAPIToken func(id int) error
 }
 
 type Auth struct {
-	apiUsers map[string]User
+	apiUsers  map[string]User
+	apiTokens map[string]*APIToken
 	sync.RWMutex
 
 	cfg       Config
@@ -74,6 +78,13 @@ type Auth struct {
 
 var sessPruneInterval = time.Hour * 12
 
+const (
+	// pendingSessionTTL and pendingSessionAttempts limit the time and the number of
+	// attempts a user has to complete the second factor of a login.
+	pendingSessionTTL      = time.Minute * 5
+	pendingSessionAttempts = 5
+)
+
 // New returns an initialize Auth instance.
 func New(cfg Config, db *sql.DB, cb *Callbacks, lo *log.Logger) (*Auth, error) {
 	a := &Auth{
@@ -81,7 +92,8 @@ func New(cfg Config, db *sql.DB, cb *Callbacks, lo *log.Logger) (*Auth, error) {
 		cb:  cb,
 		log: lo,
 
-		apiUsers: map[string]User{},
+		apiUsers:  map[string]User{},
+		apiTokens: map[string]*APIToken{},
 	}
 
 
@@ -113,10 +125,27 @@ func New(cfg Config, db *sql.DB, cb *Callbacks, lo *log.Logger) (*Auth, error) {
 	return a, nil
 }
 
-// CacheAPIUsers caches API users for authenticating requests. It wipes
-// the existing cache every time and is meant for syncing all API users
+// CacheAPIUsers caches API users and their tokens for authenticating requests.
+// It wipes the existing cache every time and is meant for syncing all API users
 // in the database in one shot.
-func (o *Auth) CacheAPIUsers(users []User) {
+func (o *Auth) CacheAPIUsers(users []User, tokens []APIToken) {
+	apiTokens := make(map[string]*APIToken, len(tokens))
+	for _, t := range tokens {
+		t := t
+
+		// IPs are validated when tokens are created. Skip tokens with bad
+		// IPs (if any) rather than let them in from everywhere.
+		nets, err := ParseIPAllowlist(t.IPAllowlist)
+		if err != nil {
+			o.log.Printf("error parsing IP allowlist of API token %d: %v", t.ID, err)
+			continue
+		}
+		t.ipNets = nets
+		t.touched = t.LastUsedAt.Time
+
+		apiTokens[t.TokenHash] = &t
+	}
+
 	o.Lock()
 	defer o.Unlock()
 
@@ -124,6 +153,7 @@ func (o *Auth) CacheAPIUsers(users []User) {
 	for _, u := range users {
 		o.apiUsers[u.Username] = u
 	}
+	o.apiTokens = apiTokens
 }
 
 // CacheAPIUser caches an API user for authenticating requests.
@@ -133,17 +163,52 @@ func (o *Auth) CacheAPIUser(u User) {
 	o.Unlock()
 }
 
-// GetAPIToken validates an API user+token.
-func (o *Auth) GetAPIToken(user string, token string) (User, bool) {
+// GetAPIToken validates an API user+token from the given IP and returns the user
+// with the permissions of the token.
+func (o *Auth) GetAPIToken(user string, token string, ip string) (User, error) {
 	o.RLock()
-	t, ok := o.apiUsers[user]
+	u, ok := o.apiUsers[user]
+	t, hasTok := o.apiTokens[HashAPIToken(token)]
 	o.RUnlock()
 
-	if !ok || subtle.ConstantTimeCompare([]byte(t.Password.String), []byte(token)) != 1 {
-		return User{}, false
+	if !ok {
+		return User{}, errInvalidAPIToken
+	}
+
+	// Legacy API credentials set in the config with a plaintext password.
+	if u.Password.String != "" {
+		if subtle.ConstantTimeCompare([]byte(u.Password.String), []byte(token)) != 1 {
+			return User{}, errInvalidAPIToken
+		}
+		return u, nil
+	}
+
+	if !hasTok || t.UserID != u.ID {
+		return User{}, errInvalidAPIToken
 	}
 
-	return t, true
+	now := time.Now()
+	if err := t.check(ip, now); err != nil {
+		return User{}, err
+	}
+
+	// Record the usage of the token, at most once in a while.
+	o.Lock()
+	touch := now.Sub(t.touched) > apiTokenTouchInterval
+	if touch {
+		t.touched = now
+	}
+	o.Unlock()
+
+	if touch && o.cb.TouchAPIToken != nil {
+		go func(id int) {
+			if err := o.cb.TouchAPIToken(id); err != nil {
+				o.log.Printf("error updating API token usage: %v", err)
+			}
+		}(t.ID)
+	}
+
+	return t.scopeUser(u), nil
 }
 
 // initOIDC initializes the OIDC provider, verifier, and OAuth config.
@@ -308,9 +373,9 @@ func (o *Auth) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
 			}
 
 			// Validate the token.
-			user, ok := o.GetAPIToken(key, token)
-			if !ok {
-				c.Set(UserHTTPCtxKey, echo.NewHTTPError(http.StatusForbidden, "invalid API credentials"))
+			user, err := o.GetAPIToken(key, token, c.RealIP())
+			if err != nil {
+				c.Set(UserHTTPCtxKey, echo.NewHTTPError(http.StatusForbidden, err.Error()))
 				return next(c)
 			}
 
@@ -342,8 +407,9 @@ func (o *Auth) Perm(next echo.HandlerFunc, perms ...string) echo.HandlerFunc {
 			return next(c)
 		}
 
-		// If the current user is a Super Admin user, do no checks.
-		if u.UserRole.ID == SuperAdminRoleID {
+		// If the current user is a Super Admin user, do no checks unless
+		// the user's API token is restricted to specific permissions.
+		if u.UserRole.ID == SuperAdminRoleID && !u.Scoped {
 			return next(c)
 		}
 
@@ -383,6 +449,63 @@ func (o *Auth) SaveSession(u User, oidcToken string, c echo.Context) error {
 	return nil
 }
 
+// SavePendingSession creates a session for a user who has passed the first factor
+// (password or OIDC) of a login, but is yet to pass the second (TOTP). Such a session
+// does not authorize any requests and expires after a few minutes or failed attempts.
+func (o *Auth) SavePendingSession(u User, oidcToken string, c echo.Context) error {
+	sess, err := o.sess.NewSession(c, c)
+	if err != nil {
+		o.log.Printf("error creating login session: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating session")
+	}
+
+	if err := sess.SetMulti(map[string]any{"pending_user_id": u.ID, "pending_at": time.Now().Unix(), "pending_attempts": 0, "pending_oidc_token": oidcToken}); err != nil {
+		o.log.Printf("error setting login session: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating session")
+	}
+
+	return nil
+}
+
+// GetPendingSession returns the pending login session (SavePendingSession) of the
+// request, the ID of its user, and the OIDC token if the first factor was OIDC.
+// Expired sessions are destroyed.
+func (o *Auth) GetPendingSession(c echo.Context) (*simplesessions.Session, int, string, error) {
+	sess, err := o.sess.Acquire(context.TODO(), c, c)
+	if err != nil {
+		return nil, 0, "", echo.NewHTTPError(http.StatusForbidden, "invalid session")
+	}
+
+	vars, err := sess.GetMulti("pending_user_id", "pending_at", "pending_attempts", "pending_oidc_token")
+	if err != nil {
+		return nil, 0, "", echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	userID, err := o.sessStore.Int(vars["pending_user_id"], nil)
+	if err != nil || userID < 1 {
+		return nil, 0, "", echo.NewHTTPError(http.StatusForbidden, "invalid session")
+	}
+
+	at, _ := o.sessStore.Int64(vars["pending_at"], nil)
+	attempts, _ := o.sessStore.Int(vars["pending_attempts"], nil)
+	if time.Since(time.Unix(at, 0)) > pendingSessionTTL || attempts >= pendingSessionAttempts {
+		_ = sess.Destroy()
+		return nil, 0, "", echo.NewHTTPError(http.StatusForbidden, "session expired")
+	}
+
+	oidcToken, _ := o.sessStore.String(vars["pending_oidc_token"], nil)
+
+	return sess, userID, oidcToken, nil
+}
+
+// FailPendingSession records a failed second factor attempt on a pending session.
+func (o *Auth) FailPendingSession(sess *simplesessions.Session) {
+	attempts, _ := o.sessStore.Int(sess.Get("pending_attempts"))
+	if err := sess.Set("pending_attempts", attempts+1); err != nil {
+		o.log.Printf("error updating login session: %v", err)
+	}
+}
+
 // validateSession checks if the cookie session is valid (in the DB) and returns the session and user details.
 func (o *Auth) validateSession(c echo.Context) (*simplesessions.Session, User, error) {
 	// Cookie session.
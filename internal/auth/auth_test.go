@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestAPITokenIPAllowlist(t *testing.T) {
+	const tok = "0123456789abcdef0123456789abcdef"
+
+	a := &Auth{cb: &Callbacks{}, log: log.New(io.Discard, "", 0)}
+	a.CacheAPIUsers([]User{{Base: Base{ID: 1}, Username: "api", Type: UserTypeAPI}},
+		[]APIToken{{ID: 1, UserID: 1, TokenHash: HashAPIToken(tok), IPAllowlist: []string{"10.0.0.1"}}})
+
+	for _, tc := range []struct {
+		name    string
+		proxies []string
+		remote  string
+		xff     string
+		ok      bool
+	}{
+		{"direct", nil, "10.0.0.1:1234", "", true},
+		{"direct not allowed", nil, "203.0.113.1:1234", "", false},
+		{"spoofed xff", nil, "203.0.113.1:1234", "10.0.0.1", false},
+		{"spoofed xff from loopback", nil, "127.0.0.1:1234", "10.0.0.1", false},
+		{"spoofed xff via untrusted proxy", []string{"192.168.1.1"}, "203.0.113.1:1234", "10.0.0.1", false},
+		{"spoofed xff behind trusted proxy", []string{"192.168.1.1"}, "192.168.1.1:1234", "10.0.0.1, 203.0.113.1", false},
+		{"xff via trusted proxy", []string{"192.168.1.0/24"}, "192.168.1.1:1234", "10.0.0.1", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ipx, err := NewIPExtractor(tc.proxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := echo.New()
+			e.IPExtractor = ipx
+
+			req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+			req.RemoteAddr = tc.remote
+			req.Header.Set("Authorization", "token api:"+tok)
+			if tc.xff != "" {
+				req.Header.Set(echo.HeaderXForwardedFor, tc.xff)
+				req.Header.Set(echo.HeaderXRealIP, "10.0.0.1")
+			}
+
+			var out any
+			c := e.NewContext(req, httptest.NewRecorder())
+			if err := a.Middleware(func(c echo.Context) error {
+				out = c.Get(UserHTTPCtxKey)
+				return nil
+			})(c); err != nil {
+				t.Fatal(err)
+			}
+
+			u, ok := out.(User)
+			if ok != tc.ok {
+				t.Fatalf("expected auth ok=%v, got %v (IP %s)", tc.ok, out, c.RealIP())
+			}
+			if ok && u.ID != 1 {
+				t.Errorf("expected user 1, got %d", u.ID)
+			}
+		})
+	}
+}
+
+func TestNewIPExtractorInvalid(t *testing.T) {
+	if _, err := NewIPExtractor([]string{"not-an-ip"}); err == nil {
+		t.Error("expected an error for an invalid proxy IP")
+	}
+}
+
+func TestAPITokenScope(t *testing.T) {
+	listPerms := func() map[int]map[string]struct{} {
+		return map[int]map[string]struct{}{
+			1: {PermListGet: {}, PermListManage: {}},
+			2: {PermListGet: {}},
+		}
+	}
+
+	superAdmin := User{UserRoleID: SuperAdminRoleID}
+	superAdmin.UserRole.ID = SuperAdminRoleID
+
+	// A super admin's token restricted to a permission isn't a super admin.
+	tok := APIToken{ID: 1, Permissions: []string{PermSubscribersGet}}
+	admin := tok.scopeUser(superAdmin)
+	if !admin.HasPerm(PermSubscribersGet) || admin.HasPerm(PermListManageAll) {
+		t.Errorf("expected the super admin token to only have %s", PermSubscribersGet)
+	}
+	if err := admin.HasListPerm(PermTypeManage, 1); err == nil {
+		t.Error("expected the scoped super admin token to not manage lists")
+	}
+	if all, ids := admin.GetPermittedLists(PermTypeGet); all || len(ids) != 0 {
+		t.Errorf("expected the scoped super admin token to get no lists, got %v %v", all, ids)
+	}
+
+	// Without a restriction, the super admin can do everything.
+	admin = (&APIToken{ID: 1}).scopeUser(superAdmin)
+	if err := admin.HasListPerm(PermTypeManage, 1); err != nil {
+		t.Error("expected the super admin to manage lists")
+	}
+	if all, _ := admin.GetPermittedLists(PermTypeGet); !all {
+		t.Error("expected the super admin to get all lists")
+	}
+
+	// Per-list permissions of the list role are restricted to the token's list permissions.
+	user := User{
+		PermissionsMap:     map[string]struct{}{PermSubscribersGet: {}},
+		ListPermissionsMap: listPerms(),
+		GetListIDs:         []int{1, 2},
+		ManageListIDs:      []int{1},
+	}
+	for _, tc := range []struct {
+		perms  []string
+		get    []int
+		manage []int
+	}{
+		{nil, []int{1, 2}, []int{1}},
+		{[]string{PermSubscribersGet}, nil, nil},
+		{[]string{PermSubscribersGet, PermListGet}, []int{1, 2}, nil},
+		{[]string{PermListManage}, nil, []int{1}},
+	} {
+		u := (&APIToken{ID: 1, Permissions: tc.perms}).scopeUser(user)
+
+		_, get := u.GetPermittedLists(PermTypeGet)
+		_, manage := u.GetPermittedLists(PermTypeManage)
+		if fmt.Sprint(get) != fmt.Sprint(tc.get) || fmt.Sprint(manage) != fmt.Sprint(tc.manage) {
+			t.Errorf("%v: expected get %v and manage %v lists, got %v and %v", tc.perms, tc.get, tc.manage, get, manage)
+		}
+
+		if err := u.HasListPerm(PermTypeManage, 1); (err == nil) != (len(tc.manage) > 0) {
+			t.Errorf("%v: unexpected manage permission on list 1: %v", tc.perms, err)
+		}
+	}
+
+	// The user's own permissions are not modified.
+	if len(user.ListPermissionsMap[1]) != 2 || len(user.GetListIDs) != 2 {
+		t.Error("expected the user's list permissions to be unmodified")
+	}
+}
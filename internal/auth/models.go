@@ -57,6 +57,14 @@ const (
 	PermCampaignsGetAnalytics = "campaigns:get_analytics"
 	PermCampaignsManage       = "campaigns:manage"
 	PermCampaignsManageAll    = "campaigns:manage_all"
+	PermSegmentsGet           = "segments:get"
+	PermSegmentsManage        = "segments:manage"
+	PermFormsGet              = "forms:get"
+	PermFormsManage           = "forms:manage"
+	PermSequencesGet          = "sequences:get"
+	PermSequencesManage       = "sequences:manage"
+	PermWebhooksGet           = "webhooks:get"
+	PermWebhooksManage        = "webhooks:manage"
 	PermBouncesGet            = "bounces:get"
 	PermBouncesManage         = "bounces:manage"
 	PermWebhooksPostBounce    = "webhooks:post_bounce"
@@ -71,6 +79,8 @@ const (
 	PermSettingsGet           = "settings:get"
 	PermSettingsManage        = "settings:manage"
 	PermSettingsMaintain      = "settings:maintain"
+	PermSettingsMetrics       = "settings:metrics"
+	PermAuditGet              = "audit:get"
 )
 
 // Base holds common fields shared across models.
@@ -103,11 +113,18 @@ type User struct {
 	UserRolePerms pq.StringArray   `db:"user_role_permissions" json:"-"`
 	ListsPermsRaw *json.RawMessage `db:"list_role_perms" json:"-"`
 
+	// TOTP 2FA.
+	TOTPEnabled        bool           `db:"totp_enabled" json:"totp_enabled"`
+	TOTPSecret         null.String    `db:"totp_secret" json:"-"`
+	TOTPRecoveryCodes  pq.StringArray `db:"totp_recovery_codes" json:"-"`
+	UserRoleRequire2FA bool           `db:"user_role_require_2fa" json:"-"`
+
 	// Non-DB fields filled post-retrieval.
 	UserRole struct {
 		ID          int      `db:"-" json:"id"`
 		Name        string   `db:"-" json:"name"`
 		Permissions []string `db:"-" json:"permissions"`
+		Require2FA  bool     `db:"-" json:"require_2fa"`
 	} `db:"-" json:"user_role"`
 
 	ListRole           *ListRolePermissions        `db:"-" json:"list_role"`
@@ -116,6 +133,11 @@ type User struct {
 	GetListIDs         []int                       `db:"-" json:"-"`
 	ManageListIDs      []int                       `db:"-" json:"-"`
 	HasPassword        bool                        `db:"-" json:"-"`
+
+	// APITokenID is the ID of the API token the request was authenticated with.
+	// Scoped is set if the token restricts the user's permissions.
+	APITokenID int  `db:"-" json:"-"`
+	Scoped     bool `db:"-" json:"-"`
 }
 
 type ListPermission struct {
@@ -136,6 +158,7 @@ type Role struct {
 	Type        string         `db:"type" json:"type"`
 	Name        null.String    `db:"name" json:"name"`
 	Permissions pq.StringArray `db:"permissions" json:"permissions"`
+	Require2FA  bool           `db:"require_2fa" json:"require_2fa"`
 
 	ListID   null.Int         `db:"list_id" json:"-"`
 	ParentID null.Int         `db:"parent_id" json:"-"`
@@ -154,10 +177,16 @@ type ListRole struct {
 	Lists    []ListPermission `db:"-" json:"lists"`
 }
 
+// Needs2FA checks if the user has to verify a TOTP code to log in, either
+// because they've enabled it, or because their role requires it.
+func (u *User) Needs2FA() bool {
+	return u.Type == UserTypeUser && (u.TOTPEnabled || u.UserRoleRequire2FA)
+}
+
 // HasPerm checks if the user has a specific permission.
 func (u *User) HasPerm(perm string) bool {
 	// Short-circuit if the user is the primordial super admin.
-	if u.UserRoleID == SuperAdminRoleID {
+	if u.UserRoleID == SuperAdminRoleID && !u.Scoped {
 		return true
 	}
 
@@ -200,7 +229,7 @@ func (u *User) HasListPerm(types PermType, listIDs ...int) error {
 
 func (u *User) hasListPerm(perm string, listID int) bool {
 	// Short-circuit if the user is the primordial super admin.
-	if u.UserRoleID == SuperAdminRoleID {
+	if u.UserRoleID == SuperAdminRoleID && !u.Scoped {
 		return true
 	}
 
@@ -222,7 +251,7 @@ func (u *User) GetPermittedLists(types PermType) (bool, []int) {
 	}
 
 	// Short-circuit if the user is the primordial super admin.
-	if u.UserRoleID == SuperAdminRoleID {
+	if u.UserRoleID == SuperAdminRoleID && !u.Scoped {
 		return true, nil
 	}
 
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	apiTokenLen       = 32
+	apiTokenPrefixLen = 4
+
+	// apiTokenTouchInterval is the minimum interval between updates of the
+	// last used timestamp of a token in the DB.
+	apiTokenTouchInterval = time.Minute
+)
+
+var (
+	errInvalidAPIToken = errors.New("invalid API credentials")
+	errExpiredAPIToken = errors.New("API token has expired")
+	errAPITokenIP      = errors.New("API token is not allowed from this IP")
+)
+
+// APIToken represents one of the access tokens of an API user. Only the hash of
+// the token is stored. Permissions, if set, restrict the token to a subset of the
+// user's role permissions and IPAllowlist, if set, to the given IPs and CIDR ranges.
+type APIToken struct {
+	ID          int            `db:"id" json:"id"`
+	UserID      int            `db:"user_id" json:"user_id"`
+	Name        string         `db:"name" json:"name"`
+	TokenHash   string         `db:"token_hash" json:"-"`
+	Prefix      string         `db:"token_prefix" json:"prefix"`
+	Permissions pq.StringArray `db:"permissions" json:"permissions"`
+	IPAllowlist pq.StringArray `db:"ip_allowlist" json:"ip_allowlist"`
+	ExpiresAt   null.Time      `db:"expires_at" json:"expires_at"`
+	LastUsedAt  null.Time      `db:"last_used_at" json:"last_used_at"`
+	CreatedAt   null.Time      `db:"created_at" json:"created_at"`
+
+	// The plaintext token that's only available (and shown to the user) on creation.
+	Token string `db:"-" json:"token,omitempty"`
+
+	ipNets  []*net.IPNet
+	touched time.Time
+}
+
+// NewAPIToken generates a new random API token and returns it along with
+// its hash and prefix for storage.
+func NewAPIToken() (string, string, string, error) {
+	tk, err := utils.GenerateRandomString(apiTokenLen)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return tk, HashAPIToken(tk), tk[:apiTokenPrefixLen], nil
+}
+
+// HashAPIToken returns the hash of an API token for storage and lookup.
+func HashAPIToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// ParseIPAllowlist parses a list of IPs and CIDR ranges.
+func ParseIPAllowlist(ips []string) ([]*net.IPNet, error) {
+	out := make([]*net.IPNet, 0, len(ips))
+	for _, s := range ips {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.New("invalid IP: " + s)
+			}
+
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			s = s + "/" + strconv.Itoa(bits)
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.New("invalid CIDR: " + s)
+		}
+		out = append(out, n)
+	}
+
+	return out, nil
+}
+
+// NewIPExtractor returns the extractor of client IPs from HTTP requests that the
+// IP allowlists of tokens are checked against. By default, it's the IP of the
+// connection. If trustedProxies (IPs and CIDR ranges) are set, the client IP is
+// taken from the X-Forwarded-For header, but only the hops added by the trusted
+// proxies are honoured, so clients can't spoof their IP by setting the header.
+func NewIPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	nets, err := ParseIPAllowlist(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, n := range nets {
+		opts = append(opts, echo.TrustIPRange(n))
+	}
+
+	return echo.ExtractIPFromXFFHeader(opts...), nil
+}
+
+// check checks if the token can be used at the given time from the given IP.
+func (t *APIToken) check(ip string, now time.Time) error {
+	if t.ExpiresAt.Valid && !now.Before(t.ExpiresAt.Time) {
+		return errExpiredAPIToken
+	}
+
+	if len(t.ipNets) > 0 {
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return errAPITokenIP
+		}
+
+		for _, n := range t.ipNets {
+			if n.Contains(addr) {
+				return nil
+			}
+		}
+		return errAPITokenIP
+	}
+
+	return nil
+}
+
+// scopeUser returns a copy of the user with the permissions restricted to the
+// token's permissions, if any. The per-list permissions of the user's list role
+// are restricted to the list:get and list:manage permissions of the token.
+func (t *APIToken) scopeUser(u User) User {
+	u.APITokenID = t.ID
+	if len(t.Permissions) == 0 {
+		return u
+	}
+
+	var (
+		perms     = make(map[string]struct{}, len(t.Permissions))
+		listPerms = make(map[string]struct{}, 2)
+	)
+	for _, p := range t.Permissions {
+		if p == PermListGet || p == PermListManage {
+			listPerms[p] = struct{}{}
+			continue
+		}
+
+		// A super admin's role permits everything.
+		if _, ok := u.PermissionsMap[p]; ok || u.UserRole.ID == SuperAdminRoleID {
+			perms[p] = struct{}{}
+		}
+	}
+	u.PermissionsMap = perms
+
+	lists := make(map[int]map[string]struct{}, len(u.ListPermissionsMap))
+	u.GetListIDs, u.ManageListIDs = nil, nil
+	for id, lp := range u.ListPermissionsMap {
+		l := make(map[string]struct{}, len(lp))
+		for p := range lp {
+			if _, ok := listPerms[p]; ok {
+				l[p] = struct{}{}
+			}
+		}
+		if len(l) == 0 {
+			continue
+		}
+		lists[id] = l
+
+		if _, ok := l[PermListGet]; ok {
+			u.GetListIDs = append(u.GetListIDs, id)
+		}
+		if _, ok := l[PermListManage]; ok {
+			u.ManageListIDs = append(u.ManageListIDs, id)
+		}
+	}
+	u.ListPermissionsMap = lists
+	sort.Ints(u.GetListIDs)
+	sort.Ints(u.ManageListIDs)
+	u.Scoped = true
+
+	return u
+}
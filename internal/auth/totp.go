@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP (RFC 6238) parameters compatible with common authenticator apps.
+const (
+	totpDigits    = 6
+	totpPeriod    = 30
+	totpSkew      = 1
+	totpSecretLen = 20
+
+	// NumRecoveryCodes is the number of one-time recovery codes generated for a user.
+	NumRecoveryCodes = 10
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret generates a new random base32 encoded TOTP secret.
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, totpSecretLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return b32.EncodeToString(b), nil
+}
+
+// TOTPURI returns the otpauth:// provisioning URI of a secret that authenticator
+// apps accept (usually as a QR code).
+func TOTPURI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprintf("%d", totpDigits))
+	q.Set("period", fmt.Sprintf("%d", totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// ValidateTOTP checks a code against a secret at the given time, allowing for
+// one period of clock skew on either side. On success, it returns the time step
+// that matched, which callers should record to reject replays of the same code.
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := b32.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil || len(key) == 0 {
+		return 0, false
+	}
+
+	step := t.Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		s := step + int64(i)
+		if hmac.Equal([]byte(totpCode(key, s)), []byte(code)) {
+			return s, true
+		}
+	}
+
+	return 0, false
+}
+
+// NewRecoveryCodes generates a set of one-time recovery codes. The plaintext codes
+// are to be shown to the user once and only their hashes (HashRecoveryCode) stored.
+func NewRecoveryCodes() ([]string, error) {
+	out := make([]string, NumRecoveryCodes)
+	for n := range out {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		s := strings.ToLower(hex.EncodeToString(b))
+		out[n] = s[:5] + "-" + s[5:]
+	}
+
+	return out, nil
+}
+
+// HashRecoveryCode returns the hash of a recovery code for storage and lookup.
+// Dashes, whitespace, and case are ignored.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+
+	h := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(h[:])
+}
+
+// totpCode computes the HOTP (RFC 4226) code of a key for a counter.
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	m := hmac.New(sha1.New, key)
+	m.Write(msg[:])
+	sum := m.Sum(nil)
+
+	// Dynamic truncation.
+	off := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, n%1000000)
+}
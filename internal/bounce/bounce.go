@@ -72,6 +72,8 @@ func New(opt Opt, q *Queries, lo *log.Logger) (*Manager, error) {
 		switch opt.MailboxType {
 		case "pop":
 			m.mailbox = mailbox.NewPOP(opt.Mailbox)
+		case "imap":
+			m.mailbox = mailbox.NewIMAP(opt.Mailbox)
 		default:
 			return nil, errors.New("unknown bounce mailbox type")
 		}
@@ -0,0 +1,211 @@
+package mailbox
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message"
+	"github.com/knadh/listmonk/models"
+)
+
+// dsn represents the delivery status fields of an RFC 3464 delivery status
+// notification or the feedback type of an RFC 5965 ARF complaint report.
+type dsn struct {
+	// Type is the bounce type (hard, soft, complaint) derived from the report.
+	Type string
+
+	Action         string
+	Status         string
+	DiagnosticCode string
+	Recipient      string
+	FeedbackType   string
+}
+
+var (
+	// Enhanced status code (RFC 3463) eg: 5.1.1, 4.2.2.
+	reStatusCode = regexp.MustCompile(`\b([245])\.\d{1,3}\.\d{1,3}\b`)
+
+	// Basic SMTP reply code (RFC 5321) eg: 550, 452.
+	reReplyCode = regexp.MustCompile(`\b([245])\d{2}\b`)
+
+	// Headers that identify auto-replies (out-of-office, vacation responders etc.)
+	autoReplyHeaders = map[string][]string{
+		"Auto-Submitted": {"auto-replied", "auto-generated"},
+		"X-Autoreply":    {"yes", "true"},
+		"X-Autorespond":  nil,
+		"Precedence":     {"auto_reply"},
+	}
+)
+
+// parseDSN walks the given MIME message looking for a multipart/report part. If
+// it's an RFC 3464 delivery-status report, the status fields of the first
+// recipient are returned. If it's an RFC 5965 feedback-report (ARF), the report
+// is returned as a complaint. If there's no report, nil is returned.
+func parseDSN(m *message.Entity) *dsn {
+	var (
+		out   *dsn
+		isARF bool
+	)
+
+	_ = m.Walk(func(_ []int, e *message.Entity, err error) error {
+		if err != nil || out != nil {
+			return nil
+		}
+
+		ct, params, _ := e.Header.ContentType()
+		switch ct {
+		case "multipart/report":
+			// ARF complaint (RFC 5965).
+			if strings.EqualFold(params["report-type"], "feedback-report") {
+				isARF = true
+			}
+
+		case "message/feedback-report":
+			d := &dsn{Type: models.BounceTypeComplaint}
+			if f, err := readFieldBlocks(e.Body); err == nil && len(f) > 0 {
+				d.FeedbackType = strings.TrimSpace(f[0].Get("Feedback-Type"))
+				d.Recipient = parseRecipient(f[0].Get("Original-Rcpt-To"))
+			}
+			out = d
+
+		case "message/delivery-status", "message/global-delivery-status":
+			f, err := readFieldBlocks(e.Body)
+			if err != nil || len(f) < 2 {
+				return nil
+			}
+
+			// The first block has the per-message fields and the subsequent
+			// blocks have per-recipient fields. Only the first recipient is considered.
+			r := f[1]
+			d := &dsn{
+				Action:         strings.ToLower(strings.TrimSpace(r.Get("Action"))),
+				Status:         strings.TrimSpace(r.Get("Status")),
+				DiagnosticCode: strings.TrimSpace(r.Get("Diagnostic-Code")),
+				Recipient:      parseRecipient(r.Get("Final-Recipient")),
+			}
+			if d.Recipient == "" {
+				d.Recipient = parseRecipient(r.Get("Original-Recipient"))
+			}
+			d.Type = d.bounceType()
+			out = d
+		}
+
+		return nil
+	})
+
+	// An ARF report without a parseable feedback-report part.
+	if out == nil && isARF {
+		out = &dsn{Type: models.BounceTypeComplaint}
+	}
+
+	return out
+}
+
+// bounceType returns the bounce type for the delivery status. 5.x.x statuses
+// are permanent failures (hard) and 4.x.x are transient failures (soft).
+// An empty string is returned if the report isn't a failure at all
+// (eg: delivered, relayed).
+func (d *dsn) bounceType() string {
+	switch d.Action {
+	case "delivered", "relayed", "expanded":
+		return ""
+	case "delayed":
+		return models.BounceTypeSoft
+	}
+
+	// Status is mandatory in a DSN, but some MTAs only put the code in the diagnostic code.
+	class := ""
+	if m := reStatusCode.FindStringSubmatch(d.Status); m != nil {
+		class = m[1]
+	} else if m := reStatusCode.FindStringSubmatch(d.DiagnosticCode); m != nil {
+		class = m[1]
+	} else if m := reReplyCode.FindStringSubmatch(d.DiagnosticCode); m != nil {
+		class = m[1]
+	}
+
+	switch class {
+	case "5":
+		return models.BounceTypeHard
+	case "4":
+		return models.BounceTypeSoft
+	case "2":
+		return ""
+	}
+
+	// A failure without a parseable status.
+	if d.Action == "failed" {
+		return models.BounceTypeHard
+	}
+
+	return models.BounceTypeSoft
+}
+
+// isAutoReply checks whether the given message headers indicate an automatic
+// reply such as an out-of-office message.
+func isAutoReply(h message.Header) bool {
+	for k, vals := range autoReplyHeaders {
+		v := strings.ToLower(strings.TrimSpace(h.Get(k)))
+		if v == "" {
+			continue
+		}
+
+		// The presence of the header is enough.
+		if vals == nil {
+			return true
+		}
+
+		for _, a := range vals {
+			if v == a {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// readFieldBlocks reads blank line separated blocks of "Name: value" fields as
+// found in message/delivery-status and message/feedback-report bodies.
+func readFieldBlocks(r io.Reader) ([]textproto.MIMEHeader, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Normalize line endings and ensure there is a trailing blank line for the reader.
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	b = append(bytes.TrimSpace(b), '\n', '\n')
+
+	var (
+		tp  = textproto.NewReader(bufio.NewReader(bytes.NewReader(b)))
+		out []textproto.MIMEHeader
+	)
+	for {
+		h, err := tp.ReadMIMEHeader()
+		if len(h) > 0 {
+			out = append(out, h)
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return out, err
+		}
+	}
+
+	return out, nil
+}
+
+// parseRecipient returns the e-mail address from a recipient DSN field
+// of the form "rfc822; user@domain.com".
+func parseRecipient(s string) string {
+	if _, addr, ok := strings.Cut(s, ";"); ok {
+		s = addr
+	}
+
+	return strings.Trim(strings.TrimSpace(s), "<>")
+}
@@ -0,0 +1,251 @@
+package mailbox
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/knadh/listmonk/models"
+)
+
+const testSubUUID = "5a8e3a6c-5f3e-4c7b-9d3f-2b1f0e6a9c11"
+
+// A Postfix RFC 3464 delivery status notification for a non-existent mailbox.
+const dsnHard = `Return-Path: <>
+Date: Mon, 13 Jan 2025 10:15:02 +0000 (UTC)
+From: MAILER-DAEMON@mail.example.com (Mail Delivery System)
+Subject: Undelivered Mail Returned to Sender
+To: bounces@listmonk.example.com
+Auto-Submitted: auto-replied
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status;
+	boundary="8A3C0E1F2B.1736763302/mail.example.com"
+Message-Id: <20250113101502.9D1E21F2B@mail.example.com>
+
+This is a MIME-encapsulated message.
+
+--8A3C0E1F2B.1736763302/mail.example.com
+Content-Description: Notification
+Content-Type: text/plain; charset=us-ascii
+
+This is the mail system at host mail.example.com.
+
+I'm sorry to have to inform you that your message could not
+be delivered to one or more recipients.
+
+<nobody@example.org>: host mx.example.org[192.0.2.10] said: 550 5.1.1
+    <nobody@example.org>: Recipient address rejected: User unknown
+
+--8A3C0E1F2B.1736763302/mail.example.com
+Content-Description: Delivery report
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mail.example.com
+X-Postfix-Queue-ID: 8A3C0E1F2B
+X-Postfix-Sender: rfc822; bounces@listmonk.example.com
+Arrival-Date: Mon, 13 Jan 2025 10:15:01 +0000 (UTC)
+
+Final-Recipient: rfc822; nobody@example.org
+Original-Recipient: rfc822;nobody@example.org
+Action: failed
+Status: 5.1.1
+Remote-MTA: dns; mx.example.org
+Diagnostic-Code: smtp; 550 5.1.1 <nobody@example.org>: Recipient address
+    rejected: User unknown
+
+--8A3C0E1F2B.1736763302/mail.example.com
+Content-Description: Undelivered Message Headers
+Content-Type: text/rfc822-headers
+
+From: Newsletter <news@listmonk.example.com>
+To: nobody@example.org
+Subject: Monthly newsletter
+X-Listmonk-Subscriber: ` + testSubUUID + `
+
+--8A3C0E1F2B.1736763302/mail.example.com--
+`
+
+// An RFC 3464 delivery status notification for a full mailbox where delivery
+// is being retried.
+const dsnSoft = `Date: Mon, 13 Jan 2025 14:20:11 +0000
+From: Mail Delivery Subsystem <MAILER-DAEMON@mail.example.com>
+Subject: Warning: message delayed
+To: bounces@listmonk.example.com
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+The mailbox of the recipient is full. Delivery will be retried.
+
+--b1
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mail.example.com
+
+Final-Recipient: rfc822; Full@Example.org
+Action: delayed
+Status: 4.2.2
+Diagnostic-Code: smtp; 452 4.2.2 Mailbox full
+Will-Retry-Until: Fri, 17 Jan 2025 14:20:11 +0000
+
+--b1--
+`
+
+// A successful delivery notification.
+const dsnDelivered = `Date: Mon, 13 Jan 2025 14:20:11 +0000
+From: MAILER-DAEMON@mail.example.com
+Subject: Successful Mail Delivery Report
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status; boundary="b2"
+
+--b2
+Content-Type: text/plain
+
+Your message was successfully delivered.
+
+--b2
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mail.example.com
+
+Final-Recipient: rfc822; user@example.org
+Action: delivered
+Status: 2.0.0
+
+--b2--
+`
+
+// An RFC 5965 ARF abuse report from a feedback loop.
+const arfComplaint = `Date: Tue, 14 Jan 2025 08:01:44 +0000
+From: <abuse@isp.example.net>
+Subject: FW: Monthly newsletter
+To: <fbl@listmonk.example.com>
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=feedback-report;
+     boundary="part1_13d.2e68ed54_boundary"
+
+--part1_13d.2e68ed54_boundary
+Content-Type: text/plain; charset="US-ASCII"
+Content-Transfer-Encoding: 7bit
+
+This is an email abuse report for an email message received from IP
+192.0.2.25 on Tue, 14 Jan 2025 07:58:02 +0000.
+
+--part1_13d.2e68ed54_boundary
+Content-Type: message/feedback-report
+
+Feedback-Type: abuse
+User-Agent: SomeGenerator/1.0
+Version: 1
+Original-Mail-From: <bounces@listmonk.example.com>
+Original-Rcpt-To: <complainer@isp.example.net>
+Arrival-Date: Tue, 14 Jan 2025 07:58:02 +0000
+Source-IP: 192.0.2.25
+
+--part1_13d.2e68ed54_boundary
+Content-Type: message/rfc822
+Content-Disposition: inline
+
+From: Newsletter <news@listmonk.example.com>
+To: complainer@isp.example.net
+Subject: Monthly newsletter
+X-Listmonk-Subscriber: ` + testSubUUID + `
+
+Hello!
+
+--part1_13d.2e68ed54_boundary--
+`
+
+// An out-of-office reply.
+const autoReply = `Date: Mon, 13 Jan 2025 10:16:00 +0000
+From: Someone <someone@example.org>
+To: news@listmonk.example.com
+Subject: Out of office: Monthly newsletter
+Auto-Submitted: auto-replied
+X-Autoreply: yes
+Content-Type: text/plain
+
+I'm out of the office until next week.
+`
+
+func TestParseBounceDSN(t *testing.T) {
+	cases := []struct {
+		name     string
+		msg      string
+		ok       bool
+		typ      string
+		status   string
+		feedback string
+		email    string
+		subUUID  string
+	}{
+		{name: "hard", msg: dsnHard, ok: true, typ: models.BounceTypeHard, status: "5.1.1", subUUID: testSubUUID},
+		{name: "soft", msg: dsnSoft, ok: true, typ: models.BounceTypeSoft, status: "4.2.2", email: "full@example.org"},
+		{name: "delivered", msg: dsnDelivered, ok: false},
+		{name: "complaint", msg: arfComplaint, ok: true, typ: models.BounceTypeComplaint, feedback: "abuse", subUUID: testSubUUID},
+		{name: "auto-reply", msg: autoReply, ok: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b, ok, err := parseBounce([]byte(strings.ReplaceAll(c.msg, "\n", "\r\n")), "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != c.ok {
+				t.Fatalf("expected ok=%v, got %v", c.ok, ok)
+			}
+			if !ok {
+				return
+			}
+
+			if b.Type != c.typ {
+				t.Errorf("expected type %s, got %s", c.typ, b.Type)
+			}
+			if b.SubscriberUUID != c.subUUID {
+				t.Errorf("expected subscriber UUID %q, got %q", c.subUUID, b.SubscriberUUID)
+			}
+			if b.Email != c.email {
+				t.Errorf("expected e-mail %q, got %q", c.email, b.Email)
+			}
+
+			var meta struct {
+				Status       string `json:"status"`
+				FeedbackType string `json:"feedback_type"`
+			}
+			if err := json.Unmarshal(b.Meta, &meta); err != nil {
+				t.Fatal(err)
+			}
+			if meta.Status != c.status {
+				t.Errorf("expected status %q, got %q", c.status, meta.Status)
+			}
+			if meta.FeedbackType != c.feedback {
+				t.Errorf("expected feedback type %q, got %q", c.feedback, meta.FeedbackType)
+			}
+		})
+	}
+}
+
+func TestDSNBounceType(t *testing.T) {
+	cases := []struct {
+		d   dsn
+		typ string
+	}{
+		{dsn{Action: "failed", Status: "5.7.1"}, models.BounceTypeHard},
+		{dsn{Action: "failed", Status: "4.4.7"}, models.BounceTypeSoft},
+		{dsn{Action: "delayed", Status: "5.0.0"}, models.BounceTypeSoft},
+		{dsn{Action: "relayed", Status: "2.0.0"}, ""},
+		{dsn{Action: "failed", DiagnosticCode: "smtp; 554 5.7.1 Message rejected"}, models.BounceTypeHard},
+		{dsn{Action: "failed", DiagnosticCode: "smtp; 421 Try again later"}, models.BounceTypeSoft},
+		{dsn{Action: "failed"}, models.BounceTypeHard},
+		{dsn{}, models.BounceTypeSoft},
+	}
+
+	for _, c := range cases {
+		if typ := c.d.bounceType(); typ != c.typ {
+			t.Errorf("%+v: expected %q, got %q", c.d, c.typ, typ)
+		}
+	}
+}
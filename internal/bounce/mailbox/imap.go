@@ -0,0 +1,168 @@
+package mailbox
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+
+	"github.com/emersion/go-imap"
+	imapclient "github.com/emersion/go-imap/client"
+	"github.com/knadh/listmonk/models"
+)
+
+const (
+	defaultIMAPFolder        = "INBOX"
+	defaultIMAPArchiveFolder = "listmonk-bounces"
+)
+
+// IMAP represents an IMAP mailbox.
+type IMAP struct {
+	opt Opt
+}
+
+// NewIMAP returns a new instance of the IMAP mailbox client.
+func NewIMAP(opt Opt) *IMAP {
+	if opt.Folder == "" {
+		opt.Folder = defaultIMAPFolder
+	}
+	if opt.ArchiveFolder == "" {
+		opt.ArchiveFolder = defaultIMAPArchiveFolder
+	}
+
+	return &IMAP{opt: opt}
+}
+
+// Scan scans the configured IMAP folder and pushes the downloaded messages into
+// the given channel. Unlike POP, the messages that are processed are not deleted,
+// but moved to the archive folder. If limit > 0, only that many messages are
+// processed in a single scan.
+func (m *IMAP) Scan(limit int, ch chan models.Bounce) error {
+	c, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	// Create the archive folder. It may already exist, in which case the
+	// server returns an error that can be ignored.
+	_ = c.Create(m.opt.ArchiveFolder)
+
+	// Select the folder to scan.
+	box, err := c.Select(m.opt.Folder, false)
+	if err != nil {
+		return fmt.Errorf("error selecting IMAP folder %s: %v", m.opt.Folder, err)
+	}
+
+	// No messages.
+	if box.Messages == 0 {
+		return nil
+	}
+
+	// Get all messages that are not already marked for deletion.
+	crit := imap.NewSearchCriteria()
+	crit.WithoutFlags = []string{imap.DeletedFlag}
+	uids, err := c.UidSearch(crit)
+	if err != nil {
+		return err
+	}
+	if len(uids) == 0 {
+		return nil
+	}
+
+	if limit > 0 && len(uids) > limit {
+		uids = uids[:limit]
+	}
+
+	var (
+		set  = new(imap.SeqSet)
+		sect = &imap.BodySectionName{Peek: true}
+	)
+	set.AddNum(uids...)
+
+	// Download messages.
+	var (
+		msgs = make(chan *imap.Message, 10)
+		done = make(chan error, 1)
+	)
+	go func() {
+		done <- c.UidFetch(set, []imap.FetchItem{imap.FetchUid, sect.FetchItem()}, msgs)
+	}()
+
+	processed := new(imap.SeqSet)
+	for msg := range msgs {
+		r := msg.GetBody(sect)
+		if r == nil {
+			continue
+		}
+
+		// Retrieve the raw bytes of the message.
+		b, err := io.ReadAll(r)
+		if err != nil {
+			continue
+		}
+
+		// Parse the bounce e-mail. Messages that can't be parsed are archived as well.
+		// If they're left in the folder, they're re-read on every scan and eventually
+		// fill up the limit, starving the real bounces behind them.
+		processed.AddNum(msg.Uid)
+		bn, ok, err := parseBounce(b, m.opt.Host)
+		if err != nil {
+			continue
+		}
+
+		// Not a bounce (eg: an auto-reply). Archive it without recording.
+		if !ok {
+			continue
+		}
+
+		select {
+		case ch <- bn:
+		default:
+		}
+	}
+	if err := <-done; err != nil {
+		return err
+	}
+
+	if processed.Empty() {
+		return nil
+	}
+
+	// Move the processed messages to the archive folder.
+	if err := c.UidMove(processed, m.opt.ArchiveFolder); err != nil {
+		return fmt.Errorf("error moving messages to IMAP folder %s: %v", m.opt.ArchiveFolder, err)
+	}
+
+	return nil
+}
+
+// connect connects to the IMAP server and authenticates.
+func (m *IMAP) connect() (*imapclient.Client, error) {
+	var (
+		addr = fmt.Sprintf("%s:%d", m.opt.Host, m.opt.Port)
+
+		c   *imapclient.Client
+		err error
+	)
+	if m.opt.TLSEnabled {
+		c, err = imapclient.DialTLS(addr, &tls.Config{
+			ServerName:         m.opt.Host,
+			InsecureSkipVerify: m.opt.TLSSkipVerify,
+		})
+	} else {
+		c, err = imapclient.Dial(addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Authenticate.
+	if m.opt.AuthProtocol != "none" {
+		if err := c.Login(m.opt.Username, m.opt.Password); err != nil {
+			c.Logout()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,143 @@
+package mailbox
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/knadh/listmonk/models"
+)
+
+// moveBackend wraps the in-memory IMAP backend with support for MOVE.
+type moveBackend struct {
+	*memory.Backend
+}
+
+type moveUser struct {
+	backend.User
+}
+
+type moveMailbox struct {
+	backend.Mailbox
+}
+
+func (b moveBackend) Login(ci *imap.ConnInfo, username, password string) (backend.User, error) {
+	u, err := b.Backend.Login(ci, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return moveUser{u}, nil
+}
+
+func (u moveUser) GetMailbox(name string) (backend.Mailbox, error) {
+	mb, err := u.User.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	return moveMailbox{mb}, nil
+}
+
+func (m moveMailbox) MoveMessages(uid bool, set *imap.SeqSet, dest string) error {
+	if err := m.CopyMessages(uid, set, dest); err != nil {
+		return err
+	}
+	if err := m.UpdateMessagesFlags(uid, set, imap.AddFlags, []string{imap.DeletedFlag}); err != nil {
+		return err
+	}
+	return m.Expunge()
+}
+
+func TestIMAPScanArchivesUnparseable(t *testing.T) {
+	const (
+		limit  = 5
+		numBad = limit * 2
+	)
+
+	be := memory.New()
+	u, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mb, err := u.GetMailbox(defaultIMAPFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mb.(*memory.Mailbox).Messages = nil
+
+	// Unparseable messages ahead of the real bounces, more than the scan limit.
+	for i := range numBad {
+		// A multipart message that's missing its closing boundary.
+		b := fmt.Sprintf("Subject: Broken %d\r\n"+
+			"Content-Type: multipart/mixed; boundary=xyz\r\n"+
+			"\r\n"+
+			"--xyz\r\n"+
+			"Content-Type: text/plain\r\n"+
+			"\r\n"+
+			"part", i)
+		if err := mb.CreateMessage(nil, time.Now(), bytes.NewReader([]byte(b))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subUUIDs := []string{"5a8e3a6c-5f3e-4c7b-9d3f-2b1f0e6a9c11", "6b9f4b7d-6a4f-4d8c-8e4a-3c2a1f7b0d22"}
+	for _, uu := range subUUIDs {
+		b := "From: mailer-daemon@example.com\r\n" +
+			"Subject: Undelivered mail\r\n" +
+			models.EmailHeaderSubscriberUUID + ": " + uu + "\r\n" +
+			"\r\n" +
+			"The message could not be delivered."
+		if err := mb.CreateMessage(nil, time.Now(), bytes.NewReader([]byte(b))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := server.New(moveBackend{be})
+	srv.AllowInsecureAuth = true
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	m := NewIMAP(Opt{
+		Host:         "127.0.0.1",
+		Port:         ln.Addr().(*net.TCPAddr).Port,
+		AuthProtocol: "login",
+		Username:     "username",
+		Password:     "password",
+	})
+
+	// Every scan should make progress until the real bounces are processed.
+	ch := make(chan models.Bounce, len(subUUIDs))
+	for range numBad/limit + 1 {
+		if err := m.Scan(limit, ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(ch) != len(subUUIDs) {
+		t.Fatalf("expected %d bounces, got %d", len(subUUIDs), len(ch))
+	}
+	for _, uu := range subUUIDs {
+		if b := <-ch; b.SubscriberUUID != uu {
+			t.Errorf("expected bounce for %s, got %s", uu, b.SubscriberUUID)
+		}
+	}
+
+	if n := len(mb.(*memory.Mailbox).Messages); n != 0 {
+		t.Errorf("expected the scanned folder to be empty, got %d messages", n)
+	}
+	archive, err := u.GetMailbox(defaultIMAPArchiveFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(archive.(*memory.Mailbox).Messages); n != numBad+len(subUUIDs) {
+		t.Errorf("expected %d archived messages, got %d", numBad+len(subUUIDs), n)
+	}
+}
@@ -21,6 +21,10 @@ type Opt struct {
 	// Folder is the name of the IMAP folder to scan for e-mails.
 	Folder string `json:"folder"`
 
+	// ArchiveFolder is the name of the IMAP folder to which processed e-mails
+	// are moved.
+	ArchiveFolder string `json:"archive_folder"`
+
 	// Optional TLS settings.
 	TLSEnabled    bool `json:"tls_enabled"`
 	TLSSkipVerify bool `json:"tls_skip_verify"`
@@ -0,0 +1,156 @@
+package mailbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message"
+	_ "github.com/emersion/go-message/charset"
+	"github.com/knadh/listmonk/models"
+)
+
+type bounceHeaders struct {
+	Header string
+	Regexp *regexp.Regexp
+}
+
+var (
+	// List of header to look for in the e-mail body, regexp to fall back to if the header is empty.
+	headerLookups = []bounceHeaders{
+		{models.EmailHeaderCampaignUUID, regexp.MustCompile(`(?m)(?:^` + models.EmailHeaderCampaignUUID + `:\s+?)([a-z0-9\-]{36})`)},
+		{models.EmailHeaderSubscriberUUID, regexp.MustCompile(`(?m)(?:^` + models.EmailHeaderSubscriberUUID + `:\s+?)([a-z0-9\-]{36})`)},
+		{models.EmailHeaderTxUUID, regexp.MustCompile(`(?m)(?:^` + models.EmailHeaderTxUUID + `:\s+?)([a-z0-9\-]{36})`)},
+		{models.EmailHeaderDate, regexp.MustCompile(`(?m)(?:^` + models.EmailHeaderDate + `:\s+?)([\w,\,\ ,:,+,-]*(?:\(?:\w*\))?)`)},
+		{models.EmailHeaderFrom, regexp.MustCompile(`(?m)(?:^` + models.EmailHeaderFrom + `:\s+?)(.*)`)},
+		{models.EmailHeaderSubject, regexp.MustCompile(`(?m)(?:^` + models.EmailHeaderSubject + `:\s+?)(.*)`)},
+		{models.EmailHeaderMessageId, regexp.MustCompile(`(?m)(?:^` + models.EmailHeaderMessageId + `:\s+?)(.*)`)},
+		{models.EmailHeaderDeliveredTo, regexp.MustCompile(`(?m)(?:^` + models.EmailHeaderDeliveredTo + `:\s+?)(.*)`)},
+	}
+
+	reHdrReceived = regexp.MustCompile(`(?m)(?:^` + models.EmailHeaderReceived + `:\s+?)(.*)`)
+)
+
+// parseBounce parses a raw bounce e-mail and returns a bounce record with the
+// campaign and subscriber UUIDs extracted from the e-mail headers, or from
+// the message body (the original message embedded in the bounce) if the
+// headers are not present. The bounce type is derived from the RFC 3464
+// delivery status report or RFC 5965 complaint report in the message, if any.
+// If the message is not a bounce (eg: an out-of-office auto-reply or a
+// successful delivery report), false is returned.
+func parseBounce(b []byte, source string) (models.Bounce, bool, error) {
+	// Parse the message for a delivery status or a feedback (complaint) report.
+	m, err := message.Read(bytes.NewReader(b))
+	if err != nil {
+		return models.Bounce{}, false, err
+	}
+
+	d := parseDSN(m)
+	if d == nil {
+		// Not a DSN. Ignore automatic replies.
+		if isAutoReply(m.Header) {
+			return models.Bounce{}, false, nil
+		}
+
+		// A non-standard bounce. Record it as hard bounce.
+		d = &dsn{Type: models.BounceTypeHard}
+	} else if d.Type == "" {
+		// A DSN that isn't a failure.
+		return models.Bounce{}, false, nil
+	}
+
+	// Parse the message again to lookup headers.
+	m, err = message.Read(bytes.NewReader(b))
+	if err != nil {
+		return models.Bounce{}, false, err
+	}
+
+	h := m
+
+	// If this is a multipart message, find the last part.
+	if mr := m.MultipartReader(); mr != nil {
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return models.Bounce{}, false, err
+			}
+			h = part
+		}
+	}
+
+	// Lookup headers in the e-mail. If a header isn't found, fall back to regexp lookups.
+	hdr := make(map[string]string, len(headerLookups))
+	for _, l := range headerLookups {
+		v := h.Header.Get(l.Header)
+
+		// Not in the header. Try regexp.
+		if v == "" {
+			if m := l.Regexp.FindAllSubmatch(b, -1); m != nil {
+				v = string(m[len(m)-1][1])
+			}
+		}
+
+		hdr[l.Header] = strings.TrimSpace(v)
+	}
+
+	// Received is a []string header.
+	msgReceived := h.Header.Map()[models.EmailHeaderReceived]
+	if len(msgReceived) == 0 {
+		if u := reHdrReceived.FindAllSubmatch(b, -1); u != nil {
+			for i := 0; i < len(u); i++ {
+				msgReceived = append(msgReceived, string(u[i][1]))
+			}
+		}
+	}
+
+	date, _ := time.Parse("Mon, 02 Jan 2006 15:04:05 -0700", hdr[models.EmailHeaderDate])
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	// Additional bounce e-mail metadata.
+	meta, _ := json.Marshal(struct {
+		From           string   `json:"from"`
+		Subject        string   `json:"subject"`
+		MessageID      string   `json:"message_id"`
+		DeliveredTo    string   `json:"delivered_to"`
+		Received       []string `json:"received"`
+		Action         string   `json:"action,omitempty"`
+		Status         string   `json:"status,omitempty"`
+		DiagnosticCode string   `json:"diagnostic_code,omitempty"`
+		FeedbackType   string   `json:"feedback_type,omitempty"`
+	}{
+		From:           hdr[models.EmailHeaderFrom],
+		Subject:        hdr[models.EmailHeaderSubject],
+		MessageID:      hdr[models.EmailHeaderMessageId],
+		DeliveredTo:    hdr[models.EmailHeaderDeliveredTo],
+		Received:       msgReceived,
+		Action:         d.Action,
+		Status:         d.Status,
+		DiagnosticCode: d.DiagnosticCode,
+		FeedbackType:   d.FeedbackType,
+	})
+
+	out := models.Bounce{
+		Type:           d.Type,
+		CampaignUUID:   hdr[models.EmailHeaderCampaignUUID],
+		SubscriberUUID: hdr[models.EmailHeaderSubscriberUUID],
+		TxUUID:         hdr[models.EmailHeaderTxUUID],
+		Source:         source,
+		CreatedAt:      date,
+		Meta:           meta,
+	}
+
+	// If the subscriber UUID isn't found in the original message, fall back to
+	// the recipient in the delivery status report.
+	if out.SubscriberUUID == "" {
+		out.Email = strings.ToLower(d.Recipient)
+	}
+
+	return out, true, nil
+}
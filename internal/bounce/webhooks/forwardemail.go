@@ -87,6 +87,7 @@ func (p *Forwardemail) ProcessBounce(sigHex string, body []byte) ([]models.Bounc
 	return []models.Bounce{{
 		Email:        strings.ToLower(n.Recipient),
 		CampaignUUID: campUUID,
+		TxUUID:       n.Headers[models.EmailHeaderTxUUID],
 		Type:         typ,
 		Source:       "forwardemail",
 		Meta:         json.RawMessage(body),
@@ -91,6 +91,7 @@ func (p *Postmark) ProcessBounce(b []byte, c echo.Context) ([]models.Bounce, err
 	return []models.Bounce{{
 		Email:        strings.ToLower(n.Email),
 		CampaignUUID: campUUID,
+		TxUUID:       n.Metadata[models.EmailHeaderTxUUID],
 		Type:         typ,
 		Source:       "postmark",
 		Meta:         json.RawMessage(b),
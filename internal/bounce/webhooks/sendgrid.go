@@ -25,6 +25,7 @@ type sendgridNotif struct {
 	// SendGrid flattens all X-headers and adds them to the bounce
 	// event notification.
 	CampaignUUID string `json:"XListmonkCampaign"`
+	TxUUID       string `json:"XListmonkTx"`
 }
 
 // Sendgrid handles Sendgrid/SNS webhook notifications including confirming SNS topic subscription
@@ -74,6 +75,7 @@ func (s *Sendgrid) ProcessBounce(sig, timestamp string, b []byte) ([]models.Boun
 		tstamp := time.Unix(n.Timestamp, 0)
 		bn := models.Bounce{
 			CampaignUUID: n.CampaignUUID,
+			TxUUID:       n.TxUUID,
 			Email:        strings.ToLower(n.Email),
 			Type:         typ,
 			Meta:         json.RawMessage(b),
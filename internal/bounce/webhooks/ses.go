@@ -145,26 +145,23 @@ func (s *SES) ProcessBounce(b []byte) (models.Bounce, error) {
 		typ = models.BounceTypeComplaint
 	}
 
-	// Look for the campaign ID in headers.
-	campUUID := ""
+	// Look for the campaign and tx message IDs in headers.
+	campUUID, txUUID := "", ""
 	if !m.Mail.HeadersTruncated {
 		for _, h := range m.Mail.Headers {
-			key, ok := h["name"]
-			if !ok || key != models.EmailHeaderCampaignUUID {
-				continue
+			switch h["name"] {
+			case models.EmailHeaderCampaignUUID:
+				campUUID = h["value"]
+			case models.EmailHeaderTxUUID:
+				txUUID = h["value"]
 			}
-
-			campUUID, ok = h["value"]
-			if !ok {
-				continue
-			}
-			break
 		}
 	}
 
 	return models.Bounce{
 		Email:        strings.ToLower(m.Mail.Destination[0]),
 		CampaignUUID: campUUID,
+		TxUUID:       txUUID,
 		Type:         typ,
 		Source:       "ses",
 		Meta:         json.RawMessage(n.Message),
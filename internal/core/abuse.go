@@ -0,0 +1,56 @@
+package core
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// QueryAbuseEvents retrieves paginated abuse events optionally filtered by type, scope,
+// and the value (IP or domain) of the key. It also returns the total number of matching records.
+func (c *Core) QueryAbuseEvents(typ, scope, value string, offset, limit int) ([]models.AbuseEvent, int, error) {
+	out := []models.AbuseEvent{}
+	if err := c.q.QueryAbuseEvents.Select(&out, typ, scope, value, offset, limit); err != nil {
+		c.log.Printf("error fetching abuse events: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{abuse.events}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetRateLimitBlocks retrieves the active rate limit blocks.
+func (c *Core) GetRateLimitBlocks() ([]models.RateLimitBlock, error) {
+	out := []models.RateLimitBlock{}
+	if err := c.q.GetRateLimitBlocks.Select(&out); err != nil {
+		c.log.Printf("error fetching rate limit blocks: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{abuse.blocks}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// DeleteRateLimitBlock deletes a rate limit block and returns it.
+func (c *Core) DeleteRateLimitBlock(id int) (models.RateLimitBlock, error) {
+	var out models.RateLimitBlock
+	if err := c.q.DeleteRateLimitBlock.Get(&out, id); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{abuse.blocks}"))
+		}
+
+		c.log.Printf("error deleting rate limit block: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{abuse.blocks}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,211 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// LoadAttribSchema loads the subscriber attribute schema from the DB into memory.
+func (c *Core) LoadAttribSchema() error {
+	out := models.AttribSchema{}
+	if err := c.q.GetSubscriberAttribs.Select(&out, 0); err != nil {
+		return err
+	}
+
+	c.attribMut.Lock()
+	c.attribSchema = out
+	c.attribMut.Unlock()
+
+	return nil
+}
+
+// GetSubscriberAttribs retrieves the subscriber attribute schema.
+func (c *Core) GetSubscriberAttribs() (models.AttribSchema, error) {
+	out := models.AttribSchema{}
+	if err := c.q.GetSubscriberAttribs.Select(&out, 0); err != nil {
+		c.log.Printf("error fetching subscriber attributes: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{subscribers.attribs}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetSubscriberAttrib retrieves a subscriber attribute definition.
+func (c *Core) GetSubscriberAttrib(id int) (models.SubscriberAttrib, error) {
+	var out models.SubscriberAttrib
+	if err := c.q.GetSubscriberAttribs.Get(&out, id); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{subscribers.attrib}"))
+		}
+
+		c.log.Printf("error fetching subscriber attribute: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{subscribers.attrib}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// CreateSubscriberAttrib creates a new subscriber attribute definition.
+func (c *Core) CreateSubscriberAttrib(a models.SubscriberAttrib) (models.SubscriberAttrib, error) {
+	var newID int
+	if err := c.q.CreateSubscriberAttrib.Get(&newID, a.Key, a.Name, a.Type, a.Required, a.Enum,
+		nullRawJSON(a.Default), a.Description); err != nil {
+		c.log.Printf("error creating subscriber attribute: %v", err)
+		return models.SubscriberAttrib{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{subscribers.attrib}", "error", pqErrMsg(err)))
+	}
+
+	c.reloadAttribSchema()
+
+	return c.GetSubscriberAttrib(newID)
+}
+
+// UpdateSubscriberAttrib updates a subscriber attribute definition.
+func (c *Core) UpdateSubscriberAttrib(id int, a models.SubscriberAttrib) (models.SubscriberAttrib, error) {
+	res, err := c.q.UpdateSubscriberAttrib.Exec(id, a.Key, a.Name, a.Type, a.Required, a.Enum,
+		nullRawJSON(a.Default), a.Description)
+	if err != nil {
+		c.log.Printf("error updating subscriber attribute: %v", err)
+		return models.SubscriberAttrib{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{subscribers.attrib}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.SubscriberAttrib{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{subscribers.attrib}"))
+	}
+
+	c.reloadAttribSchema()
+
+	return c.GetSubscriberAttrib(id)
+}
+
+// DeleteSubscriberAttrib deletes a subscriber attribute definition. Existing
+// attribute values on subscribers are retained.
+func (c *Core) DeleteSubscriberAttrib(id int) error {
+	res, err := c.q.DeleteSubscriberAttrib.Exec(id)
+	if err != nil {
+		c.log.Printf("error deleting subscriber attribute: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{subscribers.attrib}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{subscribers.attrib}"))
+	}
+
+	c.reloadAttribSchema()
+
+	return nil
+}
+
+// ValidateAttribs validates subscriber attributes against the attribute schema
+// and returns them with values converted to their types and defaults applied.
+func (c *Core) ValidateAttribs(attribs models.JSON) (models.JSON, error) {
+	c.attribMut.RLock()
+	schema := c.attribSchema
+	c.attribMut.RUnlock()
+
+	out, err := schema.Validate(attribs)
+	if err != nil {
+		return nil, c.attribError(schema, err)
+	}
+
+	return out, nil
+}
+
+// validateAttribUpdate validates the attributes of a subscriber update against the
+// attribute schema. Only the attributes that are new or changed from the current
+// attributes of the subscriber, cur, are validated (see AttribSchema.ValidateChanged).
+func (c *Core) validateAttribUpdate(attribs, cur models.JSON) (models.JSON, error) {
+	c.attribMut.RLock()
+	schema := c.attribSchema
+	c.attribMut.RUnlock()
+
+	out, err := schema.ValidateChanged(attribs, cur)
+	if err != nil {
+		return nil, c.attribError(schema, err)
+	}
+
+	return out, nil
+}
+
+// attribError translates an attribute validation error into a human readable error.
+func (c *Core) attribError(schema models.AttribSchema, err error) error {
+	var aErr *models.AttribError
+	if !errors.As(err, &aErr) {
+		return err
+	}
+
+	typ := ""
+	for _, a := range schema {
+		if a.Key == aErr.Key {
+			typ = a.Type
+			break
+		}
+	}
+
+	switch aErr.Reason {
+	case models.AttribErrRequired:
+		return errors.New(c.i18n.Ts("subscribers.attribRequired", "name", aErr.Key))
+	case models.AttribErrType:
+		return errors.New(c.i18n.Ts("subscribers.attribInvalidType", "name", aErr.Key, "type", typ))
+	}
+
+	return errors.New(c.i18n.Ts("subscribers.attribInvalidValue", "name", aErr.Key))
+}
+
+// validateSubAttribs validates a subscriber's attributes and returns an HTTP error
+// if they don't conform to the schema.
+func (c *Core) validateSubAttribs(sub *models.Subscriber) error {
+	out, err := c.ValidateAttribs(sub.Attribs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	sub.Attribs = out
+
+	return nil
+}
+
+// validateSubAttribUpdate validates the attributes of an update to an existing
+// subscriber and returns an HTTP error if the new or changed attributes don't
+// conform to the schema. Subscribers that predate the schema can be updated
+// without their existing attributes having to conform to it.
+func (c *Core) validateSubAttribUpdate(id int, sub *models.Subscriber) error {
+	cur, err := c.GetSubscriber(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	out, err := c.validateAttribUpdate(sub.Attribs, cur.Attribs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	sub.Attribs = out
+
+	return nil
+}
+
+// reloadAttribSchema reloads the cached attribute schema after it's modified.
+func (c *Core) reloadAttribSchema() {
+	if err := c.LoadAttribSchema(); err != nil {
+		c.log.Printf("error reloading subscriber attribute schema: %v", err)
+	}
+}
+
+// nullRawJSON returns nil for empty or null raw JSON so that it's stored as NULL.
+func nullRawJSON(b []byte) any {
+	if len(b) == 0 || string(b) == "null" {
+		return nil
+	}
+
+	return string(b)
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// InsertAuditLog records an entry in the audit log.
+func (c *Core) InsertAuditLog(o models.AuditLog) error {
+	meta := o.Meta
+	if len(meta) == 0 {
+		meta = json.RawMessage("{}")
+	}
+
+	if _, err := c.q.InsertAuditLog.Exec(o.UserID, o.Username, o.Action, o.TargetType, o.TargetID,
+		nullJSON(o.Before), nullJSON(o.After), meta, o.IP); err != nil {
+		c.log.Printf("error recording audit log (%s): %v", o.Action, err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.auditLog}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// QueryAuditLog retrieves paginated audit log entries matching the given filters.
+// It also returns the total number of matching records in the DB.
+func (c *Core) QueryAuditLog(q models.AuditLogQuery, offset, limit int) ([]models.AuditLog, int, error) {
+	out := []models.AuditLog{}
+	if err := c.q.QueryAuditLog.Select(&out, q.UserID, q.TargetType, q.Action, q.TargetID, q.IP,
+		q.From, q.To, offset, limit); err != nil {
+		c.log.Printf("error fetching audit log: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.auditLog}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// nullJSON returns nil for an empty JSON blob so that it's stored as NULL.
+func nullJSON(b json.RawMessage) any {
+	if len(b) == 0 {
+		return nil
+	}
+
+	return b
+}
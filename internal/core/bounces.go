@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
@@ -63,6 +64,14 @@ func (c *Core) RecordBounce(b models.Bounce) error {
 		return echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("globals.messages.invalidData")+": "+b.Type)
 	}
 
+	// Mark the transactional message, if any, as bounced, irrespective of
+	// whether the recipient is a subscriber.
+	if b.TxUUID != "" {
+		if _, err := c.q.BounceTxMessage.Exec(b.TxUUID); err != nil {
+			c.log.Printf("error updating bounced tx message (%s): %v", b.TxUUID, err)
+		}
+	}
+
 	_, err := c.q.RecordBounce.Exec(b.SubscriberUUID,
 		b.Email,
 		b.CampaignUUID,
@@ -81,9 +90,12 @@ func (c *Core) RecordBounce(b models.Bounce) error {
 		}
 
 		c.log.Printf("error recording bounce: %v", err)
+		return err
 	}
 
-	return err
+	c.triggerWebhook(webhooks.EventBounceRecorded, b)
+
+	return nil
 }
 
 // BlocklistBouncedSubscribers blocklists all bounced subscribers.
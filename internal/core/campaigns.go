@@ -7,6 +7,7 @@ import (
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
@@ -160,7 +161,7 @@ func (c *Core) GetArchivedCampaigns(offset, limit int) (models.Campaigns, int, e
 }
 
 // CreateCampaign creates a new campaign.
-func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int) (models.Campaign, error) {
+func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int, variants []models.CampaignVariant) (models.Campaign, error) {
 	uu, err := uuid.NewV4()
 	if err != nil {
 		c.log.Printf("error generating UUID: %v", err)
@@ -191,6 +192,12 @@ func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int)
 		o.ArchiveMeta,
 		pq.Array(mediaIDs),
 		o.BodySource,
+		o.ABTestPercent,
+		o.ABTestMetric,
+		o.ABTestWait,
+		o.SegmentID,
+		o.SendLocalTime,
+		o.SendTimezone,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return models.Campaign{}, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("campaigns.noSubs"))
@@ -201,6 +208,10 @@ func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int)
 			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
 	}
 
+	if err := c.setCampaignVariants(newID, variants); err != nil {
+		return models.Campaign{}, err
+	}
+
 	out, err := c.GetCampaign(newID, "", "")
 	if err != nil {
 		return models.Campaign{}, err
@@ -210,7 +221,7 @@ func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int)
 }
 
 // UpdateCampaign updates a campaign.
-func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs []int, mediaIDs []int) (models.Campaign, error) {
+func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs []int, mediaIDs []int, variants []models.CampaignVariant) (models.Campaign, error) {
 	_, err := c.q.UpdateCampaign.Exec(id,
 		o.Name,
 		o.Subject,
@@ -229,13 +240,23 @@ func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs []int, mediaIDs
 		o.ArchiveTemplateID,
 		o.ArchiveMeta,
 		pq.Array(mediaIDs),
-		o.BodySource)
+		o.BodySource,
+		o.ABTestPercent,
+		o.ABTestMetric,
+		o.ABTestWait,
+		o.SegmentID,
+		o.SendLocalTime,
+		o.SendTimezone)
 	if err != nil {
 		c.log.Printf("error updating campaign: %v", err)
 		return models.Campaign{}, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
 	}
 
+	if err := c.setCampaignVariants(id, variants); err != nil {
+		return models.Campaign{}, err
+	}
+
 	out, err := c.GetCampaign(id, "", "")
 	if err != nil {
 		return models.Campaign{}, err
@@ -244,6 +265,42 @@ func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs []int, mediaIDs
 	return out, nil
 }
 
+// GetCampaignVariants retrieves the A/B test variants of a campaign along with their stats.
+func (c *Core) GetCampaignVariants(id int) ([]models.CampaignVariant, error) {
+	out := []models.CampaignVariant{}
+	if err := c.q.GetCampaignVariants.Select(&out, id); err != nil {
+		c.log.Printf("error fetching campaign variants: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// setCampaignVariants replaces the A/B test variants of a campaign.
+func (c *Core) setCampaignVariants(id int, variants []models.CampaignVariant) error {
+	var (
+		names     = make(pq.StringArray, len(variants))
+		subjects  = make(pq.StringArray, len(variants))
+		bodies    = make(pq.StringArray, len(variants))
+		altBodies = make(pq.StringArray, len(variants))
+	)
+	for i, v := range variants {
+		names[i] = v.Name
+		subjects[i] = v.Subject
+		bodies[i] = v.Body
+		altBodies[i] = v.AltBody.String
+	}
+
+	if _, err := c.q.SetCampaignVariants.Exec(id, names, subjects, bodies, altBodies); err != nil {
+		c.log.Printf("error saving campaign variants: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
 // UpdateCampaignStatus updates a campaign's status, eg: draft to running.
 func (c *Core) UpdateCampaignStatus(id int, status string) (models.Campaign, error) {
 	cm, err := c.GetCampaign(id, "", "")
@@ -296,7 +353,17 @@ func (c *Core) UpdateCampaignStatus(id int, status string) (models.Campaign, err
 			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
 	}
 
+	prevStatus := cm.Status
 	cm.Status = status
+
+	c.triggerWebhook(webhooks.EventCampaignStatus, webhooks.CampaignStatus{
+		ID:             cm.ID,
+		UUID:           cm.UUID,
+		Name:           cm.Name,
+		Status:         status,
+		PreviousStatus: prevStatus,
+	})
+
 	return cm, nil
 }
 
@@ -426,9 +493,45 @@ func (c *Core) RegisterCampaignLinkClick(linkUUID, campUUID, subUUID string) (st
 		return "", echo.NewHTTPError(http.StatusInternalServerError, c.i18n.Ts("public.errorProcessingRequest"))
 	}
 
+	c.triggerWebhook(webhooks.EventLinkClicked, webhooks.LinkClick{
+		URL:            url,
+		LinkUUID:       linkUUID,
+		CampaignUUID:   campUUID,
+		SubscriberUUID: subUUID,
+	})
+
 	return url, nil
 }
 
+// QueryCampaignDeliveries retrieves paginated delivery log entries of a campaign
+// optionally filtered by subscriber ID, e-mail, and status. It also returns the
+// total number of matching records in the DB.
+func (c *Core) QueryCampaignDeliveries(campID, subID int, email, status string, offset, limit int) ([]models.CampaignDelivery, int, error) {
+	out := []models.CampaignDelivery{}
+	if err := c.q.QueryCampaignDeliveries.Select(&out, campID, subID, email, status, offset, limit); err != nil {
+		c.log.Printf("error fetching campaign deliveries: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.deliveries}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// DeleteCampaignDeliveries deletes campaign delivery log entries older than a given date.
+func (c *Core) DeleteCampaignDeliveries(before time.Time) error {
+	if _, err := c.q.DeleteCampaignDeliveries.Exec(before); err != nil {
+		c.log.Printf("error deleting campaign deliveries: %s", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, c.i18n.Ts("public.errorProcessingRequest"))
+	}
+
+	return nil
+}
+
 // DeleteCampaignViews deletes campaign views older than a given date.
 func (c *Core) DeleteCampaignViews(before time.Time) error {
 	if _, err := c.q.DeleteCampaignViews.Exec(before); err != nil {
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/knadh/listmonk/internal/i18n"
@@ -37,6 +38,10 @@ type Core struct {
 	db     *sqlx.DB
 	q      *models.Queries
 	log    *log.Logger
+
+	// Cached subscriber attribute schema.
+	attribSchema models.AttribSchema
+	attribMut    sync.RWMutex
 }
 
 // Constants represents constant config.
@@ -51,7 +56,10 @@ type Constants struct {
 
 // Hooks contains external function hooks that are required by the core package.
 type Hooks struct {
-	SendOptinConfirmation func(models.Subscriber, []int) (int, error)
+	SendOptinConfirmation func(models.Subscriber, []int, int) (int, error)
+
+	// TriggerWebhook queues an event with the given data for outbound webhooks.
+	TriggerWebhook func(event string, data any)
 }
 
 // Opt contains the controllers required to start the core.
@@ -87,6 +95,15 @@ func New(o *Opt, h *Hooks) *Core {
 	}
 }
 
+// triggerWebhook fires an outbound webhook event if the hook is set.
+func (c *Core) triggerWebhook(event string, data any) {
+	if c.h.TriggerWebhook == nil {
+		return
+	}
+
+	c.h.TriggerWebhook(event, data)
+}
+
 // RefreshMatViews refreshes all materialized views.
 func (c *Core) RefreshMatViews(concurrent bool) error {
 	for _, v := range []string{matDashboardCharts, matDashboardCounts, matListSubStats} {
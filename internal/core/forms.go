@@ -0,0 +1,98 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetSubscriptionForms retrieves paginated subscription forms.
+func (c *Core) GetSubscriptionForms(offset, limit int) ([]models.SubscriptionForm, int, error) {
+	out := []models.SubscriptionForm{}
+	if err := c.q.GetSubscriptionForms.Select(&out, 0, "", offset, limit); err != nil {
+		c.log.Printf("error fetching subscription forms: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.forms}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetSubscriptionForm retrieves a subscription form by its ID or UUID.
+func (c *Core) GetSubscriptionForm(id int, uuid string) (models.SubscriptionForm, error) {
+	var out []models.SubscriptionForm
+	if err := c.q.GetSubscriptionForms.Select(&out, id, uuid, 0, 1); err != nil {
+		c.log.Printf("error fetching subscription form: %v", err)
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.form}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.form}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateSubscriptionForm creates a new subscription form.
+func (c *Core) CreateSubscriptionForm(o models.SubscriptionForm) (models.SubscriptionForm, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var newID int
+	if err := c.q.CreateSubscriptionForm.Get(&newID, uu.String(), o.Name, o.Description, o.ListIDs,
+		o.SuccessURL, o.FailureURL, o.OptinTemplateID, o.Captcha); err != nil {
+		c.log.Printf("error creating subscription form: %v", err)
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.form}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetSubscriptionForm(newID, "")
+}
+
+// UpdateSubscriptionForm updates a given subscription form.
+func (c *Core) UpdateSubscriptionForm(id int, o models.SubscriptionForm) (models.SubscriptionForm, error) {
+	res, err := c.q.UpdateSubscriptionForm.Exec(id, o.Name, o.Description, o.ListIDs,
+		o.SuccessURL, o.FailureURL, o.OptinTemplateID, o.Captcha)
+	if err != nil {
+		c.log.Printf("error updating subscription form: %v", err)
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.form}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.form}"))
+	}
+
+	return c.GetSubscriptionForm(id, "")
+}
+
+// DeleteSubscriptionForm deletes a given subscription form.
+func (c *Core) DeleteSubscriptionForm(id int) error {
+	res, err := c.q.DeleteSubscriptionForm.Exec(id)
+	if err != nil {
+		c.log.Printf("error deleting subscription form: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.form}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.form}"))
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gdgvda/cron"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+// GetRecurringCampaigns retrieves paginated recurring campaigns.
+func (c *Core) GetRecurringCampaigns(offset, limit int) ([]models.RecurringCampaign, int, error) {
+	out := []models.RecurringCampaign{}
+	if err := c.q.GetRecurringCampaigns.Select(&out, 0, offset, limit); err != nil {
+		c.log.Printf("error fetching recurring campaigns: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.recurringCampaigns}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetRecurringCampaign retrieves a given recurring campaign.
+func (c *Core) GetRecurringCampaign(id int) (models.RecurringCampaign, error) {
+	var out []models.RecurringCampaign
+	if err := c.q.GetRecurringCampaigns.Select(&out, id, 0, 1); err != nil {
+		c.log.Printf("error fetching recurring campaign: %v", err)
+		return models.RecurringCampaign{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.recurringCampaign}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.RecurringCampaign{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.recurringCampaign}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateRecurringCampaign creates a new recurring campaign and schedules its first run.
+func (c *Core) CreateRecurringCampaign(o models.RecurringCampaign) (models.RecurringCampaign, error) {
+	var newID int
+	if err := c.q.CreateRecurringCampaign.Get(&newID, o.Name, o.CampaignID, o.Type, o.Status, o.Cron, o.FeedURL, nextRecurringRun(o)); err != nil {
+		c.log.Printf("error creating recurring campaign: %v", err)
+		return models.RecurringCampaign{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.recurringCampaign}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetRecurringCampaign(newID)
+}
+
+// UpdateRecurringCampaign updates a given recurring campaign and reschedules its next run.
+func (c *Core) UpdateRecurringCampaign(id int, o models.RecurringCampaign) (models.RecurringCampaign, error) {
+	res, err := c.q.UpdateRecurringCampaign.Exec(id, o.Name, o.CampaignID, o.Type, o.Status, o.Cron, o.FeedURL, nextRecurringRun(o))
+	if err != nil {
+		c.log.Printf("error updating recurring campaign: %v", err)
+		return models.RecurringCampaign{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.recurringCampaign}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.RecurringCampaign{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.recurringCampaign}"))
+	}
+
+	return c.GetRecurringCampaign(id)
+}
+
+// DeleteRecurringCampaign deletes a given recurring campaign. Campaigns that were
+// created by its runs are retained.
+func (c *Core) DeleteRecurringCampaign(id int) error {
+	if _, err := c.q.DeleteRecurringCampaign.Exec(id); err != nil {
+		c.log.Printf("error deleting recurring campaign: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.recurringCampaign}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// RunRecurringCampaign makes an active recurring campaign due so that it runs
+// on the next scan instead of waiting for its schedule.
+func (c *Core) RunRecurringCampaign(id int) (models.RecurringCampaign, error) {
+	res, err := c.q.RunRecurringCampaign.Exec(id)
+	if err != nil {
+		c.log.Printf("error running recurring campaign: %v", err)
+		return models.RecurringCampaign{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.recurringCampaign}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.RecurringCampaign{}, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("recurring.notActive"))
+	}
+
+	return c.GetRecurringCampaign(id)
+}
+
+// nextRecurringRun returns the time of the next run of a recurring campaign
+// as per its cron schedule. Disabled campaigns aren't scheduled.
+func nextRecurringRun(o models.RecurringCampaign) null.Time {
+	if o.Status != models.RecurringStatusActive {
+		return null.Time{}
+	}
+
+	sched, err := cron.ParseStandard(o.Cron)
+	if err != nil {
+		return null.Time{}
+	}
+
+	return null.TimeFrom(sched.Next(time.Now()))
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetSegments retrieves paginated saved segments.
+func (c *Core) GetSegments(offset, limit int) ([]models.Segment, int, error) {
+	out := []models.Segment{}
+	if err := c.q.GetSegments.Select(&out, 0, offset, limit); err != nil {
+		c.log.Printf("error fetching segments: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.segments}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetSegment retrieves a given segment.
+func (c *Core) GetSegment(id int) (models.Segment, error) {
+	var out []models.Segment
+	if err := c.q.GetSegments.Select(&out, id, 0, 1); err != nil {
+		c.log.Printf("error fetching segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.segment}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateSegment validates the segment's query and creates a new segment.
+func (c *Core) CreateSegment(o models.Segment) (models.Segment, error) {
+	if err := c.validateSegmentQuery(o); err != nil {
+		return models.Segment{}, err
+	}
+
+	var newID int
+	if err := c.q.CreateSegment.Get(&newID, o.Name, o.Description, o.ListIDs, o.Query); err != nil {
+		c.log.Printf("error creating segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetSegment(newID)
+}
+
+// UpdateSegment validates the segment's query and updates a given segment.
+func (c *Core) UpdateSegment(id int, o models.Segment) (models.Segment, error) {
+	if err := c.validateSegmentQuery(o); err != nil {
+		return models.Segment{}, err
+	}
+
+	res, err := c.q.UpdateSegment.Exec(id, o.Name, o.Description, o.ListIDs, o.Query)
+	if err != nil {
+		c.log.Printf("error updating segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.segment}"))
+	}
+
+	return c.GetSegment(id)
+}
+
+// DeleteSegment deletes a given segment. Segments that are targeted by
+// campaigns that are yet to finish can't be deleted.
+func (c *Core) DeleteSegment(id int) error {
+	if _, err := c.GetSegment(id); err != nil {
+		return err
+	}
+
+	var delID int
+	if err := c.q.DeleteSegment.Get(&delID, id); err != nil && err != sql.ErrNoRows {
+		c.log.Printf("error deleting segment: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+	if delID == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("segments.cantDeleteInUse"))
+	}
+
+	return nil
+}
+
+// NextCampaignSegmentSubscribers retrieves the next batch of subscribers of a running
+// campaign that targets a segment, applying the segment's lists and SQL expression.
+func (c *Core) NextCampaignSegmentSubscribers(campID int, campType string, lastSubID, maxSubID int, listIDs []int, seg models.Segment, limit int) ([]models.Subscriber, error) {
+	var out []models.Subscriber
+	err := c.db.Select(&out, c.makeSegmentQuery(c.q.NextCampaignSegmentSubscribers, seg.Query),
+		campID, campType, lastSubID, maxSubID, pq.Array(listIDs), limit, seg.ListIDs)
+	return out, err
+}
+
+// UpdateCampaignSegmentCounts updates the to_send count of a campaign that targets
+// a segment to the number of subscribers who match the segment and returns it.
+func (c *Core) UpdateCampaignSegmentCounts(campID int, seg models.Segment) (int, error) {
+	var toSend int
+	err := c.db.Get(&toSend, c.makeSegmentQuery(c.q.UpdateCampaignSegmentCounts, seg.Query), campID, seg.ListIDs)
+	return toSend, err
+}
+
+// validateSegmentQuery checks that the segment's SQL expression only accesses
+// the allowed tables and is readonly by running it in a readonly count query.
+func (c *Core) validateSegmentQuery(o models.Segment) error {
+	if o.Query == "" {
+		return nil
+	}
+
+	listIDs := make([]int, len(o.ListIDs))
+	for i, id := range o.ListIDs {
+		listIDs[i] = int(id)
+	}
+
+	stmt := strings.ReplaceAll(c.q.QuerySubscribers, "%query%", o.Query)
+	stmt = strings.ReplaceAll(stmt, "%order%", "subscribers.id "+SortAsc)
+	if err := validateQueryTables(c.db, stmt, allowedSubQueryTables); err != nil {
+		c.log.Printf("error validating query tables: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("subscribers.errorPreparingQuery", "error", err.Error()))
+	}
+
+	if _, err := c.getSubscriberCount("", o.Query, "", listIDs); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// makeSegmentQuery injects a segment's SQL expression into a raw query.
+func (c *Core) makeSegmentQuery(stmt, queryExp string) string {
+	cond := "TRUE"
+	if queryExp != "" {
+		cond = sanitizeSQLExp(queryExp)
+	}
+
+	return strings.ReplaceAll(stmt, "%query%", cond)
+}
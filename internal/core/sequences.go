@@ -0,0 +1,161 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetSequences retrieves paginated automation sequences along with their steps.
+func (c *Core) GetSequences(offset, limit int) ([]models.Sequence, int, error) {
+	out, err := c.getSequences(0, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetSequence retrieves a given sequence along with its steps.
+func (c *Core) GetSequence(id int) (models.Sequence, error) {
+	out, err := c.getSequences(id, 0, 1)
+	if err != nil {
+		return models.Sequence{}, err
+	}
+
+	if len(out) == 0 {
+		return models.Sequence{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.sequence}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateSequence creates a new sequence and its steps.
+func (c *Core) CreateSequence(o models.Sequence) (models.Sequence, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.Sequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var newID int
+	if err := c.q.CreateSequence.Get(&newID, uu, o.Name, o.ListID, o.Status, o.FromEmail, o.Messenger, o.TemplateID.Int, o.Headers); err != nil {
+		c.log.Printf("error creating sequence: %v", err)
+		return models.Sequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.sequence}", "error", pqErrMsg(err)))
+	}
+
+	if err := c.setSequenceSteps(newID, o.Steps); err != nil {
+		return models.Sequence{}, err
+	}
+
+	return c.GetSequence(newID)
+}
+
+// UpdateSequence updates a given sequence and replaces its steps.
+func (c *Core) UpdateSequence(id int, o models.Sequence) (models.Sequence, error) {
+	res, err := c.q.UpdateSequence.Exec(id, o.Name, o.ListID, o.Status, o.FromEmail, o.Messenger, o.TemplateID.Int, o.Headers)
+	if err != nil {
+		c.log.Printf("error updating sequence: %v", err)
+		return models.Sequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.sequence}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.Sequence{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.sequence}"))
+	}
+
+	if err := c.setSequenceSteps(id, o.Steps); err != nil {
+		return models.Sequence{}, err
+	}
+
+	return c.GetSequence(id)
+}
+
+// DeleteSequence deletes a given sequence.
+func (c *Core) DeleteSequence(id int) error {
+	if _, err := c.q.DeleteSequence.Exec(id); err != nil {
+		c.log.Printf("error deleting sequence: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.sequence}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// getSequences retrieves sequences and attaches their steps to them.
+func (c *Core) getSequences(id, offset, limit int) ([]models.Sequence, error) {
+	out := []models.Sequence{}
+	if err := c.q.GetSequences.Select(&out, id, offset, limit); err != nil {
+		c.log.Printf("error fetching sequences: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.sequences}", "error", pqErrMsg(err)))
+	}
+	if len(out) == 0 {
+		return out, nil
+	}
+
+	ids := make([]int, len(out))
+	for i, s := range out {
+		ids[i] = s.ID
+	}
+
+	var steps []models.SequenceStep
+	if err := c.q.GetSequenceSteps.Select(&steps, pq.Array(ids)); err != nil {
+		c.log.Printf("error fetching sequence steps: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.sequences}", "error", pqErrMsg(err)))
+	}
+
+	// Attach the steps to their sequences.
+	idx := make(map[int]int, len(out))
+	for i, s := range out {
+		idx[s.ID] = i
+		out[i].Steps = []models.SequenceStep{}
+	}
+	for _, st := range steps {
+		if i, ok := idx[st.SequenceID]; ok {
+			out[i].Steps = append(out[i].Steps, st)
+		}
+	}
+
+	return out, nil
+}
+
+// setSequenceSteps upserts the steps of a sequence in the given order and
+// deletes the ones beyond the number of given steps.
+func (c *Core) setSequenceSteps(id int, steps []models.SequenceStep) error {
+	var (
+		delays    = make(pq.Int64Array, len(steps))
+		subjects  = make(pq.StringArray, len(steps))
+		bodies    = make(pq.StringArray, len(steps))
+		altBodies = make(pq.StringArray, len(steps))
+		types     = make(pq.StringArray, len(steps))
+	)
+	for i, s := range steps {
+		delays[i] = int64(s.DelayHours)
+		subjects[i] = s.Subject
+		bodies[i] = s.Body
+		altBodies[i] = s.AltBody.String
+		types[i] = s.ContentType
+	}
+
+	if _, err := c.q.SetSequenceSteps.Exec(id, delays, subjects, bodies, altBodies, types); err != nil {
+		c.log.Printf("error saving sequence steps: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.sequence}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/gofrs/uuid/v5"
 	"github.com/jmoiron/sqlx"
 	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
@@ -282,8 +283,12 @@ func (c *Core) ExportSubscribers(searchStr, query string, subIDs, listIDs []int,
 
 // InsertSubscriber inserts a subscriber and returns the ID. The first bool indicates if
 // it was a new subscriber, and the second bool indicates if the subscriber was sent an optin confirmation.
-// bool = optinSent?
-func (c *Core) InsertSubscriber(sub models.Subscriber, listIDs []int, listUUIDs []string, preconfirm, assertOptin bool) (models.Subscriber, bool, error) {
+// bool = optinSent? optinTplID is the optional tx template of the optin confirmation e-mail.
+func (c *Core) InsertSubscriber(sub models.Subscriber, listIDs []int, listUUIDs []string, preconfirm, assertOptin bool, optinTplID int) (models.Subscriber, bool, error) {
+	if err := c.validateSubAttribs(&sub); err != nil {
+		return models.Subscriber{}, false, err
+	}
+
 	uu, err := uuid.NewV4()
 	if err != nil {
 		c.log.Printf("error generating UUID: %v", err)
@@ -334,10 +339,14 @@ func (c *Core) InsertSubscriber(sub models.Subscriber, listIDs []int, listUUIDs
 		return models.Subscriber{}, false, err
 	}
 
+	if sub.ID > 0 {
+		c.triggerWebhook(webhooks.EventSubscriberCreated, out)
+	}
+
 	hasOptin := false
 	if !preconfirm && c.consts.SendOptinConfirmation {
 		// Send a confirmation e-mail (if there are any double opt-in lists).
-		num, err := c.h.SendOptinConfirmation(out, listIDs)
+		num, err := c.h.SendOptinConfirmation(out, listIDs, optinTplID)
 		if assertOptin && err != nil {
 			return out, hasOptin, err
 		}
@@ -350,6 +359,10 @@ func (c *Core) InsertSubscriber(sub models.Subscriber, listIDs []int, listUUIDs
 
 // UpdateSubscriber updates a subscriber's properties.
 func (c *Core) UpdateSubscriber(id int, sub models.Subscriber) (models.Subscriber, error) {
+	if err := c.validateSubAttribUpdate(id, &sub); err != nil {
+		return models.Subscriber{}, err
+	}
+
 	// Format raw JSON attributes.
 	attribs := []byte("{}")
 	if len(sub.Attribs) > 0 {
@@ -379,13 +392,20 @@ func (c *Core) UpdateSubscriber(id int, sub models.Subscriber) (models.Subscribe
 		return models.Subscriber{}, err
 	}
 
+	c.triggerWebhook(webhooks.EventSubscriberUpdated, out)
+
 	return out, nil
 }
 
 // UpdateSubscriberWithLists updates a subscriber's properties.
 // If deleteLists is set to true, all existing subscriptions are deleted and only
-// the ones provided are added or retained.
-func (c *Core) UpdateSubscriberWithLists(id int, sub models.Subscriber, listIDs []int, listUUIDs []string, preconfirm, deleteLists, assertOptin bool) (models.Subscriber, bool, error) {
+// the ones provided are added or retained. optinTplID is the optional tx template
+// of the optin confirmation e-mail.
+func (c *Core) UpdateSubscriberWithLists(id int, sub models.Subscriber, listIDs []int, listUUIDs []string, preconfirm, deleteLists, assertOptin bool, optinTplID int) (models.Subscriber, bool, error) {
+	if err := c.validateSubAttribUpdate(id, &sub); err != nil {
+		return models.Subscriber{}, false, err
+	}
+
 	subStatus := models.SubscriptionStatusUnconfirmed
 	if preconfirm {
 		subStatus = models.SubscriptionStatusConfirmed
@@ -423,10 +443,12 @@ func (c *Core) UpdateSubscriberWithLists(id int, sub models.Subscriber, listIDs
 		return models.Subscriber{}, false, err
 	}
 
+	c.triggerWebhook(webhooks.EventSubscriberUpdated, out)
+
 	hasOptin := false
 	if !preconfirm && c.consts.SendOptinConfirmation {
 		// Send a confirmation e-mail (if there are any double opt-in lists).
-		num, err := c.h.SendOptinConfirmation(out, listIDs)
+		num, err := c.h.SendOptinConfirmation(out, listIDs, optinTplID)
 		if assertOptin && err != nil {
 			return out, hasOptin, err
 		}
@@ -444,6 +466,12 @@ func (c *Core) BlocklistSubscribers(subIDs []int) error {
 			c.i18n.Ts("subscribers.errorBlocklisting", "error", err.Error()))
 	}
 
+	// Blocklisting unsubscribes subscribers from all their lists.
+	c.triggerWebhook(webhooks.EventSubscriptionUnsubscribed, webhooks.Subscriptions{
+		SubscriberIDs: subIDs,
+		Blocklisted:   true,
+	})
+
 	return nil
 }
 
@@ -473,6 +501,11 @@ func (c *Core) DeleteSubscribers(subIDs []int, subUUIDs []string) error {
 			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
 	}
 
+	c.triggerWebhook(webhooks.EventSubscriberDeleted, webhooks.Subscriptions{
+		SubscriberIDs:   subIDs,
+		SubscriberUUIDs: subUUIDs,
+	})
+
 	return nil
 }
 
@@ -496,6 +529,12 @@ func (c *Core) UnsubscribeByCampaign(subUUID, campUUID string, blocklist bool) e
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
 	}
 
+	c.triggerWebhook(webhooks.EventSubscriptionUnsubscribed, webhooks.Subscriptions{
+		SubscriberUUIDs: []string{subUUID},
+		CampaignUUID:    campUUID,
+		Blocklisted:     blocklist,
+	})
+
 	return nil
 }
 
@@ -511,6 +550,11 @@ func (c *Core) ConfirmOptionSubscription(subUUID string, listUUIDs []string, met
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
 	}
 
+	c.triggerWebhook(webhooks.EventSubscriptionConfirmed, webhooks.Subscriptions{
+		SubscriberUUIDs: []string{subUUID},
+		ListUUIDs:       listUUIDs,
+	})
+
 	return nil
 }
 
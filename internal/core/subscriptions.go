@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
@@ -87,6 +88,12 @@ func (c *Core) UnsubscribeLists(subIDs, listIDs []int, listUUIDs []string) error
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", err.Error()))
 	}
 
+	c.triggerWebhook(webhooks.EventSubscriptionUnsubscribed, webhooks.Subscriptions{
+		SubscriberIDs: subIDs,
+		ListIDs:       listIDs,
+		ListUUIDs:     listUUIDs,
+	})
+
 	return nil
 }
 
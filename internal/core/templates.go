@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/knadh/listmonk/internal/auth"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 	null "gopkg.in/volatiletech/null.v6"
@@ -36,10 +37,10 @@ func (c *Core) GetTemplate(id int, noBody bool) (models.Template, error) {
 	return out[0], nil
 }
 
-// CreateTemplate creates a new template.
-func (c *Core) CreateTemplate(name, typ, subject string, body []byte, bodySource null.String) (models.Template, error) {
+// CreateTemplate creates a new template along with its first version by the given user.
+func (c *Core) CreateTemplate(name, typ, subject string, body []byte, bodySource null.String, user auth.User) (models.Template, error) {
 	var newID int
-	if err := c.q.CreateTemplate.Get(&newID, name, typ, subject, body, bodySource); err != nil {
+	if err := c.q.CreateTemplate.Get(&newID, name, typ, subject, body, bodySource, user.ID, user.Username); err != nil {
 		return models.Template{}, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.template}", "error", pqErrMsg(err)))
 	}
@@ -47,15 +48,15 @@ func (c *Core) CreateTemplate(name, typ, subject string, body []byte, bodySource
 	return c.GetTemplate(newID, false)
 }
 
-// UpdateTemplate updates a given template.
-func (c *Core) UpdateTemplate(id int, name, subject string, body []byte, bodySource null.String) (models.Template, error) {
-	res, err := c.q.UpdateTemplate.Exec(id, name, subject, body, bodySource)
-	if err != nil {
+// UpdateTemplate updates a given template and records it as a new version by the given user.
+func (c *Core) UpdateTemplate(id int, name, subject string, body []byte, bodySource null.String, user auth.User) (models.Template, error) {
+	var ids []int
+	if err := c.q.UpdateTemplate.Select(&ids, id, name, subject, body, bodySource, user.ID, user.Username); err != nil {
 		return models.Template{}, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.template}", "error", pqErrMsg(err)))
 	}
 
-	if n, _ := res.RowsAffected(); n == 0 {
+	if len(ids) == 0 {
 		return models.Template{}, echo.NewHTTPError(http.StatusBadRequest,
 			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.template}"))
 	}
@@ -63,6 +64,56 @@ func (c *Core) UpdateTemplate(id int, name, subject string, body []byte, bodySou
 	return c.GetTemplate(id, false)
 }
 
+// GetTemplateVersions retrieves the paginated versions of a template, latest first,
+// without their bodies.
+func (c *Core) GetTemplateVersions(id, offset, limit int) ([]models.TemplateVersion, int, error) {
+	out := []models.TemplateVersion{}
+	if err := c.q.GetTemplateVersions.Select(&out, id, offset, limit); err != nil {
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.templateVersions}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetTemplateVersion retrieves a given version of a template.
+func (c *Core) GetTemplateVersion(id, version int) (models.TemplateVersion, error) {
+	var out []models.TemplateVersion
+	if err := c.q.GetTemplateVersion.Select(&out, id, version); err != nil {
+		return models.TemplateVersion{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.templateVersion}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.TemplateVersion{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.templateVersion}"))
+	}
+
+	return out[0], nil
+}
+
+// RollbackTemplate restores a template to a given version. The restored template
+// is recorded as a new version by the given user.
+func (c *Core) RollbackTemplate(id, version int, user auth.User) (models.Template, error) {
+	var ids []int
+	if err := c.q.RollbackTemplate.Select(&ids, id, version, user.ID, user.Username); err != nil {
+		return models.Template{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.template}", "error", pqErrMsg(err)))
+	}
+
+	if len(ids) == 0 {
+		return models.Template{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.templateVersion}"))
+	}
+
+	return c.GetTemplate(id, false)
+}
+
 // SetDefaultTemplate sets a template as default.
 func (c *Core) SetDefaultTemplate(id int) error {
 	if _, err := c.q.SetDefaultTemplate.Exec(id); err != nil {
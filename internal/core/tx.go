@@ -0,0 +1,256 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetTxMessage retrieves a transactional message log entry by its ID or UUID.
+func (c *Core) GetTxMessage(id int64, uu string) (models.TxMessageLog, error) {
+	var out []models.TxMessageLog
+	if err := c.q.GetTxMessage.Select(&out, id, uu); err != nil {
+		c.log.Printf("error fetching tx message: %v", err)
+		return models.TxMessageLog{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.txMessage}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.TxMessageLog{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.txMessage}"))
+	}
+
+	return out[0], nil
+}
+
+// GetTxMessagesByKey retrieves the transactional messages that were sent with an
+// idempotency key within the given window, optionally to a given e-mail.
+// Keys older than the window are released for reuse.
+func (c *Core) GetTxMessagesByKey(key, email string, window time.Duration) ([]models.TxMessageLog, error) {
+	out := []models.TxMessageLog{}
+	if err := c.q.GetTxMessagesByKey.Select(&out, key, window.Seconds(), email); err != nil {
+		c.log.Printf("error fetching tx messages: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.txMessages}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// CreateTxMessage logs a new transactional message, by default in the queued state. If a
+// message with the same idempotency key has already been sent to the e-mail, false is returned.
+func (c *Core) CreateTxMessage(o models.TxMessageLog) (models.TxMessageLog, bool, error) {
+	if o.Status == "" {
+		o.Status = models.TxStatusQueued
+	}
+
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.TxMessageLog{}, false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var out []models.TxMessageLog
+	if err := c.q.InsertTxMessage.Select(&out, uu, o.IdempotencyKey.String, o.TemplateID.Int, o.SubscriberID.Int,
+		o.Email, o.Subject, o.Messenger, o.Status, o.Error, o.BatchID.Int, o.BatchIndex, o.TemplateVersion.Int); err != nil {
+		c.log.Printf("error creating tx message: %v", err)
+		return models.TxMessageLog{}, false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.txMessage}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.TxMessageLog{}, false, nil
+	}
+
+	return out[0], true, nil
+}
+
+// UpdateTxMessageStatus updates the delivery status of a transactional message.
+func (c *Core) UpdateTxMessageStatus(id int64, status, errMsg string) error {
+	if _, err := c.q.UpdateTxMessageStatus.Exec(id, status, errMsg); err != nil {
+		c.log.Printf("error updating tx message status: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.txMessage}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetTxBatch retrieves a transactional message batch by its ID or UUID.
+func (c *Core) GetTxBatch(id int64, uu string) (models.TxBatch, error) {
+	var out []models.TxBatch
+	if err := c.q.GetTxBatch.Select(&out, id, uu); err != nil {
+		c.log.Printf("error fetching tx batch: %v", err)
+		return models.TxBatch{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.txBatch}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.TxBatch{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.txBatch}"))
+	}
+
+	return out[0], nil
+}
+
+// GetTxBatchByKey retrieves the transactional message batch that was created with an
+// idempotency key within the given window. Keys older than the window are released for
+// reuse. If there's no batch, false is returned.
+func (c *Core) GetTxBatchByKey(key string, window time.Duration) (models.TxBatch, bool, error) {
+	var ids []int64
+	if err := c.q.GetTxBatchByKey.Select(&ids, key, window.Seconds()); err != nil {
+		c.log.Printf("error fetching tx batch: %v", err)
+		return models.TxBatch{}, false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.txBatch}", "error", pqErrMsg(err)))
+	}
+
+	if len(ids) == 0 {
+		return models.TxBatch{}, false, nil
+	}
+
+	out, err := c.GetTxBatch(ids[0], "")
+	return out, err == nil, err
+}
+
+// CreateTxBatch creates a new transactional message batch in the running state. The batch's
+// message is stored along with it so that the batch can be resumed if it's interrupted.
+// If a batch with the same idempotency key exists, false is returned.
+func (c *Core) CreateTxBatch(b models.TxBatchMessage) (models.TxBatch, bool, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.TxBatch{}, false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	payload, err := json.Marshal(b)
+	if err != nil {
+		c.log.Printf("error marshalling tx batch: %v", err)
+		return models.TxBatch{}, false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.txBatch}", "error", err.Error()))
+	}
+
+	var ids []int64
+	if err := c.q.InsertTxBatch.Select(&ids, uu, b.IdempotencyKey, b.TemplateID, len(b.Entries), payload); err != nil {
+		c.log.Printf("error creating tx batch: %v", err)
+		return models.TxBatch{}, false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.txBatch}", "error", pqErrMsg(err)))
+	}
+
+	if len(ids) == 0 {
+		return models.TxBatch{}, false, nil
+	}
+
+	out, err := c.GetTxBatch(ids[0], "")
+	return out, err == nil, err
+}
+
+// TouchTxBatch renews the lease of a running transactional message batch so that
+// it's not picked up as an interrupted batch.
+func (c *Core) TouchTxBatch(id int64) error {
+	if _, err := c.q.TouchTxBatch.Exec(id); err != nil {
+		c.log.Printf("error updating tx batch: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.txBatch}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// NextTxBatch claims a running transactional message batch whose lease hasn't been
+// renewed within the given duration, ie: a batch that was interrupted, and returns it
+// along with its message. If there's no such batch, false is returned.
+func (c *Core) NextTxBatch(lease time.Duration) (models.TxBatch, models.TxBatchMessage, bool, error) {
+	var out []struct {
+		ID      int64           `db:"id"`
+		Payload json.RawMessage `db:"payload"`
+	}
+	if err := c.q.NextTxBatch.Select(&out, lease.Seconds()); err != nil {
+		c.log.Printf("error fetching tx batch: %v", err)
+		return models.TxBatch{}, models.TxBatchMessage{}, false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.txBatch}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.TxBatch{}, models.TxBatchMessage{}, false, nil
+	}
+
+	var b models.TxBatchMessage
+	if err := json.Unmarshal(out[0].Payload, &b); err != nil {
+		c.log.Printf("error unmarshalling tx batch %d: %v", out[0].ID, err)
+		return models.TxBatch{}, models.TxBatchMessage{}, false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.txBatch}", "error", err.Error()))
+	}
+
+	batch, err := c.GetTxBatch(out[0].ID, "")
+	if err != nil {
+		return models.TxBatch{}, models.TxBatchMessage{}, false, err
+	}
+
+	return batch, b, true, nil
+}
+
+// GetTxBatchDone returns the indices of the entries in a transactional message batch
+// that have already been processed.
+func (c *Core) GetTxBatchDone(id int64) (map[int]bool, error) {
+	var idx []int
+	if err := c.q.GetTxBatchDone.Select(&idx, id); err != nil {
+		c.log.Printf("error fetching tx batch messages: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.txMessages}", "error", pqErrMsg(err)))
+	}
+
+	out := make(map[int]bool, len(idx))
+	for _, n := range idx {
+		out[n] = true
+	}
+
+	return out, nil
+}
+
+// FinishTxBatch marks a transactional message batch as finished.
+func (c *Core) FinishTxBatch(id int64) error {
+	if _, err := c.q.FinishTxBatch.Exec(id); err != nil {
+		c.log.Printf("error updating tx batch: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.txBatch}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// DeleteTxLogs deletes transactional messages and finished batches older than the given
+// date and returns the number of messages deleted.
+func (c *Core) DeleteTxLogs(before time.Time) (int, error) {
+	var n int
+	if err := c.q.DeleteTxLogs.Get(&n, before); err != nil {
+		c.log.Printf("error deleting tx messages: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.txMessages}", "error", pqErrMsg(err)))
+	}
+
+	return n, nil
+}
+
+// GetTxBatchMessages retrieves the paginated messages of a transactional message batch
+// in the order of the batch's entries.
+func (c *Core) GetTxBatchMessages(id int64, offset, limit int) ([]models.TxMessageLog, int, error) {
+	out := []models.TxMessageLog{}
+	if err := c.q.GetTxBatchMessages.Select(&out, id, offset, limit); err != nil {
+		c.log.Printf("error fetching tx batch messages: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.txMessages}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
@@ -4,9 +4,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/knadh/listmonk/internal/auth"
-	"github.com/knadh/listmonk/internal/utils"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
 	"gopkg.in/volatiletech/null.v6"
@@ -43,18 +44,12 @@ func (c *Core) GetUser(id int, username, email string) (auth.User, error) {
 func (c *Core) CreateUser(u auth.User) (auth.User, error) {
 	var id int
 
-	// If it's an API user, generate a random token for password
-	// and set the e-mail to default.
+	// If it's an API user, set the e-mail to default. API users authenticate
+	// with tokens and don't have passwords.
 	if u.Type == auth.UserTypeAPI {
-		// Generate a random admin password.
-		tk, err := utils.GenerateRandomString(32)
-		if err != nil {
-			return auth.User{}, err
-		}
-
 		u.Email = null.String{String: u.Username + "@api", Valid: true}
 		u.PasswordLogin = false
-		u.Password = null.String{String: tk, Valid: true}
+		u.Password = null.String{}
 	}
 
 	if err := c.q.CreateUser.Get(&id, u.Username, u.PasswordLogin, u.Password, u.Email, u.Name, u.Type, u.UserRoleID, u.ListRoleID, u.Status); err != nil {
@@ -62,14 +57,22 @@ func (c *Core) CreateUser(u auth.User) (auth.User, error) {
 			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
 	}
 
-	// Hide the password field in the response except for when the user type is an API token,
-	// where the frontend shows the token on the UI just once.
-	if u.Type != auth.UserTypeAPI {
-		u.Password = null.String{Valid: false}
+	out, err := c.GetUser(id, "", "")
+	if err != nil {
+		return out, err
 	}
 
-	out, err := c.GetUser(id, "", "")
-	return out, err
+	// Create a default token for API users. The token is returned in the password field
+	// for the frontend to show on the UI just once.
+	if u.Type == auth.UserTypeAPI {
+		tk, err := c.CreateAPIToken(auth.APIToken{UserID: id, Name: "default"})
+		if err != nil {
+			return auth.User{}, err
+		}
+		out.Password = null.String{String: tk.Token, Valid: true}
+	}
+
+	return out, nil
 }
 
 // UpdateUser updates a given user.
@@ -151,6 +154,147 @@ func (c *Core) LoginUser(username, password string) (auth.User, error) {
 	return out, nil
 }
 
+// SetUserTOTP sets a user's TOTP secret, whether 2FA is enabled, and the hashes of
+// the user's recovery codes. A null secret removes 2FA from the user.
+func (c *Core) SetUserTOTP(id int, secret null.String, enabled bool, codeHashes []string) error {
+	if codeHashes == nil {
+		codeHashes = []string{}
+	}
+
+	res, err := c.q.SetUserTOTP.Exec(id, secret, enabled, pq.Array(codeHashes))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.user}"))
+	}
+
+	return nil
+}
+
+// SetUserTOTPRecoveryCodes replaces the recovery code hashes of a user with 2FA enabled.
+func (c *Core) SetUserTOTPRecoveryCodes(id int, codeHashes []string) error {
+	res, err := c.q.SetUserTOTPRecoveryCodes.Exec(id, pq.Array(codeHashes))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("users.totpNotEnabled"))
+	}
+
+	return nil
+}
+
+// VerifyUserTOTP verifies a TOTP code against the user's secret. If the user has 2FA
+// enabled, one of the user's recovery codes is also accepted, after which it's removed.
+// A TOTP code can only be used once.
+func (c *Core) VerifyUserTOTP(u auth.User, code string) error {
+	code = strings.TrimSpace(code)
+
+	if step, ok := auth.ValidateTOTP(u.TOTPSecret.String, code, time.Now()); ok {
+		res, err := c.q.UseUserTOTPStep.Exec(u.ID, step)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+		}
+
+		if n, _ := res.RowsAffected(); n > 0 {
+			return nil
+		}
+
+		return echo.NewHTTPError(http.StatusForbidden, c.i18n.T("users.invalidTOTP"))
+	}
+
+	// Not a TOTP code. Is it a recovery code?
+	if code != "" && u.TOTPEnabled {
+		res, err := c.q.UseUserRecoveryCode.Exec(u.ID, auth.HashRecoveryCode(code))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+		}
+
+		if n, _ := res.RowsAffected(); n > 0 {
+			c.log.Printf("user %s logged in with a 2FA recovery code", u.Username)
+			return nil
+		}
+	}
+
+	return echo.NewHTTPError(http.StatusForbidden, c.i18n.T("users.invalidTOTP"))
+}
+
+// GetAPITokens retrieves the tokens of a given API user, or of all API users if userID is 0.
+func (c *Core) GetAPITokens(userID int) ([]auth.APIToken, error) {
+	out := []auth.APIToken{}
+	if err := c.q.GetAPITokens.Select(&out, userID); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{users.apiTokens}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// CreateAPIToken generates and creates a new token for an API user. The plaintext
+// token is only available on the returned token.
+func (c *Core) CreateAPIToken(t auth.APIToken) (auth.APIToken, error) {
+	tk, hash, prefix, err := auth.NewAPIToken()
+	if err != nil {
+		c.log.Printf("error generating API token: %v", err)
+		return auth.APIToken{}, echo.NewHTTPError(http.StatusInternalServerError, c.i18n.T("globals.messages.internalError"))
+	}
+
+	if t.Permissions == nil {
+		t.Permissions = []string{}
+	}
+	if t.IPAllowlist == nil {
+		t.IPAllowlist = []string{}
+	}
+
+	var id int
+	if err := c.q.CreateAPIToken.Get(&id, t.UserID, t.Name, hash, prefix, t.Permissions, t.IPAllowlist, t.ExpiresAt); err != nil {
+		if err == sql.ErrNoRows {
+			return auth.APIToken{}, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.user}"))
+		}
+
+		return auth.APIToken{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{users.apiToken}", "error", pqErrMsg(err)))
+	}
+
+	t.ID = id
+	t.Prefix = prefix
+	t.Token = tk
+	t.CreatedAt = null.TimeFrom(time.Now())
+
+	return t, nil
+}
+
+// DeleteAPIToken deletes a token of an API user.
+func (c *Core) DeleteAPIToken(userID, id int) error {
+	res, err := c.q.DeleteAPIToken.Exec(id, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{users.apiToken}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{users.apiToken}"))
+	}
+
+	return nil
+}
+
+// TouchAPIToken updates the last used timestamp of an API token.
+func (c *Core) TouchAPIToken(id int) error {
+	_, err := c.q.TouchAPIToken.Exec(id)
+	return err
+}
+
 // setupUserFields prepares and sets up various user fields.
 func (c *Core) setupUserFields(users []auth.User) []auth.User {
 	for n, u := range users {
@@ -168,6 +312,7 @@ func (c *Core) setupUserFields(users []auth.User) []auth.User {
 		u.UserRole.ID = u.UserRoleID
 		u.UserRole.Name = u.UserRoleName
 		u.UserRole.Permissions = u.UserRolePerms
+		u.UserRole.Require2FA = u.UserRoleRequire2FA
 		u.UserRoleID = 0
 
 		// Prepare lookup maps.
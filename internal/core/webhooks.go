@@ -0,0 +1,115 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetWebhooks retrieves paginated outbound webhooks.
+func (c *Core) GetWebhooks(offset, limit int) ([]models.Webhook, int, error) {
+	out := []models.Webhook{}
+	if err := c.q.GetWebhooks.Select(&out, 0, offset, limit); err != nil {
+		c.log.Printf("error fetching webhooks: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.webhooks}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetWebhook retrieves a given webhook.
+func (c *Core) GetWebhook(id int) (models.Webhook, error) {
+	var out []models.Webhook
+	if err := c.q.GetWebhooks.Select(&out, id, 0, 1); err != nil {
+		c.log.Printf("error fetching webhook: %v", err)
+		return models.Webhook{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.webhook}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.Webhook{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.webhook}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateWebhook creates a new webhook.
+func (c *Core) CreateWebhook(o models.Webhook) (models.Webhook, error) {
+	var newID int
+	if err := c.q.CreateWebhook.Get(&newID, o.Name, o.URL, o.Secret, o.Events, o.Enabled); err != nil {
+		c.log.Printf("error creating webhook: %v", err)
+		return models.Webhook{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.webhook}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetWebhook(newID)
+}
+
+// UpdateWebhook updates a given webhook. The existing secret is retained if
+// the incoming secret is empty.
+func (c *Core) UpdateWebhook(id int, o models.Webhook) (models.Webhook, error) {
+	res, err := c.q.UpdateWebhook.Exec(id, o.Name, o.URL, o.Secret, o.Events, o.Enabled)
+	if err != nil {
+		c.log.Printf("error updating webhook: %v", err)
+		return models.Webhook{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.webhook}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.Webhook{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.webhook}"))
+	}
+
+	return c.GetWebhook(id)
+}
+
+// DeleteWebhook deletes a given webhook along with its deliveries.
+func (c *Core) DeleteWebhook(id int) error {
+	if _, err := c.q.DeleteWebhook.Exec(id); err != nil {
+		c.log.Printf("error deleting webhook: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.webhook}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// QueryWebhookDeliveries retrieves paginated deliveries of a webhook optionally
+// filtered by status. It also returns the total number of matching records in the DB.
+func (c *Core) QueryWebhookDeliveries(webhookID int, status string, offset, limit int) ([]models.WebhookDelivery, int, error) {
+	out := []models.WebhookDelivery{}
+	if err := c.q.QueryWebhookDeliveries.Select(&out, webhookID, status, offset, limit); err != nil {
+		c.log.Printf("error fetching webhook deliveries: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.webhooks}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// DeleteWebhookDeliveries deletes processed webhook deliveries older than a given date.
+func (c *Core) DeleteWebhookDeliveries(before time.Time) (int, error) {
+	res, err := c.q.DeleteWebhookDeliveries.Exec(before)
+	if err != nil {
+		c.log.Printf("error deleting webhook deliveries: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{webhooks.deliveries}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
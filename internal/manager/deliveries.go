@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+const (
+	// deliveryFlushInterval is the interval at which buffered delivery log
+	// entries are written to the store.
+	deliveryFlushInterval = time.Second
+
+	// deliveryQueueTimeout is the maximum time a message worker waits to queue
+	// a delivery log entry when the queue is full.
+	deliveryQueueTimeout = time.Second * 5
+
+	// deliveryCloseTimeout is the maximum time to wait for the queued delivery
+	// log entries to be written to the store on close.
+	deliveryCloseTimeout = time.Second * 2
+)
+
+// recordDelivery queues a delivery log entry for a campaign message
+// if the delivery log is enabled. Messages that aren't from campaigns,
+// such as automation sequences, aren't logged. If the queue is full, eg: when
+// the store is slow, the worker waits for deliveryQueueTimeout before dropping
+// the entry so that a stalled store doesn't hold up sending indefinitely.
+func (m *Manager) recordDelivery(msg CampaignMessage, status string, err error) {
+	if !m.cfg.DeliveryLog || msg.Campaign.ID == 0 {
+		return
+	}
+
+	d := models.CampaignDelivery{
+		CampaignID:   msg.Campaign.ID,
+		SubscriberID: msg.Subscriber.ID,
+		Messenger:    msg.Campaign.Messenger,
+		Status:       status,
+		CreatedAt:    time.Now(),
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+
+	select {
+	case m.deliveries <- d:
+		return
+	default:
+	}
+
+	t := time.NewTimer(deliveryQueueTimeout)
+	defer t.Stop()
+
+	select {
+	case m.deliveries <- d:
+	case <-t.C:
+		m.deliveriesDropped.Add(1)
+	}
+}
+
+// recordTxStatus records the delivery status of a transactional message
+// in the store. Messages that aren't logged, such as notifications, are ignored.
+func (m *Manager) recordTxStatus(msg models.Message, err error) {
+	if msg.TxID == 0 {
+		return
+	}
+
+	status, errMsg := models.TxStatusSent, ""
+	if err != nil {
+		status, errMsg = models.TxStatusFailed, err.Error()
+	}
+
+	if err := m.store.UpdateTxMessageStatus(msg.TxID, status, errMsg); err != nil {
+		m.log.Printf("error updating tx message status (%d): %v", msg.TxID, err)
+	}
+}
+
+// runDeliveryLog is a blocking function that collects delivery log entries
+// and writes them to the store in batches. Entries that fail to be written
+// are retried on the next flush. On close, the queue is drained and flushed.
+func (m *Manager) runDeliveryLog() {
+	defer close(m.deliveriesDone)
+
+	var (
+		batch   = make([]models.CampaignDelivery, 0, m.cfg.BatchSize)
+		t       = time.NewTicker(deliveryFlushInterval)
+		dropped uint64
+		failing bool
+
+		// The maximum number of entries retained for retrying while the store fails.
+		maxPending = max(cap(m.deliveries), m.cfg.BatchSize)
+	)
+	defer t.Stop()
+
+	flush := func() {
+		if len(batch) > 0 {
+			if err := m.store.RecordDeliveries(batch); err != nil {
+				m.log.Printf("error recording %d campaign deliveries (will retry): %v", len(batch), err)
+				failing = true
+
+				// Drop the oldest entries beyond the retry limit.
+				if n := len(batch) - maxPending; n > 0 {
+					batch = append(batch[:0], batch[n:]...)
+					m.deliveriesDropped.Add(uint64(n))
+				}
+			} else {
+				failing = false
+				batch = batch[:0]
+			}
+		}
+
+		if n := m.deliveriesDropped.Load(); n > dropped {
+			m.log.Printf("dropped %d campaign delivery log entries as they couldn't be recorded in time", n-dropped)
+			dropped = n
+		}
+	}
+
+	for {
+		select {
+		case d := <-m.deliveries:
+			batch = append(batch, d)
+
+			// While the store is failing, only retry at the flush interval.
+			if len(batch) >= m.cfg.BatchSize && !failing {
+				flush()
+			}
+
+		case <-t.C:
+			flush()
+
+		case <-m.deliveriesStop:
+			// Drain the queue and write the remaining entries.
+		drain:
+			for {
+				select {
+				case d := <-m.deliveries:
+					batch = append(batch, d)
+				default:
+					break drain
+				}
+			}
+			flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package manager
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	// feedTimeout is the timeout for fetching RSS/Atom feeds.
+	feedTimeout = 30 * time.Second
+
+	// feedMaxSize is the maximum size of a feed that's read.
+	feedMaxSize = 10 * 1024 * 1024
+
+	// feedMaxSeen is the maximum number of seen feed items that are remembered.
+	feedMaxSeen = 1000
+)
+
+// feed represents an RSS 2.0, RSS 1.0 (RDF), or Atom feed. The root element
+// isn't matched so that all three formats decode into the same struct.
+type feed struct {
+	Channel struct {
+		Items []feedRSSItem `xml:"item"`
+	} `xml:"channel"`
+
+	// RSS 1.0 items are siblings of the channel.
+	Items []feedRSSItem `xml:"item"`
+
+	// Atom.
+	Entries []feedAtomEntry `xml:"entry"`
+}
+
+type feedRSSItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Author      string `xml:"author"`
+	Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type feedAtomEntry struct {
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Summary string `xml:"summary"`
+	Content string `xml:"content"`
+	Author  struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	ID        string `xml:"id"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+}
+
+// feedDateLayouts are the date formats found in the wild in RSS and Atom feeds.
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+var feedClient = &http.Client{Timeout: feedTimeout}
+
+// fetchFeed fetches an RSS/Atom feed and returns its items, newest first.
+func fetchFeed(url string) (models.FeedItems, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "listmonk")
+
+	resp, err := feedClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+
+	return parseFeed(io.LimitReader(resp.Body, feedMaxSize))
+}
+
+// parseFeed parses an RSS/Atom feed and returns its items, newest first.
+func parseFeed(r io.Reader) (models.FeedItems, error) {
+	var f feed
+	dec := xml.NewDecoder(r)
+
+	// Feeds in legacy charsets are read as is.
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("error parsing feed: %v", err)
+	}
+
+	out := models.FeedItems{}
+	for _, it := range append(f.Channel.Items, f.Items...) {
+		author := it.Author
+		if author == "" {
+			author = it.Creator
+		}
+		date := it.PubDate
+		if date == "" {
+			date = it.Date
+		}
+
+		out = append(out, models.FeedItem{
+			Title:       strings.TrimSpace(it.Title),
+			URL:         strings.TrimSpace(it.Link),
+			Description: strings.TrimSpace(it.Description),
+			Content:     strings.TrimSpace(it.Content),
+			Author:      strings.TrimSpace(author),
+			GUID:        strings.TrimSpace(it.GUID),
+			PublishedAt: parseFeedDate(date),
+		})
+	}
+
+	for _, e := range f.Entries {
+		// The alternate link, which is the default, is the entry's URL.
+		var url string
+		for _, l := range e.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				url = l.Href
+				break
+			}
+		}
+		date := e.Published
+		if date == "" {
+			date = e.Updated
+		}
+
+		out = append(out, models.FeedItem{
+			Title:       strings.TrimSpace(e.Title),
+			URL:         strings.TrimSpace(url),
+			Description: strings.TrimSpace(e.Summary),
+			Content:     strings.TrimSpace(e.Content),
+			Author:      strings.TrimSpace(e.Author.Name),
+			GUID:        strings.TrimSpace(e.ID),
+			PublishedAt: parseFeedDate(date),
+		})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].PublishedAt.After(out[j].PublishedAt)
+	})
+
+	return out, nil
+}
+
+// newFeedItems returns the items that haven't been seen by previous runs. Items
+// are identified by feedItemKey. If no items have been seen, eg: runs from before
+// seen items were recorded, items published after the given time are new. If
+// that's null too, all items are new.
+func newFeedItems(items models.FeedItems, seen []string, after null.Time) models.FeedItems {
+	if len(seen) == 0 {
+		if !after.Valid {
+			return items
+		}
+
+		out := models.FeedItems{}
+		for _, it := range items {
+			if it.PublishedAt.After(after.Time) {
+				out = append(out, it)
+			}
+		}
+		return out
+	}
+
+	s := make(map[string]struct{}, len(seen))
+	for _, k := range seen {
+		s[k] = struct{}{}
+	}
+
+	out := models.FeedItems{}
+	for _, it := range items {
+		if _, ok := s[feedItemKey(it)]; !ok {
+			out = append(out, it)
+		}
+	}
+
+	return out
+}
+
+// seenFeedItems returns the keys of the items in the feed followed by the previously
+// seen keys that are no longer in the feed, up to feedMaxSeen.
+func seenFeedItems(items models.FeedItems, seen []string) []string {
+	var (
+		out = make([]string, 0, len(items)+len(seen))
+		has = make(map[string]struct{}, len(items)+len(seen))
+	)
+	for _, it := range items {
+		k := feedItemKey(it)
+		if _, ok := has[k]; !ok {
+			has[k] = struct{}{}
+			out = append(out, k)
+		}
+	}
+	for _, k := range seen {
+		if _, ok := has[k]; !ok {
+			has[k] = struct{}{}
+			out = append(out, k)
+		}
+	}
+
+	if len(out) > feedMaxSeen {
+		out = out[:feedMaxSeen]
+	}
+
+	return out
+}
+
+// feedItemKey returns the key that identifies a feed item across fetches, its
+// GUID, or its link if it doesn't have one, or as a last resort, its title.
+func feedItemKey(it models.FeedItem) string {
+	switch {
+	case it.GUID != "":
+		return it.GUID
+	case it.URL != "":
+		return it.URL
+	}
+
+	return it.Title
+}
+
+// parseFeedDate parses a feed item's date. Unknown formats return a zero time.
+func parseFeedDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, l := range feedDateLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
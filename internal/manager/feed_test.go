@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+func TestNewFeedItems(t *testing.T) {
+	titles := func(items models.FeedItems) string {
+		var out []string
+		for _, it := range items {
+			out = append(out, it.Title)
+		}
+		return strings.Join(out, ",")
+	}
+
+	// A feed without dates.
+	undated, err := parseFeed(strings.NewReader(`<rss><channel>
+		<item><title>b</title><link>https://example.com/b</link></item>
+		<item><title>a</title><guid>a-guid</guid><link>https://example.com/a</link></item>
+	</channel></rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// On the first run, all items are new.
+	items := newFeedItems(undated, nil, null.Time{})
+	if titles(items) != "b,a" {
+		t.Fatalf("expected all items on the first run, got %s", titles(items))
+	}
+	seen := seenFeedItems(undated, nil)
+	if strings.Join(seen, ",") != "https://example.com/b,a-guid" {
+		t.Fatalf("unexpected seen items: %v", seen)
+	}
+
+	// Nothing is new on the next run.
+	if items := newFeedItems(undated, seen, null.Time{}); len(items) != 0 {
+		t.Fatalf("expected no new items, got %s", titles(items))
+	}
+
+	// A new undated item in a dated feed is new, and an old item that's been
+	// seen is not, regardless of its date.
+	now := time.Now()
+	feed := models.FeedItems{
+		{Title: "c", GUID: "c-guid", PublishedAt: now},
+		{Title: "a", GUID: "a-guid", PublishedAt: now.Add(time.Hour)},
+		{Title: "d", URL: "https://example.com/d"},
+	}
+	items = newFeedItems(feed, seen, null.TimeFrom(now.Add(time.Hour*2)))
+	if titles(items) != "c,d" {
+		t.Fatalf("expected new items c,d, got %s", titles(items))
+	}
+
+	// Items that dropped off the feed are remembered after the current ones.
+	seen = seenFeedItems(feed, seen)
+	if strings.Join(seen, ",") != "c-guid,a-guid,https://example.com/d,https://example.com/b" {
+		t.Fatalf("unexpected seen items: %v", seen)
+	}
+
+	// Without seen items, eg: for runs before they were recorded, the last item's date is used.
+	items = newFeedItems(feed, nil, null.TimeFrom(now.Add(time.Minute)))
+	if titles(items) != "a" {
+		t.Fatalf("expected item a published after the last item, got %s", titles(items))
+	}
+}
@@ -8,16 +8,19 @@ import (
 	"net/textproto"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"maps"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/knadh/listmonk/internal/i18n"
+	"github.com/knadh/listmonk/internal/metrics"
 	"github.com/knadh/listmonk/internal/notifs"
 	"github.com/knadh/listmonk/models"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
+	null "gopkg.in/volatiletech/null.v6"
 )
 
 const (
@@ -42,6 +45,20 @@ type Store interface {
 	CreateLink(url string) (string, error)
 	BlocklistSubscriber(id int64) error
 	DeleteSubscriber(id int64) error
+	RecordDeliveries(d []models.CampaignDelivery) error
+	UpdateTxMessageStatus(id int64, status, errMsg string) error
+	GetCampaignVariants(campID int) ([]models.CampaignVariant, error)
+	RecordCampaignVariants(campID int, subIDs []int64, variantIDs []int64) error
+	UpdateCampaignABTest(campID int, size int, endsAt null.Time) error
+	PickCampaignABWinner(campID int) (int, error)
+	NextCampaignLocalWindow(campID int) (null.Time, error)
+	NextSequenceMessages(limit int) ([]models.SequenceMessage, error)
+	GetSequenceStep(id int) (*models.Campaign, error)
+	RevertSequenceProgress(m models.SequenceMessage) error
+	GetDueRecurringCampaigns() ([]models.RecurringCampaign, error)
+	ClaimRecurringCampaign(id int, nextRunAt, newNextRunAt null.Time) (bool, error)
+	ReleaseRecurringCampaign(id int, nextRunAt, retryAt null.Time) error
+	CreateRecurringCampaignInstance(id, campID int, name string, items models.FeedItems, lastItemAt null.Time, seen []string) (int, error)
 }
 
 // Messenger is an interface for a generic messaging backend,
@@ -58,6 +75,50 @@ type CampStats struct {
 	SendRate int
 }
 
+// Stats is a snapshot of the manager's internals that's exposed as metrics.
+type Stats struct {
+	CampMsgQueue    int
+	CampMsgQueueCap int
+	MsgQueue        int
+	MsgQueueCap     int
+
+	// Number of times sending was paused on hitting the sliding window limit
+	// and the total time spent waiting.
+	SlidingWaits       int64
+	SlidingWaitSeconds float64
+
+	// Number of campaign delivery log entries dropped as they couldn't be
+	// recorded in time, eg: when the database is slow or failing.
+	DeliveriesDropped uint64
+
+	Campaigns  []CampaignStats
+	Messengers []MessengerStats
+}
+
+// CampaignStats represents the counts of a running campaign.
+type CampaignStats struct {
+	ID       int
+	Name     string
+	Sent     int64
+	Errors   int64
+	SendRate int
+}
+
+// MessengerStats represents the push counts and latency of a messenger.
+type MessengerStats struct {
+	Name    string
+	Success uint64
+	Errors  uint64
+	Latency *metrics.Histogram
+}
+
+// pushStats tracks the outcome and latency of messenger pushes.
+type pushStats struct {
+	success atomic.Uint64
+	errors  atomic.Uint64
+	latency *metrics.Histogram
+}
+
 // Manager handles the scheduling, processing, and queuing of campaigns
 // and message pushes.
 type Manager struct {
@@ -65,6 +126,7 @@ type Manager struct {
 	store      Store
 	i18n       *i18n.I18n
 	messengers map[string]Messenger
+	pushStats  map[string]*pushStats
 	fnNotify   func(subject string, data any) error
 	log        *log.Logger
 
@@ -85,12 +147,25 @@ type Manager struct {
 	campMsgQ  chan CampaignMessage
 	msgQ      chan models.Message
 
+	// Delivery log entries of campaign messages to be written to the store
+	// and the number of entries dropped as they couldn't be recorded in time.
+	// deliveriesStop stops the delivery log, which closes deliveriesDone once
+	// the queued entries have been written.
+	deliveries        chan models.CampaignDelivery
+	deliveriesDropped atomic.Uint64
+	deliveriesStop    chan struct{}
+	deliveriesDone    chan struct{}
+
 	// Sliding window keeps track of the total number of messages sent in a period
 	// and on reaching the specified limit, waits until the window is over before
 	// sending further messages.
 	slidingCount int
 	slidingStart time.Time
 
+	// Number of sliding window waits and the total time (ns) spent waiting.
+	slidingWaits atomic.Int64
+	slidingWait  atomic.Int64
+
 	tplFuncs template.FuncMap
 }
 
@@ -132,6 +207,9 @@ type Config struct {
 	RootURL               string
 	UnsubHeader           bool
 
+	// DeliveryLog enables recording of every campaign message send attempt.
+	DeliveryLog bool
+
 	// Interval to scan the DB for active campaign checkpoints.
 	ScanInterval time.Duration
 
@@ -164,15 +242,19 @@ func New(cfg Config, store Store, i *i18n.I18n, l *log.Logger) *Manager {
 		fnNotify: func(subject string, data any) error {
 			return notifs.NotifySystem(subject, notifs.TplCampaignStatus, data, nil)
 		},
-		log:          l,
-		messengers:   make(map[string]Messenger),
-		pipes:        make(map[int]*pipe),
-		tpls:         make(map[int]*models.Template),
-		links:        make(map[string]string),
-		nextPipes:    make(chan *pipe, 1000),
-		campMsgQ:     make(chan CampaignMessage, cfg.Concurrency*cfg.MessageRate*2),
-		msgQ:         make(chan models.Message, cfg.Concurrency*cfg.MessageRate*2),
-		slidingStart: time.Now(),
+		log:            l,
+		messengers:     make(map[string]Messenger),
+		pushStats:      make(map[string]*pushStats),
+		pipes:          make(map[int]*pipe),
+		tpls:           make(map[int]*models.Template),
+		links:          make(map[string]string),
+		nextPipes:      make(chan *pipe, 1000),
+		campMsgQ:       make(chan CampaignMessage, cfg.Concurrency*cfg.MessageRate*2),
+		msgQ:           make(chan models.Message, cfg.Concurrency*cfg.MessageRate*2),
+		deliveries:     make(chan models.CampaignDelivery, cfg.BatchSize+cfg.Concurrency*cfg.MessageRate*2),
+		deliveriesStop: make(chan struct{}),
+		deliveriesDone: make(chan struct{}),
+		slidingStart:   time.Now(),
 	}
 	m.tplFuncs = m.makeGnericFuncMap()
 
@@ -186,6 +268,7 @@ func (m *Manager) AddMessenger(msg Messenger) error {
 		return fmt.Errorf("messenger '%s' is already loaded", id)
 	}
 	m.messengers[id] = msg
+	m.pushStats[id] = &pushStats{latency: metrics.NewHistogram(metrics.DefBuckets)}
 
 	return nil
 }
@@ -255,6 +338,43 @@ func (m *Manager) GetCampaignStats(id int) CampStats {
 	return CampStats{SendRate: n}
 }
 
+// GetStats returns a snapshot of the manager's queues, running campaigns,
+// and messengers.
+func (m *Manager) GetStats() Stats {
+	out := Stats{
+		CampMsgQueue:       len(m.campMsgQ),
+		CampMsgQueueCap:    cap(m.campMsgQ),
+		MsgQueue:           len(m.msgQ),
+		MsgQueueCap:        cap(m.msgQ),
+		SlidingWaits:       m.slidingWaits.Load(),
+		SlidingWaitSeconds: time.Duration(m.slidingWait.Load()).Seconds(),
+		DeliveriesDropped:  m.deliveriesDropped.Load(),
+	}
+
+	m.pipesMut.RLock()
+	for _, p := range m.pipes {
+		out.Campaigns = append(out.Campaigns, CampaignStats{
+			ID:       p.camp.ID,
+			Name:     p.camp.Name,
+			Sent:     p.totalSent.Load(),
+			Errors:   int64(p.errors.Load()),
+			SendRate: int(p.rate.Rate()),
+		})
+	}
+	m.pipesMut.RUnlock()
+
+	for name, s := range m.pushStats {
+		out.Messengers = append(out.Messengers, MessengerStats{
+			Name:    name,
+			Success: s.success.Load(),
+			Errors:  s.errors.Load(),
+			Latency: s.latency,
+		})
+	}
+
+	return out
+}
+
 // Run is a blocking function (that should be invoked as a goroutine)
 // that scans the data source at regular intervals for pending campaigns,
 // and queues them for processing. The process queue fetches batches of
@@ -266,6 +386,17 @@ func (m *Manager) Run() {
 		// Periodically scan campaigns and push running campaigns to nextPipes
 		// to fetch subscribers from the campaign.
 		go m.scanCampaigns(m.cfg.ScanInterval)
+
+		// Periodically scan automation sequences for messages that are due.
+		go m.scanSequences(sequenceScanInterval)
+
+		// Periodically scan recurring campaigns for runs that are due.
+		go m.scanRecurring(recurringScanInterval)
+	}
+
+	// Write campaign message delivery logs to the store.
+	if m.cfg.DeliveryLog {
+		go m.runDeliveryLog()
 	}
 
 	// Spawn N message workers.
@@ -391,10 +522,20 @@ func (m *Manager) StopCampaign(id int) {
 	m.pipesMut.RUnlock()
 }
 
-// Close closes and exits the campaign manager.
+// Close closes and exits the campaign manager. Queued campaign delivery log
+// entries are written to the store before returning.
 func (m *Manager) Close() {
 	close(m.nextPipes)
 	close(m.msgQ)
+
+	if m.cfg.DeliveryLog {
+		close(m.deliveriesStop)
+		select {
+		case <-m.deliveriesDone:
+		case <-time.After(deliveryCloseTimeout):
+			m.log.Printf("timed out writing campaign delivery log entries")
+		}
+	}
 }
 
 // scanCampaigns is a blocking function that periodically scans the data source
@@ -414,6 +555,18 @@ func (m *Manager) scanCampaigns(tick time.Duration) {
 		}
 
 		for _, c := range campaigns {
+			// The A/B test of the campaign has been sent and its wait period is over.
+			// Pick the winning variant to send to the rest of the audience.
+			if c.ABTestEndsAt.Valid && !c.ABWinnerID.Valid {
+				id, err := m.store.PickCampaignABWinner(c.ID)
+				if err != nil {
+					m.log.Printf("error picking A/B test winner of campaign (%s): %v", c.Name, err)
+					continue
+				}
+				c.ABWinnerID = null.IntFrom(id)
+				m.log.Printf("picked variant %d as the A/B test winner of campaign (%s)", id, c.Name)
+			}
+
 			// Create a new pipe that'll handle this campaign's states.
 			p, err := m.newPipe(c)
 			if err != nil {
@@ -450,6 +603,7 @@ func (m *Manager) worker() {
 			if msg.pipe != nil && msg.pipe.stopped.Load() {
 				// Reduce the message counter on the pipe.
 				msg.pipe.wg.Done()
+				m.recordDelivery(msg, models.DeliveryStatusSkipped, nil)
 				continue
 			}
 
@@ -496,9 +650,12 @@ func (m *Manager) worker() {
 			out.Headers = h
 
 			// Push the message to the messenger.
-			err := m.messengers[msg.Campaign.Messenger].Push(out)
+			err := m.push(msg.Campaign.Messenger, out)
 			if err != nil {
 				m.log.Printf("error sending message in campaign %s: subscriber %d: %v", msg.Campaign.Name, msg.Subscriber.ID, err)
+				m.recordDelivery(msg, models.DeliveryStatusFailed, err)
+			} else {
+				m.recordDelivery(msg, models.DeliveryStatusSent, nil)
 			}
 
 			// Increment the send rate or the error counter if there was an error.
@@ -517,6 +674,7 @@ func (m *Manager) worker() {
 					}
 					msg.pipe.rate.Incr(1)
 					msg.pipe.sent.Add(1)
+					msg.pipe.totalSent.Add(1)
 				}
 			}
 
@@ -527,13 +685,32 @@ func (m *Manager) worker() {
 			}
 
 			// Push the message to the messenger.
-			if err := m.messengers[msg.Messenger].Push(msg); err != nil {
+			err := m.push(msg.Messenger, msg)
+			if err != nil {
 				m.log.Printf("error sending message '%s': %v", msg.Subject, err)
 			}
+			m.recordTxStatus(msg, err)
 		}
 	}
 }
 
+// push pushes a message to the given messenger while recording its stats.
+func (m *Manager) push(name string, msg models.Message) error {
+	start := time.Now()
+	err := m.messengers[name].Push(msg)
+
+	if s, ok := m.pushStats[name]; ok {
+		s.latency.Since(start)
+		if err != nil {
+			s.errors.Add(1)
+		} else {
+			s.success.Add(1)
+		}
+	}
+
+	return err
+}
+
 // getCurrentCampaigns returns the IDs of campaigns currently being processed
 // and their sent counts.
 func (m *Manager) getCurrentCampaigns() ([]int64, []int64) {
@@ -2,12 +2,14 @@ package manager
 
 import (
 	"fmt"
+	"math"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/knadh/listmonk/models"
 	"github.com/paulbellamy/ratecounter"
+	null "gopkg.in/volatiletech/null.v6"
 )
 
 type pipe struct {
@@ -15,11 +17,21 @@ type pipe struct {
 	rate       *ratecounter.RateCounter
 	wg         *sync.WaitGroup
 	sent       atomic.Int64
+	totalSent  atomic.Int64
 	lastID     atomic.Uint64
 	errors     atomic.Uint64
 	stopped    atomic.Bool
 	withErrors atomic.Bool
 
+	// A/B test variants of the campaign, each compiled as a copy of the campaign,
+	// the winning variant (if picked), and the number of subscribers in the test
+	// audience who have been sent a variant.
+	variants   []*models.Campaign
+	variantIDs []int64
+	winner     *models.Campaign
+	abSent     int
+	abWaiting  atomic.Bool
+
 	m *Manager
 }
 
@@ -49,6 +61,13 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 		m:    m,
 	}
 
+	// Load the A/B test variants.
+	if c.ABTestPercent > 0 {
+		if err := p.loadVariants(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Increment the waitgroup so that Wait() blocks immediately. This is necessary
 	// as a campaign pipe is created first and subscribers/messages under it are
 	// fetched asynchronolusly later. The messages each add to the wg and that
@@ -74,8 +93,22 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 // in the current batch or not. A false indicates that all subscribers
 // have been processed, or that a campaign has been paused or cancelled.
 func (p *pipe) NextSubscribers() (bool, error) {
+	// If the campaign's A/B test is in progress, only fetch the remainder of the test audience.
+	var (
+		limit   = p.m.cfg.BatchSize
+		testing = p.isABTesting()
+	)
+	if testing {
+		rem := p.camp.ABTestSize - p.abSent
+		if rem <= 0 {
+			p.endABTest()
+			return false, nil
+		}
+		limit = min(limit, rem)
+	}
+
 	// Fetch the next batch of subscribers from a 'running' campaign.
-	subs, err := p.m.store.NextSubscribers(p.camp.ID, p.m.cfg.BatchSize)
+	subs, err := p.m.store.NextSubscribers(p.camp.ID, limit)
 	if err != nil {
 		return false, fmt.Errorf("error fetching campaign subscribers (%s): %v", p.camp.Name, err)
 	}
@@ -86,16 +119,23 @@ func (p *pipe) NextSubscribers() (bool, error) {
 		return false, nil
 	}
 
+	// The campaign (or variant) to send to each subscriber in the batch.
+	camps, err := p.assignVariants(subs, testing)
+	if err != nil {
+		return false, err
+	}
+
 	// Is there a sliding window limit configured?
 	hasSliding := p.m.cfg.SlidingWindow &&
 		p.m.cfg.SlidingWindowRate > 0 &&
 		p.m.cfg.SlidingWindowDuration.Seconds() > 1
 
 	// Push messages.
-	for _, s := range subs {
-		msg, err := p.newMessage(s)
+	for i, s := range subs {
+		msg, err := p.newMessage(camps[i], s)
 		if err != nil {
 			p.m.log.Printf("error rendering message (%s) (%s): %v", p.camp.Name, s.Email, err)
+			p.m.recordDelivery(msg, models.DeliveryStatusFailed, err)
 			continue
 		}
 
@@ -126,23 +166,132 @@ func (p *pipe) NextSubscribers() (bool, error) {
 					wait.Round(time.Second)*1)
 
 				p.m.slidingCount = 0
+				p.m.slidingWaits.Add(1)
+				p.m.slidingWait.Add(int64(wait))
 				time.Sleep(wait)
 			}
 		}
 	}
 
+	// The entire test audience has been sent a variant. End the pipe
+	// and wait for the test period to end.
+	if testing && p.abSent >= p.camp.ABTestSize {
+		p.endABTest()
+		return false, nil
+	}
+
 	return true, nil
 }
 
+// loadVariants fetches the A/B test variants of the campaign and compiles
+// each one as a copy of the campaign with the variant's subject and body.
+func (p *pipe) loadVariants() error {
+	vars, err := p.m.store.GetCampaignVariants(p.camp.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching variants: %v", err)
+	}
+	if len(vars) < 2 {
+		return fmt.Errorf("A/B test needs at least two variants, found %d", len(vars))
+	}
+
+	for _, v := range vars {
+		c := *p.camp
+		c.Subject = v.Subject
+		c.Body = v.Body
+		c.AltBody = v.AltBody
+		c.SubjectTpl = nil
+		c.AltBodyTpl = nil
+		if err := c.CompileTemplate(p.m.TemplateFuncs(p.camp)); err != nil {
+			return fmt.Errorf("error compiling variant %s: %v", v.Name, err)
+		}
+
+		p.variants = append(p.variants, &c)
+		p.variantIDs = append(p.variantIDs, int64(v.ID))
+		p.abSent += v.Subscribers
+
+		if p.camp.ABWinnerID.Valid && p.camp.ABWinnerID.Int == v.ID {
+			p.winner = &c
+		}
+	}
+
+	// Compute the size of the test audience the first time the campaign is processed.
+	if p.camp.ABTestSize == 0 {
+		size := max(int(math.Ceil(float64(p.camp.ToSend)*float64(p.camp.ABTestPercent)/100)), len(p.variants))
+		if err := p.m.store.UpdateCampaignABTest(p.camp.ID, size, null.Time{}); err != nil {
+			return fmt.Errorf("error updating A/B test size: %v", err)
+		}
+		p.camp.ABTestSize = size
+	}
+
+	return nil
+}
+
+// isABTesting returns true if the campaign's A/B test audience is yet to be sent.
+func (p *pipe) isABTesting() bool {
+	return len(p.variants) > 0 && !p.camp.ABWinnerID.Valid && !p.camp.ABTestEndsAt.Valid
+}
+
+// assignVariants returns the campaign to be sent to each subscriber in a batch.
+// During an A/B test, variants are distributed across the batch round-robin and the
+// assignments are recorded for attributing views and clicks. After the test, the
+// winning variant is sent to everyone.
+func (p *pipe) assignVariants(subs []models.Subscriber, testing bool) ([]*models.Campaign, error) {
+	out := make([]*models.Campaign, len(subs))
+	if !testing {
+		c := p.camp
+		if p.winner != nil {
+			c = p.winner
+		}
+		for i := range out {
+			out[i] = c
+		}
+		return out, nil
+	}
+
+	var (
+		subIDs = make([]int64, len(subs))
+		varIDs = make([]int64, len(subs))
+	)
+	for i, s := range subs {
+		n := (p.abSent + i) % len(p.variants)
+		out[i] = p.variants[n]
+		subIDs[i] = int64(s.ID)
+		varIDs[i] = p.variantIDs[n]
+	}
+
+	if err := p.m.store.RecordCampaignVariants(p.camp.ID, subIDs, varIDs); err != nil {
+		return nil, fmt.Errorf("error recording campaign variants (%s): %v", p.camp.Name, err)
+	}
+	p.abSent += len(subs)
+
+	return out, nil
+}
+
+// endABTest sets the time at which the campaign's A/B test ends and marks the pipe
+// as waiting so that the campaign isn't finished on cleanup. Once the wait period
+// is over, the campaign is picked up again and the winning variant is sent to the rest.
+func (p *pipe) endABTest() {
+	wait, _ := time.ParseDuration(p.camp.ABTestWait)
+	endsAt := time.Now().Add(wait)
+
+	if err := p.m.store.UpdateCampaignABTest(p.camp.ID, p.camp.ABTestSize, null.TimeFrom(endsAt)); err != nil {
+		p.m.log.Printf("error ending A/B test of campaign (%s): %v", p.camp.Name, err)
+	}
+
+	p.abWaiting.Store(true)
+	p.m.log.Printf("A/B test of campaign (%s) sent to %d subscribers. picking winner at %s",
+		p.camp.Name, p.abSent, endsAt.Format(time.RFC822Z))
+}
+
 // OnError keeps track of the number of errors that occur while sending messages
 // and pauses the campaign if the error threshold is met.
 func (p *pipe) OnError() {
+	count := p.errors.Add(1)
 	if p.m.cfg.MaxSendErrors < 1 {
 		return
 	}
 
 	// If the error threshold is met, pause the campaign.
-	count := p.errors.Add(1)
 	if int(count) < p.m.cfg.MaxSendErrors {
 		return
 	}
@@ -170,8 +319,8 @@ func (p *pipe) Stop(withErrors bool) {
 // newMessage returns a campaign message while internally incrementing the
 // number of messages in the pipe wait group so that the status of every
 // message can be atomically tracked.
-func (p *pipe) newMessage(s models.Subscriber) (CampaignMessage, error) {
-	msg, err := p.m.NewCampaignMessage(p.camp, s)
+func (p *pipe) newMessage(c *models.Campaign, s models.Subscriber) (CampaignMessage, error) {
+	msg, err := p.m.NewCampaignMessage(c, s)
 	if err != nil {
 		return msg, err
 	}
@@ -215,6 +364,29 @@ func (p *pipe) cleanup() {
 		return
 	}
 
+	// The A/B test audience has been sent. The campaign continues to run
+	// and is picked up again after the test period.
+	if p.abWaiting.Load() {
+		p.m.log.Printf("campaign (%s) waiting for A/B test results", p.camp.Name)
+		return
+	}
+
+	// The subscribers in the current local time window have been sent. If there
+	// are timezones yet to reach the send time, the campaign continues to run and
+	// is picked up again when the next one does.
+	if p.camp.SendLocalTime {
+		next, err := p.m.store.NextCampaignLocalWindow(p.camp.ID)
+		if err != nil {
+			p.m.log.Printf("error fetching next local time window of campaign (%s): %v", p.camp.Name, err)
+			return
+		}
+
+		if next.Valid {
+			p.m.log.Printf("campaign (%s) waiting for the next timezone at %s", p.camp.Name, next.Time.Format(time.RFC3339))
+			return
+		}
+	}
+
 	// Campaign wasn't manually stopped and subscribers were naturally exhausted.
 	// Fetch the up-to-date campaign status from the DB.
 	c, err := p.m.store.GetCampaign(p.camp.ID)
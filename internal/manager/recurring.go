@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gdgvda/cron"
+	"github.com/knadh/listmonk/models"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	// recurringScanInterval is the interval at which the store is scanned for
+	// recurring campaigns that are due to run.
+	recurringScanInterval = time.Minute
+
+	// recurringRetryInterval is the interval after which a run whose feed couldn't
+	// be fetched is retried, as long as it's before the next scheduled run.
+	recurringRetryInterval = time.Minute * 5
+)
+
+// scanRecurring is a blocking function that periodically fetches recurring
+// campaigns that are due and runs them.
+func (m *Manager) scanRecurring(tick time.Duration) {
+	t := time.NewTicker(tick)
+	defer t.Stop()
+
+	for range t.C {
+		camps, err := m.store.GetDueRecurringCampaigns()
+		if err != nil {
+			m.log.Printf("error fetching recurring campaigns: %v", err)
+			continue
+		}
+
+		for _, r := range camps {
+			m.runRecurring(r)
+		}
+	}
+}
+
+// runRecurring advances a due recurring campaign to its next run and clones
+// its campaign into a new instance that's sent right away. RSS campaigns are
+// skipped if the feed has no new items since the last run.
+func (m *Manager) runRecurring(r models.RecurringCampaign) {
+	// If the schedule is invalid, the campaign isn't scheduled any further.
+	var next null.Time
+	if sched, err := cron.ParseStandard(r.Cron); err != nil {
+		m.log.Printf("error parsing schedule of recurring campaign (%s): %v", r.Name, err)
+	} else {
+		next = null.TimeFrom(sched.Next(time.Now()))
+	}
+
+	// Another instance may have claimed the run already.
+	ok, err := m.store.ClaimRecurringCampaign(r.ID, r.NextRunAt, next)
+	if err != nil {
+		m.log.Printf("error updating recurring campaign (%s): %v", r.Name, err)
+		return
+	}
+	if !ok || !next.Valid {
+		return
+	}
+
+	var (
+		items      models.FeedItems
+		lastItemAt null.Time
+		seen       []string
+	)
+	if r.Type == models.RecurringTypeRSS {
+		all, err := fetchFeed(r.FeedURL)
+		if err != nil {
+			m.log.Printf("error fetching feed of recurring campaign (%s): %v", r.Name, err)
+
+			// Release the claimed run so that it's retried before the next scheduled run.
+			if retry := time.Now().Add(recurringRetryInterval); retry.Before(next.Time) {
+				if err := m.store.ReleaseRecurringCampaign(r.ID, next, null.TimeFrom(retry)); err != nil {
+					m.log.Printf("error updating recurring campaign (%s): %v", r.Name, err)
+				}
+			}
+			return
+		}
+
+		items = newFeedItems(all, r.FeedSeenItems, r.FeedLastItemAt)
+		if len(items) == 0 {
+			m.log.Printf("no new feed items for recurring campaign (%s). Skipping run.", r.Name)
+			return
+		}
+
+		// Items are sorted newest first. Undated ones are at the end.
+		if !items[0].PublishedAt.IsZero() {
+			lastItemAt = null.TimeFrom(items[0].PublishedAt)
+		}
+		seen = seenFeedItems(all, r.FeedSeenItems)
+	}
+
+	name := fmt.Sprintf("%s (%s)", r.Name, time.Now().Format("2006-01-02"))
+	id, err := m.store.CreateRecurringCampaignInstance(r.ID, r.CampaignID, name, items, lastItemAt, seen)
+	if err != nil {
+		m.log.Printf("error creating campaign for recurring campaign (%s): %v", r.Name, err)
+		return
+	}
+
+	m.log.Printf("created campaign %d (%s) for recurring campaign (%s)", id, name, r.Name)
+}
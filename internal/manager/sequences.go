@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// sequenceScanInterval is the interval at which the store is scanned for
+// automation sequence steps that are due to be sent to subscribers.
+const sequenceScanInterval = time.Minute
+
+// scanSequences is a blocking function that periodically fetches subscribers
+// who are due for the next step in automation sequences and queues the messages.
+func (m *Manager) scanSequences(tick time.Duration) {
+	t := time.NewTicker(tick)
+	defer t.Stop()
+
+	for range t.C {
+		// Keep fetching batches until there are no more due messages.
+		for {
+			msgs, err := m.store.NextSequenceMessages(m.cfg.BatchSize)
+			if err != nil {
+				m.log.Printf("error fetching sequence messages: %v", err)
+				break
+			}
+
+			// Subscribers whose messages failed are due again right away, so
+			// they're retried on the next scan instead of in this one.
+			failed := m.pushSequenceMessages(msgs)
+			if failed > 0 || len(msgs) < m.cfg.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// pushSequenceMessages compiles the sequence steps in a batch of due messages
+// and pushes them to the subscribers via the campaign message queue. The progress
+// of subscribers whose messages fail is reverted so that they're retried. It
+// returns the number of failed messages.
+func (m *Manager) pushSequenceMessages(msgs []models.SequenceMessage) int {
+	// Compiled steps in the batch.
+	steps := map[int]*models.Campaign{}
+
+	failed := 0
+	revert := func(s models.SequenceMessage) {
+		failed++
+		if err := m.store.RevertSequenceProgress(s); err != nil {
+			m.log.Printf("error reverting sequence progress of subscriber %d: %v", s.Subscriber.ID, err)
+		}
+	}
+
+	for _, s := range msgs {
+		c, ok := steps[s.StepID]
+		if !ok {
+			var err error
+			c, err = m.getSequenceStep(s.StepID)
+			if err != nil {
+				m.log.Printf("error processing sequence step %d: %v", s.StepID, err)
+			}
+
+			// Cache failed steps as well so that they're skipped for the rest of the batch.
+			steps[s.StepID] = c
+		}
+		if c == nil {
+			revert(s)
+			continue
+		}
+
+		msg, err := m.NewCampaignMessage(c, s.Subscriber)
+		if err != nil {
+			m.log.Printf("error rendering message (%s) (%s): %v", c.Name, c.Subject, err)
+			revert(s)
+			continue
+		}
+
+		if err := m.PushCampaignMessage(msg); err != nil {
+			m.log.Printf("error pushing sequence message (%s) to subscriber %d: %v", c.Name, s.Subscriber.ID, err)
+			revert(s)
+		}
+	}
+
+	return failed
+}
+
+// getSequenceStep fetches a sequence step as a campaign and compiles its templates.
+func (m *Manager) getSequenceStep(id int) (*models.Campaign, error) {
+	c, err := m.store.GetSequenceStep(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !m.HasMessenger(c.Messenger) {
+		return nil, fmt.Errorf("unknown messenger %s on sequence %s", c.Messenger, c.Name)
+	}
+
+	if err := c.CompileTemplate(m.sequenceTemplateFuncs(c)); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// sequenceTemplateFuncs returns the template functions for sequence messages.
+// Sequences aren't campaigns, so links and views in them aren't tracked and
+// they don't have archive pages.
+func (m *Manager) sequenceTemplateFuncs(c *models.Campaign) template.FuncMap {
+	f := m.TemplateFuncs(c)
+
+	f["TrackLink"] = func(url string, msg *CampaignMessage) string {
+		return url
+	}
+	f["TrackView"] = func(msg *CampaignMessage) template.HTML {
+		return ""
+	}
+	f["MessageURL"] = func(msg *CampaignMessage) string {
+		return ""
+	}
+
+	return f
+}
@@ -0,0 +1,265 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// DKIM (RFC 6376) signing.
+
+// dkimDefaultHeaders is the list of headers that are signed if no list is configured.
+// Only the headers that are present in a message are signed.
+var dkimDefaultHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID", "MIME-Version",
+	"Content-Type", "Content-Transfer-Encoding", "List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// DKIM represents the DKIM signing config of an SMTP server.
+type DKIM struct {
+	Enabled  bool   `json:"enabled"`
+	Domain   string `json:"domain"`
+	Selector string `json:"selector"`
+
+	// PEM encoded RSA (PKCS#1 or PKCS#8) or Ed25519 (PKCS#8) private key.
+	PrivateKey string `json:"private_key"`
+
+	// Colon or comma separated list of headers to sign, eg: From:Subject:Date.
+	Headers string `json:"headers"`
+
+	// header/body canonicalization, eg: relaxed/relaxed, relaxed/simple.
+	Canonicalization string `json:"canonicalization"`
+}
+
+// dkimSigner signs raw e-mail messages.
+type dkimSigner struct {
+	domain    string
+	selector  string
+	headers   []string
+	hdrCanon  dkim.Canonicalization
+	bodyCanon dkim.Canonicalization
+
+	key crypto.Signer
+}
+
+// newDKIMSigner parses and validates the DKIM config and returns a signer.
+func newDKIMSigner(d DKIM) (*dkimSigner, error) {
+	s := &dkimSigner{
+		domain:    strings.TrimSpace(d.Domain),
+		selector:  strings.TrimSpace(d.Selector),
+		hdrCanon:  dkim.CanonicalizationRelaxed,
+		bodyCanon: dkim.CanonicalizationRelaxed,
+	}
+	if s.domain == "" || s.selector == "" {
+		return nil, errors.New("DKIM domain and selector are required")
+	}
+
+	// Canonicalization. If only one algorithm is given, it applies to the headers
+	// and the body is canonicalized with 'simple' (RFC 6376 3.5).
+	if c := strings.ToLower(strings.TrimSpace(d.Canonicalization)); c != "" {
+		hc, bc, ok := strings.Cut(c, "/")
+		if !ok {
+			bc = string(dkim.CanonicalizationSimple)
+		}
+		for _, v := range []string{hc, bc} {
+			if v != string(dkim.CanonicalizationSimple) && v != string(dkim.CanonicalizationRelaxed) {
+				return nil, fmt.Errorf("unknown DKIM canonicalization '%s'", c)
+			}
+		}
+		s.hdrCanon, s.bodyCanon = dkim.Canonicalization(hc), dkim.Canonicalization(bc)
+	}
+
+	// Headers to sign. From is mandatory.
+	s.headers = dkimDefaultHeaders
+	if h := strings.TrimSpace(d.Headers); h != "" {
+		s.headers = nil
+		hasFrom := false
+		for _, f := range strings.FieldsFunc(h, func(r rune) bool { return r == ':' || r == ',' }) {
+			f = strings.TrimSpace(f)
+			if f == "" {
+				continue
+			}
+			if strings.EqualFold(f, "From") {
+				hasFrom = true
+			}
+			s.headers = append(s.headers, f)
+		}
+		if !hasFrom {
+			s.headers = append([]string{"From"}, s.headers...)
+		}
+	}
+
+	// Private key.
+	key, err := parseDKIMKey(d.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	s.key = key
+
+	if k, ok := key.(*rsa.PrivateKey); ok && k.N.BitLen() < 1024 {
+		return nil, errors.New("DKIM RSA key should be at least 1024 bits")
+	}
+
+	return s, nil
+}
+
+// parseDKIMKey parses a PEM encoded RSA or Ed25519 private key.
+func parseDKIMKey(str string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(str)))
+	if block == nil {
+		return nil, errors.New("invalid DKIM private key: no PEM data found")
+	}
+
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DKIM private key: %v", err)
+	}
+
+	switch key := k.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+
+	return nil, errors.New("invalid DKIM private key: only RSA and Ed25519 keys are supported")
+}
+
+// ValidateDKIM validates a DKIM config by signing a test message with it.
+func ValidateDKIM(d DKIM) error {
+	_, err := validateDKIM(d)
+	return err
+}
+
+// CheckDKIM validates a DKIM config and checks that the public key published
+// in the selector's DNS TXT record matches the private key.
+func CheckDKIM(d DKIM) error {
+	s, err := validateDKIM(d)
+	if err != nil {
+		return err
+	}
+
+	// Look up the public key.
+	host := s.selector + "._domainkey." + s.domain
+	recs, err := net.LookupTXT(host)
+	if err != nil {
+		return fmt.Errorf("error looking up DKIM DNS record %s: %v", host, err)
+	}
+
+	var pub crypto.PublicKey
+	for _, r := range recs {
+		if p, ok := parseDKIMRecord(r); ok {
+			pub = p
+			break
+		}
+	}
+	if pub == nil {
+		return fmt.Errorf("no valid DKIM public key found in DNS record %s", host)
+	}
+
+	if k, ok := s.key.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(pub) {
+		return fmt.Errorf("DKIM private key does not match the public key in DNS record %s", host)
+	}
+
+	return nil
+}
+
+func validateDKIM(d DKIM) (*dkimSigner, error) {
+	s, err := newDKIMSigner(d)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := "From: test@" + s.domain + "\r\nSubject: DKIM test\r\n\r\nTest\r\n"
+	if _, err := s.Sign([]byte(msg)); err != nil {
+		return nil, fmt.Errorf("error signing test message: %v", err)
+	}
+
+	return s, nil
+}
+
+// parseDKIMRecord parses the public key (p=) from a DKIM DNS TXT record.
+func parseDKIMRecord(rec string) (crypto.PublicKey, bool) {
+	var kType, p string
+	for _, t := range strings.Split(rec, ";") {
+		k, v, _ := strings.Cut(t, "=")
+		v = strings.Join(strings.Fields(v), "")
+		switch strings.TrimSpace(k) {
+		case "k":
+			kType = v
+		case "p":
+			p = v
+		}
+	}
+
+	b, err := base64.StdEncoding.DecodeString(p)
+	if err != nil || len(b) == 0 {
+		return nil, false
+	}
+
+	if kType == "ed25519" {
+		if len(b) != ed25519.PublicKeySize {
+			return nil, false
+		}
+		return ed25519.PublicKey(b), true
+	}
+
+	// RSA keys are published as SubjectPublicKeyInfo, and sometimes as PKCS#1.
+	if k, err := x509.ParsePKIXPublicKey(b); err == nil {
+		return k, true
+	}
+	if k, err := x509.ParsePKCS1PublicKey(b); err == nil {
+		return k, true
+	}
+
+	return nil, false
+}
+
+// Sign signs the given raw message and returns it with the DKIM-Signature
+// header prepended.
+func (s *dkimSigner) Sign(msg []byte) ([]byte, error) {
+	// Only the configured headers that are present in the message are signed.
+	// From is mandatory.
+	hdr, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(msg))).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(s.headers))
+	for _, h := range s.headers {
+		if _, ok := hdr[textproto.CanonicalMIMEHeaderKey(h)]; ok || strings.EqualFold(h, "From") {
+			keys = append(keys, h)
+		}
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(msg)+512))
+	if err := dkim.Sign(out, bytes.NewReader(msg), &dkim.SignOptions{
+		Domain:                 s.domain,
+		Selector:               s.selector,
+		Signer:                 s.key,
+		HeaderCanonicalization: s.hdrCanon,
+		BodyCanonicalization:   s.bodyCanon,
+		HeaderKeys:             keys,
+	}); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,269 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/knadh/listmonk/models"
+	"github.com/knadh/smtppool/v2"
+)
+
+const (
+	testDKIMDomain   = "example.com"
+	testDKIMSelector = "listmonk"
+)
+
+// testSMTPServer is a minimal SMTP server that accepts messages and sends
+// the raw DATA of each received message to the returned channel.
+func testSMTPServer(t *testing.T) (int, chan []byte) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	msgs := make(chan []byte, 10)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(c, msgs)
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port, msgs
+}
+
+func serveSMTP(c net.Conn, msgs chan []byte) {
+	defer c.Close()
+
+	tc := textproto.NewConn(c)
+	tc.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+
+		switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+		case "DATA":
+			tc.PrintfLine("354 Go ahead")
+			b, err := tc.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msgs <- b
+			tc.PrintfLine("250 OK")
+		case "QUIT":
+			tc.PrintfLine("221 Bye")
+			return
+		default:
+			tc.PrintfLine("250 OK")
+		}
+	}
+}
+
+// testDKIMKeys returns a PEM encoded private key and the DKIM DNS TXT record
+// of its public key.
+func testDKIMKeys(t *testing.T, typ string) (string, string) {
+	var (
+		key crypto.Signer
+		rec string
+	)
+	switch typ {
+	case "ed25519":
+		pub, k, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, rec = k, "v=DKIM1; k=ed25519; p="+base64.StdEncoding.EncodeToString(pub)
+	default:
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := x509.MarshalPKIXPublicKey(k.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, rec = k, "v=DKIM1; k=rsa; p="+base64.StdEncoding.EncodeToString(pub)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), rec
+}
+
+func TestDKIMSignVerify(t *testing.T) {
+	port, msgs := testSMTPServer(t)
+
+	for _, tc := range []struct {
+		key   string
+		canon string
+	}{
+		{"rsa", "relaxed/relaxed"},
+		{"rsa", "simple/simple"},
+		{"rsa", "relaxed/simple"},
+		{"ed25519", "relaxed/relaxed"},
+		{"ed25519", "simple/simple"},
+	} {
+		t.Run(tc.key+"-"+tc.canon, func(t *testing.T) {
+			key, rec := testDKIMKeys(t, tc.key)
+
+			e, err := New("email", Server{
+				AuthProtocol: "none",
+				TLSType:      "none",
+				EmailHeaders: map[string]string{"X-Mailer": "listmonk"},
+				DKIM: DKIM{
+					Enabled:          true,
+					Domain:           testDKIMDomain,
+					Selector:         testDKIMSelector,
+					PrivateKey:       key,
+					Canonicalization: tc.canon,
+				},
+				Opt: smtppool.Opt{Host: "127.0.0.1", Port: port, MaxConns: 1},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer e.Close()
+
+			// A multipart message with folded headers, trailing whitespace, lines
+			// starting with dots, and an attachment.
+			err = e.Push(models.Message{
+				From:        "Listmonk <noreply@example.com>",
+				To:          []string{"Subscriber <user@example.org>"},
+				Subject:     "A long subject line that is likely to be folded by the mail renderer at some point",
+				ContentType: "html",
+				Body:        []byte("<p>Hello   there \t</p>\r\n.leading dot\r\n\r\n\r\n"),
+				AltBody:     []byte("Hello   there \t\r\n.leading dot\r\n"),
+				Headers: textproto.MIMEHeader{
+					"List-Unsubscribe": {"<https://example.com/unsub>"},
+				},
+				Attachments: []models.Attachment{{
+					Name:    "file.txt",
+					Header:  textproto.MIMEHeader{"Content-Type": {"text/plain"}, "Content-Disposition": {`attachment; filename="file.txt"`}, "Content-Transfer-Encoding": {"base64"}},
+					Content: []byte("attachment"),
+				}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			vs, err := dkim.VerifyWithOptions(bytes.NewReader(<-msgs), &dkim.VerifyOptions{
+				LookupTXT: func(domain string) ([]string, error) {
+					if domain != testDKIMSelector+"._domainkey."+testDKIMDomain {
+						t.Errorf("unexpected DKIM lookup %s", domain)
+					}
+					return []string{rec}, nil
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(vs) != 1 {
+				t.Fatalf("expected 1 signature, got %d", len(vs))
+			}
+			if vs[0].Err != nil {
+				t.Fatalf("signature verification failed: %v", vs[0].Err)
+			}
+			if vs[0].Domain != testDKIMDomain {
+				t.Errorf("expected domain %s, got %s", testDKIMDomain, vs[0].Domain)
+			}
+
+			// Signed headers that are present in the message.
+			signed := strings.ToLower(strings.Join(vs[0].HeaderKeys, ":"))
+			for _, h := range []string{"from", "to", "subject", "date", "message-id", "list-unsubscribe"} {
+				if !strings.Contains(signed, h) {
+					t.Errorf("expected %s to be signed, got %s", h, signed)
+				}
+			}
+			if strings.Contains(signed, "reply-to") {
+				t.Errorf("expected absent Reply-To to not be signed, got %s", signed)
+			}
+		})
+	}
+}
+
+func TestDKIMTamperedBody(t *testing.T) {
+	key, rec := testDKIMKeys(t, "rsa")
+	s, err := newDKIMSigner(DKIM{Domain: testDKIMDomain, Selector: testDKIMSelector, PrivateKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := s.Sign([]byte("From: noreply@example.com\r\nSubject: Test\r\n\r\nHello\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = bytes.Replace(b, []byte("Hello"), []byte("Howdy"), 1)
+
+	vs, err := dkim.VerifyWithOptions(bufio.NewReader(bytes.NewReader(b)), &dkim.VerifyOptions{
+		LookupTXT: func(string) ([]string, error) { return []string{rec}, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 1 || vs[0].Err == nil {
+		t.Fatal("expected verification of a tampered message to fail")
+	}
+}
+
+func TestRawSenderStall(t *testing.T) {
+	// A server that accepts connections and greets, but never responds after.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				c.Write([]byte("220 localhost ESMTP\r\n"))
+				io.Copy(io.Discard, c)
+			}()
+		}
+	}()
+
+	s := newRawSender(smtppool.Opt{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port})
+	s.ioTimeout = time.Millisecond * 200
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Send("from@example.com", []string{"to@example.com"}, []byte("Subject: test\r\n\r\ntest\r\n"))
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error from a stalled server")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("send blocked on a stalled server")
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"crypto/tls"
 	"fmt"
 	"math/rand"
+	"net/mail"
 	"net/smtp"
 	"net/textproto"
 	"strings"
+	"sync/atomic"
 
 	"github.com/knadh/listmonk/models"
 	"github.com/knadh/smtppool/v2"
@@ -30,6 +32,7 @@ type Server struct {
 	TLSType       string            `json:"tls_type"`
 	TLSSkipVerify bool              `json:"tls_skip_verify"`
 	EmailHeaders  map[string]string `json:"email_headers"`
+	DKIM          DKIM              `json:"dkim"`
 
 	// Rest of the options are embedded directly from the smtppool lib.
 	// The JSON tag is for config unmarshal to work.
@@ -37,6 +40,21 @@ type Server struct {
 	smtppool.Opt `json:",squash"`
 
 	pool *smtppool.Pool
+
+	// If DKIM is enabled, messages are signed and sent via the raw sender
+	// instead of the pool.
+	dkim *dkimSigner
+	raw  *rawSender
+
+	// Number of messages that are being sent at the moment.
+	busy int64
+}
+
+// ServerStats represents the connection usage of an SMTP server.
+type ServerStats struct {
+	Host     string
+	MaxConns int
+	Busy     int
 }
 
 // Emailer is the SMTP e-mail messenger.
@@ -90,12 +108,22 @@ func New(name string, servers ...Server) (*Emailer, error) {
 			}
 		}
 
-		pool, err := smtppool.New(s.Opt)
-		if err != nil {
-			return nil, err
+		// DKIM signing.
+		if s.DKIM.Enabled {
+			sg, err := newDKIMSigner(s.DKIM)
+			if err != nil {
+				return nil, err
+			}
+			s.dkim = sg
+			s.raw = newRawSender(s.Opt)
+		} else {
+			pool, err := smtppool.New(s.Opt)
+			if err != nil {
+				return nil, err
+			}
+			s.pool = pool
 		}
 
-		s.pool = pool
 		e.servers = append(e.servers, &s)
 	}
 
@@ -189,9 +217,30 @@ func (e *Emailer) Push(m models.Message) error {
 		}
 	}
 
+	atomic.AddInt64(&srv.busy, 1)
+	defer atomic.AddInt64(&srv.busy, -1)
+
+	if srv.dkim != nil {
+		return srv.sendSigned(em)
+	}
+
 	return srv.pool.Send(em)
 }
 
+// Stats returns the connection usage of the SMTP servers.
+func (e *Emailer) Stats() []ServerStats {
+	out := make([]ServerStats, 0, len(e.servers))
+	for _, s := range e.servers {
+		out = append(out, ServerStats{
+			Host:     fmt.Sprintf("%s:%d", s.Host, s.Port),
+			MaxConns: s.MaxConns,
+			Busy:     int(atomic.LoadInt64(&s.busy)),
+		})
+	}
+
+	return out
+}
+
 // Flush flushes the message queue to the server.
 func (e *Emailer) Flush() error {
 	return nil
@@ -200,7 +249,48 @@ func (e *Emailer) Flush() error {
 // Close closes the SMTP pools.
 func (e *Emailer) Close() error {
 	for _, s := range e.servers {
+		if s.raw != nil {
+			s.raw.Close()
+			continue
+		}
 		s.pool.Close()
 	}
 	return nil
 }
+
+// sendSigned renders the e-mail, signs it with DKIM, and sends the raw message.
+func (s *Server) sendSigned(em smtppool.Email) error {
+	b, err := em.Bytes()
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.dkim.Sign(b)
+	if err != nil {
+		return fmt.Errorf("error signing message with DKIM: %v", err)
+	}
+
+	// SMTP envelope sender.
+	sender := em.Sender
+	if sender == "" {
+		sender = em.From
+	}
+	from, err := mail.ParseAddress(sender)
+	if err != nil {
+		return err
+	}
+
+	// Envelope recipients.
+	rcpts := make([]string, 0, len(em.To)+len(em.Cc)+len(em.Bcc))
+	for _, list := range [][]string{em.To, em.Cc, em.Bcc} {
+		for _, a := range list {
+			addr, err := mail.ParseAddress(a)
+			if err != nil {
+				return err
+			}
+			rcpts = append(rcpts, addr.Address)
+		}
+	}
+
+	return s.raw.Send(from.Address, rcpts, msg)
+}
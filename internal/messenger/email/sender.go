@@ -0,0 +1,264 @@
+package email
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/knadh/smtppool/v2"
+)
+
+// rawConnTimeout is the maximum time to wait for a read or write on an SMTP
+// connection, so that a server that stalls mid-conversation doesn't block
+// the sender forever.
+const rawConnTimeout = time.Minute
+
+// rawSender sends pre-rendered messages over a small pool of SMTP connections.
+// smtppool renders an Email on every send (with new MIME boundaries), which
+// would invalidate a DKIM signature computed on an earlier rendering. Signed
+// messages are thus rendered once and written as-is via rawSender.
+type rawSender struct {
+	opt       smtppool.Opt
+	ioTimeout time.Duration
+
+	// Idle connections and the semaphore limiting the number of open connections.
+	conns chan *rawConn
+	sem   chan struct{}
+}
+
+type rawConn struct {
+	cl           *smtp.Client
+	lastActivity time.Time
+}
+
+// deadlineConn is a net.Conn that extends its deadline by timeout before every
+// read and write.
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+func newRawSender(o smtppool.Opt) *rawSender {
+	if o.MaxConns < 1 {
+		o.MaxConns = 1
+	}
+	if o.MaxMessageRetries < 1 {
+		o.MaxMessageRetries = 1
+	}
+	if o.PoolWaitTimeout.Seconds() < 1 {
+		o.PoolWaitTimeout = time.Second * 2
+	}
+
+	return &rawSender{
+		opt:       o,
+		ioTimeout: rawConnTimeout,
+		conns:     make(chan *rawConn, o.MaxConns),
+		sem:       make(chan struct{}, o.MaxConns),
+	}
+}
+
+// Send sends a raw message to the given recipients. On network errors,
+// the message is retried on a new connection.
+func (s *rawSender) Send(from string, to []string, msg []byte) error {
+	select {
+	case s.sem <- struct{}{}:
+	case <-time.After(s.opt.PoolWaitTimeout):
+		return errors.New("timed out waiting for free SMTP conn")
+	}
+	defer func() { <-s.sem }()
+
+	var lastErr error
+	for range s.opt.MaxMessageRetries {
+		c, err := s.getConn()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		err = c.send(from, to, msg)
+		s.putConn(c, err)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		// SMTP protocol errors (rejections) are not retried.
+		if _, ok := err.(*textproto.Error); ok {
+			return err
+		}
+	}
+
+	return lastErr
+}
+
+// Close closes all idle connections.
+func (s *rawSender) Close() {
+	for {
+		select {
+		case c := <-s.conns:
+			c.cl.Close()
+		default:
+			return
+		}
+	}
+}
+
+// getConn returns an idle connection or creates a new one.
+func (s *rawSender) getConn() (*rawConn, error) {
+	for {
+		select {
+		case c := <-s.conns:
+			if s.opt.IdleTimeout > 0 && time.Since(c.lastActivity) > s.opt.IdleTimeout {
+				c.cl.Close()
+				continue
+			}
+			return c, nil
+		default:
+			return s.newConn()
+		}
+	}
+}
+
+// putConn returns a connection to the idle pool, or closes it if the last
+// transaction on it failed with a non-protocol error.
+func (s *rawSender) putConn(c *rawConn, lastErr error) {
+	if lastErr != nil {
+		if _, ok := lastErr.(*textproto.Error); !ok {
+			c.cl.Close()
+			return
+		}
+	}
+
+	// RSET the connection before reusing it.
+	if err := c.cl.Reset(); err != nil {
+		c.cl.Close()
+		return
+	}
+
+	select {
+	case s.conns <- c:
+	default:
+		c.cl.Close()
+	}
+}
+
+// newConn creates a new SMTP connection with the same semantics as smtppool.
+func (s *rawSender) newConn() (c *rawConn, err error) {
+	var (
+		netCon net.Conn
+		addr   = net.JoinHostPort(s.opt.Host, strconv.Itoa(s.opt.Port))
+	)
+
+	netCon, err = net.DialTimeout("tcp", addr, s.opt.PoolWaitTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every read and write, including the TLS handshakes, times out if the server stalls.
+	netCon = &deadlineConn{Conn: netCon, timeout: s.ioTimeout}
+
+	if s.opt.SSL == smtppool.SSLTLS {
+		tc := tls.Client(netCon, s.tlsConfig())
+		if err = tc.Handshake(); err != nil {
+			netCon.Close()
+			return nil, err
+		}
+		netCon = tc
+	}
+
+	cl, err := smtp.NewClient(netCon, s.opt.Host)
+	if err != nil {
+		netCon.Close()
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			cl.Close()
+		}
+	}()
+
+	if s.opt.HelloHostname != "" {
+		if err = cl.Hello(s.opt.HelloHostname); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.opt.SSL == smtppool.SSLSTARTTLS {
+		if ok, _ := cl.Extension("STARTTLS"); !ok {
+			err = errors.New("SMTP STARTTLS extension not found")
+			return nil, err
+		}
+		if err = cl.StartTLS(s.opt.TLSConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.opt.Auth != nil {
+		if ok, _ := cl.Extension("AUTH"); !ok {
+			err = errors.New("SMTP AUTH extension not found")
+			return nil, err
+		}
+		if err = cl.Auth(s.opt.Auth); err != nil {
+			return nil, err
+		}
+	}
+
+	return &rawConn{cl: cl}, nil
+}
+
+// tlsConfig returns the TLS config for the connection with the server name set,
+// as tls.Dial does.
+func (s *rawSender) tlsConfig() *tls.Config {
+	if s.opt.TLSConfig == nil {
+		return &tls.Config{ServerName: s.opt.Host}
+	}
+	if s.opt.TLSConfig.ServerName != "" || s.opt.TLSConfig.InsecureSkipVerify {
+		return s.opt.TLSConfig
+	}
+
+	c := s.opt.TLSConfig.Clone()
+	c.ServerName = s.opt.Host
+	return c
+}
+
+func (c *rawConn) send(from string, to []string, msg []byte) error {
+	c.lastActivity = time.Now()
+
+	if err := c.cl.Mail(from); err != nil {
+		return err
+	}
+	for _, r := range to {
+		if err := c.cl.Rcpt(r); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.cl.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,314 @@
+// Package metrics implements a minimal registry of counters, gauges, and
+// histograms that are exposed in the Prometheus text exposition format.
+// Counters and histograms are updated as events occur, while gauges are
+// collected from callbacks at the time of scraping.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metric types.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefBuckets are the default histogram buckets (in seconds) that are suitable
+// for network request latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// Set is a registry of metrics.
+type Set struct {
+	mu         sync.RWMutex
+	descs      map[string]desc
+	counters   map[string]*Counter
+	histograms map[string]*Histogram
+	collectors []func(*Writer)
+}
+
+type desc struct {
+	typ  string
+	help string
+}
+
+// Counter is a monotonically increasing counter.
+type Counter struct {
+	n atomic.Uint64
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Writer writes metrics in the Prometheus text format.
+type Writer struct {
+	lines map[string][]string
+}
+
+// New returns a new metrics Set.
+func New() *Set {
+	return &Set{
+		descs:      make(map[string]desc),
+		counters:   make(map[string]*Counter),
+		histograms: make(map[string]*Histogram),
+	}
+}
+
+// Describe sets the type and help text of a metric.
+func (s *Set) Describe(name, typ, help string) {
+	s.mu.Lock()
+	s.descs[name] = desc{typ: typ, help: help}
+	s.mu.Unlock()
+}
+
+// Counter returns the counter with the given name and label pairs,
+// creating it if it doesn't exist. eg: Counter("x_total", "source", "api").
+func (s *Set) Counter(name string, labels ...string) *Counter {
+	key := name + formatLabels(labels)
+
+	s.mu.RLock()
+	c, ok := s.counters[key]
+	s.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.counters[key]; ok {
+		return c
+	}
+
+	c = &Counter{}
+	s.counters[key] = c
+
+	return c
+}
+
+// Histogram returns the histogram with the given name and label pairs,
+// creating it with the default buckets if it doesn't exist.
+func (s *Set) Histogram(name string, labels ...string) *Histogram {
+	key := name + formatLabels(labels)
+
+	s.mu.RLock()
+	h, ok := s.histograms[key]
+	s.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h, ok := s.histograms[key]; ok {
+		return h
+	}
+
+	h = NewHistogram(DefBuckets)
+	s.histograms[key] = h
+
+	return h
+}
+
+// Collect registers a callback that's invoked on every scrape to write
+// metrics whose values are read from other components, for instance,
+// queue depths.
+func (s *Set) Collect(fn func(*Writer)) {
+	s.mu.Lock()
+	s.collectors = append(s.collectors, fn)
+	s.mu.Unlock()
+}
+
+// WritePrometheus writes all metrics in the Prometheus text format.
+func (s *Set) WritePrometheus(w io.Writer) error {
+	wr := &Writer{lines: make(map[string][]string)}
+
+	s.mu.RLock()
+	for key, c := range s.counters {
+		name, labels := splitKey(key)
+		wr.add(name, name+labels+" "+formatValue(float64(c.Value())))
+	}
+	for key, h := range s.histograms {
+		name, labels := splitKey(key)
+		wr.histogram(name, labels, h)
+	}
+	collectors := slices.Clone(s.collectors)
+	s.mu.RUnlock()
+
+	for _, fn := range collectors {
+		fn(wr)
+	}
+
+	// Write metric families sorted by name.
+	names := make([]string, 0, len(wr.lines))
+	for n := range wr.lines {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var b strings.Builder
+	for _, n := range names {
+		if d, ok := s.descs[n]; ok {
+			b.WriteString("# HELP " + n + " " + d.help + "\n")
+			b.WriteString("# TYPE " + n + " " + d.typ + "\n")
+		}
+
+		// Histogram lines are written in bucket order.
+		lines := wr.lines[n]
+		if s.descs[n].typ != TypeHistogram {
+			sort.Strings(lines)
+		}
+		for _, l := range lines {
+			b.WriteString(l + "\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	c.n.Add(1)
+}
+
+// Add increments the counter by n.
+func (c *Counter) Add(n uint64) {
+	c.n.Add(n)
+}
+
+// Value returns the value of the counter.
+func (c *Counter) Value() uint64 {
+	return c.n.Load()
+}
+
+// NewHistogram returns a new histogram with the given upper bounds of buckets.
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// Observe records a value.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+// Since records the time elapsed since t in seconds.
+func (h *Histogram) Since(t time.Time) {
+	h.Observe(time.Since(t).Seconds())
+}
+
+// Counter writes a counter value that's collected at the time of scraping.
+func (w *Writer) Counter(name string, v float64, labels ...string) {
+	w.add(name, name+formatLabels(labels)+" "+formatValue(v))
+}
+
+// Gauge writes a gauge value.
+func (w *Writer) Gauge(name string, v float64, labels ...string) {
+	w.add(name, name+formatLabels(labels)+" "+formatValue(v))
+}
+
+// Histogram writes a histogram that's maintained outside the Set.
+func (w *Writer) Histogram(name string, h *Histogram, labels ...string) {
+	w.histogram(name, formatLabels(labels), h)
+}
+
+func (w *Writer) histogram(name, labels string, h *Histogram) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Bucket labels are appended to the metric's labels.
+	lb := "{"
+	if labels != "" {
+		lb = strings.TrimSuffix(labels, "}") + ","
+	}
+
+	for i, b := range h.buckets {
+		w.add(name, fmt.Sprintf(`%s_bucket%sle="%s"} %d`, name, lb, formatValue(b), h.counts[i]))
+	}
+	w.add(name, fmt.Sprintf(`%s_bucket%sle="+Inf"} %d`, name, lb, h.count))
+	w.add(name, name+"_sum"+labels+" "+formatValue(h.sum))
+	w.add(name, name+"_count"+labels+" "+strconv.FormatUint(h.count, 10))
+}
+
+func (w *Writer) add(name, line string) {
+	w.lines[name] = append(w.lines[name], line)
+}
+
+// formatLabels formats key-value label pairs as {k="v",...}.
+func formatLabels(pairs []string) string {
+	if len(pairs) < 2 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// splitKey splits a metric key into the name and the formatted labels.
+func splitKey(key string) (string, string) {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		return key[:i], key[i:]
+	}
+
+	return key, ""
+}
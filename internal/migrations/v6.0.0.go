@@ -0,0 +1,511 @@
+package migrations
+
+import (
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/knadh/koanf/v2"
+	"github.com/knadh/stuffbin"
+)
+
+// V6_0_0 performs the DB migrations.
+func V6_0_0(db *sqlx.DB, fs stuffbin.FileSystem, ko *koanf.Koanf, lo *log.Logger) error {
+	// Campaign delivery log.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'delivery_status') THEN
+				CREATE TYPE delivery_status AS ENUM ('sent', 'failed', 'skipped');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS campaign_deliveries (
+			id               BIGSERIAL PRIMARY KEY,
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			messenger        TEXT NOT NULL,
+			status           delivery_status NOT NULL,
+			error            TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_deliveries_camp_id ON campaign_deliveries(campaign_id);
+		CREATE INDEX IF NOT EXISTS idx_deliveries_sub_id ON campaign_deliveries(subscriber_id);
+		CREATE INDEX IF NOT EXISTS idx_deliveries_created_at ON campaign_deliveries(created_at);
+
+		INSERT INTO settings (key, value) VALUES ('app.delivery_log', 'true') ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Campaign A/B test variants.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'ab_test_metric') THEN
+				CREATE TYPE ab_test_metric AS ENUM ('views', 'clicks');
+			END IF;
+		END$$;
+
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_test_percent INT NOT NULL DEFAULT 0;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_test_metric ab_test_metric NOT NULL DEFAULT 'views';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_test_wait TEXT NOT NULL DEFAULT '4h';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_test_size INT NOT NULL DEFAULT 0;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_test_ends_at TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_winner_id INT NULL;
+
+		CREATE TABLE IF NOT EXISTS campaign_variants (
+			id               SERIAL PRIMARY KEY,
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			name             TEXT NOT NULL,
+			subject          TEXT NOT NULL,
+			body             TEXT NOT NULL,
+			altbody          TEXT NULL,
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_camp_variants_name ON campaign_variants (campaign_id, name);
+
+		CREATE TABLE IF NOT EXISTS campaign_variant_subscribers (
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			variant_id       INTEGER NOT NULL REFERENCES campaign_variants(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+			PRIMARY KEY (campaign_id, subscriber_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_camp_variant_subs_variant_id ON campaign_variant_subscribers(variant_id);
+	`); err != nil {
+		return err
+	}
+
+	// Automation sequences.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'sequence_status') THEN
+				CREATE TYPE sequence_status AS ENUM ('active', 'disabled');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS sequences (
+			id               SERIAL PRIMARY KEY,
+			uuid uuid        NOT NULL UNIQUE,
+			name             TEXT NOT NULL,
+			list_id          INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			status           sequence_status NOT NULL DEFAULT 'active',
+			from_email       TEXT NOT NULL,
+			messenger        TEXT NOT NULL,
+			template_id      INTEGER REFERENCES templates(id) ON DELETE SET NULL,
+			headers          JSONB NOT NULL DEFAULT '[]',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_sequences_list_id ON sequences(list_id);
+
+		CREATE TABLE IF NOT EXISTS sequence_steps (
+			id               SERIAL PRIMARY KEY,
+			sequence_id      INTEGER NOT NULL REFERENCES sequences(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			position         INT NOT NULL,
+
+			delay_hours      INT NOT NULL DEFAULT 0,
+
+			subject          TEXT NOT NULL,
+			body             TEXT NOT NULL,
+			altbody          TEXT NULL,
+			content_type     content_type NOT NULL DEFAULT 'richtext',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_sequence_steps_pos ON sequence_steps(sequence_id, position);
+
+		CREATE TABLE IF NOT EXISTS sequence_subscribers (
+			sequence_id      INTEGER NOT NULL REFERENCES sequences(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+			last_position    INT NOT NULL DEFAULT 0,
+			last_delay_hours INT NOT NULL DEFAULT 0,
+
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+			PRIMARY KEY (sequence_id, subscriber_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_sequence_subs_sub_id ON sequence_subscribers(subscriber_id);
+	`); err != nil {
+		return err
+	}
+
+	// Saved subscriber segments.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS segments (
+			id               SERIAL PRIMARY KEY,
+			name             TEXT NOT NULL,
+			description      TEXT NOT NULL DEFAULT '',
+			list_ids         INT[] NOT NULL DEFAULT '{}',
+			query            TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS segment_id INTEGER NULL REFERENCES segments(id) ON DELETE SET NULL;
+	`); err != nil {
+		return err
+	}
+
+	// Outbound event webhooks.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'webhook_delivery_status') THEN
+				CREATE TYPE webhook_delivery_status AS ENUM ('pending', 'success', 'failed');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id               SERIAL PRIMARY KEY,
+			name             TEXT NOT NULL,
+			url              TEXT NOT NULL,
+			secret           TEXT NOT NULL,
+			events           TEXT[] NOT NULL DEFAULT '{}',
+			enabled          BOOLEAN NOT NULL DEFAULT true,
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id               BIGSERIAL PRIMARY KEY,
+			webhook_id       INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			event            TEXT NOT NULL,
+			payload          JSONB NOT NULL DEFAULT '{}',
+			status           webhook_delivery_status NOT NULL DEFAULT 'pending',
+			attempts         INT NOT NULL DEFAULT 0,
+			response_code    INT NULL,
+			response         TEXT NOT NULL DEFAULT '',
+			next_attempt_at  TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+	`); err != nil {
+		return err
+	}
+
+	// Campaign delivery at subscribers' local time.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS send_local_time BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS send_timezone TEXT NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS local_window_start TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS local_window_end TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS local_next_at TIMESTAMP WITH TIME ZONE NULL;
+	`); err != nil {
+		return err
+	}
+
+	// TOTP 2FA.
+	if _, err := db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT NULL;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_recovery_codes TEXT[] NOT NULL DEFAULT '{}';
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE roles ADD COLUMN IF NOT EXISTS require_2fa BOOLEAN NOT NULL DEFAULT false;
+	`); err != nil {
+		return err
+	}
+
+	// Audit log.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id               BIGSERIAL PRIMARY KEY,
+			user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			username         TEXT NOT NULL DEFAULT '',
+			action           TEXT NOT NULL,
+			target_type      TEXT NOT NULL DEFAULT '',
+			target_id        INTEGER NULL,
+			before           JSONB NULL,
+			after            JSONB NULL,
+			meta             JSONB NOT NULL DEFAULT '{}',
+			ip               TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log(user_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+	`); err != nil {
+		return err
+	}
+
+	// Multiple hashed API tokens per API user. Move the existing plaintext
+	// tokens of API users (stored as their passwords) to the tokens table.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id               SERIAL PRIMARY KEY,
+			user_id          INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			name             TEXT NOT NULL,
+			token_hash       TEXT NOT NULL UNIQUE,
+			token_prefix     TEXT NOT NULL DEFAULT '',
+			permissions      TEXT[] NOT NULL DEFAULT '{}',
+			ip_allowlist     TEXT[] NOT NULL DEFAULT '{}',
+			expires_at       TIMESTAMP WITH TIME ZONE NULL,
+			last_used_at     TIMESTAMP WITH TIME ZONE NULL,
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+
+		INSERT INTO api_tokens (user_id, name, token_hash, token_prefix)
+			SELECT id, 'default', ENCODE(DIGEST(password, 'sha256'), 'hex'), LEFT(password, 4) FROM users
+			WHERE type = 'api' AND password IS NOT NULL AND password != ''
+			ON CONFLICT (token_hash) DO NOTHING;
+		UPDATE users SET password = NULL WHERE type = 'api';
+	`); err != nil {
+		return err
+	}
+
+	// Rate limiting and abuse protection of public subscription endpoints.
+	if _, err := db.Exec(`
+		CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_counters (
+			key              TEXT NOT NULL,
+			window_start     TIMESTAMP WITH TIME ZONE NOT NULL,
+			hits             INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (key, window_start)
+		);
+
+		CREATE TABLE IF NOT EXISTS rate_limit_blocks (
+			id               SERIAL PRIMARY KEY,
+			scope            TEXT NOT NULL,
+			value            TEXT NOT NULL,
+			expires_at       TIMESTAMP WITH TIME ZONE NOT NULL,
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+			UNIQUE (scope, value)
+		);
+
+		CREATE TABLE IF NOT EXISTS abuse_events (
+			id               BIGSERIAL PRIMARY KEY,
+			type             TEXT NOT NULL,
+			scope            TEXT NOT NULL,
+			value            TEXT NOT NULL,
+			ip               TEXT NOT NULL DEFAULT '',
+			route            TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_abuse_events_created_at ON abuse_events(created_at);
+
+		INSERT INTO settings (key, value) VALUES ('security.rate_limit',
+			'{"enabled": false, "backend": "memory", "window": "1m", "ip_rate": 10, "domain_rate": 50, "block_threshold": 20, "block_duration": "1h"}')
+			ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Subscriber attribute schema.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'attrib_type') THEN
+				CREATE TYPE attrib_type AS ENUM ('string', 'number', 'boolean', 'date', 'list');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS subscriber_attribs (
+			id              SERIAL PRIMARY KEY,
+			key             TEXT NOT NULL UNIQUE,
+			name            TEXT NOT NULL DEFAULT '',
+			type            attrib_type NOT NULL DEFAULT 'string',
+			required        BOOLEAN NOT NULL DEFAULT false,
+			enum            TEXT[] NOT NULL DEFAULT '{}',
+			default_value   JSONB NULL,
+			description     TEXT NOT NULL DEFAULT '',
+
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Custom fields on the public subscription form.
+	if _, err := db.Exec(`INSERT INTO settings (key, value) VALUES ('app.public_form_fields', '[]') ON CONFLICT DO NOTHING`); err != nil {
+		return err
+	}
+
+	// Named subscription forms.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS subscription_forms (
+			id                SERIAL PRIMARY KEY,
+			uuid              uuid NOT NULL UNIQUE,
+			name              TEXT NOT NULL,
+			description       TEXT NOT NULL DEFAULT '',
+			list_ids          INT[] NOT NULL DEFAULT '{}',
+			success_url       TEXT NOT NULL DEFAULT '',
+			failure_url       TEXT NOT NULL DEFAULT '',
+			optin_template_id INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			captcha           BOOLEAN NOT NULL DEFAULT true,
+			created_at        TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at        TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Queued subscriber import jobs.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'import_status') THEN
+				CREATE TYPE import_status AS ENUM ('queued', 'importing', 'stopping', 'finished', 'failed', 'stopped');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS import_jobs (
+			id               SERIAL PRIMARY KEY,
+			name             TEXT NOT NULL,
+			status           import_status NOT NULL DEFAULT 'queued',
+			params           JSONB NOT NULL DEFAULT '{}',
+			file_path        TEXT NOT NULL DEFAULT '',
+			total            INTEGER NOT NULL DEFAULT 0,
+			imported         INTEGER NOT NULL DEFAULT 0,
+			new              INTEGER NOT NULL DEFAULT 0,
+			updated          INTEGER NOT NULL DEFAULT 0,
+			invalid          INTEGER NOT NULL DEFAULT 0,
+			blocklisted      INTEGER NOT NULL DEFAULT 0,
+			log              TEXT NOT NULL DEFAULT '',
+			rejected         TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			started_at       TIMESTAMP WITH TIME ZONE NULL,
+			finished_at      TIMESTAMP WITH TIME ZONE NULL,
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_import_jobs_status ON import_jobs(status);
+
+		INSERT INTO settings (key, value) VALUES ('app.import_concurrency', '1') ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Recurring campaigns.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'recurring_type') THEN
+				CREATE TYPE recurring_type AS ENUM ('cron', 'rss');
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'recurring_status') THEN
+				CREATE TYPE recurring_status AS ENUM ('active', 'disabled');
+			END IF;
+		END$$;
+
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS feed JSONB NOT NULL DEFAULT '[]';
+
+		CREATE TABLE IF NOT EXISTS recurring_campaigns (
+			id                SERIAL PRIMARY KEY,
+			name              TEXT NOT NULL,
+			campaign_id       INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			type              recurring_type NOT NULL DEFAULT 'cron',
+			status            recurring_status NOT NULL DEFAULT 'active',
+			cron              TEXT NOT NULL,
+			feed_url          TEXT NOT NULL DEFAULT '',
+			feed_last_item_at TIMESTAMP WITH TIME ZONE NULL,
+			feed_seen_items   TEXT[] NOT NULL DEFAULT '{}',
+			runs              INTEGER NOT NULL DEFAULT 0,
+			last_campaign_id  INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL,
+			last_run_at       TIMESTAMP WITH TIME ZONE NULL,
+			next_run_at       TIMESTAMP WITH TIME ZONE NULL,
+			created_at        TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at        TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_recurring_next_run_at ON recurring_campaigns(next_run_at);
+	`); err != nil {
+		return err
+	}
+
+	// Transactional message log.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'tx_status') THEN
+				CREATE TYPE tx_status AS ENUM ('queued', 'sent', 'failed', 'bounced');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS tx_messages (
+			id               BIGSERIAL PRIMARY KEY,
+			uuid uuid        NOT NULL UNIQUE,
+			idempotency_key  TEXT NULL,
+			template_id      INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			subscriber_id    INTEGER NULL REFERENCES subscribers(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			email            TEXT NOT NULL,
+			subject          TEXT NOT NULL DEFAULT '',
+			messenger        TEXT NOT NULL,
+			status           tx_status NOT NULL DEFAULT 'queued',
+			error            TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_tx_messages_key ON tx_messages(idempotency_key, email) WHERE idempotency_key IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_tx_messages_created_at ON tx_messages(created_at);
+
+		INSERT INTO settings (key, value) VALUES ('app.tx_idempotency_window', '"24h"') ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Transactional message batches.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'tx_batch_status') THEN
+				CREATE TYPE tx_batch_status AS ENUM ('running', 'finished');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS tx_batches (
+			id               BIGSERIAL PRIMARY KEY,
+			uuid uuid        NOT NULL UNIQUE,
+			idempotency_key  TEXT NULL,
+			template_id      INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			status           tx_batch_status NOT NULL DEFAULT 'running',
+			total            INTEGER NOT NULL DEFAULT 0,
+			payload          JSONB NOT NULL DEFAULT '{}',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_tx_batches_key ON tx_batches(idempotency_key) WHERE idempotency_key IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_tx_batches_running ON tx_batches(updated_at) WHERE status = 'running';
+
+		ALTER TABLE tx_messages ADD COLUMN IF NOT EXISTS batch_id BIGINT NULL REFERENCES tx_batches(id) ON DELETE CASCADE ON UPDATE CASCADE;
+		ALTER TABLE tx_messages ADD COLUMN IF NOT EXISTS batch_index INTEGER NULL;
+		CREATE INDEX IF NOT EXISTS idx_tx_messages_batch_id ON tx_messages(batch_id);
+	`); err != nil {
+		return err
+	}
+
+	// Template versions. Existing templates start at version 1.
+	if _, err := db.Exec(`
+		ALTER TABLE templates ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+		CREATE TABLE IF NOT EXISTS template_versions (
+			id               SERIAL PRIMARY KEY,
+			template_id      INTEGER NOT NULL REFERENCES templates(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			version          INTEGER NOT NULL,
+			name             TEXT NOT NULL,
+			subject          TEXT NOT NULL,
+			body             TEXT NOT NULL,
+			body_source      TEXT NULL,
+			user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			username         TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+			UNIQUE (template_id, version)
+		);
+
+		INSERT INTO template_versions (template_id, version, name, subject, body, body_source, created_at)
+			SELECT id, version, name, subject, body, body_source, updated_at FROM templates
+			ON CONFLICT DO NOTHING;
+
+		ALTER TABLE tx_messages ADD COLUMN IF NOT EXISTS template_version INTEGER NULL;
+	`); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -81,6 +81,15 @@ func Notify(toEmails []string, subject, tplName string, data any, hdr textproto.
 
 	subject, body = GetTplSubject(subject, body)
 
+	return NotifyRaw(toEmails, subject, body, hdr)
+}
+
+// NotifyRaw sends out an e-mail notification with an already rendered body.
+func NotifyRaw(toEmails []string, subject string, body []byte, hdr textproto.MIMEHeader) error {
+	if len(toEmails) == 0 {
+		return nil
+	}
+
 	m := models.Message{
 		Messenger:   "email",
 		ContentType: no.opt.ContentType,
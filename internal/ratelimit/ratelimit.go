@@ -0,0 +1,360 @@
+// Package ratelimit implements per-key rate limiting and temporary blocking of
+// abusive clients on public endpoints. Limits are enforced either with in-process
+// token buckets or, for setups with multiple instances, with fixed window counters
+// that are shared in the DB. Blocks and abuse events are always recorded in the DB.
+package ratelimit
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Backends for the rate limit counters.
+const (
+	BackendMemory   = "memory"
+	BackendPostgres = "postgres"
+)
+
+// Scopes of rate limit keys.
+const (
+	ScopeIP     = "ip"
+	ScopeDomain = "domain"
+)
+
+// Abuse event types.
+const (
+	// EventLimited is recorded when a key first exceeds its rate in a window.
+	EventLimited = "limited"
+
+	// EventBlocked is recorded when a key is temporarily blocked.
+	EventBlocked = "blocked"
+)
+
+const (
+	// Interval at which expired in-memory buckets and DB counters are pruned.
+	gcInterval = time.Minute * 10
+)
+
+var (
+	ErrLimited = errors.New("rate limit exceeded")
+	ErrBlocked = errors.New("temporarily blocked")
+)
+
+// Opt represents rate limiting options.
+type Opt struct {
+	// BackendMemory or BackendPostgres.
+	Backend string
+
+	// Window is the period over which the rates apply.
+	Window time.Duration
+
+	// Max number of requests per IP and per e-mail domain in a window.
+	// 0 disables the limit.
+	IPRate     int
+	DomainRate int
+
+	// Number of rejected requests from an IP in a window after which the IP
+	// is blocked for BlockDuration. 0 disables blocking. E-mail domains are
+	// never blocked as they may be shared by many legitimate users (eg: gmail.com).
+	BlockThreshold int
+	BlockDuration  time.Duration
+}
+
+// Queries contains the queries.
+type Queries struct {
+	IncrCounter   *sqlx.Stmt
+	PruneCounters *sqlx.Stmt
+	GetBlock      *sqlx.Stmt
+	GetBlocks     *sqlx.Stmt
+	UpsertBlock   *sqlx.Stmt
+	InsertEvent   *sqlx.Stmt
+}
+
+// Event represents an abuse event.
+type Event struct {
+	Type  string
+	Scope string
+	Value string
+	IP    string
+	Route string
+}
+
+// Limiter rate limits and blocks keys.
+type Limiter struct {
+	opt     Opt
+	queries *Queries
+	log     *log.Logger
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	blocks  map[string]time.Time
+	lastGC  time.Time
+}
+
+// bucket is an in-memory token bucket of a key along with the count of
+// requests rejected in the current window.
+type bucket struct {
+	tokens float64
+	last   time.Time
+
+	rejected    int
+	rejectStart time.Time
+}
+
+// New returns a new instance of the rate limiter.
+func New(opt Opt, q *Queries, lo *log.Logger) *Limiter {
+	if opt.Window <= 0 {
+		opt.Window = time.Minute
+	}
+
+	return &Limiter{
+		opt:     opt,
+		queries: q,
+		log:     lo,
+		buckets: make(map[string]*bucket),
+		blocks:  make(map[string]time.Time),
+		lastGC:  time.Now(),
+	}
+}
+
+// Load loads the active blocks from the DB into memory. With the memory
+// backend, this retains blocks across restarts.
+func (l *Limiter) Load() error {
+	var res []struct {
+		Scope     string    `db:"scope"`
+		Value     string    `db:"value"`
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+	if err := l.queries.GetBlocks.Select(&res); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	for _, b := range res {
+		l.blocks[makeKey(b.Scope, b.Value)] = b.ExpiresAt
+	}
+	l.mu.Unlock()
+
+	return nil
+}
+
+// Check checks whether a request from the given key, eg: an IP, is permitted.
+// It returns ErrBlocked if the key is blocked and ErrLimited if the key has
+// exceeded its rate along with the duration after which the request may be retried.
+// ip and route are recorded against abuse events.
+func (l *Limiter) Check(scope, value, ip, route string) (time.Duration, error) {
+	rate := l.rate(scope)
+	if rate <= 0 || value == "" {
+		return 0, nil
+	}
+
+	value = strings.ToLower(value)
+
+	var (
+		key = makeKey(scope, value)
+		now = time.Now()
+	)
+	l.gc(now)
+
+	// Is the key blocked? Domains are never blocked (blocks placed by older versions are ignored).
+	if scope != ScopeDomain {
+		if until, ok := l.getBlock(scope, value, now); ok {
+			return until.Sub(now), ErrBlocked
+		}
+	}
+
+	var (
+		retry    time.Duration
+		rejected int
+		ok       bool
+	)
+	if l.opt.Backend == BackendPostgres {
+		retry, rejected, ok = l.takeDB(key, rate, now)
+	} else {
+		retry, rejected, ok = l.take(key, rate, now)
+	}
+	if ok {
+		return 0, nil
+	}
+
+	ev := Event{Type: EventLimited, Scope: scope, Value: value, IP: ip, Route: route}
+
+	// Block the key if it has crossed the threshold of rejected requests. Domains
+	// are only rate limited so that flooding from a few IPs doesn't lock out every
+	// subscriber of a shared (freemail) domain.
+	if scope != ScopeDomain && l.opt.BlockThreshold > 0 && l.opt.BlockDuration > 0 && rejected >= l.opt.BlockThreshold {
+		until := now.Add(l.opt.BlockDuration)
+		l.block(scope, value, until)
+
+		ev.Type = EventBlocked
+		l.record(ev)
+
+		return l.opt.BlockDuration, ErrBlocked
+	}
+
+	// Only record the first rejection in a window to not flood the DB.
+	if rejected == 1 {
+		l.record(ev)
+	}
+
+	return retry, ErrLimited
+}
+
+// Unblock removes a key from the in-memory block list. The block
+// should be deleted from the DB separately.
+func (l *Limiter) Unblock(scope, value string) {
+	l.mu.Lock()
+	delete(l.blocks, makeKey(scope, value))
+	l.mu.Unlock()
+}
+
+// rate returns the rate of the given scope.
+func (l *Limiter) rate(scope string) int {
+	switch scope {
+	case ScopeIP:
+		return l.opt.IPRate
+	case ScopeDomain:
+		return l.opt.DomainRate
+	}
+
+	return 0
+}
+
+// take takes a token from the in-memory bucket of a key. If the bucket is empty,
+// it returns the duration after which a token will be available and the number
+// of requests rejected in the current window.
+func (l *Limiter) take(key string, rate int, now time.Time) (time.Duration, int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate), last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill the bucket at rate tokens per window.
+	perSec := float64(rate) / l.opt.Window.Seconds()
+	b.tokens = math.Min(float64(rate), b.tokens+now.Sub(b.last).Seconds()*perSec)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, 0, true
+	}
+
+	if now.Sub(b.rejectStart) >= l.opt.Window {
+		b.rejected = 0
+		b.rejectStart = now
+	}
+	b.rejected++
+
+	retry := time.Duration((1 - b.tokens) / perSec * float64(time.Second))
+	return retry, b.rejected, false
+}
+
+// takeDB increments the DB counter of a key in the current fixed window.
+// DB errors are logged and the request is permitted.
+func (l *Limiter) takeDB(key string, rate int, now time.Time) (time.Duration, int, bool) {
+	start := now.Truncate(l.opt.Window)
+
+	var hits int
+	if err := l.queries.IncrCounter.Get(&hits, key, start); err != nil {
+		l.log.Printf("error incrementing rate limit counter: %v", err)
+		return 0, 0, true
+	}
+
+	if hits <= rate {
+		return 0, 0, true
+	}
+
+	return start.Add(l.opt.Window).Sub(now), hits - rate, false
+}
+
+// getBlock returns the expiry of the block on a key if it's blocked.
+func (l *Limiter) getBlock(scope, value string, now time.Time) (time.Time, bool) {
+	key := makeKey(scope, value)
+
+	l.mu.Lock()
+	until, ok := l.blocks[key]
+	if ok && !now.Before(until) {
+		delete(l.blocks, key)
+		ok = false
+	}
+	l.mu.Unlock()
+
+	if ok || l.opt.Backend != BackendPostgres {
+		return until, ok
+	}
+
+	// Check the DB for blocks placed by other instances.
+	if err := l.queries.GetBlock.Get(&until, scope, value); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			l.log.Printf("error fetching rate limit block: %v", err)
+		}
+		return until, false
+	}
+
+	return until, true
+}
+
+// block blocks a key until the given time.
+func (l *Limiter) block(scope, value string, until time.Time) {
+	l.mu.Lock()
+	l.blocks[makeKey(scope, value)] = until
+	l.mu.Unlock()
+
+	if _, err := l.queries.UpsertBlock.Exec(scope, value, until); err != nil {
+		l.log.Printf("error recording rate limit block: %v", err)
+	}
+}
+
+// record records an abuse event in the DB.
+func (l *Limiter) record(e Event) {
+	if _, err := l.queries.InsertEvent.Exec(e.Type, e.Scope, e.Value, e.IP, e.Route); err != nil {
+		l.log.Printf("error recording abuse event: %v", err)
+	}
+}
+
+// gc prunes idle in-memory buckets and expired DB counters.
+func (l *Limiter) gc(now time.Time) {
+	l.mu.Lock()
+	if now.Sub(l.lastGC) < gcInterval {
+		l.mu.Unlock()
+		return
+	}
+	l.lastGC = now
+
+	// A bucket that has been idle for a window is full again and can be dropped.
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= l.opt.Window && now.Sub(b.rejectStart) >= l.opt.Window {
+			delete(l.buckets, k)
+		}
+	}
+	for k, until := range l.blocks {
+		if !now.Before(until) {
+			delete(l.blocks, k)
+		}
+	}
+	l.mu.Unlock()
+
+	if l.opt.Backend == BackendPostgres {
+		go func() {
+			if _, err := l.queries.PruneCounters.Exec(now.Truncate(l.opt.Window)); err != nil {
+				l.log.Printf("error pruning rate limit counters: %v", err)
+			}
+		}()
+	}
+}
+
+// makeKey returns the key of a scope and value.
+func makeKey(scope, value string) string {
+	return scope + ":" + strings.ToLower(value)
+}
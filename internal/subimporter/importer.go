@@ -1,13 +1,13 @@
-// Package subimporter implements a bulk ZIP/CSV importer of subscribers.
-// It implements a simple queue for buffering imports and committing records
-// to DB along with ZIP and CSV handling utilities. It is meant to be used as
-// a singleton as each Importer instance is stateful, where it keeps track of
-// an import in progress. Only one import should happen on a single importer
-// instance at a time.
+// Package subimporter implements a bulk ZIP/CSV/JSONL/XLSX importer of subscribers.
+// Imports are persisted as jobs in a DB queue that is processed by a pool of
+// workers. Each job runs in its own Session that has a simple queue for buffering
+// and committing records to DB, and keeps track of its status, logs, and rejected
+// rows. ZIP and CSV handling utilities are also implemented here.
 package subimporter
 
 import (
 	"archive/zip"
+	"bufio"
 	"bytes"
 	"database/sql"
 	"encoding/csv"
@@ -18,9 +18,11 @@ import (
 	"log"
 	"net/mail"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/knadh/listmonk/internal/i18n"
@@ -33,25 +35,53 @@ import (
 const (
 	// commitBatchSize is the number of inserts to commit in a single SQL transaction.
 	commitBatchSize = 10000
+
+	// maxJSONLineLen is the maximum length of a line in a JSONL file.
+	maxJSONLineLen = 1024 * 1024
+
+	// maxNameLen is the maximum length of the name of a message recipient.
+	maxNameLen = 2000
+
+	// dryRunBatchSize is the number of e-mails to look up in a single query in dry-runs.
+	dryRunBatchSize = 1000
 )
 
 // Various import statuses.
 const (
-	StatusNone      = "none"
+	StatusQueued    = "queued"
 	StatusImporting = "importing"
 	StatusStopping  = "stopping"
 	StatusFinished  = "finished"
 	StatusFailed    = "failed"
+	StatusStopped   = "stopped"
 
 	ModeSubscribe = "subscribe"
 	ModeBlocklist = "blocklist"
 )
 
-// Importer represents the bulk CSV subscriber import system.
+// Supported import file formats.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatXLSX  = "xlsx"
+	FormatZIP   = "zip"
+)
+
+// Subscriber fields that source columns can be mapped to. Columns can also
+// be mapped to individual attributes with the attribute prefix, eg: attribs.city.
+const (
+	FieldEmail        = "email"
+	FieldName         = "name"
+	FieldAttribs      = "attributes"
+	FieldAttribPrefix = "attribs."
+)
+
+// Importer represents the bulk subscriber import system.
 type Importer struct {
 	opt  Options
 	db   *sql.DB
 	i18n *i18n.I18n
+	log  *log.Logger
 
 	domainBlocklist       map[string]struct{}
 	hasBlocklistWildcards bool
@@ -61,8 +91,12 @@ type Importer struct {
 	hasAllowlistWildcards bool
 	hasAllowlist          bool
 
-	stop   chan bool
-	status Status
+	// Sessions of the jobs that are being processed by job ID.
+	sessions map[int]*Session
+	closing  bool
+
+	chNotify chan struct{}
+	chClose  chan struct{}
 	sync.RWMutex
 }
 
@@ -73,17 +107,42 @@ type Options struct {
 	UpdateListDateStmt *sql.Stmt
 	PostCB             func(subject string, data any) error
 
+	// GetStatusesStmt returns the statuses of existing subscribers by e-mails.
+	// It's used in dry-runs.
+	GetStatusesStmt *sql.Stmt
+
+	// Queries for the import job queue.
+	Queries JobQueries
+
+	// Concurrency is the number of import jobs that are processed simultaneously.
+	Concurrency int
+
+	// ScanInterval is the interval at which the job queue is checked for new jobs.
+	ScanInterval time.Duration
+
+	// Dir is the directory where uploaded files are stored until they're imported.
+	Dir string
+
+	// ValidateAttribs, if set, validates and converts subscriber attributes.
+	ValidateAttribs func(models.JSON) (models.JSON, error)
+
 	DomainBlocklist []string
 	DomainAllowlist []string
 }
 
-// Session represents a single import session.
+// Session represents a single import session of a job.
 type Session struct {
 	im       *Importer
+	id       int
 	subQueue chan SubReq
 	log      *log.Logger
+	stop     chan bool
 
-	opt SessionOpt
+	opt     SessionOpt
+	mapping map[string]string
+
+	status Status
+	sync.RWMutex
 }
 
 // SessionOpt represents the options for an importer session.
@@ -94,15 +153,39 @@ type SessionOpt struct {
 	Overwrite bool   `json:"overwrite"`
 	Delim     string `json:"delim"`
 	ListIDs   []int  `json:"lists"`
+
+	// Mapping maps source columns (CSV and XLSX headers, JSONL keys) to subscriber
+	// fields, eg: {"E-mail": "email", "City": "attribs.city"}. Unmapped columns
+	// are ignored. If it's empty, columns are mapped by their names.
+	Mapping map[string]string `json:"mapping"`
+
+	// DryRun validates the file and counts the records that would be
+	// imported without writing anything to the DB.
+	DryRun bool `json:"dry_run"`
 }
 
-// Status represents statistics from an ongoing import session.
+// Status represents statistics from an import session.
 type Status struct {
 	Name     string `json:"name"`
 	Total    int    `json:"total"`
 	Imported int    `json:"imported"`
 	Status   string `json:"status"`
-	logBuf   *bytes.Buffer
+	DryRun   bool   `json:"dry_run"`
+	Counts
+
+	logBuf *bytes.Buffer
+
+	// rejected is the CSV report of rows that were rejected.
+	rejected    *bytes.Buffer
+	rejectedCSV *csv.Writer
+}
+
+// Counts represents the number of new, updated, and rejected records in an import.
+type Counts struct {
+	New         int `json:"new"`
+	Updated     int `json:"updated"`
+	Invalid     int `json:"invalid"`
+	Blocklisted int `json:"blocklisted"`
 }
 
 // SubReq is a wrapper over the Subscriber model.
@@ -111,6 +194,9 @@ type SubReq struct {
 	Lists          []int    `json:"lists"`
 	ListUUIDs      []string `json:"list_uuids"`
 	PreconfirmSubs bool     `json:"preconfirm_subscriptions"`
+
+	// line is the line number of the record in the import file.
+	line int
 }
 
 type importStatusTpl struct {
@@ -121,28 +207,58 @@ type importStatusTpl struct {
 }
 
 var (
-	// ErrIsImporting is thrown when an import request is made while an
-	// import is already running.
-	ErrIsImporting = errors.New("import is already running")
+	// defaultMapping maps source columns to fields when there's no explicit mapping.
+	defaultMapping = map[string]string{
+		"email":      FieldEmail,
+		"name":       FieldName,
+		"attributes": FieldAttribs,
+		"attribs":    FieldAttribs,
+	}
 
-	csvHeaders = map[string]bool{
-		"email":      true,
-		"name":       true,
-		"attributes": true}
+	// errSkipRow is returned by row readers for rows that should be skipped silently.
+	errSkipRow = errors.New("skip row")
+
+	// rejectedHeader is the header of the rejected rows CSV report. The e-mail,
+	// name, and attributes columns can be re-imported once the rows are fixed.
+	rejectedHeader = []string{"line", "reason", "email", "name", "attributes"}
 
 	regexCleanStr = regexp.MustCompile("[[:^ascii:]]")
 )
 
+// rowError is returned by row readers for rows that can't be read and are rejected.
+type rowError struct {
+	reason string
+}
+
+func (e rowError) Error() string {
+	return e.reason
+}
+
+// domainError is returned for e-mails whose domains are blocklisted or not allowlisted.
+type domainError struct {
+	msg string
+}
+
+func (e domainError) Error() string {
+	return e.msg
+}
+
 // New returns a new instance of Importer.
-func New(opt Options, db *sql.DB, i *i18n.I18n) *Importer {
+func New(opt Options, db *sql.DB, i *i18n.I18n, lo *log.Logger) *Importer {
+	if opt.Concurrency < 1 {
+		opt.Concurrency = 1
+	}
+
 	im := Importer{
 		opt:             opt,
 		db:              db,
 		i18n:            i,
+		log:             lo,
 		domainBlocklist: make(map[string]struct{}, len(opt.DomainBlocklist)),
 		domainAllowlist: make(map[string]struct{}, len(opt.DomainAllowlist)),
-		status:          Status{Status: StatusNone, logBuf: bytes.NewBuffer(nil)},
-		stop:            make(chan bool, 1),
+		sessions:        make(map[int]*Session),
+		chNotify:        make(chan struct{}, opt.Concurrency),
+		chClose:         make(chan struct{}),
 	}
 
 	// Domain blocklist.
@@ -160,114 +276,183 @@ func New(opt Options, db *sql.DB, i *i18n.I18n) *Importer {
 	return &im
 }
 
-// NewSession returns an new instance of Session. It takes the name
-// of the uploaded file, but doesn't do anything with it but retains it for stats.
-func (im *Importer) NewSession(opt SessionOpt) (*Session, error) {
-	if !im.isDone() {
-		return nil, errors.New("an import is already running")
-	}
+// newStatus returns a new import Status with empty log and rejected rows buffers.
+func newStatus(status, name string, dryRun bool) Status {
+	rej := bytes.NewBuffer(nil)
+	w := csv.NewWriter(rej)
+	_ = w.Write(rejectedHeader)
+	w.Flush()
 
-	im.Lock()
-	im.status = Status{Status: StatusImporting,
-		Name:   opt.Filename,
-		logBuf: bytes.NewBuffer(nil)}
-	im.Unlock()
+	return Status{
+		Name:        name,
+		Status:      status,
+		DryRun:      dryRun,
+		logBuf:      bytes.NewBuffer(nil),
+		rejected:    rej,
+		rejectedCSV: w,
+	}
+}
 
+// newSession returns a new instance of Session for the given job.
+func (im *Importer) newSession(id int, opt SessionOpt) *Session {
 	s := &Session{
 		im:       im,
-		log:      log.New(im.status.logBuf, "", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile),
+		id:       id,
 		subQueue: make(chan SubReq, commitBatchSize),
+		stop:     make(chan bool, 1),
 		opt:      opt,
+		mapping:  defaultMapping,
+		status:   newStatus(StatusImporting, opt.Filename, opt.DryRun),
+	}
+	s.log = log.New(s.status.logBuf, "", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	if len(opt.Mapping) > 0 {
+		s.mapping = make(map[string]string, len(opt.Mapping))
+		for col, field := range opt.Mapping {
+			s.mapping[strings.TrimSpace(col)] = field
+		}
 	}
 
 	s.log.Printf("processing '%s'", opt.Filename)
-	return s, nil
+	return s
 }
 
-// GetStats returns the global Stats of the importer.
-func (im *Importer) GetStats() Status {
-	im.RLock()
-	defer im.RUnlock()
+// GetStats returns the Stats of the session.
+func (s *Session) GetStats() Status {
+	s.RLock()
+	defer s.RUnlock()
 
 	return Status{
-		Name:     im.status.Name,
-		Status:   im.status.Status,
-		Total:    im.status.Total,
-		Imported: im.status.Imported,
+		Name:     s.status.Name,
+		Status:   s.status.Status,
+		Total:    s.status.Total,
+		Imported: s.status.Imported,
+		DryRun:   s.status.DryRun,
+		Counts:   s.status.Counts,
 	}
 }
 
-// GetLogs returns the log entries of the last import session.
-func (im *Importer) GetLogs() []byte {
-	im.RLock()
-	defer im.RUnlock()
+// GetLogs returns the log entries of the session.
+func (s *Session) GetLogs() []byte {
+	s.RLock()
+	defer s.RUnlock()
 
-	if im.status.logBuf == nil {
-		return []byte{}
-	}
+	return s.status.logBuf.Bytes()
+}
 
-	return im.status.logBuf.Bytes()
+// GetRejected returns the CSV report of the rows rejected in the session.
+func (s *Session) GetRejected() []byte {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.status.rejected.Bytes()
 }
 
-// setStatus sets the Importer's status.
-func (im *Importer) setStatus(status string) {
-	im.Lock()
-	im.status.Status = status
-	im.Unlock()
+// setStatus sets the session's status.
+func (s *Session) setStatus(status string) {
+	s.Lock()
+	s.status.Status = status
+	s.Unlock()
 }
 
-// getStatus get's the Importer's status.
-func (im *Importer) getStatus() string {
-	im.RLock()
-	status := im.status.Status
-	im.RUnlock()
+// getStatus get's the session's status.
+func (s *Session) getStatus() string {
+	s.RLock()
+	status := s.status.Status
+	s.RUnlock()
 	return status
 }
 
-// isDone returns true if the importer is working (importing|stopping).
-func (im *Importer) isDone() bool {
-	s := true
-	im.RLock()
-	if im.getStatus() == StatusImporting || im.getStatus() == StatusStopping {
-		s = false
+// finish sets the final status of the session once all records are processed,
+// unless it has already failed, and returns the status.
+func (s *Session) finish() string {
+	s.Lock()
+	defer s.Unlock()
+
+	switch s.status.Status {
+	case StatusImporting:
+		s.status.Status = StatusFinished
+	case StatusStopping:
+		s.status.Status = StatusStopped
 	}
-	im.RUnlock()
 
-	return s
+	return s.status.Status
 }
 
-// incrementImportCount sets the Importer's "imported" counter.
-func (im *Importer) incrementImportCount(n int) {
-	im.Lock()
-	im.status.Imported += n
-	im.Unlock()
+// incrementImportCount sets the session's "imported" counter.
+func (s *Session) incrementImportCount(n int) {
+	s.Lock()
+	s.status.Imported += n
+	s.Unlock()
+}
+
+// addCounts adds to the session's new, updated, and rejected counters.
+func (s *Session) addCounts(c Counts) {
+	s.Lock()
+	s.status.New += c.New
+	s.status.Updated += c.Updated
+	s.status.Invalid += c.Invalid
+	s.status.Blocklisted += c.Blocklisted
+	s.Unlock()
+}
+
+// reject records a rejected row in the rejected rows report and counts it
+// as invalid or blocklisted.
+func (s *Session) reject(line int, reason string, sub SubReq, blocklisted bool) {
+	var attribs string
+	if len(sub.Attribs) > 0 {
+		if b, err := json.Marshal(sub.Attribs); err == nil {
+			attribs = string(b)
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if blocklisted {
+		s.status.Blocklisted++
+	} else {
+		s.status.Invalid++
+	}
+
+	_ = s.status.rejectedCSV.Write([]string{fmt.Sprintf("%d", line), reason, sub.Email, sub.Name, attribs})
+	s.status.rejectedCSV.Flush()
 }
 
 // sendNotif sends admin notifications for import completions.
-func (im *Importer) sendNotif(status string) error {
+func (s *Session) sendNotif(status string) error {
 	var (
-		s   = im.GetStats()
+		st  = s.GetStats()
 		out = importStatusTpl{
-			Name:     s.Name,
+			Name:     st.Name,
 			Status:   status,
-			Imported: s.Imported,
-			Total:    s.Total,
+			Imported: st.Imported,
+			Total:    st.Total,
 		}
-		subject = fmt.Sprintf("%s: %s import", cases.Title(language.Und).String(status), s.Name)
+		subject = fmt.Sprintf("%s: %s import", cases.Title(language.Und).String(status), st.Name)
 	)
-	return im.opt.PostCB(subject, out)
+	return s.im.opt.PostCB(subject, out)
 }
 
 // Start is a blocking function that selects on a channel queue until all
 // subscriber entries in the import session are imported. It should be
 // invoked as a goroutine.
 func (s *Session) Start() {
+	if s.opt.DryRun {
+		s.dryRun()
+		return
+	}
+
 	var (
 		tx    *sql.Tx
 		stmt  *sql.Stmt
 		err   error
 		total = 0
 		cur   = 0
+
+		// Counts and blocklisted subscribers in the current batch.
+		counts  Counts
+		blocked []SubReq
 	)
 
 	listIDs := make([]int, len(s.opt.ListIDs))
@@ -296,10 +481,16 @@ func (s *Session) Start() {
 			break
 		}
 
+		// The returned UUID is the generated one only if the subscriber was inserted.
+		var (
+			subUUID string
+			status  string
+		)
 		if s.opt.Mode == ModeSubscribe {
-			_, err = stmt.Exec(uu, sub.Email, sub.Name, sub.Attribs, pq.Array(listIDs), s.opt.SubStatus, s.opt.Overwrite)
+			var id int
+			err = stmt.QueryRow(uu, sub.Email, sub.Name, sub.Attribs, pq.Array(listIDs), s.opt.SubStatus, s.opt.Overwrite).Scan(&subUUID, &id, &status)
 		} else if s.opt.Mode == ModeBlocklist {
-			_, err = stmt.Exec(uu, sub.Email, sub.Name, sub.Attribs)
+			err = stmt.QueryRow(uu, sub.Email, sub.Name, sub.Attribs).Scan(&subUUID)
 		}
 		if err != nil {
 			s.log.Printf("error executing insert: %v", err)
@@ -309,67 +500,187 @@ func (s *Session) Start() {
 		cur++
 		total++
 
+		switch {
+		case s.opt.Mode == ModeSubscribe && status == models.SubscriberStatusBlockListed:
+			// Existing blocklisted subscribers are not subscribed to lists.
+			blocked = append(blocked, sub)
+		case subUUID == uu.String():
+			counts.New++
+		default:
+			counts.Updated++
+		}
+
 		// Batch size is met. Commit.
 		if cur%commitBatchSize == 0 {
 			if err := tx.Commit(); err != nil {
 				tx.Rollback()
 				s.log.Printf("error committing to DB: %v", err)
 			} else {
-				s.im.incrementImportCount(cur)
+				s.incrementImportCount(cur)
+				s.commitCounts(counts, blocked)
 				s.log.Printf("imported %d", total)
 			}
 
 			cur = 0
+			counts = Counts{}
+			blocked = nil
 		}
 	}
 
 	// Queue's closed and there's nothing left to commit.
 	if cur == 0 {
-		s.im.setStatus(StatusFinished)
-		s.log.Printf("imported finished")
+		status := s.finish()
+		s.log.Printf("import %s", status)
 		if _, err := s.im.opt.UpdateListDateStmt.Exec(pq.Array(listIDs)); err != nil {
 			s.log.Printf("error updating lists date: %v", err)
 		}
-		s.im.sendNotif(StatusFinished)
+		s.sendNotif(status)
 		return
 	}
 
 	// Queue's closed and there are records left to commit.
 	if err := tx.Commit(); err != nil {
 		tx.Rollback()
-		s.im.setStatus(StatusFailed)
+		s.setStatus(StatusFailed)
 		s.log.Printf("error committing to DB: %v", err)
-		s.im.sendNotif(StatusFailed)
+		s.sendNotif(StatusFailed)
 		return
 	}
 
-	s.im.incrementImportCount(cur)
-	s.im.setStatus(StatusFinished)
-	s.log.Printf("imported finished")
+	s.incrementImportCount(cur)
+	s.commitCounts(counts, blocked)
+	status := s.finish()
+	s.log.Printf("import %s", status)
 	if _, err := s.im.opt.UpdateListDateStmt.Exec(pq.Array(listIDs)); err != nil {
 		s.log.Printf("error updating lists date: %v", err)
 	}
 
-	s.im.sendNotif(StatusFinished)
+	s.sendNotif(status)
 }
 
-// Stop stops an active import session.
-func (s *Session) Stop() {
-	close(s.subQueue)
+// commitCounts adds the counts of a committed batch to the importer's counters
+// and records existing blocklisted subscribers in the rejected rows report.
+func (s *Session) commitCounts(c Counts, blocked []SubReq) {
+	s.addCounts(c)
+	for _, sub := range blocked {
+		s.reject(sub.line, s.im.i18n.T("import.subscriberBlocklisted"), sub, true)
+	}
+}
+
+// dryRun is a blocking function that selects on a channel queue until all
+// subscriber entries in the import session are processed, and counts the records
+// that would be inserted and updated by looking up existing subscribers without
+// writing anything to the DB.
+func (s *Session) dryRun() {
+	var (
+		// E-mails that have already been seen in the file. Repeated e-mails
+		// would update the record inserted by the first one.
+		seen  = make(map[string]struct{})
+		batch = make([]SubReq, 0, dryRunBatchSize)
+		total = 0
+		err   error
+	)
+
+	for sub := range s.subQueue {
+		if err != nil {
+			// Drain the queue.
+			continue
+		}
+
+		batch = append(batch, sub)
+		if len(batch) < dryRunBatchSize {
+			continue
+		}
+
+		if err = s.checkBatch(batch, seen); err == nil {
+			total += len(batch)
+			s.log.Printf("validated %d", total)
+		}
+		batch = batch[:0]
+	}
+
+	if err == nil && len(batch) > 0 {
+		err = s.checkBatch(batch, seen)
+	}
+	if err != nil {
+		s.log.Printf("error looking up subscribers: %v", err)
+		s.setStatus(StatusFailed)
+		return
+	}
+
+	s.log.Printf("dry-run %s", s.finish())
+}
+
+// checkBatch looks up the statuses of existing subscribers in a batch of
+// subscribers in a dry-run, and counts them.
+func (s *Session) checkBatch(batch []SubReq, seen map[string]struct{}) error {
+	emails := make([]string, 0, len(batch))
+	for _, sub := range batch {
+		emails = append(emails, sub.Email)
+	}
+
+	rows, err := s.im.opt.GetStatusesStmt.Query(pq.Array(emails))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]string, len(batch))
+	for rows.Next() {
+		var email, status string
+		if err := rows.Scan(&email, &status); err != nil {
+			return err
+		}
+		existing[strings.ToLower(email)] = status
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var (
+		counts  Counts
+		blocked []SubReq
+	)
+	for _, sub := range batch {
+		status, exists := existing[sub.Email]
+		switch {
+		case s.opt.Mode == ModeSubscribe && status == models.SubscriberStatusBlockListed:
+			blocked = append(blocked, sub)
+		case exists:
+			counts.Updated++
+		default:
+			if _, ok := seen[sub.Email]; ok {
+				counts.Updated++
+			} else {
+				counts.New++
+			}
+		}
+		seen[sub.Email] = struct{}{}
+	}
+
+	s.incrementImportCount(len(batch))
+	s.commitCounts(counts, blocked)
+
+	return nil
 }
 
-// ExtractZIP takes a ZIP file's path and extracts all .csv files in it to
-// a temporary directory, and returns the name of the temp directory and the
-// list of extracted .csv files.
-func (s *Session) ExtractZIP(srcPath string, maxCSVs int) (string, []string, error) {
-	if s.im.isDone() {
-		return "", nil, ErrIsImporting
+// Stop sends a signal to stop the import session.
+func (s *Session) Stop() {
+	select {
+	case s.stop <- true:
+		s.setStatus(StatusStopping)
+	default:
 	}
+}
 
+// ExtractZIP takes a ZIP file's path and extracts all .csv, .jsonl, and .xlsx
+// files in it to a temporary directory, and returns the name of the temp directory
+// and the list of extracted files.
+func (s *Session) ExtractZIP(srcPath string, maxFiles int) (string, []string, error) {
 	failed := true
 	defer func() {
 		if failed {
-			s.im.setStatus(StatusFailed)
+			s.setStatus(StatusFailed)
 		}
 	}()
 
@@ -396,9 +707,9 @@ func (s *Session) ExtractZIP(srcPath string, maxCSVs int) (string, []string, err
 			continue
 		}
 
-		// Skip files without the .csv extension.
-		if !strings.HasSuffix(strings.ToLower(fName), ".csv") {
-			s.log.Printf("skipping non .csv file '%s'", fName)
+		// Skip files that can't be imported.
+		if format := GetFormat(fName); format == "" || format == FormatZIP {
+			s.log.Printf("skipping unsupported file '%s'", fName)
 			continue
 		}
 
@@ -424,40 +735,45 @@ func (s *Session) ExtractZIP(srcPath string, maxCSVs int) (string, []string, err
 		s.log.Printf("extracted '%s'", fName)
 
 		files = append(files, fName)
-		if len(files) > maxCSVs {
-			s.log.Printf("won't extract any more files. Maximum is %d", maxCSVs)
+		if len(files) > maxFiles {
+			s.log.Printf("won't extract any more files. Maximum is %d", maxFiles)
 			break
 		}
 	}
 
 	if len(files) == 0 {
-		s.log.Println("no CSV files found in the ZIP")
-		return "", nil, errors.New("no CSV files found in the ZIP")
+		s.log.Println("no CSV, JSONL, or XLSX files found in the ZIP")
+		return "", nil, errors.New("no CSV, JSONL, or XLSX files found in the ZIP")
 	}
 
 	failed = false
 	return dir, files, nil
 }
 
-// LoadCSV loads a CSV file and validates and imports the subscriber entries in it.
-func (s *Session) LoadCSV(srcPath string, delim rune) error {
-	if s.im.isDone() {
-		return ErrIsImporting
+// Load loads a file of the given format and validates and imports the subscriber
+// entries in it. delim is the CSV delimiter.
+func (s *Session) Load(srcPath, format string, delim rune) error {
+	switch format {
+	case FormatCSV:
+		return s.LoadCSV(srcPath, delim)
+	case FormatJSONL:
+		return s.LoadJSONL(srcPath)
+	case FormatXLSX:
+		return s.LoadXLSX(srcPath)
 	}
 
-	// Default status is "failed" in case the function
-	// returns at one of the many possible errors.
-	failed := true
-	defer func() {
-		if failed {
-			s.im.setStatus(StatusFailed)
-		}
-	}()
+	s.setStatus(StatusFailed)
+	return fmt.Errorf("unknown file format '%s'", format)
+}
 
+// LoadCSV loads a CSV file and validates and imports the subscriber entries in it.
+func (s *Session) LoadCSV(srcPath string, delim rune) error {
 	f, err := os.Open(srcPath)
 	if err != nil {
+		s.setStatus(StatusFailed)
 		return err
 	}
+	defer f.Close()
 
 	// Count the total number of lines in the file. This doesn't distinguish
 	// between "blank" and non "blank" lines, and is only used to derive
@@ -465,18 +781,15 @@ func (s *Session) LoadCSV(srcPath string, delim rune) error {
 	numLines, err := countLines(f)
 	if err != nil {
 		s.log.Printf("error counting lines in '%s': '%v'", srcPath, err)
+		s.setStatus(StatusFailed)
 		return err
 	}
 
 	if numLines == 0 {
+		s.setStatus(StatusFailed)
 		return errors.New("empty file")
 	}
 
-	// Exclude the header from count.
-	s.im.Lock()
-	s.im.status.Total = numLines - 1
-	s.im.Unlock()
-
 	// Rewind, now that we've done a linecount on the same handler.
 	_, _ = f.Seek(0, 0)
 	rd := csv.NewReader(f)
@@ -486,110 +799,289 @@ func (s *Session) LoadCSV(srcPath string, delim rune) error {
 	csvHdr, err := rd.Read()
 	if err != nil {
 		s.log.Printf("error reading header from '%s': '%v'", srcPath, err)
+		s.setStatus(StatusFailed)
 		return err
 	}
 
-	hdrKeys := s.mapCSVHeaders(csvHdr, csvHeaders)
-	// email is a required header.
-	if _, ok := hdrKeys["email"]; !ok {
-		s.log.Printf("'email' column not found in '%s'", srcPath)
-		return errors.New("'email' column not found")
+	hdrKeys := s.mapHeaders(csvHdr)
+	if err := s.checkEmailMapped(hdrKeys); err != nil {
+		s.log.Printf("%v in '%s'", err, srcPath)
+		s.setStatus(StatusFailed)
+		return err
 	}
 
-	var (
-		lnHdr = len(hdrKeys)
-		i     = 0
-	)
+	// Exclude the header from count.
+	return s.importRows(numLines-1, func() (map[string]any, int, error) {
+		cols, err := rd.Read()
+		if err != nil {
+			if err, ok := err.(*csv.ParseError); ok && err.Err == csv.ErrFieldCount {
+				return nil, 0, rowError{err.Error()}
+			}
+			return nil, 0, err
+		}
+
+		row, err := makeRow(cols, hdrKeys)
+		return row, 0, err
+	})
+}
+
+// LoadJSONL loads a JSON Lines file where each line is a JSON object of a subscriber,
+// eg: {"email": "", "name": "", "attribs": {}}, and validates and imports the
+// subscriber entries in it.
+func (s *Session) LoadJSONL(srcPath string) error {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		s.setStatus(StatusFailed)
+		return err
+	}
+	defer f.Close()
+
+	numLines, err := countLines(f)
+	if err != nil {
+		s.log.Printf("error counting lines in '%s': '%v'", srcPath, err)
+		s.setStatus(StatusFailed)
+		return err
+	}
+
+	if numLines == 0 {
+		s.setStatus(StatusFailed)
+		return errors.New("empty file")
+	}
+
+	// Rewind, now that we've done a linecount on the same handler.
+	_, _ = f.Seek(0, 0)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), maxJSONLineLen)
+
+	return s.importRows(numLines, func() (map[string]any, int, error) {
+		if !sc.Scan() {
+			if err := sc.Err(); err != nil {
+				return nil, 0, err
+			}
+			return nil, 0, io.EOF
+		}
+
+		ln := bytes.TrimSpace(sc.Bytes())
+		if len(ln) == 0 {
+			return nil, 0, errSkipRow
+		}
+
+		var row map[string]any
+		if err := json.Unmarshal(ln, &row); err != nil {
+			return nil, 0, rowError{fmt.Sprintf("invalid JSON: %v", err)}
+		}
+
+		return row, 0, nil
+	})
+}
+
+// LoadXLSX loads the first worksheet of an Excel .xlsx file where the first row
+// is the header, and validates and imports the subscriber entries in it. Lines in
+// the rejected rows report are the row numbers in the worksheet.
+func (s *Session) LoadXLSX(srcPath string) error {
+	x, err := openXLSX(srcPath)
+	if err != nil {
+		s.log.Printf("error reading XLSX '%s': '%v'", srcPath, err)
+		s.setStatus(StatusFailed)
+		return err
+	}
+	defer x.Close()
+
+	// Count the total number of rows. Like the line count of CSV files, it's only
+	// used to derive the progress percentage for the frontend.
+	numRows, err := x.Count()
+	if err != nil {
+		s.log.Printf("error counting rows in '%s': '%v'", srcPath, err)
+		s.setStatus(StatusFailed)
+		return err
+	}
+
+	// Read the header, which is the first non-empty row.
+	hdr, _, err := x.Next()
+	if err != nil {
+		if err == io.EOF {
+			err = errors.New("empty file")
+		} else {
+			s.log.Printf("error reading header from '%s': '%v'", srcPath, err)
+		}
+		s.setStatus(StatusFailed)
+		return err
+	}
+
+	hdrKeys := s.mapHeaders(hdr)
+	if err := s.checkEmailMapped(hdrKeys); err != nil {
+		s.log.Printf("%v in '%s'", err, srcPath)
+		s.setStatus(StatusFailed)
+		return err
+	}
+
+	// Exclude the header from count.
+	return s.importRows(max(numRows-1, 0), func() (map[string]any, int, error) {
+		cols, num, err := x.Next()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// Trailing empty cells are omitted in XLSX rows. Pad them.
+		for len(cols) < len(hdr) {
+			cols = append(cols, "")
+		}
+
+		row, err := makeRow(cols, hdrKeys)
+		return row, num, err
+	})
+}
+
+// importRows reads rows from the given reader until io.EOF, maps them to subscribers,
+// validates them, and sends them to the import queue. total is the number of rows
+// that's used to derive the import progress. The queue is closed by the caller.
+// The reader may return the line number of a row in the file. If it's 0, rows are
+// numbered in the order they are read.
+func (s *Session) importRows(total int, next func() (map[string]any, int, error)) error {
+	// Default status is "failed" in case the function
+	// returns at one of the many possible errors.
+	failed := true
+	defer func() {
+		if failed {
+			s.setStatus(StatusFailed)
+		}
+	}()
+
+	s.Lock()
+	s.status.Total = total
+	s.Unlock()
+
+	n := 0
 	for {
-		i++
+		n++
 
 		// Check for the stop signal.
 		select {
-		case <-s.im.stop:
+		case <-s.stop:
 			failed = false
-			close(s.subQueue)
 			s.log.Println("stop request received")
 			return nil
 		default:
 		}
 
-		cols, err := rd.Read()
+		row, i, err := next()
+		if i == 0 {
+			i = n
+		}
 		if err == io.EOF {
 			break
+		} else if err == errSkipRow {
+			continue
+		} else if rErr, ok := err.(rowError); ok {
+			s.log.Printf("skipping line %d: %v", i, rErr)
+			s.reject(i, rErr.Error(), SubReq{}, false)
+			continue
 		} else if err != nil {
-			if err, ok := err.(*csv.ParseError); ok && err.Err == csv.ErrFieldCount {
-				s.log.Printf("skipping line %d. %v", i, err)
-				continue
-			} else {
-				s.log.Printf("error reading CSV '%s'", err)
-				return err
-			}
+			s.log.Printf("error reading line %d: %v", i, err)
+			return err
 		}
 
-		lnCols := len(cols)
-		if lnCols < lnHdr {
-			s.log.Printf("skipping line %d. column count (%d) does not match minimum header count (%d)", i, lnCols, lnHdr)
+		sub, err := s.mapRow(row)
+		if err != nil {
+			s.log.Printf("skipping line %d: %v", i, err)
+			s.reject(i, err.Error(), sub, false)
 			continue
 		}
-
-		// Iterate the key map and based on the indices mapped earlier,
-		// form a map of key: csv_value, eg: email: user@user.com.
-		row := make(map[string]string, lnCols)
-		for key := range hdrKeys {
-			row[key] = cols[hdrKeys[key]]
-		}
-
-		sub := SubReq{}
-		sub.Email = row["email"]
-
-		if v, ok := row["name"]; ok {
-			sub.Name = v
-		}
+		sub.line = i
 
 		sub, err = s.im.ValidateFields(sub)
 		if err != nil {
-			s.log.Printf("skipping line %d: %v: %v", i, err, cols)
-			continue
-		}
+			s.log.Printf("skipping line %d: %v: %v", i, err, row)
 
-		// JSON attributes.
-		if len(row["attributes"]) > 0 {
-			var (
-				attribs models.JSON
-				b       = []byte(row["attributes"])
-			)
-			if err := json.Unmarshal(b, &attribs); err != nil {
-				s.log.Printf("skipping invalid attributes JSON on line %d for '%s': %v", i, sub.Email, err)
-			} else {
-				sub.Attribs = attribs
-			}
+			_, blocklisted := err.(domainError)
+			s.reject(i, err.Error(), sub, blocklisted)
+			continue
 		}
 
 		// Send the subscriber to the queue.
 		s.subQueue <- sub
 	}
 
-	close(s.subQueue)
 	failed = false
 
 	return nil
 }
 
-// Stop sends a signal to stop the existing import.
-func (im *Importer) Stop() {
-	if im.getStatus() != StatusImporting {
-		im.Lock()
-		im.status = Status{Status: StatusNone}
-		im.Unlock()
+// mapRow maps the columns of a row to a subscriber's fields as per the session's
+// column mapping. Values of individual attribute columns override the ones in
+// the attributes JSON. An error is returned if the attributes are invalid.
+func (s *Session) mapRow(row map[string]any) (SubReq, error) {
+	var (
+		sub     = SubReq{}
+		attribs = models.JSON{}
+		err     error
+	)
+	for col, field := range s.mapping {
+		val, ok := row[col]
+		if !ok || val == nil {
+			continue
+		}
 
-		return
+		switch field {
+		case FieldEmail:
+			sub.Email = toString(val)
+		case FieldName:
+			sub.Name = toString(val)
+		case FieldAttribs:
+			switch v := val.(type) {
+			case map[string]any:
+				for k, a := range v {
+					attribs[k] = a
+				}
+			case string:
+				if v == "" {
+					continue
+				}
+
+				var a models.JSON
+				if jErr := json.Unmarshal([]byte(v), &a); jErr != nil {
+					err = fmt.Errorf("invalid attributes JSON: %v", jErr)
+					continue
+				}
+				for k, v := range a {
+					attribs[k] = v
+				}
+			default:
+				err = errors.New("invalid attributes")
+			}
+		}
 	}
 
-	select {
-	case im.stop <- true:
-		im.setStatus(StatusStopping)
-	default:
+	// Individual attribute columns.
+	for col, field := range s.mapping {
+		if !strings.HasPrefix(field, FieldAttribPrefix) {
+			continue
+		}
+
+		// Skip empty values so that missing values aren't stored as empty strings.
+		val, ok := row[col]
+		if !ok || val == nil || val == "" {
+			continue
+		}
+		attribs[strings.TrimPrefix(field, FieldAttribPrefix)] = val
 	}
+
+	if len(attribs) > 0 {
+		sub.Attribs = attribs
+	}
+
+	return sub, err
+}
+
+// checkEmailMapped checks if one of the mapped header columns is mapped to e-mail.
+func (s *Session) checkEmailMapped(hdrKeys map[string]int) error {
+	for h := range hdrKeys {
+		if s.mapping[h] == FieldEmail {
+			return nil
+		}
+	}
+
+	return errors.New("'email' column not found")
 }
 
 // SanitizeEmail validates and sanitizes an e-mail string and returns the lowercased,
@@ -618,11 +1110,11 @@ func (im *Importer) SanitizeEmail(email string) (string, error) {
 		// If there's an allowlist, check if the domain is in it. Checking blocklist after that is moot.
 		if im.hasAllowlist {
 			if !im.checkInList(domain, im.hasAllowlistWildcards, im.domainAllowlist) {
-				return "", errors.New(im.i18n.T("subscribers.domainBlocklisted"))
+				return "", domainError{im.i18n.T("subscribers.domainBlocklisted")}
 			}
 		} else if im.hasBlocklist {
 			if im.checkInList(domain, im.hasBlocklistWildcards, im.domainBlocklist) {
-				return "", errors.New(im.i18n.T("subscribers.domainBlocklisted"))
+				return "", domainError{im.i18n.T("subscribers.domainBlocklisted")}
 			}
 		}
 	}
@@ -645,19 +1137,58 @@ func (im *Importer) ValidateFields(s SubReq) (SubReq, error) {
 	// If there's no name, use the name part of the e-mail.
 	s.Name = strings.TrimSpace(s.Name)
 	if len(s.Name) == 0 {
-		name := strings.ToLower(strings.Split(s.Email, "@")[0])
+		s.Name = nameFromEmail(s.Email)
+	}
 
-		parts := strings.Fields(strings.ReplaceAll(name, ".", " "))
-		for n, p := range parts {
-			parts[n] = cases.Title(language.Und).String(p)
+	if im.opt.ValidateAttribs != nil {
+		a, err := im.opt.ValidateAttribs(s.Attribs)
+		if err != nil {
+			return s, err
 		}
-
-		s.Name = strings.Join(parts, " ")
+		s.Attribs = a
 	}
 
 	return s, nil
 }
 
+// ValidateRecipient validates and sanitizes the e-mail and name of a message
+// recipient who isn't a subscriber. Unlike ValidateFields, the attributes are
+// not validated against the subscriber attribute schema.
+func (im *Importer) ValidateRecipient(r models.TxRecipient) (models.TxRecipient, error) {
+	em, err := im.SanitizeEmail(r.Email)
+	if err != nil {
+		return r, err
+	}
+	r.Email = em
+
+	// If there's no name, use the name part of the e-mail.
+	r.Name = strings.TrimSpace(r.Name)
+	if len(r.Name) == 0 {
+		r.Name = nameFromEmail(r.Email)
+	} else if len(r.Name) > maxNameLen {
+		return r, errors.New(im.i18n.T("subscribers.invalidName"))
+	}
+
+	if r.Attribs == nil {
+		r.Attribs = models.JSON{}
+	}
+
+	return r, nil
+}
+
+// nameFromEmail returns a title cased name from the name part of an e-mail,
+// eg: john.doe@example.com = John Doe.
+func nameFromEmail(email string) string {
+	name := strings.ToLower(strings.Split(email, "@")[0])
+
+	parts := strings.Fields(strings.ReplaceAll(name, ".", " "))
+	for n, p := range parts {
+		parts[n] = cases.Title(language.Und).String(p)
+	}
+
+	return strings.Join(parts, " ")
+}
+
 // Check the domain against the given map of domains (block/allowlist).
 func (im *Importer) checkInList(domain string, hasWildcards bool, mp map[string]struct{}) bool {
 	// Check the domain as-is.
@@ -682,17 +1213,17 @@ func (im *Importer) checkInList(domain string, hasWildcards bool, mp map[string]
 	return false
 }
 
-// mapCSVHeaders takes a list of headers obtained from a CSV file, a map of known headers,
-// and returns a new map with each of the headers in the known map mapped by the position (0-n)
-// in the given CSV list.
-func (s *Session) mapCSVHeaders(csvHdrs []string, knownHdrs map[string]bool) map[string]int {
+// mapHeaders takes a list of headers obtained from a CSV or XLSX file and returns
+// a map of the headers in the session's column mapping mapped by their position (0-n)
+// in the given list.
+func (s *Session) mapHeaders(hdrs []string) map[string]int {
 	// Map 0-n column index to the header keys, name: 0, email: 1 etc.
 	// This is to allow dynamic ordering of columns in th CSV.
 	hdrKeys := make(map[string]int)
-	for i, h := range csvHdrs {
+	for i, h := range hdrs {
 		// Clean the string of non-ASCII characters (BOM etc.).
 		h := regexCleanStr.ReplaceAllString(strings.TrimSpace(h), "")
-		if _, ok := knownHdrs[h]; !ok {
+		if _, ok := s.mapping[h]; !ok {
 			s.log.Printf("ignoring unknown header '%s'", h)
 			continue
 		}
@@ -702,6 +1233,80 @@ func (s *Session) mapCSVHeaders(csvHdrs []string, knownHdrs map[string]bool) map
 	return hdrKeys
 }
 
+// makeRow makes a row map of header: value from a list of columns. Rows
+// that have fewer columns than the mapped headers are rejected.
+func makeRow(cols []string, hdrKeys map[string]int) (map[string]any, error) {
+	row := make(map[string]any, len(hdrKeys))
+	for key, i := range hdrKeys {
+		if i >= len(cols) {
+			return nil, rowError{"missing columns"}
+		}
+		row[key] = cols[i]
+	}
+
+	return row, nil
+}
+
+// GetFormat returns the import format of a file by its extension. An empty
+// string is returned for unsupported files.
+func GetFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return FormatCSV
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	case ".xlsx":
+		return FormatXLSX
+	case ".zip":
+		return FormatZIP
+	}
+
+	return ""
+}
+
+// ValidateMapping validates a column mapping. Fields should be one of
+// the known fields or an attribute with a valid key, and e-mail should be mapped.
+func ValidateMapping(m map[string]string) error {
+	if len(m) == 0 {
+		return nil
+	}
+
+	hasEmail := false
+	for col, field := range m {
+		if strings.TrimSpace(col) == "" {
+			return errors.New("empty column name")
+		}
+
+		switch field {
+		case FieldEmail:
+			if hasEmail {
+				return errors.New("more than one column mapped to 'email'")
+			}
+			hasEmail = true
+		case FieldName, FieldAttribs:
+		default:
+			if !strings.HasPrefix(field, FieldAttribPrefix) || !models.IsValidAttribKey(strings.TrimPrefix(field, FieldAttribPrefix)) {
+				return fmt.Errorf("invalid field '%s' for column '%s'", field, col)
+			}
+		}
+	}
+
+	if !hasEmail {
+		return errors.New("no column mapped to 'email'")
+	}
+
+	return nil
+}
+
+// toString returns the string representation of a scalar value.
+func toString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
 // countLines counts the number of line breaks in a file. This does not
 // distinguish between "blank" and non "blank" lines.
 // Credit: https://stackoverflow.com/a/24563853
@@ -0,0 +1,64 @@
+package subimporter
+
+import (
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/knadh/listmonk/internal/i18n"
+	"github.com/knadh/listmonk/models"
+)
+
+func TestValidateRecipient(t *testing.T) {
+	b, err := os.ReadFile("../../i18n/en.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := i18n.New(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A subscriber attribute schema with a required attribute.
+	schema := models.AttribSchema{{Key: "city", Type: models.AttribTypeString, Required: true}}
+
+	im := New(Options{
+		DomainBlocklist: []string{"blocked.com"},
+		ValidateAttribs: schema.Validate,
+	}, nil, i, log.New(io.Discard, "", 0))
+
+	// The schema applies to subscribers.
+	if _, err := im.ValidateFields(SubReq{Subscriber: models.Subscriber{Email: "guest@example.com"}}); err == nil {
+		t.Fatal("expected a subscriber without the required attribute to be invalid")
+	}
+
+	// But not to recipients who are not subscribers.
+	r, err := im.ValidateRecipient(models.TxRecipient{Email: " Guest.User@Example.com "})
+	if err != nil {
+		t.Fatalf("expected a recipient without the required attribute to be valid, got %v", err)
+	}
+	if r.Email != "guest.user@example.com" || r.Name != "Guest User" || r.Attribs == nil {
+		t.Errorf("unexpected sanitized recipient: %+v", r)
+	}
+
+	r, err = im.ValidateRecipient(models.TxRecipient{Email: "user@example.com", Name: " User ", Attribs: models.JSON{"city": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "User" || r.Attribs["city"] != 1 {
+		t.Errorf("unexpected sanitized recipient: %+v", r)
+	}
+
+	for _, r := range []models.TxRecipient{
+		{Email: "invalid"},
+		{Email: "Name <guest@example.com>"},
+		{Email: "guest@blocked.com"},
+		{Email: "guest@example.com", Name: strings.Repeat("a", maxNameLen+1)},
+	} {
+		if _, err := im.ValidateRecipient(r); err == nil {
+			t.Errorf("expected recipient %+v to be invalid", r)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package subimporter
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// JobQueries contains the prepared queries for the import job queue.
+type JobQueries struct {
+	Insert  *sql.Stmt
+	GetAll  *sql.Stmt
+	Get     *sql.Stmt
+	GetLogs *sql.Stmt
+	Next    *sql.Stmt
+	Update  *sql.Stmt
+	Touch   *sql.Stmt
+	Reset   *sql.Stmt
+	Stop    *sql.Stmt
+	Delete  *sql.Stmt
+}
+
+// Job represents a queued import job.
+type Job struct {
+	ID int `json:"id"`
+	Status
+
+	Params     SessionOpt `json:"params"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// jobLeaseTimeout is the duration after which a job that's being imported is
+// considered to be interrupted if the instance importing it hasn't renewed its
+// lease. Leases are renewed at the scan interval.
+const jobLeaseTimeout = time.Minute
+
+var (
+	// ErrJobNotFound is returned when a job doesn't exist, or when it's
+	// in a state that doesn't allow the requested operation.
+	ErrJobNotFound = errors.New("import job not found")
+)
+
+// Enqueue stores the file to be imported and adds a new job to the import queue.
+func (im *Importer) Enqueue(opt SessionOpt, src io.Reader) (Job, error) {
+	if err := os.MkdirAll(im.opt.Dir, 0700); err != nil {
+		return Job{}, err
+	}
+
+	// Retain the extension as the format is derived from it.
+	out, err := os.CreateTemp(im.opt.Dir, "import-*"+filepath.Ext(opt.Filename))
+	if err != nil {
+		return Job{}, err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, src); err != nil {
+		os.Remove(out.Name())
+		return Job{}, err
+	}
+
+	params, err := json.Marshal(opt)
+	if err != nil {
+		os.Remove(out.Name())
+		return Job{}, err
+	}
+
+	var (
+		j Job
+		b []byte
+	)
+	if err := im.opt.Queries.Insert.QueryRow(opt.Filename, string(params), out.Name()).Scan(j.cols(&b)...); err != nil {
+		os.Remove(out.Name())
+		return Job{}, err
+	}
+	if err := j.setParams(b); err != nil {
+		return Job{}, err
+	}
+
+	// Wake up a worker.
+	select {
+	case im.chNotify <- struct{}{}:
+	default:
+	}
+
+	return j, nil
+}
+
+// GetJobs returns import jobs, newest first, along with the total number of jobs.
+func (im *Importer) GetJobs(offset, limit int) ([]Job, int, error) {
+	rows, err := im.opt.Queries.GetAll.Query(offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var (
+		out   = []Job{}
+		total = 0
+	)
+	for rows.Next() {
+		var (
+			j Job
+			b []byte
+		)
+		if err := rows.Scan(append([]any{&total}, j.cols(&b)...)...); err != nil {
+			return nil, 0, err
+		}
+		if err := j.setParams(b); err != nil {
+			return nil, 0, err
+		}
+
+		out = append(out, im.withLiveStatus(j))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return out, total, nil
+}
+
+// GetJob returns an import job.
+func (im *Importer) GetJob(id int) (Job, error) {
+	var (
+		j Job
+		b []byte
+	)
+	if err := im.opt.Queries.Get.QueryRow(id).Scan(j.cols(&b)...); err != nil {
+		if err == sql.ErrNoRows {
+			return Job{}, ErrJobNotFound
+		}
+		return Job{}, err
+	}
+	if err := j.setParams(b); err != nil {
+		return Job{}, err
+	}
+
+	return im.withLiveStatus(j), nil
+}
+
+// GetLogs returns the log entries of an import job.
+func (im *Importer) GetLogs(id int) ([]byte, error) {
+	if s := im.getSession(id); s != nil {
+		return s.GetLogs(), nil
+	}
+
+	logs, _, err := im.getJobLogs(id)
+	return logs, err
+}
+
+// GetRejected returns the CSV report of the rows rejected in an import job.
+func (im *Importer) GetRejected(id int) ([]byte, error) {
+	if s := im.getSession(id); s != nil {
+		return s.GetRejected(), nil
+	}
+
+	_, rejected, err := im.getJobLogs(id)
+	return rejected, err
+}
+
+// StopJob stops a running or queued import job. If the job is already
+// done, it's deleted.
+func (im *Importer) StopJob(id int) error {
+	if s := im.getSession(id); s != nil {
+		s.Stop()
+		return nil
+	}
+
+	// Stop a queued job.
+	var path string
+	err := im.opt.Queries.Stop.QueryRow(id).Scan(&path)
+	if err == nil {
+		os.Remove(path)
+		return nil
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	// Delete a finished job.
+	var jobID int
+	if err := im.opt.Queries.Delete.QueryRow(id).Scan(&jobID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrJobNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetRunning returns the statuses of the jobs that are being processed.
+func (im *Importer) GetRunning() []Status {
+	im.RLock()
+	defer im.RUnlock()
+
+	out := make([]Status, 0, len(im.sessions))
+	for _, s := range im.sessions {
+		out = append(out, s.GetStats())
+	}
+
+	return out
+}
+
+// HasRunningJobs returns true if there are jobs that are being processed.
+func (im *Importer) HasRunningJobs() bool {
+	im.RLock()
+	defer im.RUnlock()
+
+	return len(im.sessions) > 0
+}
+
+// Run starts the workers that process queued import jobs. Jobs that were
+// interrupted by a shutdown or a crash of any instance are restarted from
+// the beginning once their leases expire. It's a blocking function and should
+// be invoked as a goroutine.
+func (im *Importer) Run() {
+	im.resetJobs()
+
+	var wg sync.WaitGroup
+	for i := 0; i < im.opt.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			im.worker()
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		im.renewLeases()
+	}()
+	wg.Wait()
+}
+
+// Close stops the workers from picking up new jobs. Jobs that are being processed
+// are not updated any further so that they're restarted on the next run.
+func (im *Importer) Close() {
+	im.Lock()
+	im.closing = true
+	im.Unlock()
+
+	close(im.chClose)
+}
+
+// worker processes queued jobs one by one until there are none left, and
+// then waits for new jobs.
+func (im *Importer) worker() {
+	t := time.NewTicker(im.opt.ScanInterval)
+	defer t.Stop()
+
+	for {
+		for {
+			select {
+			case <-im.chClose:
+				return
+			default:
+			}
+
+			id, opt, path, ok := im.nextJob()
+			if !ok {
+				break
+			}
+			im.runJob(id, opt, path)
+		}
+
+		select {
+		case <-im.chClose:
+			return
+		case <-im.chNotify:
+		case <-t.C:
+		}
+	}
+}
+
+// renewLeases periodically renews the leases of the jobs that are being imported
+// by this instance and re-queues the jobs of other instances whose leases have expired.
+func (im *Importer) renewLeases() {
+	t := time.NewTicker(im.opt.ScanInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-im.chClose:
+			return
+		case <-t.C:
+		}
+
+		im.RLock()
+		ids := make([]int64, 0, len(im.sessions))
+		for id := range im.sessions {
+			ids = append(ids, int64(id))
+		}
+		im.RUnlock()
+
+		if len(ids) > 0 {
+			if _, err := im.opt.Queries.Touch.Exec(pq.Int64Array(ids)); err != nil {
+				im.log.Printf("error renewing import job leases: %v", err)
+			}
+		}
+
+		im.resetJobs()
+	}
+}
+
+// resetJobs re-queues interrupted jobs whose leases have expired.
+func (im *Importer) resetJobs() {
+	res, err := im.opt.Queries.Reset.Exec(jobLeaseTimeout.Seconds())
+	if err != nil {
+		im.log.Printf("error resetting interrupted import jobs: %v", err)
+		return
+	}
+
+	if n, _ := res.RowsAffected(); n > 0 {
+		im.log.Printf("re-queued %d interrupted import job(s)", n)
+
+		// Wake up a worker.
+		select {
+		case im.chNotify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// nextJob picks the next queued job.
+func (im *Importer) nextJob() (int, SessionOpt, string, bool) {
+	var (
+		id     int
+		params []byte
+		path   string
+		opt    SessionOpt
+	)
+	if err := im.opt.Queries.Next.QueryRow().Scan(&id, &params, &path); err != nil {
+		if err != sql.ErrNoRows {
+			im.log.Printf("error fetching next import job: %v", err)
+		}
+		return 0, opt, "", false
+	}
+
+	if err := json.Unmarshal(params, &opt); err != nil {
+		im.log.Printf("error reading params of import job %d: %v", id, err)
+		opt.Filename = filepath.Base(path)
+	}
+
+	return id, opt, path, true
+}
+
+// runJob imports the file of a job in a new session and records the results.
+func (im *Importer) runJob(id int, opt SessionOpt, path string) {
+	s := im.newSession(id, opt)
+
+	im.Lock()
+	im.sessions[id] = s
+	im.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.Start()
+		close(done)
+	}()
+
+	if err := s.loadFile(path); err != nil {
+		s.log.Printf("error importing '%s': %v", opt.Filename, err)
+	}
+	close(s.subQueue)
+	<-done
+
+	im.Lock()
+	delete(im.sessions, id)
+	closing := im.closing
+	im.Unlock()
+
+	// The app is shutting down. Leave the job as is so that it's restarted on the next run.
+	if closing {
+		return
+	}
+
+	os.Remove(path)
+
+	st := s.GetStats()
+	if _, err := im.opt.Queries.Update.Exec(id, st.Status, st.Total, st.Imported,
+		st.New, st.Updated, st.Invalid, st.Blocklisted, string(s.GetLogs()), string(s.GetRejected())); err != nil {
+		im.log.Printf("error updating import job %d: %v", id, err)
+	}
+}
+
+// loadFile loads the file of the session's job, extracting it first if it's a ZIP.
+func (s *Session) loadFile(srcPath string) error {
+	delim := ','
+	if s.opt.Delim != "" {
+		delim = rune(s.opt.Delim[0])
+	}
+
+	format := GetFormat(s.opt.Filename)
+	if format != FormatZIP {
+		return s.Load(srcPath, format, delim)
+	}
+
+	// Only 1 file from the ZIP is considered. If multiple files have
+	// to be processed, counting the net number of lines (to track progress),
+	// keeping the global import state (failed / successful) etc. across
+	// multiple files becomes complex. Instead, it's just easier for the
+	// end user to concat multiple CSVs (if there are multiple in the first)
+	// place and upload as one in the first place.
+	dir, files, err := s.ExtractZIP(srcPath, 1)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	return s.Load(filepath.Join(dir, files[0]), GetFormat(files[0]), delim)
+}
+
+// getSession returns the session of a job that's being processed.
+func (im *Importer) getSession(id int) *Session {
+	im.RLock()
+	defer im.RUnlock()
+
+	return im.sessions[id]
+}
+
+// getJobLogs returns the logs and the rejected rows report of a job from the DB.
+func (im *Importer) getJobLogs(id int) ([]byte, []byte, error) {
+	var logs, rejected string
+	if err := im.opt.Queries.GetLogs.QueryRow(id).Scan(&logs, &rejected); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, ErrJobNotFound
+		}
+		return nil, nil, err
+	}
+
+	return []byte(logs), []byte(rejected), nil
+}
+
+// withLiveStatus returns the job with the live status of its session if it's
+// being processed.
+func (im *Importer) withLiveStatus(j Job) Job {
+	if s := im.getSession(j.ID); s != nil {
+		j.Status = s.GetStats()
+	}
+
+	return j
+}
+
+// cols returns the scan destinations of the job fields in the order of the
+// columns in the job queries. The params are scanned into b.
+func (j *Job) cols(b *[]byte) []any {
+	return []any{&j.ID, &j.Name, &j.Status.Status, b, &j.Total, &j.Imported,
+		&j.New, &j.Updated, &j.Invalid, &j.Blocklisted, &j.CreatedAt, &j.StartedAt, &j.FinishedAt}
+}
+
+// setParams sets the job's params from JSON.
+func (j *Job) setParams(b []byte) error {
+	if err := json.Unmarshal(b, &j.Params); err != nil {
+		return err
+	}
+	j.DryRun = j.Params.DryRun
+
+	return nil
+}
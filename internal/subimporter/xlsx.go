@@ -0,0 +1,312 @@
+package subimporter
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// XLSX (Office Open XML) files are ZIP files of XML documents. Only the bits
+// required to read cell values from the first worksheet are implemented here.
+// Formulas are read as their last computed values, and formatting (including
+// date formatting of numeric cells) is ignored.
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRels struct {
+	Rels []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a rich or plain text string in shared strings and inline strings.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+type xlsxSST struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxRow struct {
+	Num   int `xml:"r,attr"`
+	Cells []struct {
+		Ref    string   `xml:"r,attr"`
+		Type   string   `xml:"t,attr"`
+		Value  string   `xml:"v"`
+		Inline xlsxText `xml:"is"`
+	} `xml:"c"`
+}
+
+const (
+	xlsxDefaultSheet = "xl/worksheets/sheet1.xml"
+
+	// xlsxMaxCols is the maximum number of columns in an Excel worksheet (A-XFD).
+	xlsxMaxCols = 16384
+)
+
+// xlsxReader streams the rows of cell values of the first worksheet in an .xlsx file.
+type xlsxReader struct {
+	z     *zip.ReadCloser
+	sheet *zip.File
+	sst   xlsxSST
+
+	r   io.ReadCloser
+	dec *xml.Decoder
+
+	// Number of the last row read.
+	num int
+}
+
+// openXLSX opens an .xlsx file for reading the rows of its first worksheet.
+func openXLSX(srcPath string) (*xlsxReader, error) {
+	z, err := zip.OpenReader(srcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File, len(z.File))
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+
+	x := &xlsxReader{z: z}
+
+	// Shared strings are optional.
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeXLSXFile(f, &x.sst); err != nil {
+			z.Close()
+			return nil, err
+		}
+	}
+
+	f, ok := files[getXLSXSheetPath(files)]
+	if !ok {
+		z.Close()
+		return nil, errors.New("no worksheets found in the XLSX file")
+	}
+	x.sheet = f
+
+	if err := x.rewind(); err != nil {
+		z.Close()
+		return nil, err
+	}
+
+	return x, nil
+}
+
+// Count counts the number of rows in the worksheet, including empty rows that
+// are in the file, and rewinds the reader.
+func (x *xlsxReader) Count() (int, error) {
+	n := 0
+	for {
+		tk, err := x.dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+
+		if el, ok := tk.(xml.StartElement); ok && el.Name.Local == "row" {
+			n++
+			if err := x.dec.Skip(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return n, x.rewind()
+}
+
+// Next returns the cell values of the next non-empty row along with the
+// 1-n number of the row in the worksheet. io.EOF is returned at the end.
+func (x *xlsxReader) Next() ([]string, int, error) {
+	for {
+		tk, err := x.dec.Token()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		el, ok := tk.(xml.StartElement)
+		if !ok || el.Name.Local != "row" {
+			continue
+		}
+
+		var row xlsxRow
+		if err := x.dec.DecodeElement(&row, &el); err != nil {
+			return nil, 0, err
+		}
+
+		// Empty rows may be omitted from the sheet. The row number is in the
+		// optional reference, eg: r="4".
+		if row.Num > 0 {
+			x.num = row.Num
+		} else {
+			x.num++
+		}
+
+		cols, empty, err := x.readCells(row)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !empty {
+			return cols, x.num, nil
+		}
+	}
+}
+
+// Close closes the file.
+func (x *xlsxReader) Close() error {
+	if x.r != nil {
+		x.r.Close()
+	}
+
+	return x.z.Close()
+}
+
+// readCells returns the cell values of a row and whether all of them are empty.
+func (x *xlsxReader) readCells(row xlsxRow) ([]string, bool, error) {
+	var (
+		cols  []string
+		empty = true
+	)
+	for n, c := range row.Cells {
+		// Cells may be sparse. The column index is derived from the cell reference, eg: C4.
+		idx := n
+		if c.Ref != "" {
+			idx = getXLSXColIndex(c.Ref)
+		}
+		if idx < 0 || idx >= xlsxMaxCols {
+			return nil, false, errors.New("invalid cell reference in the XLSX file")
+		}
+		for len(cols) <= idx {
+			cols = append(cols, "")
+		}
+
+		var v string
+		switch c.Type {
+		case "s":
+			i, err := strconv.Atoi(c.Value)
+			if err != nil || i < 0 || i >= len(x.sst.Items) {
+				return nil, false, errors.New("invalid shared string reference in the XLSX file")
+			}
+			v = x.sst.Items[i].String()
+		case "inlineStr":
+			v = c.Inline.String()
+		case "b":
+			v = strconv.FormatBool(c.Value == "1")
+		default:
+			v = c.Value
+		}
+
+		cols[idx] = v
+		if v != "" {
+			empty = false
+		}
+	}
+
+	return cols, empty, nil
+}
+
+// rewind (re)opens the worksheet for reading from the first row.
+func (x *xlsxReader) rewind() error {
+	if x.r != nil {
+		x.r.Close()
+	}
+
+	r, err := x.sheet.Open()
+	if err != nil {
+		return err
+	}
+	x.r = r
+	x.dec = xml.NewDecoder(r)
+	x.num = 0
+
+	return nil
+}
+
+// getXLSXSheetPath returns the path of the first worksheet in the workbook.
+func getXLSXSheetPath(files map[string]*zip.File) string {
+	var (
+		wb   xlsxWorkbook
+		rels xlsxRels
+	)
+
+	wf, ok := files["xl/workbook.xml"]
+	if !ok || decodeXLSXFile(wf, &wb) != nil || len(wb.Sheets) == 0 {
+		return xlsxDefaultSheet
+	}
+
+	rf, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok || decodeXLSXFile(rf, &rels) != nil {
+		return xlsxDefaultSheet
+	}
+
+	for _, r := range rels.Rels {
+		if r.ID != wb.Sheets[0].RID {
+			continue
+		}
+
+		// Targets are relative to xl/ or absolute from the root of the package.
+		if strings.HasPrefix(r.Target, "/") {
+			return strings.TrimPrefix(r.Target, "/")
+		}
+		return path.Join("xl", r.Target)
+	}
+
+	return xlsxDefaultSheet
+}
+
+// getXLSXColIndex returns the 0-n column index of a cell reference, eg: A1 = 0, AB12 = 27.
+func getXLSXColIndex(ref string) int {
+	n := 0
+	for _, c := range strings.ToUpper(ref) {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		n = n*26 + int(c-'A'+1)
+		if n > xlsxMaxCols {
+			return -1
+		}
+	}
+
+	return n - 1
+}
+
+// decodeXLSXFile decodes an XML file in the XLSX package.
+func decodeXLSXFile(f *zip.File, out any) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return xml.NewDecoder(r).Decode(out)
+}
+
+// String returns the plain text of a plain or rich text string.
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells is the maximum size of the LCS table when diffing the changed
+// lines of two strings. Beyond it, the changed lines are diffed as a whole.
+const maxDiffCells = 1 << 22
+
+type diffOp struct {
+	kind byte
+	text string
+
+	// Positions of the op in the lines of a and b.
+	a, b int
+}
+
+// DiffLines returns the line diff between a and b in the unified format with
+// the given number of context lines around changes. An empty string is returned
+// if a and b are identical.
+func DiffLines(a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+
+	var (
+		ops = diffLines(splitLines(a), splitLines(b))
+		out strings.Builder
+	)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Merge the changes that are close enough to share context lines into one hunk.
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			} else if j-end > context*2 {
+				break
+			}
+		}
+
+		var (
+			hunk   = ops[max(i-context, 0):min(end+context+1, len(ops))]
+			aN, bN = 0, 0
+		)
+		for _, o := range hunk {
+			if o.kind != '+' {
+				aN++
+			}
+			if o.kind != '-' {
+				bN++
+			}
+		}
+
+		// An empty range starts at the line before it.
+		aLine, bLine := hunk[0].a+1, hunk[0].b+1
+		if aN == 0 {
+			aLine--
+		}
+		if bN == 0 {
+			bLine--
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aLine, aN, bLine, bN)
+		for _, o := range hunk {
+			out.WriteByte(o.kind)
+			out.WriteString(o.text)
+			out.WriteByte('\n')
+		}
+
+		i = end + 1
+	}
+
+	return out.String()
+}
+
+// diffLines returns the edit script that turns the lines in a into the lines in b.
+// The common leading and trailing lines are skipped and the changed lines in between
+// are diffed with their longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	var pre, suf int
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	out := make([]diffOp, 0, len(a)+len(b))
+	for i := range pre {
+		out = append(out, diffOp{kind: ' ', text: a[i], a: i, b: i})
+	}
+
+	var (
+		am = a[pre : len(a)-suf]
+		bm = b[pre : len(b)-suf]
+		n  = len(am)
+		m  = len(bm)
+	)
+	if n*m > maxDiffCells {
+		for i, l := range am {
+			out = append(out, diffOp{kind: '-', text: l, a: pre + i, b: pre})
+		}
+		for j, l := range bm {
+			out = append(out, diffOp{kind: '+', text: l, a: pre + n, b: pre + j})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of am[i:] and bm[j:].
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if am[i] == bm[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && am[i] == bm[j]:
+				out = append(out, diffOp{kind: ' ', text: am[i], a: pre + i, b: pre + j})
+				i++
+				j++
+			case j == m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+				out = append(out, diffOp{kind: '-', text: am[i], a: pre + i, b: pre + j})
+				i++
+			default:
+				out = append(out, diffOp{kind: '+', text: bm[j], a: pre + i, b: pre + j})
+				j++
+			}
+		}
+	}
+
+	for k := suf; k > 0; k-- {
+		out = append(out, diffOp{kind: ' ', text: a[len(a)-k], a: len(a) - k, b: len(b) - k})
+	}
+
+	return out
+}
+
+// splitLines splits a string into lines without the trailing empty line.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,365 @@
+// Package webhooks implements outbound event webhooks. Events are queued in the
+// DB as deliveries, one per subscribed webhook, and are posted to the webhook URLs
+// by a worker that retries failed deliveries with an exponential backoff.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/knadh/listmonk/models"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// Events that can be subscribed to.
+const (
+	EventSubscriberCreated        = "subscriber.created"
+	EventSubscriberUpdated        = "subscriber.updated"
+	EventSubscriberDeleted        = "subscriber.deleted"
+	EventSubscriptionConfirmed    = "subscription.confirmed"
+	EventSubscriptionUnsubscribed = "subscription.unsubscribed"
+	EventCampaignStatus           = "campaign.status"
+	EventBounceRecorded           = "bounce.recorded"
+	EventLinkClicked              = "link.clicked"
+)
+
+// Events is the list of all events that webhooks can subscribe to.
+var Events = []string{
+	EventSubscriberCreated,
+	EventSubscriberUpdated,
+	EventSubscriberDeleted,
+	EventSubscriptionConfirmed,
+	EventSubscriptionUnsubscribed,
+	EventCampaignStatus,
+	EventBounceRecorded,
+	EventLinkClicked,
+}
+
+const (
+	// Max size of the response body recorded against a delivery attempt.
+	maxResponseLen = 1024
+
+	hdrEvent     = "X-Listmonk-Event"
+	hdrDelivery  = "X-Listmonk-Delivery"
+	hdrTimestamp = "X-Listmonk-Timestamp"
+	hdrSignature = "X-Listmonk-Signature"
+)
+
+// Payload is the JSON body that's posted to webhooks.
+type Payload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Subscriptions is the payload data of subscription events. Depending on the source
+// of the event, subscribers and lists are identified either by their IDs or UUIDs.
+// Empty lists indicate all of the subscriber's lists.
+type Subscriptions struct {
+	SubscriberIDs   []int    `json:"subscriber_ids"`
+	SubscriberUUIDs []string `json:"subscriber_uuids"`
+	ListIDs         []int    `json:"list_ids"`
+	ListUUIDs       []string `json:"list_uuids"`
+	CampaignUUID    string   `json:"campaign_uuid,omitempty"`
+	Blocklisted     bool     `json:"blocklisted"`
+}
+
+// CampaignStatus is the payload data of campaign status change events.
+type CampaignStatus struct {
+	ID             int    `json:"id"`
+	UUID           string `json:"uuid"`
+	Name           string `json:"name"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previous_status"`
+}
+
+// LinkClick is the payload data of link click events.
+type LinkClick struct {
+	URL            string `json:"url"`
+	LinkUUID       string `json:"link_uuid"`
+	CampaignUUID   string `json:"campaign_uuid"`
+	SubscriberUUID string `json:"subscriber_uuid"`
+}
+
+// Opt represents webhook delivery options.
+type Opt struct {
+	// Number of deliveries that are posted concurrently.
+	Concurrency int
+
+	// Max number of delivery attempts after which a delivery is marked as failed.
+	MaxAttempts int
+
+	// Interval after which a failed attempt is retried. It is doubled with
+	// every subsequent attempt up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// HTTP request timeout.
+	Timeout time.Duration
+
+	// Interval at which the DB is scanned for pending deliveries.
+	ScanInterval time.Duration
+}
+
+// Queries contains the queries.
+type Queries struct {
+	GetEvents       *sqlx.Stmt
+	QueueDeliveries *sqlx.Stmt
+	NextDeliveries  *sqlx.Stmt
+	UpdateDelivery  *sqlx.Stmt
+}
+
+// Manager queues and posts webhook event deliveries.
+type Manager struct {
+	opt     Opt
+	queries *Queries
+	client  *http.Client
+	log     *log.Logger
+
+	// Events that enabled webhooks are subscribed to. Events that no webhook
+	// is interested in are not queued.
+	events map[string]struct{}
+	mu     sync.RWMutex
+
+	chNotify chan struct{}
+	chClose  chan struct{}
+}
+
+// New returns a new instance of the webhook manager.
+func New(opt Opt, q *Queries, lo *log.Logger) *Manager {
+	return &Manager{
+		opt:     opt,
+		queries: q,
+		client: &http.Client{
+			Timeout: opt.Timeout,
+		},
+		log:      lo,
+		events:   map[string]struct{}{},
+		chNotify: make(chan struct{}, 1),
+		chClose:  make(chan struct{}),
+	}
+}
+
+// Load loads the events that enabled webhooks are subscribed to. It should be
+// called every time webhooks are modified.
+func (m *Manager) Load() error {
+	var events []string
+	if err := m.queries.GetEvents.Select(&events); err != nil {
+		return err
+	}
+
+	ev := make(map[string]struct{}, len(events))
+	for _, e := range events {
+		ev[e] = struct{}{}
+	}
+
+	m.mu.Lock()
+	m.events = ev
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Trigger queues an event with the given data for delivery to all webhooks
+// that are subscribed to it.
+func (m *Manager) Trigger(event string, data any) {
+	m.mu.RLock()
+	_, ok := m.events[event]
+	m.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	b, err := json.Marshal(Payload{Event: event, CreatedAt: time.Now(), Data: data})
+	if err != nil {
+		m.log.Printf("error marshalling webhook payload (%s): %v", event, err)
+		return
+	}
+
+	if _, err := m.queries.QueueDeliveries.Exec(event, json.RawMessage(b)); err != nil {
+		m.log.Printf("error queuing webhook event (%s): %v", event, err)
+		return
+	}
+
+	// Wake up the worker.
+	select {
+	case m.chNotify <- struct{}{}:
+	default:
+	}
+}
+
+// Run is a blocking function that posts pending deliveries as they are queued
+// and retries failed ones at the specified interval.
+func (m *Manager) Run() {
+	t := time.NewTicker(m.opt.ScanInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-m.chClose:
+			return
+		case <-m.chNotify:
+		case <-t.C:
+		}
+
+		m.process()
+	}
+}
+
+// Close stops the worker.
+func (m *Manager) Close() {
+	close(m.chClose)
+}
+
+// process posts all due deliveries batch by batch. Every batch is claimed for
+// long enough to be posted so that other instances don't post the same deliveries.
+// If the instance dies midway, the deliveries are retried once the claim expires.
+func (m *Manager) process() {
+	var (
+		limit = m.opt.Concurrency * 10
+		lease = m.opt.Timeout * time.Duration(limit/m.opt.Concurrency+1)
+	)
+	for {
+		select {
+		case <-m.chClose:
+			return
+		default:
+		}
+
+		var items []models.WebhookDelivery
+		if err := m.queries.NextDeliveries.Select(&items, limit, lease.Seconds()); err != nil {
+			m.log.Printf("error fetching webhook deliveries: %v", err)
+			return
+		}
+
+		var (
+			wg  sync.WaitGroup
+			sem = make(chan struct{}, m.opt.Concurrency)
+		)
+		for _, d := range items {
+			wg.Add(1)
+			sem <- struct{}{}
+
+			go func(d models.WebhookDelivery) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				m.deliver(d)
+			}(d)
+		}
+		wg.Wait()
+
+		if len(items) < limit {
+			return
+		}
+	}
+}
+
+// deliver posts a delivery's payload to its webhook and records the result.
+func (m *Manager) deliver(d models.WebhookDelivery) {
+	code, resp, err := m.post(d)
+
+	status := models.WebhookDeliveryStatusSuccess
+	if err != nil {
+		resp = err.Error()
+		status = models.WebhookDeliveryStatusPending
+		if d.Attempts+1 >= m.opt.MaxAttempts {
+			status = models.WebhookDeliveryStatusFailed
+		}
+	}
+
+	var (
+		rCode   = null.NewInt(code, code > 0)
+		backoff = m.backoff(d.Attempts).Seconds()
+	)
+	if _, err := m.queries.UpdateDelivery.Exec(d.ID, status, rCode, cleanResponse(resp), backoff); err != nil {
+		m.log.Printf("error updating webhook delivery %d: %v", d.ID, err)
+
+		// Record the attempt without the response so that the delivery isn't
+		// retried indefinitely regardless of the max attempts.
+		if _, err := m.queries.UpdateDelivery.Exec(d.ID, status, rCode, "", backoff); err != nil {
+			m.log.Printf("error updating webhook delivery %d: %v", d.ID, err)
+		}
+	}
+}
+
+// cleanResponse makes a response body safe to be stored in a TEXT column by
+// removing invalid UTF-8 and NUL bytes, and truncates it to maxResponseLen on
+// a character boundary.
+func cleanResponse(s string) string {
+	s = strings.ReplaceAll(strings.ToValidUTF8(s, ""), "\x00", "")
+	if len(s) <= maxResponseLen {
+		return s
+	}
+
+	n := maxResponseLen
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// post makes the HTTP request to the webhook. The payload is signed with the
+// webhook's secret as HMAC-SHA256(secret, timestamp + "." + body).
+func (m *Manager) post(d models.WebhookDelivery) (int, string, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "listmonk")
+	req.Header.Set(hdrEvent, d.Event)
+	req.Header.Set(hdrDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(hdrTimestamp, ts)
+	req.Header.Set(hdrSignature, "sha256="+Sign([]byte(d.Secret), ts, d.Payload))
+
+	r, err := m.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer r.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(r.Body, maxResponseLen))
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return r.StatusCode, "", fmt.Errorf("non-OK response: %d: %s", r.StatusCode, b)
+	}
+
+	return r.StatusCode, string(b), nil
+}
+
+// backoff returns the interval after which a delivery that has been attempted
+// n times is retried.
+func (m *Manager) backoff(n int) time.Duration {
+	d := m.opt.Backoff
+	for i := 0; i < n && d < m.opt.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, m.opt.MaxBackoff)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of a payload and its timestamp.
+func Sign(secret []byte, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,33 @@
+package webhooks
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCleanResponse(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{"plain", "ok", "ok"},
+		{"nul", "o\x00k", "ok"},
+		{"invalid utf8", "o\xffk\xc3", "ok"},
+		{"truncated", strings.Repeat("a", maxResponseLen+10), strings.Repeat("a", maxResponseLen)},
+
+		// A multi-byte character that straddles the limit is dropped whole.
+		{"truncated rune", strings.Repeat("a", maxResponseLen-1) + "é", strings.Repeat("a", maxResponseLen-1)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := cleanResponse(tc.in)
+			if out != tc.out {
+				t.Errorf("expected %q, got %q", tc.out, out)
+			}
+			if !utf8.ValidString(out) || len(out) > maxResponseLen {
+				t.Errorf("expected valid UTF-8 of up to %d bytes, got %d bytes", maxResponseLen, len(out))
+			}
+		})
+	}
+}
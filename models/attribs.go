@@ -0,0 +1,303 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// Subscriber attribute types.
+const (
+	AttribTypeString  = "string"
+	AttribTypeNumber  = "number"
+	AttribTypeBoolean = "boolean"
+	AttribTypeDate    = "date"
+	AttribTypeList    = "list"
+)
+
+// Reasons of attribute validation errors.
+const (
+	AttribErrRequired = "required"
+	AttribErrType     = "type"
+	AttribErrValue    = "value"
+)
+
+// AttribTypes is the list of subscriber attribute types.
+var AttribTypes = []string{AttribTypeString, AttribTypeNumber, AttribTypeBoolean, AttribTypeDate, AttribTypeList}
+
+var reAttribKey = regexp.MustCompile(`^[a-zA-Z0-9_\-]{1,100}$`)
+
+// SubscriberAttrib defines the type and constraints of a top-level key in
+// subscriber attributes.
+type SubscriberAttrib struct {
+	ID          int             `db:"id" json:"id"`
+	Key         string          `db:"key" json:"key"`
+	Name        string          `db:"name" json:"name"`
+	Type        string          `db:"type" json:"type"`
+	Required    bool            `db:"required" json:"required"`
+	Enum        pq.StringArray  `db:"enum" json:"enum"`
+	Default     json.RawMessage `db:"default_value" json:"default"`
+	Description string          `db:"description" json:"description"`
+	CreatedAt   null.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt   null.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// AttribSchema is the schema of subscriber attributes. Attributes that
+// are not in the schema are not validated.
+type AttribSchema []SubscriberAttrib
+
+// AttribError is the error of an attribute that failed validation.
+type AttribError struct {
+	Key    string
+	Reason string
+}
+
+func (e *AttribError) Error() string {
+	if e.Reason == AttribErrRequired {
+		return fmt.Sprintf("attribute '%s' is required", e.Key)
+	}
+
+	return fmt.Sprintf("attribute '%s' has an invalid %s", e.Key, e.Reason)
+}
+
+// IsValidAttribKey checks whether the given attribute key is valid.
+func IsValidAttribKey(key string) bool {
+	return reAttribKey.MatchString(key)
+}
+
+// Validate validates the given attributes against the schema and returns a copy
+// of them with values converted to the types in the schema, eg: "30" to 30 for
+// number attributes, and defaults set on missing attributes.
+func (s AttribSchema) Validate(attribs JSON) (JSON, error) {
+	if len(s) == 0 {
+		return attribs, nil
+	}
+
+	out := make(JSON, len(attribs))
+	for k, v := range attribs {
+		out[k] = v
+	}
+
+	for _, a := range s {
+		v, ok := out[a.Key]
+		if !ok || v == nil || v == "" {
+			if len(a.Default) > 0 && string(a.Default) != "null" {
+				var d any
+				if err := json.Unmarshal(a.Default, &d); err == nil {
+					out[a.Key] = d
+					continue
+				}
+			}
+
+			if a.Required {
+				return nil, &AttribError{Key: a.Key, Reason: AttribErrRequired}
+			}
+			continue
+		}
+
+		val, err := a.Convert(v)
+		if err != nil {
+			return nil, err
+		}
+		out[a.Key] = val
+	}
+
+	return out, nil
+}
+
+// ValidateChanged validates the attributes of an update that are new or changed
+// from the current attributes, cur, against the schema and returns a copy of them
+// with the values converted. Unchanged attributes, which may predate the schema,
+// are retained as they are and attributes absent in the update are not required.
+func (s AttribSchema) ValidateChanged(attribs, cur JSON) (JSON, error) {
+	if len(s) == 0 {
+		return attribs, nil
+	}
+
+	out := make(JSON, len(attribs))
+	for k, v := range attribs {
+		out[k] = v
+	}
+
+	for _, a := range s {
+		v, ok := out[a.Key]
+		if !ok {
+			continue
+		}
+		if c, ok := cur[a.Key]; ok && reflect.DeepEqual(v, c) {
+			continue
+		}
+
+		// A required attribute can't be cleared.
+		if v == nil || v == "" {
+			if a.Required {
+				return nil, &AttribError{Key: a.Key, Reason: AttribErrRequired}
+			}
+			continue
+		}
+
+		val, err := a.Convert(v)
+		if err != nil {
+			return nil, err
+		}
+		out[a.Key] = val
+	}
+
+	return out, nil
+}
+
+// Convert converts a value to the type of the attribute and validates it
+// against the attribute's enum values, if any.
+func (a SubscriberAttrib) Convert(v any) (any, error) {
+	var (
+		out any
+		ok  bool
+	)
+
+	switch a.Type {
+	case AttribTypeString:
+		out, ok = toAttribString(v)
+
+	case AttribTypeNumber:
+		out, ok = toAttribNumber(v)
+
+	case AttribTypeBoolean:
+		switch b := v.(type) {
+		case bool:
+			out, ok = b, true
+		case float64:
+			out, ok = b != 0, b == 0 || b == 1
+		case string:
+			switch strings.ToLower(strings.TrimSpace(b)) {
+			case "true", "t", "1", "yes", "y":
+				out, ok = true, true
+			case "false", "f", "0", "no", "n":
+				out, ok = false, true
+			}
+		}
+
+	case AttribTypeDate:
+		if s, isStr := v.(string); isStr {
+			s = strings.TrimSpace(s)
+			if _, err := time.Parse(time.DateOnly, s); err == nil {
+				out, ok = s, true
+			} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+				out, ok = t.Format(time.RFC3339), true
+			}
+		}
+
+	case AttribTypeList:
+		var items []any
+		switch l := v.(type) {
+		case []any:
+			items, ok = l, true
+		case []string:
+			for _, s := range l {
+				items = append(items, s)
+			}
+			ok = true
+		case string:
+			// Comma separated values, eg: from CSV imports.
+			for _, s := range strings.Split(l, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					items = append(items, s)
+				}
+			}
+			ok = true
+		}
+
+		// Validate the items against the enum values.
+		if ok && len(a.Enum) > 0 {
+			for _, i := range items {
+				s, _ := toAttribString(i)
+				if !a.inEnum(s) {
+					return nil, &AttribError{Key: a.Key, Reason: AttribErrValue}
+				}
+			}
+		}
+		out = items
+		if items == nil {
+			out = []any{}
+		}
+	}
+
+	if !ok {
+		return nil, &AttribError{Key: a.Key, Reason: AttribErrType}
+	}
+
+	// Validate scalar values against the enum values.
+	if len(a.Enum) > 0 && a.Type != AttribTypeList {
+		s, _ := toAttribString(out)
+		if !a.inEnum(s) {
+			return nil, &AttribError{Key: a.Key, Reason: AttribErrValue}
+		}
+	}
+
+	return out, nil
+}
+
+// inEnum checks whether the string form of a value is one of the attribute's enum values.
+func (a SubscriberAttrib) inEnum(s string) bool {
+	for _, e := range a.Enum {
+		if e == s {
+			return true
+		}
+	}
+
+	// Numbers may be written differently, eg: 1 and 1.0.
+	if a.Type == AttribTypeNumber {
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return false
+		}
+		for _, e := range a.Enum {
+			if f, err := strconv.ParseFloat(e, 64); err == nil && f == n {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// toAttribString converts scalar values to strings.
+func toAttribString(v any) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(s), true
+	case bool:
+		return strconv.FormatBool(s), true
+	}
+
+	return "", false
+}
+
+// toAttribNumber converts numbers and numeric strings to float64.
+func toAttribNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, false
+		}
+		return f, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAttribSchemaValidateChanged(t *testing.T) {
+	schema := AttribSchema{
+		{Key: "city", Type: AttribTypeString, Required: true},
+		{Key: "age", Type: AttribTypeNumber},
+		{Key: "plan", Type: AttribTypeString, Enum: []string{"free", "pro"}, Default: []byte(`"free"`)},
+	}
+
+	// A legacy subscriber that predates the schema. It's missing the required
+	// city and has an age that's not a number.
+	cur := JSON{"age": "unknown", "notes": "vip"}
+
+	// Updates that don't touch the non-conforming attributes, eg: a name change
+	// from the preferences page that sends back the current attributes.
+	out, err := schema.ValidateChanged(JSON{"age": "unknown", "notes": "vip"}, cur)
+	if err != nil {
+		t.Fatalf("expected unchanged legacy attributes to be accepted, got %v", err)
+	}
+	if out["age"] != "unknown" {
+		t.Errorf("expected unchanged age to be retained, got %v", out["age"])
+	}
+	if _, ok := out["plan"]; ok {
+		t.Errorf("expected absent attributes to not get defaults, got %v", out["plan"])
+	}
+
+	if _, err := schema.ValidateChanged(JSON{"age": "unknown"}, cur); err != nil {
+		t.Fatalf("expected a partial update to be accepted, got %v", err)
+	}
+
+	// Changed attributes are validated and converted.
+	out, err = schema.ValidateChanged(JSON{"age": "30", "notes": "vip"}, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["age"] != float64(30) {
+		t.Errorf("expected age to be converted to 30, got %v", out["age"])
+	}
+
+	for _, tc := range []struct {
+		attribs JSON
+		key     string
+		reason  string
+	}{
+		{JSON{"age": "thirty"}, "age", AttribErrType},
+		{JSON{"age": "unknown", "plan": "enterprise"}, "plan", AttribErrValue},
+		{JSON{"city": ""}, "city", AttribErrRequired},
+	} {
+		_, err := schema.ValidateChanged(tc.attribs, cur)
+
+		var aErr *AttribError
+		if !errors.As(err, &aErr) {
+			t.Fatalf("%v: expected an attribute error, got %v", tc.attribs, err)
+		}
+		if aErr.Key != tc.key || aErr.Reason != tc.reason {
+			t.Errorf("%v: expected %s %s error, got %s %s", tc.attribs, tc.key, tc.reason, aErr.Key, aErr.Reason)
+		}
+	}
+
+	// A full validation of the same legacy attributes fails.
+	if _, err := schema.Validate(cur); err == nil {
+		t.Error("expected full validation of the legacy attributes to fail")
+	}
+}
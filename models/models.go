@@ -49,6 +49,8 @@ const (
 	CampaignContentTypeMarkdown = "markdown"
 	CampaignContentTypePlain    = "plain"
 	CampaignContentTypeVisual   = "visual"
+	CampaignABMetricViews       = "views"
+	CampaignABMetricClicks      = "clicks"
 
 	// List.
 	ListTypePrivate = "private"
@@ -65,6 +67,7 @@ const (
 	// Headers attached to e-mails for bounce tracking.
 	EmailHeaderSubscriberUUID = "X-Listmonk-Subscriber"
 	EmailHeaderCampaignUUID   = "X-Listmonk-Campaign"
+	EmailHeaderTxUUID         = "X-Listmonk-Tx"
 
 	// Standard e-mail headers.
 	EmailHeaderDate        = "Date"
@@ -78,6 +81,36 @@ const (
 	BounceTypeSoft      = "soft"
 	BounceTypeComplaint = "complaint"
 
+	// Campaign message delivery.
+	DeliveryStatusSent    = "sent"
+	DeliveryStatusFailed  = "failed"
+	DeliveryStatusSkipped = "skipped"
+
+	// Transactional message delivery.
+	TxStatusQueued  = "queued"
+	TxStatusSent    = "sent"
+	TxStatusFailed  = "failed"
+	TxStatusBounced = "bounced"
+
+	// Transactional message batch.
+	TxBatchStatusRunning  = "running"
+	TxBatchStatusFinished = "finished"
+
+	// Automation sequence.
+	SequenceStatusActive   = "active"
+	SequenceStatusDisabled = "disabled"
+
+	// Recurring campaigns.
+	RecurringTypeCron       = "cron"
+	RecurringTypeRSS        = "rss"
+	RecurringStatusActive   = "active"
+	RecurringStatusDisabled = "disabled"
+
+	// Outbound webhook delivery.
+	WebhookDeliveryStatusPending = "pending"
+	WebhookDeliveryStatusSuccess = "success"
+	WebhookDeliveryStatusFailed  = "failed"
+
 	// Templates.
 	TemplateTypeCampaign       = "campaign"
 	TemplateTypeCampaignVisual = "campaign_visual"
@@ -88,6 +121,10 @@ const (
 // similar to url.Values{}
 type Headers []map[string]string
 
+// FeedItems represents the items of an RSS/Atom feed that are injected into
+// the instances of recurring RSS campaigns.
+type FeedItems []FeedItem
+
 // regTplFunc represents contains a regular expression for wrapping and
 // substituting a Go template function from the user's shorthand to a full
 // function call.
@@ -247,6 +284,29 @@ type Campaign struct {
 	ArchiveTemplateID null.Int        `db:"archive_template_id" json:"archive_template_id"`
 	ArchiveMeta       json.RawMessage `db:"archive_meta" json:"archive_meta"`
 
+	// A/B testing.
+	ABTestPercent int       `db:"ab_test_percent" json:"ab_test_percent"`
+	ABTestMetric  string    `db:"ab_test_metric" json:"ab_test_metric"`
+	ABTestWait    string    `db:"ab_test_wait" json:"ab_test_wait"`
+	ABTestSize    int       `db:"ab_test_size" json:"ab_test_size"`
+	ABTestEndsAt  null.Time `db:"ab_test_ends_at" json:"ab_test_ends_at"`
+	ABWinnerID    null.Int  `db:"ab_winner_id" json:"ab_winner_id"`
+
+	// Optional saved segment that filters the campaign's subscribers.
+	SegmentID null.Int `db:"segment_id" json:"segment_id"`
+
+	// Delivery at subscribers' local time. The local window fields track the
+	// range of release times that are being sent while the campaign runs.
+	SendLocalTime    bool        `db:"send_local_time" json:"send_local_time"`
+	SendTimezone     null.String `db:"send_timezone" json:"send_timezone"`
+	LocalWindowStart null.Time   `db:"local_window_start" json:"-"`
+	LocalWindowEnd   null.Time   `db:"local_window_end" json:"-"`
+	LocalNextAt      null.Time   `db:"local_next_at" json:"local_next_at"`
+
+	// New feed items of the recurring RSS campaign run that created the campaign.
+	// They're available in the campaign's templates as {{ .Campaign.Feed }}.
+	Feed FeedItems `db:"feed" json:"feed"`
+
 	// TemplateBody is joined in from templates by the next-campaigns query.
 	TemplateBody        string             `db:"template_body" json:"-"`
 	ArchiveTemplateBody string             `db:"archive_template_body" json:"-"`
@@ -281,11 +341,32 @@ type CampaignMeta struct {
 	Lists types.JSONText `db:"lists" json:"lists"`
 	Media types.JSONText `db:"media" json:"media"`
 
+	// A/B test variants with per-variant stats.
+	Variants types.JSONText `db:"variants" json:"variants"`
+
 	StartedAt null.Time `db:"started_at" json:"started_at"`
 	ToSend    int       `db:"to_send" json:"to_send"`
 	Sent      int       `db:"sent" json:"sent"`
 }
 
+// CampaignVariant represents an alternate subject and body of a campaign
+// that's sent to a portion of the audience in an A/B test.
+type CampaignVariant struct {
+	ID         int         `db:"id" json:"id"`
+	CampaignID int         `db:"campaign_id" json:"-"`
+	Name       string      `db:"name" json:"name"`
+	Subject    string      `db:"subject" json:"subject"`
+	Body       string      `db:"body" json:"body"`
+	AltBody    null.String `db:"altbody" json:"altbody"`
+	CreatedAt  null.Time   `db:"created_at" json:"-"`
+	UpdatedAt  null.Time   `db:"updated_at" json:"-"`
+
+	// Number of subscribers who received the variant and their unique views and clicks.
+	Subscribers int `db:"subscribers" json:"subscribers"`
+	Views       int `db:"views" json:"views"`
+	Clicks      int `db:"clicks" json:"clicks"`
+}
+
 type CampaignStats struct {
 	ID        int       `db:"id" json:"id"`
 	Status    string    `db:"status" json:"status"`
@@ -322,12 +403,42 @@ type Template struct {
 	Body       string      `db:"body" json:"body,omitempty"`
 	BodySource null.String `db:"body_source" json:"body_source,omitempty"`
 	IsDefault  bool        `db:"is_default" json:"is_default"`
+	Version    int         `db:"version" json:"version"`
 
 	// Only relevant to tx (transactional) templates.
 	SubjectTpl *txttpl.Template   `json:"-"`
 	Tpl        *template.Template `json:"-"`
 }
 
+// TemplateVersion is an immutable snapshot of a template that's recorded on every save.
+type TemplateVersion struct {
+	ID         int         `db:"id" json:"id"`
+	TemplateID int         `db:"template_id" json:"template_id"`
+	Version    int         `db:"version" json:"version"`
+	Name       string      `db:"name" json:"name"`
+	Subject    string      `db:"subject" json:"subject"`
+	Body       string      `db:"body" json:"body,omitempty"`
+	BodySource null.String `db:"body_source" json:"body_source,omitempty"`
+	UserID     null.Int    `db:"user_id" json:"user_id"`
+	Username   string      `db:"username" json:"username"`
+	CreatedAt  null.Time   `db:"created_at" json:"created_at"`
+
+	// Pseudofield for getting the total number of versions
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// TemplateDiff is the line diff between two versions of a template. The diffs
+// are in the unified format and are empty if the fields are identical.
+type TemplateDiff struct {
+	TemplateID int    `json:"template_id"`
+	From       int    `json:"from"`
+	To         int    `json:"to"`
+	Name       string `json:"name"`
+	Subject    string `json:"subject"`
+	Body       string `json:"body"`
+}
+
 // Bounce represents a single bounce event.
 type Bounce struct {
 	ID        int             `db:"id" json:"id"`
@@ -345,11 +456,301 @@ type Bounce struct {
 	CampaignUUID string           `db:"campaign_uuid" json:"campaign_uuid,omitempty"`
 	Campaign     *json.RawMessage `db:"campaign" json:"campaign"`
 
+	// UUID of the transactional message that bounced, if any.
+	TxUUID string `db:"-" json:"tx_uuid,omitempty"`
+
 	// Pseudofield for getting the total number of bounces
 	// in searches and queries.
 	Total int `db:"total" json:"-"`
 }
 
+// CampaignDelivery represents a single message send attempt to a subscriber in a campaign.
+type CampaignDelivery struct {
+	ID             int64     `db:"id" json:"id"`
+	CampaignID     int       `db:"campaign_id" json:"campaign_id"`
+	SubscriberID   int       `db:"subscriber_id" json:"subscriber_id"`
+	SubscriberUUID string    `db:"subscriber_uuid" json:"subscriber_uuid"`
+	Email          string    `db:"email" json:"email"`
+	Messenger      string    `db:"messenger" json:"messenger"`
+	Status         string    `db:"status" json:"status"`
+	Error          string    `db:"error" json:"error"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+
+	// Pseudofield for getting the total number of deliveries
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// Segment represents a saved subscriber filter made of a set of lists
+// and an arbitrary SQL expression that can be used as a campaign target.
+type Segment struct {
+	Base
+
+	Name        string        `db:"name" json:"name"`
+	Description string        `db:"description" json:"description"`
+	ListIDs     pq.Int64Array `db:"list_ids" json:"list_ids"`
+	Query       string        `db:"query" json:"query"`
+
+	// Pseudofield for getting the total number of segments
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// SubscriptionForm is a named public subscription form with its own lists,
+// redirects, and opt-in e-mail template.
+type SubscriptionForm struct {
+	Base
+
+	UUID        string        `db:"uuid" json:"uuid"`
+	Name        string        `db:"name" json:"name"`
+	Description string        `db:"description" json:"description"`
+	ListIDs     pq.Int64Array `db:"list_ids" json:"list_ids"`
+
+	// Optional URLs that the subscriber is redirected to after the form is submitted.
+	SuccessURL string `db:"success_url" json:"success_url"`
+	FailureURL string `db:"failure_url" json:"failure_url"`
+
+	// Optional tx template that replaces the default opt-in confirmation e-mail.
+	OptinTemplateID null.Int `db:"optin_template_id" json:"optin_template_id"`
+
+	// Whether the form requires a CAPTCHA if one is configured.
+	Captcha bool `db:"captcha" json:"captcha"`
+
+	// Pseudofield for getting the total number of forms
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// Sequence represents an automation series of messages that are sent to
+// the subscribers of a list at intervals after they subscribe to it.
+type Sequence struct {
+	Base
+
+	UUID       string   `db:"uuid" json:"uuid"`
+	Name       string   `db:"name" json:"name"`
+	ListID     int      `db:"list_id" json:"list_id"`
+	ListName   string   `db:"list_name" json:"list_name"`
+	Status     string   `db:"status" json:"status"`
+	FromEmail  string   `db:"from_email" json:"from_email"`
+	Messenger  string   `db:"messenger" json:"messenger"`
+	TemplateID null.Int `db:"template_id" json:"template_id"`
+	Headers    Headers  `db:"headers" json:"headers"`
+
+	// Number of subscribers who have received at least one step.
+	SubscriberCount int `db:"subscriber_count" json:"subscriber_count"`
+
+	Steps []SequenceStep `db:"-" json:"steps"`
+
+	// Pseudofield for getting the total number of sequences
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// SequenceStep represents a single message in a sequence that's sent
+// DelayHours after a subscriber subscribes to the sequence's list.
+type SequenceStep struct {
+	ID          int         `db:"id" json:"id"`
+	SequenceID  int         `db:"sequence_id" json:"-"`
+	Position    int         `db:"position" json:"position"`
+	DelayHours  int         `db:"delay_hours" json:"delay_hours"`
+	Subject     string      `db:"subject" json:"subject"`
+	Body        string      `db:"body" json:"body"`
+	AltBody     null.String `db:"altbody" json:"altbody"`
+	ContentType string      `db:"content_type" json:"content_type"`
+	CreatedAt   null.Time   `db:"created_at" json:"created_at"`
+	UpdatedAt   null.Time   `db:"updated_at" json:"updated_at"`
+
+	// Number of subscribers the step has been sent to.
+	Sent int `db:"sent" json:"sent"`
+}
+
+// SequenceMessage represents a sequence step that's due to be sent to a subscriber.
+// The subscriber's previous progress in the sequence is restored if the step can't
+// be sent.
+type SequenceMessage struct {
+	SequenceID     int       `db:"sequence_id"`
+	StepID         int       `db:"step_id"`
+	Position       int       `db:"position"`
+	PrevPosition   int       `db:"prev_position"`
+	PrevDelayHours int       `db:"prev_delay_hours"`
+	PrevUpdatedAt  null.Time `db:"prev_updated_at"`
+
+	Subscriber
+}
+
+// RecurringCampaign represents a campaign that's cloned into a new instance
+// and sent on every run of a cron schedule. RSS campaigns only run when the
+// feed has new items since the last run.
+type RecurringCampaign struct {
+	Base
+
+	Name           string    `db:"name" json:"name"`
+	CampaignID     int       `db:"campaign_id" json:"campaign_id"`
+	CampaignName   string    `db:"campaign_name" json:"campaign_name"`
+	Type           string    `db:"type" json:"type"`
+	Status         string    `db:"status" json:"status"`
+	Cron           string    `db:"cron" json:"cron"`
+	FeedURL        string    `db:"feed_url" json:"feed_url"`
+	FeedLastItemAt null.Time `db:"feed_last_item_at" json:"feed_last_item_at"`
+
+	// GUIDs (or links) of the feed items that have been picked up by previous runs.
+	FeedSeenItems pq.StringArray `db:"feed_seen_items" json:"-"`
+
+	Runs           int       `db:"runs" json:"runs"`
+	LastCampaignID null.Int  `db:"last_campaign_id" json:"last_campaign_id"`
+	LastRunAt      null.Time `db:"last_run_at" json:"last_run_at"`
+	NextRunAt      null.Time `db:"next_run_at" json:"next_run_at"`
+
+	// Pseudofield for getting the total number of recurring campaigns
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// TxMessageLog represents a transactional message sent to a recipient
+// and its delivery status.
+type TxMessageLog struct {
+	ID              int64       `db:"id" json:"id"`
+	UUID            string      `db:"uuid" json:"uuid"`
+	IdempotencyKey  null.String `db:"idempotency_key" json:"idempotency_key"`
+	TemplateID      null.Int    `db:"template_id" json:"template_id"`
+	TemplateVersion null.Int    `db:"template_version" json:"template_version"`
+	SubscriberID    null.Int    `db:"subscriber_id" json:"subscriber_id"`
+	Email           string      `db:"email" json:"email"`
+	Subject         string      `db:"subject" json:"subject"`
+	Messenger       string      `db:"messenger" json:"messenger"`
+	Status          string      `db:"status" json:"status"`
+	Error           string      `db:"error" json:"error"`
+	BatchID         null.Int    `db:"batch_id" json:"batch_id"`
+	BatchIndex      null.Int    `db:"batch_index" json:"batch_index"`
+	CreatedAt       null.Time   `db:"created_at" json:"created_at"`
+	UpdatedAt       null.Time   `db:"updated_at" json:"updated_at"`
+
+	// Pseudofield for getting the total number of messages
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// TxBatch represents a batch of transactional messages that are sent asynchronously.
+type TxBatch struct {
+	ID             int64       `db:"id" json:"id"`
+	UUID           string      `db:"uuid" json:"uuid"`
+	IdempotencyKey null.String `db:"idempotency_key" json:"idempotency_key"`
+	TemplateID     null.Int    `db:"template_id" json:"template_id"`
+	Status         string      `db:"status" json:"status"`
+	Total          int         `db:"total" json:"total"`
+	CreatedAt      null.Time   `db:"created_at" json:"created_at"`
+	UpdatedAt      null.Time   `db:"updated_at" json:"updated_at"`
+
+	// Number of messages in the batch in each status, eg: {"sent": 10, "failed": 1}.
+	Counts types.JSONText `db:"counts" json:"counts"`
+}
+
+// FeedItem represents an item in an RSS/Atom feed.
+type FeedItem struct {
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Content     string    `json:"content"`
+	Author      string    `json:"author"`
+	GUID        string    `json:"guid"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Webhook represents an outbound HTTP endpoint that is notified of events.
+type Webhook struct {
+	Base
+
+	Name    string         `db:"name" json:"name"`
+	URL     string         `db:"url" json:"url"`
+	Secret  string         `db:"secret" json:"secret"`
+	Events  pq.StringArray `db:"events" json:"events"`
+	Enabled bool           `db:"enabled" json:"enabled"`
+
+	// Pseudofield for getting the total number of webhooks
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// WebhookDelivery represents an event payload queued for delivery to a webhook
+// along with the result of the last delivery attempt.
+type WebhookDelivery struct {
+	ID            int64           `db:"id" json:"id"`
+	WebhookID     int             `db:"webhook_id" json:"webhook_id"`
+	Event         string          `db:"event" json:"event"`
+	Payload       json.RawMessage `db:"payload" json:"payload"`
+	Status        string          `db:"status" json:"status"`
+	Attempts      int             `db:"attempts" json:"attempts"`
+	ResponseCode  null.Int        `db:"response_code" json:"response_code"`
+	Response      string          `db:"response" json:"response"`
+	NextAttemptAt null.Time       `db:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     null.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt     null.Time       `db:"updated_at" json:"updated_at"`
+
+	// Webhook fields used for sending.
+	URL    string `db:"url" json:"-"`
+	Secret string `db:"secret" json:"-"`
+
+	// Pseudofield for getting the total number of deliveries
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// AuditLog represents a recorded admin or API action. Before and After hold the
+// changed fields of the target record where available.
+type AuditLog struct {
+	ID         int64           `db:"id" json:"id"`
+	UserID     null.Int        `db:"user_id" json:"user_id"`
+	Username   string          `db:"username" json:"username"`
+	Action     string          `db:"action" json:"action"`
+	TargetType string          `db:"target_type" json:"target_type"`
+	TargetID   null.Int        `db:"target_id" json:"target_id"`
+	Before     json.RawMessage `db:"before" json:"before"`
+	After      json.RawMessage `db:"after" json:"after"`
+	Meta       json.RawMessage `db:"meta" json:"meta"`
+	IP         string          `db:"ip" json:"ip"`
+	CreatedAt  null.Time       `db:"created_at" json:"created_at"`
+
+	// Pseudofield for getting the total number of entries
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// AuditLogQuery represents the filters for querying the audit log.
+type AuditLogQuery struct {
+	UserID     int
+	TargetType string
+	TargetID   int
+	Action     string
+	IP         string
+	From       null.Time
+	To         null.Time
+}
+
+// AbuseEvent represents a request to a public endpoint that exceeded a rate limit
+// or led to a temporary block.
+type AbuseEvent struct {
+	ID        int64     `db:"id" json:"id"`
+	Type      string    `db:"type" json:"type"`
+	Scope     string    `db:"scope" json:"scope"`
+	Value     string    `db:"value" json:"value"`
+	IP        string    `db:"ip" json:"ip"`
+	Route     string    `db:"route" json:"route"`
+	CreatedAt null.Time `db:"created_at" json:"created_at"`
+
+	// Pseudofield for getting the total number of entries
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// RateLimitBlock represents a temporarily blocked IP or e-mail domain.
+type RateLimitBlock struct {
+	ID        int       `db:"id" json:"id"`
+	Scope     string    `db:"scope" json:"scope"`
+	Value     string    `db:"value" json:"value"`
+	ExpiresAt null.Time `db:"expires_at" json:"expires_at"`
+	CreatedAt null.Time `db:"created_at" json:"created_at"`
+}
+
 // Message is the message pushed to a Messenger.
 type Message struct {
 	From        string
@@ -368,6 +769,10 @@ type Message struct {
 
 	// Messenger is the messenger backend to use: email|postback.
 	Messenger string
+
+	// TxID is the ID of the transactional message log entry whose status is
+	// updated once the message is pushed to the messenger.
+	TxID int64
 }
 
 // Attachment represents a file or blob attachment that can be
@@ -383,6 +788,9 @@ type TxMessage struct {
 	SubscriberEmails []string `json:"subscriber_emails"`
 	SubscriberIDs    []int    `json:"subscriber_ids"`
 
+	// Recipients are arbitrary recipients who are not subscribers.
+	Recipients []TxRecipient `json:"recipients"`
+
 	// Deprecated.
 	SubscriberEmail string `json:"subscriber_email"`
 	SubscriberID    int    `json:"subscriber_id"`
@@ -395,6 +803,14 @@ type TxMessage struct {
 	Messenger   string         `json:"messenger"`
 	Subject     string         `json:"subject"`
 
+	// IdempotencyKey, if set, dedupes messages sent with the same key within
+	// the idempotency window. Falls back to the Idempotency-Key request header.
+	IdempotencyKey string `json:"idempotency_key"`
+
+	// TemplateVersion, if set, pins the message to a version of the template
+	// instead of its current version.
+	TemplateVersion int `json:"template_version"`
+
 	// File attachments added from multi-part form data.
 	Attachments []Attachment `json:"-"`
 
@@ -403,6 +819,40 @@ type TxMessage struct {
 	SubjectTpl *txttpl.Template   `json:"-"`
 }
 
+// TxBatchMessage is a batch of transactional messages rendered against a single
+// template with per-recipient data and headers.
+type TxBatchMessage struct {
+	TemplateID      int     `json:"template_id"`
+	TemplateVersion int     `json:"template_version"`
+	FromEmail       string  `json:"from_email"`
+	Headers         Headers `json:"headers"`
+	ContentType     string  `json:"content_type"`
+	Messenger       string  `json:"messenger"`
+	Subject         string  `json:"subject"`
+	IdempotencyKey  string  `json:"idempotency_key"`
+
+	Entries []TxBatchEntry `json:"entries"`
+}
+
+// TxBatchEntry is a single recipient in a batch of transactional messages. One of
+// the subscriber's e-mail or ID or a raw recipient should be set. Headers are added
+// to the batch's headers.
+type TxBatchEntry struct {
+	SubscriberEmail string         `json:"subscriber_email"`
+	SubscriberID    int            `json:"subscriber_id"`
+	Recipient       *TxRecipient   `json:"recipient"`
+	Data            map[string]any `json:"data"`
+	Headers         Headers        `json:"headers"`
+}
+
+// TxRecipient is a recipient of a transactional message who isn't a
+// subscriber. It isn't recorded in the DB.
+type TxRecipient struct {
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Attribs JSON   `json:"attribs"`
+}
+
 // markdown is a global instance of Markdown parser and renderer.
 var markdown = goldmark.New(
 	goldmark.WithParserOptions(
@@ -516,6 +966,7 @@ func (camps Campaigns) LoadStats(stmt *sqlx.Stmt) error {
 			camps[i].Clicks = c.Clicks
 			camps[i].Bounces = c.Bounces
 			camps[i].Media = c.Media
+			camps[i].Variants = c.Variants
 		}
 	}
 
@@ -758,3 +1209,27 @@ func (h Headers) Value() (driver.Value, error) {
 
 	return "[]", nil
 }
+
+// Scan implements the sql.Scanner interface.
+func (f *FeedItems) Scan(src any) error {
+	var b []byte
+	switch src := src.(type) {
+	case []byte:
+		b = src
+	case string:
+		b = []byte(src)
+	case nil:
+		return nil
+	}
+
+	return json.Unmarshal(b, f)
+}
+
+// Value implements the driver.Valuer interface.
+func (f FeedItems) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return "[]", nil
+	}
+
+	return json.Marshal(f)
+}
@@ -17,6 +17,7 @@ type Queries struct {
 	InsertSubscriber                *sqlx.Stmt `query:"insert-subscriber"`
 	UpsertSubscriber                *sqlx.Stmt `query:"upsert-subscriber"`
 	UpsertBlocklistSubscriber       *sqlx.Stmt `query:"upsert-blocklist-subscriber"`
+	GetSubscriberStatusesByEmails   *sqlx.Stmt `query:"get-subscriber-statuses-by-emails"`
 	GetSubscriber                   *sqlx.Stmt `query:"get-subscriber"`
 	HasSubscriberLists              *sqlx.Stmt `query:"has-subscriber-list"`
 	GetSubscribersByEmails          *sqlx.Stmt `query:"get-subscribers-by-emails"`
@@ -38,6 +39,22 @@ type Queries struct {
 	ExportSubscriberData            *sqlx.Stmt `query:"export-subscriber-data"`
 	GetSubscriberActivity           *sqlx.Stmt `query:"get-subscriber-activity"`
 
+	GetSubscriberAttribs   *sqlx.Stmt `query:"get-subscriber-attribs"`
+	CreateSubscriberAttrib *sqlx.Stmt `query:"create-subscriber-attrib"`
+	UpdateSubscriberAttrib *sqlx.Stmt `query:"update-subscriber-attrib"`
+	DeleteSubscriberAttrib *sqlx.Stmt `query:"delete-subscriber-attrib"`
+
+	InsertImportJob  *sqlx.Stmt `query:"insert-import-job"`
+	GetImportJobs    *sqlx.Stmt `query:"get-import-jobs"`
+	GetImportJob     *sqlx.Stmt `query:"get-import-job"`
+	GetImportJobLogs *sqlx.Stmt `query:"get-import-job-logs"`
+	NextImportJob    *sqlx.Stmt `query:"next-import-job"`
+	UpdateImportJob  *sqlx.Stmt `query:"update-import-job"`
+	TouchImportJobs  *sqlx.Stmt `query:"touch-import-jobs"`
+	ResetImportJobs  *sqlx.Stmt `query:"reset-import-jobs"`
+	StopImportJob    *sqlx.Stmt `query:"stop-import-job"`
+	DeleteImportJob  *sqlx.Stmt `query:"delete-import-job"`
+
 	// Non-prepared arbitrary subscriber queries.
 	QuerySubscribers                       string     `query:"query-subscribers"`
 	QuerySubscribersCount                  string     `query:"query-subscribers-count"`
@@ -49,6 +66,8 @@ type Queries struct {
 	BlocklistSubscribersByQuery            string     `query:"blocklist-subscribers-by-query"`
 	DeleteSubscriptionsByQuery             string     `query:"delete-subscriptions-by-query"`
 	UnsubscribeSubscribersFromListsByQuery string     `query:"unsubscribe-subscribers-from-lists-by-query"`
+	NextCampaignSegmentSubscribers         string     `query:"next-campaign-segment-subscribers"`
+	UpdateCampaignSegmentCounts            string     `query:"update-campaign-segment-counts"`
 
 	CreateList      *sqlx.Stmt `query:"create-list"`
 	QueryLists      string     `query:"query-lists"`
@@ -89,6 +108,60 @@ type Queries struct {
 	RegisterCampaignView     *sqlx.Stmt `query:"register-campaign-view"`
 	DeleteCampaign           *sqlx.Stmt `query:"delete-campaign"`
 
+	GetCampaignVariants              *sqlx.Stmt `query:"get-campaign-variants"`
+	SetCampaignVariants              *sqlx.Stmt `query:"set-campaign-variants"`
+	RecordCampaignVariantSubscribers *sqlx.Stmt `query:"record-campaign-variant-subscribers"`
+	UpdateCampaignABTest             *sqlx.Stmt `query:"update-campaign-ab-test"`
+	PickCampaignABWinner             *sqlx.Stmt `query:"pick-campaign-ab-winner"`
+
+	NextCampaignLocalWindow *sqlx.Stmt `query:"next-campaign-local-window"`
+
+	InsertCampaignDeliveries *sqlx.Stmt `query:"insert-campaign-deliveries"`
+	QueryCampaignDeliveries  *sqlx.Stmt `query:"query-campaign-deliveries"`
+	DeleteCampaignDeliveries *sqlx.Stmt `query:"delete-campaign-deliveries"`
+
+	GetSegments   *sqlx.Stmt `query:"get-segments"`
+	CreateSegment *sqlx.Stmt `query:"create-segment"`
+	UpdateSegment *sqlx.Stmt `query:"update-segment"`
+	DeleteSegment *sqlx.Stmt `query:"delete-segment"`
+
+	GetSubscriptionForms   *sqlx.Stmt `query:"get-subscription-forms"`
+	CreateSubscriptionForm *sqlx.Stmt `query:"create-subscription-form"`
+	UpdateSubscriptionForm *sqlx.Stmt `query:"update-subscription-form"`
+	DeleteSubscriptionForm *sqlx.Stmt `query:"delete-subscription-form"`
+
+	GetWebhooks             *sqlx.Stmt `query:"get-webhooks"`
+	GetWebhookEvents        *sqlx.Stmt `query:"get-webhook-events"`
+	CreateWebhook           *sqlx.Stmt `query:"create-webhook"`
+	UpdateWebhook           *sqlx.Stmt `query:"update-webhook"`
+	DeleteWebhook           *sqlx.Stmt `query:"delete-webhook"`
+	QueueWebhookDeliveries  *sqlx.Stmt `query:"queue-webhook-deliveries"`
+	NextWebhookDeliveries   *sqlx.Stmt `query:"next-webhook-deliveries"`
+	UpdateWebhookDelivery   *sqlx.Stmt `query:"update-webhook-delivery"`
+	QueryWebhookDeliveries  *sqlx.Stmt `query:"query-webhook-deliveries"`
+	DeleteWebhookDeliveries *sqlx.Stmt `query:"delete-webhook-deliveries"`
+
+	GetSequences           *sqlx.Stmt `query:"get-sequences"`
+	GetSequenceSteps       *sqlx.Stmt `query:"get-sequence-steps"`
+	CreateSequence         *sqlx.Stmt `query:"create-sequence"`
+	UpdateSequence         *sqlx.Stmt `query:"update-sequence"`
+	SetSequenceSteps       *sqlx.Stmt `query:"set-sequence-steps"`
+	DeleteSequence         *sqlx.Stmt `query:"delete-sequence"`
+	RevertSequenceProgress *sqlx.Stmt `query:"revert-sequence-progress"`
+	NextSequenceMessages   *sqlx.Stmt `query:"next-sequence-messages"`
+	GetSequenceStep        *sqlx.Stmt `query:"get-sequence-step"`
+
+	GetRecurringCampaigns           *sqlx.Stmt `query:"get-recurring-campaigns"`
+	CreateRecurringCampaign         *sqlx.Stmt `query:"create-recurring-campaign"`
+	UpdateRecurringCampaign         *sqlx.Stmt `query:"update-recurring-campaign"`
+	DeleteRecurringCampaign         *sqlx.Stmt `query:"delete-recurring-campaign"`
+	RunRecurringCampaign            *sqlx.Stmt `query:"run-recurring-campaign"`
+	GetDueRecurringCampaigns        *sqlx.Stmt `query:"get-due-recurring-campaigns"`
+	ClaimRecurringCampaign          *sqlx.Stmt `query:"claim-recurring-campaign"`
+	ReleaseRecurringCampaign        *sqlx.Stmt `query:"release-recurring-campaign"`
+	CreateRecurringCampaignInstance *sqlx.Stmt `query:"create-recurring-campaign-instance"`
+	UpdateRecurringCampaignRun      *sqlx.Stmt `query:"update-recurring-campaign-run"`
+
 	InsertMedia *sqlx.Stmt `query:"insert-media"`
 	GetMedia    *sqlx.Stmt `query:"get-media"`
 	QueryMedia  *sqlx.Stmt `query:"query-media"`
@@ -100,6 +173,25 @@ type Queries struct {
 	SetDefaultTemplate *sqlx.Stmt `query:"set-default-template"`
 	DeleteTemplate     *sqlx.Stmt `query:"delete-template"`
 
+	GetTemplateVersions *sqlx.Stmt `query:"get-template-versions"`
+	GetTemplateVersion  *sqlx.Stmt `query:"get-template-version"`
+	RollbackTemplate    *sqlx.Stmt `query:"rollback-template"`
+
+	GetTxMessage          *sqlx.Stmt `query:"get-tx-message"`
+	GetTxMessagesByKey    *sqlx.Stmt `query:"get-tx-messages-by-key"`
+	InsertTxMessage       *sqlx.Stmt `query:"insert-tx-message"`
+	UpdateTxMessageStatus *sqlx.Stmt `query:"update-tx-message-status"`
+	BounceTxMessage       *sqlx.Stmt `query:"bounce-tx-message"`
+	GetTxBatch            *sqlx.Stmt `query:"get-tx-batch"`
+	GetTxBatchByKey       *sqlx.Stmt `query:"get-tx-batch-by-key"`
+	InsertTxBatch         *sqlx.Stmt `query:"insert-tx-batch"`
+	TouchTxBatch          *sqlx.Stmt `query:"touch-tx-batch"`
+	NextTxBatch           *sqlx.Stmt `query:"next-tx-batch"`
+	GetTxBatchDone        *sqlx.Stmt `query:"get-tx-batch-done"`
+	FinishTxBatch         *sqlx.Stmt `query:"finish-tx-batch"`
+	GetTxBatchMessages    *sqlx.Stmt `query:"get-tx-batch-messages"`
+	DeleteTxLogs          *sqlx.Stmt `query:"delete-tx-logs"`
+
 	CreateLink        *sqlx.Stmt `query:"create-link"`
 	RegisterLinkClick *sqlx.Stmt `query:"register-link-click"`
 
@@ -122,8 +214,28 @@ type Queries struct {
 	GetUsers          *sqlx.Stmt `query:"get-users"`
 	GetUser           *sqlx.Stmt `query:"get-user"`
 	GetAPITokens      *sqlx.Stmt `query:"get-api-tokens"`
+	CreateAPIToken    *sqlx.Stmt `query:"create-api-token"`
+	DeleteAPIToken    *sqlx.Stmt `query:"delete-api-token"`
+	TouchAPIToken     *sqlx.Stmt `query:"touch-api-token"`
 	LoginUser         *sqlx.Stmt `query:"login-user"`
 
+	SetUserTOTP              *sqlx.Stmt `query:"set-user-totp"`
+	SetUserTOTPRecoveryCodes *sqlx.Stmt `query:"set-user-totp-recovery-codes"`
+	UseUserTOTPStep          *sqlx.Stmt `query:"use-user-totp-step"`
+	UseUserRecoveryCode      *sqlx.Stmt `query:"use-user-recovery-code"`
+
+	InsertAuditLog *sqlx.Stmt `query:"insert-audit-log"`
+	QueryAuditLog  *sqlx.Stmt `query:"query-audit-log"`
+
+	IncrRateLimitCounter   *sqlx.Stmt `query:"incr-rate-limit-counter"`
+	PruneRateLimitCounters *sqlx.Stmt `query:"prune-rate-limit-counters"`
+	GetRateLimitBlock      *sqlx.Stmt `query:"get-rate-limit-block"`
+	GetRateLimitBlocks     *sqlx.Stmt `query:"get-rate-limit-blocks"`
+	UpsertRateLimitBlock   *sqlx.Stmt `query:"upsert-rate-limit-block"`
+	DeleteRateLimitBlock   *sqlx.Stmt `query:"delete-rate-limit-block"`
+	InsertAbuseEvent       *sqlx.Stmt `query:"insert-abuse-event"`
+	QueryAbuseEvents       *sqlx.Stmt `query:"query-abuse-events"`
+
 	CreateRole            *sqlx.Stmt `query:"create-role"`
 	GetUserRoles          *sqlx.Stmt `query:"get-user-roles"`
 	GetListRoles          *sqlx.Stmt `query:"get-list-roles"`
@@ -4,18 +4,19 @@ import "gopkg.in/volatiletech/null.v6"
 
 // Settings represents the app settings stored in the DB.
 type Settings struct {
-	AppSiteName                   string   `json:"app.site_name"`
-	AppRootURL                    string   `json:"app.root_url"`
-	AppLogoURL                    string   `json:"app.logo_url"`
-	AppFaviconURL                 string   `json:"app.favicon_url"`
-	AppFromEmail                  string   `json:"app.from_email"`
-	AppNotifyEmails               []string `json:"app.notify_emails"`
-	EnablePublicSubPage           bool     `json:"app.enable_public_subscription_page"`
-	EnablePublicArchive           bool     `json:"app.enable_public_archive"`
-	EnablePublicArchiveRSSContent bool     `json:"app.enable_public_archive_rss_content"`
-	SendOptinConfirmation         bool     `json:"app.send_optin_confirmation"`
-	CheckUpdates                  bool     `json:"app.check_updates"`
-	AppLang                       string   `json:"app.lang"`
+	AppSiteName                   string      `json:"app.site_name"`
+	AppRootURL                    string      `json:"app.root_url"`
+	AppLogoURL                    string      `json:"app.logo_url"`
+	AppFaviconURL                 string      `json:"app.favicon_url"`
+	AppFromEmail                  string      `json:"app.from_email"`
+	AppNotifyEmails               []string    `json:"app.notify_emails"`
+	EnablePublicSubPage           bool        `json:"app.enable_public_subscription_page"`
+	PublicFormFields              []FormField `json:"app.public_form_fields"`
+	EnablePublicArchive           bool        `json:"app.enable_public_archive"`
+	EnablePublicArchiveRSSContent bool        `json:"app.enable_public_archive_rss_content"`
+	SendOptinConfirmation         bool        `json:"app.send_optin_confirmation"`
+	CheckUpdates                  bool        `json:"app.check_updates"`
+	AppLang                       string      `json:"app.lang"`
 
 	AppBatchSize             int    `json:"app.batch_size"`
 	AppConcurrency           int    `json:"app.concurrency"`
@@ -27,6 +28,9 @@ type Settings struct {
 	AppMessageSlidingWindow         bool   `json:"app.message_sliding_window"`
 	AppMessageSlidingWindowDuration string `json:"app.message_sliding_window_duration"`
 	AppMessageSlidingWindowRate     int    `json:"app.message_sliding_window_rate"`
+	AppDeliveryLog                  bool   `json:"app.delivery_log"`
+	AppImportConcurrency            int    `json:"app.import_concurrency"`
+	AppTxIdempotencyWindow          string `json:"app.tx_idempotency_window"`
 
 	PrivacyIndividualTracking bool     `json:"privacy.individual_tracking"`
 	PrivacyUnsubHeader        bool     `json:"privacy.unsubscribe_header"`
@@ -64,6 +68,16 @@ type Settings struct {
 
 	SecurityCORSOrigins []string `json:"security.cors_origins"`
 
+	SecurityRateLimit struct {
+		Enabled        bool   `json:"enabled"`
+		Backend        string `json:"backend"`
+		Window         string `json:"window"`
+		IPRate         int    `json:"ip_rate"`
+		DomainRate     int    `json:"domain_rate"`
+		BlockThreshold int    `json:"block_threshold"`
+		BlockDuration  string `json:"block_duration"`
+	} `json:"security.rate_limit"`
+
 	UploadProvider             string   `json:"upload.provider"`
 	UploadExtensions           []string `json:"upload.extensions"`
 	UploadFilesystemUploadPath string   `json:"upload.filesystem.upload_path"`
@@ -96,6 +110,14 @@ type Settings struct {
 		WaitTimeout   string              `json:"wait_timeout"`
 		TLSType       string              `json:"tls_type"`
 		TLSSkipVerify bool                `json:"tls_skip_verify"`
+		DKIM          struct {
+			Enabled          bool   `json:"enabled"`
+			Domain           string `json:"domain"`
+			Selector         string `json:"selector"`
+			PrivateKey       string `json:"private_key,omitempty"`
+			Headers          string `json:"headers"`
+			Canonicalization string `json:"canonicalization"`
+		} `json:"dkim"`
 	} `json:"smtp"`
 
 	Messengers []struct {
@@ -138,6 +160,8 @@ type Settings struct {
 		ReturnPath    string `json:"return_path"`
 		Username      string `json:"username"`
 		Password      string `json:"password,omitempty"`
+		Folder        string `json:"folder"`
+		ArchiveFolder string `json:"archive_folder"`
 		TLSEnabled    bool   `json:"tls_enabled"`
 		TLSSkipVerify bool   `json:"tls_skip_verify"`
 		ScanInterval  string `json:"scan_interval"`
@@ -148,3 +172,27 @@ type Settings struct {
 	PublicCustomCSS string `json:"appearance.public.custom_css"`
 	PublicCustomJS  string `json:"appearance.public.custom_js"`
 }
+
+// Types of custom fields on the public subscription form.
+const (
+	FormFieldText     = "text"
+	FormFieldSelect   = "select"
+	FormFieldCheckbox = "checkbox"
+	FormFieldHidden   = "hidden"
+)
+
+// FormFieldTypes is the list of custom form field types.
+var FormFieldTypes = []string{FormFieldText, FormFieldSelect, FormFieldCheckbox, FormFieldHidden}
+
+// FormField is an admin defined field on the public subscription form. Its value
+// is stored in the subscriber's attributes under Key.
+type FormField struct {
+	Key      string   `json:"key"`
+	Label    string   `json:"label"`
+	Type     string   `json:"type"`
+	Options  []string `json:"options"`
+	Required bool     `json:"required"`
+
+	// Default is the value of hidden fields that aren't set, eg: a sign-up source.
+	Default string `json:"default"`
+}
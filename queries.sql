@@ -132,7 +132,7 @@ subs AS (
     SET updated_at = NOW(),
         status = CASE WHEN $7 THEN EXCLUDED.status ELSE subscriber_lists.status END
 )
-SELECT uuid, id from sub;
+SELECT uuid, id, status from sub;
 
 -- name: upsert-blocklist-subscriber
 -- Upserts a subscriber where the update will only set the status to blocklisted
@@ -143,10 +143,17 @@ WITH sub AS (
     INSERT INTO subscribers (uuid, email, name, attribs, status)
     VALUES($1, $2, $3, $4, 'blocklisted')
     ON CONFLICT (email) DO UPDATE SET status='blocklisted', updated_at=NOW()
-    RETURNING id
+    RETURNING uuid, id
+),
+subs AS (
+    UPDATE subscriber_lists SET status='unsubscribed', updated_at=NOW()
+        WHERE subscriber_id = (SELECT id FROM sub)
 )
-UPDATE subscriber_lists SET status='unsubscribed', updated_at=NOW()
-    WHERE subscriber_id = (SELECT id FROM sub);
+SELECT uuid FROM sub;
+
+-- name: get-subscriber-statuses-by-emails
+-- Returns the statuses of existing subscribers by e-mails. This is used in import dry-runs.
+SELECT email, status FROM subscribers WHERE LOWER(email) = ANY($1::TEXT[]);
 
 -- name: update-subscriber
 UPDATE subscribers SET
@@ -251,6 +258,8 @@ WITH lists AS (
     SELECT list_id FROM campaign_lists
     LEFT JOIN campaigns ON (campaign_lists.campaign_id = campaigns.id)
     WHERE campaigns.uuid = $1
+    -- Messages from automation sequences carry the sequence's UUID.
+    UNION SELECT list_id FROM sequences WHERE uuid = $1
 ),
 sub AS (
     UPDATE subscribers SET status = (CASE WHEN $3 IS TRUE THEN 'blocklisted' ELSE status END)
@@ -463,6 +472,73 @@ WITH subs AS (%query%)
 UPDATE subscriber_lists SET status='unsubscribed', updated_at=NOW()
     WHERE (subscriber_id, list_id) = ANY(SELECT a, b FROM UNNEST(ARRAY(SELECT id FROM subs)) a, UNNEST($5::INT[]) b);
 
+-- subscriber attribute schema
+-- name: get-subscriber-attribs
+SELECT * FROM subscriber_attribs WHERE ($1 = 0 OR id = $1) ORDER BY key;
+
+-- name: create-subscriber-attrib
+INSERT INTO subscriber_attribs (key, name, type, required, enum, default_value, description)
+    VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id;
+
+-- name: update-subscriber-attrib
+UPDATE subscriber_attribs SET key=$2, name=$3, type=$4, required=$5, enum=$6, default_value=$7,
+    description=$8, updated_at=NOW() WHERE id = $1;
+
+-- name: delete-subscriber-attrib
+DELETE FROM subscriber_attribs WHERE id = $1;
+
+-- import jobs
+-- name: insert-import-job
+INSERT INTO import_jobs (name, params, file_path) VALUES($1, $2, $3)
+    RETURNING id, name, status, params, total, imported, new, updated, invalid, blocklisted, created_at, started_at, finished_at;
+
+-- name: get-import-jobs
+SELECT COUNT(*) OVER () AS total_count, id, name, status, params, total, imported, new, updated, invalid, blocklisted,
+    created_at, started_at, finished_at
+    FROM import_jobs ORDER BY id DESC OFFSET $1 LIMIT (CASE WHEN $2 < 1 THEN NULL ELSE $2 END);
+
+-- name: get-import-job
+SELECT id, name, status, params, total, imported, new, updated, invalid, blocklisted, created_at, started_at, finished_at
+    FROM import_jobs WHERE id = $1;
+
+-- name: get-import-job-logs
+SELECT log, rejected FROM import_jobs WHERE id = $1;
+
+-- name: next-import-job
+-- Picks the oldest queued import job and marks it as importing.
+UPDATE import_jobs SET status='importing', started_at=NOW(), updated_at=NOW()
+    WHERE id = (SELECT id FROM import_jobs WHERE status = 'queued' ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)
+    RETURNING id, params, file_path;
+
+-- name: update-import-job
+UPDATE import_jobs SET status=$2::import_status, total=$3, imported=$4, new=$5, updated=$6, invalid=$7, blocklisted=$8,
+    log=$9, rejected=$10, file_path=(CASE WHEN $2 IN ('finished', 'failed', 'stopped') THEN '' ELSE file_path END),
+    finished_at=(CASE WHEN $2 IN ('finished', 'failed', 'stopped') THEN NOW() ELSE finished_at END), updated_at=NOW()
+    WHERE id = $1;
+
+-- name: touch-import-jobs
+-- Renews the leases of the jobs that are being imported by an instance.
+UPDATE import_jobs SET updated_at=NOW() WHERE id = ANY($1::INT[]) AND status IN ('importing', 'stopping');
+
+-- name: reset-import-jobs
+-- Re-queues jobs that were interrupted by a shutdown or a crash so that they're restarted from the beginning.
+-- Jobs whose leases are renewed by the instances importing them are left alone.
+UPDATE import_jobs SET status='queued', total=0, imported=0, new=0, updated=0, invalid=0, blocklisted=0,
+    log='', rejected='', started_at=NULL, updated_at=NOW()
+    WHERE status IN ('importing', 'stopping') AND updated_at < NOW() - MAKE_INTERVAL(secs => $1);
+
+-- name: stop-import-job
+-- Stops a queued job that hasn't started yet.
+WITH job AS (
+    SELECT id, file_path FROM import_jobs WHERE id = $1 AND status = 'queued' FOR UPDATE
+)
+UPDATE import_jobs SET status='stopped', file_path='', finished_at=NOW(), updated_at=NOW()
+    FROM job WHERE import_jobs.id = job.id
+    RETURNING job.file_path;
+
+-- name: delete-import-job
+DELETE FROM import_jobs WHERE id = $1 AND status IN ('finished', 'failed', 'stopped') RETURNING id;
+
 
 -- lists
 -- name: get-lists
@@ -577,7 +653,8 @@ counts AS (
 camp AS (
     INSERT INTO campaigns (uuid, type, name, subject, from_email, body, altbody,
         content_type, send_at, headers, tags, messenger, template_id, to_send,
-        max_subscriber_id, archive, archive_slug, archive_template_id, archive_meta, body_source)
+        max_subscriber_id, archive, archive_slug, archive_template_id, archive_meta, body_source,
+        ab_test_percent, ab_test_metric, ab_test_wait, segment_id, send_local_time, send_timezone)
         SELECT $1, $2, $3, $4, $5,
             -- body
             COALESCE(NULLIF($6, ''), (SELECT body FROM tpl), ''),
@@ -592,7 +669,8 @@ camp AS (
             $17,
             $18,
             -- body_source
-            COALESCE($20, (SELECT body_source FROM tpl))
+            COALESCE($20, (SELECT body_source FROM tpl)),
+            $21, $22::ab_test_metric, $23, $24, $25, NULLIF($26, '')
         RETURNING id
 ),
 med AS (
@@ -686,19 +764,41 @@ bounces AS (
     SELECT campaign_id, COUNT(campaign_id) as num FROM bounces
     WHERE campaign_id = ANY($1)
     GROUP BY campaign_id
+),
+variants AS (
+    -- A/B test variants with the number of subscribers who received each variant and their
+    -- unique views and clicks.
+    SELECT cv.campaign_id, JSON_AGG(JSON_BUILD_OBJECT(
+        'id', cv.id, 'name', cv.name, 'subject', cv.subject, 'body', cv.body, 'altbody', cv.altbody,
+        'subscribers', (SELECT COUNT(*) FROM campaign_variant_subscribers vs WHERE vs.variant_id = cv.id),
+        'views', (
+            SELECT COUNT(DISTINCT w.subscriber_id) FROM campaign_views w
+            JOIN campaign_variant_subscribers vs ON (vs.campaign_id = w.campaign_id AND vs.subscriber_id = w.subscriber_id)
+            WHERE vs.variant_id = cv.id
+        ),
+        'clicks', (
+            SELECT COUNT(DISTINCT k.subscriber_id) FROM link_clicks k
+            JOIN campaign_variant_subscribers vs ON (vs.campaign_id = k.campaign_id AND vs.subscriber_id = k.subscriber_id)
+            WHERE vs.variant_id = cv.id
+        )
+    ) ORDER BY cv.id) AS variants FROM campaign_variants cv
+    WHERE cv.campaign_id = ANY($1)
+    GROUP BY cv.campaign_id
 )
 SELECT id as campaign_id,
     COALESCE(v.num, 0) AS views,
     COALESCE(c.num, 0) AS clicks,
     COALESCE(b.num, 0) AS bounces,
     COALESCE(l.lists, '[]') AS lists,
-    COALESCE(m.media, '[]') AS media
+    COALESCE(m.media, '[]') AS media,
+    COALESCE(va.variants, '[]') AS variants
 FROM (SELECT id FROM UNNEST($1) AS id) x
 LEFT JOIN lists AS l ON (l.campaign_id = id)
 LEFT JOIN media AS m ON (m.campaign_id = id)
 LEFT JOIN views AS v ON (v.campaign_id = id)
 LEFT JOIN clicks AS c ON (c.campaign_id = id)
 LEFT JOIN bounces AS b ON (b.campaign_id = id)
+LEFT JOIN variants AS va ON (va.campaign_id = id)
 ORDER BY ARRAY_POSITION($1, id);
 
 -- name: get-campaign-for-preview
@@ -735,8 +835,19 @@ WITH camps AS (
     SELECT campaigns.*, COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1), '') AS template_body
     FROM campaigns
     LEFT JOIN templates ON (templates.id = campaigns.template_id)
-    WHERE (status='running' OR (status='scheduled' AND NOW() >= campaigns.send_at))
+    WHERE (status='running' OR (status='scheduled' AND NOW() >= (
+        -- Campaigns sent at subscribers' local time start when the earliest timezone (UTC+14)
+        -- reaches the wall clock time of send_at in the campaign's timezone.
+        CASE WHEN campaigns.send_local_time
+            THEN (campaigns.send_at AT TIME ZONE campaigns.send_timezone) AT TIME ZONE 'Etc/GMT-14'
+            ELSE campaigns.send_at
+        END
+    )))
     AND NOT(campaigns.id = ANY($1::INT[]))
+    -- Skip campaigns whose A/B test has been sent and are waiting for the test period to end.
+    AND NOT (campaigns.ab_test_ends_at IS NOT NULL AND campaigns.ab_winner_id IS NULL AND NOW() < campaigns.ab_test_ends_at)
+    -- Skip local time campaigns that are waiting for the next timezone to reach the send time.
+    AND NOT (campaigns.local_next_at IS NOT NULL AND NOW() < campaigns.local_next_at)
 ),
 campLists AS (
     -- Get the list_ids and their optin statuses for the campaigns found in the previous step.
@@ -777,7 +888,10 @@ u AS (
     SET to_send = co.to_send,
         status = (CASE WHEN status != 'running' THEN 'running' ELSE status END),
         max_subscriber_id = co.max_subscriber_id,
-        started_at=(CASE WHEN ca.started_at IS NULL THEN NOW() ELSE ca.started_at END)
+        started_at=(CASE WHEN ca.started_at IS NULL THEN NOW() ELSE ca.started_at END),
+        -- For local time campaigns, subscribers whose local send time has been reached
+        -- by now are sent in this window.
+        local_window_end=(CASE WHEN ca.send_local_time THEN COALESCE(ca.local_window_end, NOW()) ELSE NULL END)
     FROM (SELECT * FROM counts) co
     WHERE ca.id = co.campaign_id
 )
@@ -830,10 +944,12 @@ SELECT COUNT(%s) AS "count", url
 -- name: get-running-campaign
 -- Returns the metadata for a running campaign that is required by next-campaign-subscribers to retrieve
 -- a batch of campaign subscribers for processing.
-SELECT campaigns.id AS campaign_id, campaigns.type as campaign_type, last_subscriber_id, max_subscriber_id, lists.id AS list_id
+SELECT campaigns.id AS campaign_id, campaigns.type as campaign_type, last_subscriber_id, max_subscriber_id, lists.id AS list_id,
+    campaigns.segment_id, COALESCE(segments.list_ids, '{}') AS segment_list_ids, COALESCE(segments.query, '') AS segment_query
     FROM campaigns
     LEFT JOIN campaign_lists ON (campaign_lists.campaign_id = campaigns.id)
     LEFT JOIN lists ON (lists.id = campaign_lists.list_id)
+    LEFT JOIN segments ON (segments.id = campaigns.segment_id)
     WHERE campaigns.id = $1 AND status='running';
 
 -- name: next-campaign-subscribers
@@ -853,6 +969,16 @@ WITH campLists AS (
     LEFT JOIN campaign_lists ON campaign_lists.list_id = lists.id
     WHERE campaign_lists.campaign_id = $1
 ),
+camp AS (
+    SELECT send_local_time, send_timezone, (send_at AT TIME ZONE send_timezone) AS local_send_at,
+        local_window_start, local_window_end
+    FROM campaigns WHERE id = $1
+),
+tzs AS MATERIALIZED (
+    -- Valid timezone names to validate subscribers' timezones against. Only read
+    -- for campaigns that are sent at subscribers' local time.
+    SELECT name FROM pg_timezone_names WHERE (SELECT send_local_time FROM camp)
+),
 subs AS (
     SELECT s.*
     FROM (
@@ -860,6 +986,9 @@ subs AS (
         FROM subscriber_lists sl
         JOIN campLists ON sl.list_id = campLists.list_id
         JOIN subscribers s ON s.id = sl.subscriber_id
+        CROSS JOIN camp
+        -- The subscriber's timezone, if there's a valid one in the attributes.
+        LEFT JOIN tzs ON (camp.send_local_time AND tzs.name = s.attribs->>'timezone')
         WHERE
             sl.list_id = ANY($5::INT[])
             -- last_subscriber_id
@@ -882,6 +1011,82 @@ subs AS (
                     )
                 )
             )
+            -- For campaigns sent at subscribers' local time, only pick subscribers whose local
+            -- send time (send_at's wall clock time in their timezone, or the campaign's timezone
+            -- if they don't have one) falls in the campaign's current window.
+            AND (NOT camp.send_local_time OR (
+                (camp.local_send_at AT TIME ZONE COALESCE(tzs.name, camp.send_timezone)) <= camp.local_window_end
+                AND (camp.local_window_start IS NULL OR
+                    (camp.local_send_at AT TIME ZONE COALESCE(tzs.name, camp.send_timezone)) > camp.local_window_start)
+            ))
+        ORDER BY s.id LIMIT $6
+    ) subIDs JOIN subscribers s ON (s.id = subIDs.id) ORDER BY s.id
+),
+u AS (
+    UPDATE campaigns
+    SET last_subscriber_id = (SELECT MAX(id) FROM subs), updated_at = NOW()
+    WHERE (SELECT COUNT(id) FROM subs) > 0 AND id=$1
+)
+SELECT * FROM subs;
+
+-- name: next-campaign-segment-subscribers
+-- raw: true
+-- Replica of next-campaign-subscribers for campaigns that target a saved segment. In addition to
+-- the campaign's lists, subscribers should be in one of the segment's lists ($7, if any) and match
+-- the segment's arbitrary SQL expression (%query%). The expression is evaluated against an unaliased
+-- subscribers table so that it behaves the same as in the subscriber query API.
+WITH campLists AS (
+    SELECT lists.id AS list_id, optin FROM lists
+    LEFT JOIN campaign_lists ON campaign_lists.list_id = lists.id
+    WHERE campaign_lists.campaign_id = $1
+),
+camp AS (
+    SELECT send_local_time, send_timezone, (send_at AT TIME ZONE send_timezone) AS local_send_at,
+        local_window_start, local_window_end
+    FROM campaigns WHERE id = $1
+),
+tzs AS MATERIALIZED (
+    -- Valid timezone names to validate subscribers' timezones against. Only read
+    -- for campaigns that are sent at subscribers' local time.
+    SELECT name FROM pg_timezone_names WHERE (SELECT send_local_time FROM camp)
+),
+subs AS (
+    SELECT s.*
+    FROM (
+        SELECT DISTINCT s.id
+        FROM subscriber_lists sl
+        JOIN campLists ON sl.list_id = campLists.list_id
+        JOIN subscribers s ON s.id = sl.subscriber_id
+        CROSS JOIN camp
+        -- The subscriber's timezone, if there's a valid one in the attributes.
+        LEFT JOIN tzs ON (camp.send_local_time AND tzs.name = s.attribs->>'timezone')
+        WHERE
+            sl.list_id = ANY($5::INT[])
+            AND s.id > $3
+            AND s.id <= $4
+            AND s.status != 'blocklisted'
+            AND (
+                ($2 = 'optin' AND sl.status = 'unconfirmed' AND campLists.optin = 'double')
+                OR (
+                    $2 != 'optin' AND (
+                        (campLists.optin = 'double' AND sl.status = 'confirmed') OR
+                        (campLists.optin != 'double' AND sl.status != 'unsubscribed')
+                    )
+                )
+            )
+            -- Local send time window.
+            AND (NOT camp.send_local_time OR (
+                (camp.local_send_at AT TIME ZONE COALESCE(tzs.name, camp.send_timezone)) <= camp.local_window_end
+                AND (camp.local_window_start IS NULL OR
+                    (camp.local_send_at AT TIME ZONE COALESCE(tzs.name, camp.send_timezone)) > camp.local_window_start)
+            ))
+            -- Segment lists.
+            AND (CARDINALITY($7::INT[]) = 0 OR EXISTS (
+                SELECT 1 FROM subscriber_lists ssl
+                WHERE ssl.subscriber_id = s.id AND ssl.list_id = ANY($7::INT[]) AND ssl.status != 'unsubscribed'
+            ))
+            -- Segment expression.
+            AND EXISTS (SELECT 1 FROM subscribers WHERE subscribers.id = s.id AND %query%)
         ORDER BY s.id LIMIT $6
     ) subIDs JOIN subscribers s ON (s.id = subIDs.id) ORDER BY s.id
 ),
@@ -892,6 +1097,69 @@ u AS (
 )
 SELECT * FROM subs;
 
+-- name: next-campaign-local-window
+-- Moves a running campaign that's sent at subscribers' local time to its next window, that is,
+-- the earliest local send time of its subscribers after the current window. The campaign is picked
+-- up by next-campaigns again at that time. Returns no rows if all timezones have been reached.
+WITH camp AS (
+    SELECT id, type, send_timezone, (send_at AT TIME ZONE send_timezone) AS local_send_at, local_window_end
+    FROM campaigns WHERE id = $1 AND status = 'running' AND send_local_time AND local_window_end IS NOT NULL
+),
+tzs AS MATERIALIZED (
+    SELECT name FROM pg_timezone_names WHERE EXISTS (SELECT 1 FROM camp)
+),
+nextAt AS (
+    SELECT MIN(camp.local_send_at AT TIME ZONE COALESCE(tzs.name, camp.send_timezone)) AS next_at
+    FROM camp
+    JOIN campaign_lists cl ON cl.campaign_id = camp.id
+    JOIN lists l ON l.id = cl.list_id
+    JOIN subscriber_lists sl ON sl.list_id = l.id
+        AND (
+            CASE
+                WHEN camp.type = 'optin' THEN sl.status = 'unconfirmed' AND l.optin = 'double'
+                WHEN l.optin = 'double' THEN sl.status = 'confirmed'
+                ELSE sl.status != 'unsubscribed'
+            END
+        )
+    JOIN subscribers s ON (s.id = sl.subscriber_id AND s.status != 'blocklisted')
+    LEFT JOIN tzs ON (tzs.name = s.attribs->>'timezone')
+    WHERE (camp.local_send_at AT TIME ZONE COALESCE(tzs.name, camp.send_timezone)) > camp.local_window_end
+)
+UPDATE campaigns SET
+    local_window_start = local_window_end,
+    local_window_end = NULL,
+    local_next_at = (SELECT next_at FROM nextAt),
+    last_subscriber_id = 0,
+    updated_at = NOW()
+WHERE id = (SELECT id FROM camp) AND (SELECT next_at FROM nextAt) IS NOT NULL
+RETURNING local_next_at;
+
+-- name: update-campaign-segment-counts
+-- raw: true
+-- Updates the to_send count of a campaign that targets a saved segment to the number of
+-- subscribers in its lists who match the segment. $1 = campaign ID, $2 = segment list IDs.
+UPDATE campaigns SET to_send = (
+    SELECT COUNT(DISTINCT s.id)
+    FROM subscriber_lists sl
+    JOIN lists l ON (l.id = sl.list_id)
+    JOIN campaign_lists cl ON (cl.list_id = sl.list_id AND cl.campaign_id = $1)
+    JOIN subscribers s ON (s.id = sl.subscriber_id)
+    WHERE s.status != 'blocklisted'
+        AND (
+            CASE
+                WHEN campaigns.type = 'optin' THEN sl.status = 'unconfirmed' AND l.optin = 'double'
+                WHEN l.optin = 'double' THEN sl.status = 'confirmed'
+                ELSE sl.status != 'unsubscribed'
+            END
+        )
+        AND (CARDINALITY($2::INT[]) = 0 OR EXISTS (
+            SELECT 1 FROM subscriber_lists ssl
+            WHERE ssl.subscriber_id = s.id AND ssl.list_id = ANY($2::INT[]) AND ssl.status != 'unsubscribed'
+        ))
+        AND EXISTS (SELECT 1 FROM subscribers WHERE subscribers.id = s.id AND %query%)
+)
+WHERE id = $1 RETURNING to_send;
+
 -- name: delete-campaign-views
 DELETE FROM campaign_views WHERE created_at < $1;
 
@@ -932,6 +1200,12 @@ WITH camp AS (
         archive_template_id=(CASE WHEN $7::content_type = 'visual' THEN NULL ELSE $16::INT END),
         archive_meta=$17,
         body_source=$19,
+        ab_test_percent=$20,
+        ab_test_metric=$21::ab_test_metric,
+        ab_test_wait=$22,
+        segment_id=$23,
+        send_local_time=$24,
+        send_timezone=NULLIF($25, ''),
         updated_at=NOW()
     WHERE id = $1 RETURNING id
 ),
@@ -992,27 +1266,564 @@ WITH view AS (
 INSERT INTO campaign_views (campaign_id, subscriber_id)
     VALUES((SELECT campaign_id FROM view), (SELECT subscriber_id FROM view));
 
+-- campaign variants
+-- name: get-campaign-variants
+-- Returns the A/B test variants of a campaign along with the number of subscribers
+-- who received each variant and their unique views and clicks.
+SELECT cv.*,
+    (SELECT COUNT(*) FROM campaign_variant_subscribers vs WHERE vs.variant_id = cv.id) AS subscribers,
+    (
+        SELECT COUNT(DISTINCT w.subscriber_id) FROM campaign_views w
+        JOIN campaign_variant_subscribers vs ON (vs.campaign_id = w.campaign_id AND vs.subscriber_id = w.subscriber_id)
+        WHERE vs.variant_id = cv.id
+    ) AS views,
+    (
+        SELECT COUNT(DISTINCT k.subscriber_id) FROM link_clicks k
+        JOIN campaign_variant_subscribers vs ON (vs.campaign_id = k.campaign_id AND vs.subscriber_id = k.subscriber_id)
+        WHERE vs.variant_id = cv.id
+    ) AS clicks
+FROM campaign_variants cv WHERE cv.campaign_id = $1 ORDER BY cv.id;
+
+-- name: set-campaign-variants
+-- Upserts the variants of a campaign by name and deletes the ones that are not in the given list.
+-- $2 to $5 are arrays of the same length representing the variant fields.
+WITH del AS (
+    DELETE FROM campaign_variants WHERE campaign_id = $1 AND NOT(name = ANY($2::TEXT[]))
+)
+INSERT INTO campaign_variants (campaign_id, name, subject, body, altbody)
+    SELECT $1, v.name, v.subject, v.body, NULLIF(v.altbody, '')
+    FROM UNNEST($2::TEXT[], $3::TEXT[], $4::TEXT[], $5::TEXT[]) AS v(name, subject, body, altbody)
+    ON CONFLICT (campaign_id, name) DO UPDATE
+    SET subject = EXCLUDED.subject, body = EXCLUDED.body, altbody = EXCLUDED.altbody, updated_at = NOW();
+
+-- name: record-campaign-variant-subscribers
+-- Records the variants sent to a batch of subscribers in the A/B test audience of a campaign.
+INSERT INTO campaign_variant_subscribers (campaign_id, subscriber_id, variant_id)
+    SELECT $1, v.subscriber_id, v.variant_id
+    FROM UNNEST($2::INT[], $3::INT[]) AS v(subscriber_id, variant_id)
+    WHERE EXISTS (SELECT 1 FROM subscribers WHERE id = v.subscriber_id)
+    ON CONFLICT (campaign_id, subscriber_id) DO NOTHING;
+
+-- name: update-campaign-ab-test
+-- Sets the A/B test audience size of a campaign and optionally, the time at which
+-- the test ends and the winner is to be picked.
+UPDATE campaigns SET
+    ab_test_size=$2,
+    ab_test_ends_at=(CASE WHEN $3::TIMESTAMP WITH TIME ZONE IS NOT NULL THEN $3 ELSE ab_test_ends_at END),
+    updated_at=NOW()
+WHERE id=$1;
+
+-- name: pick-campaign-ab-winner
+-- Picks the variant with the highest number of unique views or clicks (based on the campaign's
+-- ab_test_metric) among the test audience as the winner. Ties go to the first variant.
+WITH camp AS (
+    SELECT id, ab_test_metric FROM campaigns WHERE id = $1
+),
+counts AS (
+    SELECT cv.id,
+        (CASE WHEN (SELECT ab_test_metric FROM camp) = 'clicks' THEN (
+            SELECT COUNT(DISTINCT k.subscriber_id) FROM link_clicks k
+            JOIN campaign_variant_subscribers vs ON (vs.campaign_id = k.campaign_id AND vs.subscriber_id = k.subscriber_id)
+            WHERE vs.variant_id = cv.id
+        ) ELSE (
+            SELECT COUNT(DISTINCT w.subscriber_id) FROM campaign_views w
+            JOIN campaign_variant_subscribers vs ON (vs.campaign_id = w.campaign_id AND vs.subscriber_id = w.subscriber_id)
+            WHERE vs.variant_id = cv.id
+        ) END) AS num
+    FROM campaign_variants cv WHERE cv.campaign_id = $1
+)
+UPDATE campaigns SET
+    ab_winner_id = (SELECT id FROM counts ORDER BY num DESC, id ASC LIMIT 1),
+    updated_at=NOW()
+WHERE id = $1
+RETURNING COALESCE(ab_winner_id, 0);
+
+-- campaign deliveries
+-- name: insert-campaign-deliveries
+-- Bulk inserts a batch of delivery log entries. Each argument is an array of the same
+-- length representing one column.
+INSERT INTO campaign_deliveries (campaign_id, subscriber_id, messenger, status, error, created_at)
+    SELECT d.campaign_id, d.subscriber_id, d.messenger, d.status, d.error, d.created_at
+    FROM UNNEST($1::INT[], $2::INT[], $3::TEXT[], $4::delivery_status[], $5::TEXT[], $6::TIMESTAMP WITH TIME ZONE[])
+        AS d(campaign_id, subscriber_id, messenger, status, error, created_at)
+    -- Subscribers or the campaign may have been deleted while the campaign was running.
+    WHERE EXISTS (SELECT 1 FROM subscribers WHERE id = d.subscriber_id)
+        AND EXISTS (SELECT 1 FROM campaigns WHERE id = d.campaign_id);
+
+-- name: query-campaign-deliveries
+SELECT COUNT(*) OVER () AS total,
+    campaign_deliveries.id,
+    campaign_deliveries.campaign_id,
+    campaign_deliveries.subscriber_id,
+    subscribers.uuid AS subscriber_uuid,
+    subscribers.email AS email,
+    campaign_deliveries.messenger,
+    campaign_deliveries.status,
+    campaign_deliveries.error,
+    campaign_deliveries.created_at
+FROM campaign_deliveries
+LEFT JOIN subscribers ON (subscribers.id = campaign_deliveries.subscriber_id)
+WHERE campaign_deliveries.campaign_id = $1
+    AND ($2 = 0 OR campaign_deliveries.subscriber_id = $2)
+    AND ($3 = '' OR LOWER(subscribers.email) = LOWER($3))
+    AND ($4 = '' OR campaign_deliveries.status = $4::delivery_status)
+ORDER BY campaign_deliveries.id DESC OFFSET $5 LIMIT (CASE WHEN $6 < 1 THEN NULL ELSE $6 END);
+
+-- name: delete-campaign-deliveries
+DELETE FROM campaign_deliveries WHERE created_at < $1;
+
+-- sequences
+-- name: get-sequences
+SELECT COUNT(*) OVER () AS total, sequences.*, COALESCE(lists.name, '') AS list_name,
+    (SELECT COUNT(*) FROM sequence_subscribers WHERE sequence_id = sequences.id) AS subscriber_count
+    FROM sequences
+    LEFT JOIN lists ON (lists.id = sequences.list_id)
+    WHERE ($1 = 0 OR sequences.id = $1)
+    ORDER BY sequences.created_at DESC OFFSET $2 LIMIT (CASE WHEN $3 < 1 THEN NULL ELSE $3 END);
+
+-- name: get-sequence-steps
+-- Returns the steps of the given sequences along with the number of subscribers
+-- each step has been sent to.
+SELECT st.*,
+    (
+        SELECT COUNT(*) FROM sequence_subscribers ss
+        WHERE ss.sequence_id = st.sequence_id AND ss.last_position >= st.position
+    ) AS sent
+FROM sequence_steps st WHERE st.sequence_id = ANY($1::INT[]) ORDER BY st.sequence_id, st.position;
+
+-- name: create-sequence
+INSERT INTO sequences (uuid, name, list_id, status, from_email, messenger, template_id, headers)
+    VALUES($1, $2, $3, $4, $5, $6,
+        (CASE WHEN $7 = 0 THEN (SELECT id FROM templates WHERE is_default = true AND type = 'campaign') ELSE $7 END),
+        $8)
+    RETURNING id;
+
+-- name: update-sequence
+UPDATE sequences SET
+    name=$2,
+    list_id=$3,
+    status=$4,
+    from_email=$5,
+    messenger=$6,
+    template_id=(CASE WHEN $7 = 0 THEN (SELECT id FROM templates WHERE is_default = true AND type = 'campaign') ELSE $7 END),
+    headers=$8,
+    updated_at=NOW()
+WHERE id = $1;
+
+-- name: set-sequence-steps
+-- Upserts the steps of a sequence by their position (1..N) and deletes the ones beyond
+-- the given number of steps. $2 to $6 are arrays of the same length representing the step fields.
+WITH del AS (
+    DELETE FROM sequence_steps WHERE sequence_id = $1 AND position > CARDINALITY($2::INT[])
+)
+INSERT INTO sequence_steps (sequence_id, position, delay_hours, subject, body, altbody, content_type)
+    SELECT $1, v.pos, v.delay_hours, v.subject, v.body, NULLIF(v.altbody, ''), v.content_type
+    FROM UNNEST($2::INT[], $3::TEXT[], $4::TEXT[], $5::TEXT[], $6::content_type[])
+        WITH ORDINALITY AS v(delay_hours, subject, body, altbody, content_type, pos)
+    ON CONFLICT (sequence_id, position) DO UPDATE
+    SET delay_hours = EXCLUDED.delay_hours, subject = EXCLUDED.subject, body = EXCLUDED.body,
+        altbody = EXCLUDED.altbody, content_type = EXCLUDED.content_type, updated_at = NOW();
+
+-- name: delete-sequence
+DELETE FROM sequences WHERE id = $1;
+
+-- name: next-sequence-messages
+-- Returns a batch of subscribers who are due for the next step in active sequences along
+-- with the step and records their progress in the sequence so that multiple instances don't
+-- pick up the same subscribers. Their previous progress is returned so that it can be restored
+-- if the step can't be sent. A step is due when its delay has passed since the subscriber's
+-- subscription to the sequence's list, or on double optin lists, since its confirmation. Only
+-- subscriptions made after a sequence was created are enrolled in it.
+WITH due AS (
+    SELECT seq.id AS sequence_id, step.id AS step_id, step.position, step.delay_hours, sl.subscriber_id,
+        COALESCE(ss.last_position, 0) AS prev_position, COALESCE(ss.last_delay_hours, 0) AS prev_delay_hours,
+        ss.updated_at AS prev_updated_at
+    FROM sequences seq
+    JOIN lists ON (lists.id = seq.list_id)
+    JOIN subscriber_lists sl ON (sl.list_id = seq.list_id)
+    JOIN subscribers s ON (s.id = sl.subscriber_id)
+    LEFT JOIN sequence_subscribers ss ON (ss.sequence_id = seq.id AND ss.subscriber_id = sl.subscriber_id)
+    JOIN LATERAL (
+        SELECT id, position, delay_hours FROM sequence_steps
+        WHERE sequence_id = seq.id AND position > COALESCE(ss.last_position, 0)
+        ORDER BY position LIMIT 1
+    ) step ON TRUE
+    WHERE seq.status = 'active'
+        AND s.status != 'blocklisted'
+        AND sl.created_at >= seq.created_at
+        -- Double optin lists require a confirmed subscription.
+        AND (CASE WHEN lists.optin = 'double' THEN sl.status = 'confirmed' ELSE sl.status != 'unsubscribed' END)
+        -- Confirmed double optin subscriptions were last updated on confirmation.
+        AND (CASE WHEN lists.optin = 'double' THEN sl.updated_at ELSE sl.created_at END) + MAKE_INTERVAL(hours => step.delay_hours) <= NOW()
+        -- If a subscriber has fallen behind (eg: the sequence was disabled for a while), space
+        -- out the remaining steps by their relative delays instead of sending them all at once.
+        AND (ss.updated_at IS NULL OR ss.updated_at + MAKE_INTERVAL(hours => step.delay_hours - ss.last_delay_hours) <= NOW())
+    ORDER BY sl.created_at
+    LIMIT $1
+),
+prog AS (
+    INSERT INTO sequence_subscribers (sequence_id, subscriber_id, last_position, last_delay_hours)
+        SELECT sequence_id, subscriber_id, position, delay_hours FROM due
+        ON CONFLICT (sequence_id, subscriber_id) DO UPDATE
+        SET last_position = EXCLUDED.last_position, last_delay_hours = EXCLUDED.last_delay_hours, updated_at = NOW()
+)
+SELECT due.sequence_id, due.step_id, due.position, due.prev_position, due.prev_delay_hours, due.prev_updated_at, s.* FROM due
+    JOIN subscribers s ON (s.id = due.subscriber_id)
+    ORDER BY due.step_id, s.id;
+
+-- name: revert-sequence-progress
+-- Restores the previous progress ($4, $5, $6) of a subscriber ($2) in a sequence ($1) whose
+-- step at position $3 couldn't be sent so that it's retried. Progress without a previous
+-- step is removed.
+WITH del AS (
+    DELETE FROM sequence_subscribers
+        WHERE sequence_id=$1 AND subscriber_id=$2 AND last_position=$3 AND $4 = 0
+)
+UPDATE sequence_subscribers SET last_position=$4, last_delay_hours=$5, updated_at=$6
+    WHERE sequence_id=$1 AND subscriber_id=$2 AND last_position=$3 AND $4 > 0;
+
+-- name: get-sequence-step
+-- Returns a sequence step in the shape of a campaign for compiling and sending it
+-- with the campaign message machinery.
+SELECT seq.uuid, seq.name, st.subject, seq.from_email, st.body, st.altbody, st.content_type,
+    'regular' AS type, seq.headers, seq.messenger, seq.template_id, st.created_at, st.updated_at,
+    COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1), '') AS template_body
+    FROM sequence_steps st
+    JOIN sequences seq ON (seq.id = st.sequence_id)
+    LEFT JOIN templates ON (templates.id = seq.template_id)
+    WHERE st.id = $1;
+
+-- recurring campaigns
+-- name: get-recurring-campaigns
+SELECT COUNT(*) OVER () AS total, r.*, COALESCE(c.name, '') AS campaign_name
+    FROM recurring_campaigns r
+    LEFT JOIN campaigns c ON (c.id = r.campaign_id)
+    WHERE ($1 = 0 OR r.id = $1)
+    ORDER BY r.created_at DESC OFFSET $2 LIMIT (CASE WHEN $3 < 1 THEN NULL ELSE $3 END);
+
+-- name: create-recurring-campaign
+INSERT INTO recurring_campaigns (name, campaign_id, type, status, cron, feed_url, next_run_at)
+    VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id;
+
+-- name: update-recurring-campaign
+-- Changing the feed URL resets the feed's progress so that the new feed's items are picked up.
+UPDATE recurring_campaigns SET name=$2, campaign_id=$3, type=$4, status=$5, cron=$6, feed_url=$7, next_run_at=$8,
+    feed_last_item_at=(CASE WHEN feed_url != $7 THEN NULL ELSE feed_last_item_at END),
+    feed_seen_items=(CASE WHEN feed_url != $7 THEN '{}' ELSE feed_seen_items END),
+    updated_at=NOW()
+    WHERE id=$1;
+
+-- name: delete-recurring-campaign
+DELETE FROM recurring_campaigns WHERE id=$1;
+
+-- name: run-recurring-campaign
+-- Makes an active recurring campaign due right away.
+UPDATE recurring_campaigns SET next_run_at=NOW(), updated_at=NOW() WHERE id=$1 AND status='active';
+
+-- name: get-due-recurring-campaigns
+SELECT * FROM recurring_campaigns WHERE status='active' AND next_run_at <= NOW() ORDER BY next_run_at;
+
+-- name: claim-recurring-campaign
+-- Advances a due recurring campaign to its next run. The current next_run_at ($2) is
+-- checked so that a run is only claimed once when multiple instances scan the DB.
+UPDATE recurring_campaigns SET next_run_at=$3, last_run_at=NOW(), updated_at=NOW()
+    WHERE id=$1 AND next_run_at=$2 RETURNING id;
+
+-- name: release-recurring-campaign
+-- Reschedules a claimed run ($2 is the next_run_at it was claimed with) to be retried at $3,
+-- eg: when the feed couldn't be fetched.
+UPDATE recurring_campaigns SET next_run_at=$3, updated_at=NOW() WHERE id=$1 AND next_run_at=$2;
+
+-- name: create-recurring-campaign-instance
+-- Clones the campaign ($1) of a recurring campaign along with its lists, media, and
+-- A/B variants into a new campaign that's scheduled to go out right away.
+WITH src AS (
+    SELECT * FROM campaigns WHERE id=$1
+),
+camp_lists AS (
+    SELECT lists.id, lists.name FROM campaign_lists
+        JOIN lists ON (lists.id = campaign_lists.list_id)
+        WHERE campaign_lists.campaign_id=$1
+),
+counts AS (
+    SELECT
+        COALESCE(COUNT(DISTINCT sl.subscriber_id), 0) AS to_send, COALESCE(MAX(s.id), 0) AS max_sub_id
+    FROM subscriber_lists sl
+        JOIN lists l ON sl.list_id = l.id
+        JOIN subscribers s ON sl.subscriber_id = s.id
+    WHERE sl.list_id = ANY(SELECT id FROM camp_lists)
+      AND s.status != 'blocklisted'
+      AND (
+        (l.optin = 'double' AND sl.status = 'confirmed') OR
+        (l.optin != 'double' AND sl.status != 'unsubscribed')
+      )
+),
+camp AS (
+    INSERT INTO campaigns (uuid, type, name, subject, from_email, body, body_source, altbody,
+        content_type, send_at, status, headers, tags, messenger, template_id, to_send,
+        max_subscriber_id, archive, archive_slug, archive_template_id, archive_meta,
+        ab_test_percent, ab_test_metric, ab_test_wait, segment_id, send_local_time, send_timezone, feed)
+        SELECT $2, type, $3, subject, from_email, body, body_source, altbody,
+            content_type, NOW(), 'scheduled', headers, tags, messenger, template_id,
+            (SELECT to_send FROM counts),
+            (SELECT max_sub_id FROM counts),
+            -- Archive slugs are unique, so every instance gets a dated slug.
+            archive, archive_slug || '-' || TO_CHAR(NOW(), 'YYYY-MM-DD-HH24MI'), archive_template_id, archive_meta,
+            ab_test_percent, ab_test_metric, ab_test_wait, segment_id, send_local_time, send_timezone, $4
+        FROM src
+        RETURNING id
+),
+med AS (
+    INSERT INTO campaign_media (campaign_id, media_id, filename)
+        SELECT (SELECT id FROM camp), media_id, filename FROM campaign_media WHERE campaign_id=$1
+),
+variants AS (
+    INSERT INTO campaign_variants (campaign_id, name, subject, body, altbody)
+        SELECT (SELECT id FROM camp), name, subject, body, altbody FROM campaign_variants WHERE campaign_id=$1
+),
+insLists AS (
+    INSERT INTO campaign_lists (campaign_id, list_id, list_name)
+        SELECT (SELECT id FROM camp), id, name FROM camp_lists
+)
+SELECT id FROM camp;
+
+-- name: update-recurring-campaign-run
+-- Records the campaign created by a run, the publish date of the newest feed item in it,
+-- and the feed items that have been seen.
+UPDATE recurring_campaigns SET runs=runs+1, last_campaign_id=$2,
+    feed_last_item_at=COALESCE($3, feed_last_item_at), feed_seen_items=COALESCE($4, feed_seen_items), updated_at=NOW()
+    WHERE id=$1;
+
+-- segments
+-- name: get-segments
+SELECT COUNT(*) OVER () AS total, segments.* FROM segments
+    WHERE ($1 = 0 OR id = $1)
+    ORDER BY name OFFSET $2 LIMIT (CASE WHEN $3 < 1 THEN NULL ELSE $3 END);
+
+-- name: create-segment
+INSERT INTO segments (name, description, list_ids, query) VALUES($1, $2, $3, $4) RETURNING id;
+
+-- name: update-segment
+UPDATE segments SET name=$2, description=$3, list_ids=$4, query=$5, updated_at=NOW() WHERE id = $1;
+
+-- name: delete-segment
+-- Deletes a segment unless it's the target of a campaign that's yet to finish.
+DELETE FROM segments WHERE id = $1 AND NOT EXISTS (
+    SELECT 1 FROM campaigns WHERE segment_id = $1 AND status IN ('draft', 'scheduled', 'running', 'paused')
+) RETURNING id;
+
+-- subscription forms
+-- name: get-subscription-forms
+SELECT COUNT(*) OVER () AS total, subscription_forms.* FROM subscription_forms
+    WHERE ($1 = 0 OR id = $1) AND ($2 = '' OR uuid = $2::UUID)
+    ORDER BY name OFFSET $3 LIMIT (CASE WHEN $4 < 1 THEN NULL ELSE $4 END);
+
+-- name: create-subscription-form
+INSERT INTO subscription_forms (uuid, name, description, list_ids, success_url, failure_url, optin_template_id, captcha)
+    VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;
+
+-- name: update-subscription-form
+UPDATE subscription_forms SET name=$2, description=$3, list_ids=$4, success_url=$5, failure_url=$6,
+    optin_template_id=$7, captcha=$8, updated_at=NOW() WHERE id = $1;
+
+-- name: delete-subscription-form
+DELETE FROM subscription_forms WHERE id = $1;
+
+-- webhooks
+-- name: get-webhooks
+SELECT COUNT(*) OVER () AS total, webhooks.* FROM webhooks
+    WHERE ($1 = 0 OR id = $1)
+    ORDER BY created_at OFFSET $2 LIMIT (CASE WHEN $3 < 1 THEN NULL ELSE $3 END);
+
+-- name: get-webhook-events
+-- Returns the distinct events that enabled webhooks are subscribed to.
+SELECT DISTINCT UNNEST(events) FROM webhooks WHERE enabled = true;
+
+-- name: create-webhook
+INSERT INTO webhooks (name, url, secret, events, enabled) VALUES($1, $2, $3, $4, $5) RETURNING id;
+
+-- name: update-webhook
+-- The existing secret is retained if an empty one is given.
+UPDATE webhooks SET
+    name=$2,
+    url=$3,
+    secret=(CASE WHEN $4 != '' THEN $4 ELSE secret END),
+    events=$5,
+    enabled=$6,
+    updated_at=NOW()
+WHERE id = $1;
+
+-- name: delete-webhook
+DELETE FROM webhooks WHERE id = $1;
+
+-- name: queue-webhook-deliveries
+-- Queues an event payload for delivery to all enabled webhooks that are subscribed to the event.
+INSERT INTO webhook_deliveries (webhook_id, event, payload)
+    SELECT id, $1, $2::JSONB FROM webhooks WHERE enabled = true AND $1 = ANY(events);
+
+-- name: next-webhook-deliveries
+-- Claims pending deliveries that are due for an attempt by pushing their next attempt $2 seconds
+-- ahead so that other instances don't pick them up while they're being posted. SKIP LOCKED lets
+-- multiple instances claim deliveries concurrently. Returns the claimed deliveries along with
+-- their webhooks' URLs and secrets.
+WITH due AS (
+    SELECT d.id FROM webhook_deliveries d
+        JOIN webhooks w ON (w.id = d.webhook_id)
+        WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND w.enabled = true
+        ORDER BY d.id LIMIT $1
+        FOR UPDATE OF d SKIP LOCKED
+),
+claimed AS (
+    UPDATE webhook_deliveries d SET next_attempt_at = NOW() + MAKE_INTERVAL(secs => $2)
+        FROM due WHERE d.id = due.id
+        RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts
+)
+SELECT c.id, c.webhook_id, c.event, c.payload, c.attempts, w.url, w.secret
+    FROM claimed c
+    JOIN webhooks w ON (w.id = c.webhook_id)
+    ORDER BY c.id;
+
+-- name: update-webhook-delivery
+-- Records a delivery attempt. $5 is the number of seconds after which the next attempt is due.
+UPDATE webhook_deliveries SET
+    status=$2,
+    attempts=attempts + 1,
+    response_code=$3,
+    response=$4,
+    next_attempt_at=NOW() + MAKE_INTERVAL(secs => $5),
+    updated_at=NOW()
+WHERE id = $1;
+
+-- name: query-webhook-deliveries
+SELECT COUNT(*) OVER () AS total, id, webhook_id, event, payload, status, attempts,
+    response_code, response, next_attempt_at, created_at, updated_at
+    FROM webhook_deliveries
+    WHERE webhook_id = $1 AND ($2 = '' OR status = $2::webhook_delivery_status)
+    ORDER BY id DESC OFFSET $3 LIMIT (CASE WHEN $4 < 1 THEN NULL ELSE $4 END);
+
+-- name: delete-webhook-deliveries
+-- Deletes processed (successful or failed) deliveries older than a given date. Pending
+-- deliveries are retained.
+DELETE FROM webhook_deliveries WHERE status != 'pending' AND created_at < $1;
+
+-- audit log
+-- name: insert-audit-log
+INSERT INTO audit_log (user_id, username, action, target_type, target_id, before, after, meta, ip)
+    VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9);
+
+-- name: query-audit-log
+-- $3 matches a substring of the action. $6 and $7 are optional created_at bounds.
+SELECT COUNT(*) OVER () AS total, audit_log.* FROM audit_log
+    WHERE ($1 = 0 OR user_id = $1)
+    AND ($2 = '' OR target_type = $2)
+    AND ($3 = '' OR action ILIKE '%' || $3 || '%')
+    AND ($4 = 0 OR target_id = $4)
+    AND ($5 = '' OR ip = $5)
+    AND ($6::TIMESTAMP WITH TIME ZONE IS NULL OR created_at >= $6)
+    AND ($7::TIMESTAMP WITH TIME ZONE IS NULL OR created_at < $7)
+    ORDER BY id DESC OFFSET $8 LIMIT (CASE WHEN $9 < 1 THEN NULL ELSE $9 END);
+
+-- rate limits
+-- name: incr-rate-limit-counter
+INSERT INTO rate_limit_counters (key, window_start, hits) VALUES($1, $2, 1)
+    ON CONFLICT (key, window_start) DO UPDATE SET hits = rate_limit_counters.hits + 1
+    RETURNING hits;
+
+-- name: prune-rate-limit-counters
+DELETE FROM rate_limit_counters WHERE window_start < $1;
+
+-- name: get-rate-limit-block
+SELECT expires_at FROM rate_limit_blocks WHERE scope = $1 AND value = $2 AND expires_at > NOW();
+
+-- name: get-rate-limit-blocks
+SELECT * FROM rate_limit_blocks WHERE expires_at > NOW() ORDER BY created_at DESC;
+
+-- name: upsert-rate-limit-block
+INSERT INTO rate_limit_blocks (scope, value, expires_at) VALUES($1, $2, $3)
+    ON CONFLICT (scope, value) DO UPDATE SET expires_at = $3, created_at = NOW();
+
+-- name: delete-rate-limit-block
+DELETE FROM rate_limit_blocks WHERE id = $1 RETURNING scope, value;
+
+-- name: insert-abuse-event
+INSERT INTO abuse_events (type, scope, value, ip, route) VALUES($1, $2, $3, $4, $5);
+
+-- name: query-abuse-events
+SELECT COUNT(*) OVER () AS total, abuse_events.* FROM abuse_events
+    WHERE ($1 = '' OR type = $1)
+    AND ($2 = '' OR scope = $2)
+    AND ($3 = '' OR value = LOWER($3) OR ip = $3)
+    ORDER BY id DESC OFFSET $4 LIMIT (CASE WHEN $5 < 1 THEN NULL ELSE $5 END);
+
 -- templates
 -- name: get-templates
 -- Only if the second param ($2 - noBody) is true, body and body_source is returned.
 SELECT id, name, type, subject,
     (CASE WHEN $2 = false THEN body ELSE '' END) as body,
     (CASE WHEN $2 = false THEN body_source ELSE NULL END) as body_source,
-    is_default, created_at, updated_at
+    is_default, version, created_at, updated_at
     FROM templates WHERE ($1 = 0 OR id = $1) AND ($3 = '' OR type = $3::template_type)
     ORDER BY created_at;
 
 -- name: create-template
-INSERT INTO templates (name, type, subject, body, body_source) VALUES($1, $2, $3, $4, $5) RETURNING id;
+-- Creates a template along with its first version. $6 and $7 are the ID and name of the author.
+WITH tpl AS (
+    INSERT INTO templates (name, type, subject, body, body_source) VALUES($1, $2, $3, $4, $5) RETURNING *
+),
+ver AS (
+    INSERT INTO template_versions (template_id, version, name, subject, body, body_source, user_id, username)
+        SELECT id, version, name, subject, body, body_source, NULLIF($6, 0), $7 FROM tpl
+)
+SELECT id FROM tpl;
 
 -- name: update-template
-UPDATE templates SET
-    name=(CASE WHEN $2 != '' THEN $2 ELSE name END),
-    subject=(CASE WHEN $3 != '' THEN $3 ELSE name END),
-    body=(CASE WHEN $4 != '' THEN $4 ELSE body END),
-    body_source=(CASE WHEN $5 != '' THEN $5 ELSE body_source END),
-    updated_at=NOW()
-WHERE id = $1;
+-- Updates a template and records the result as its next version. $6 and $7 are the ID and name of the author.
+WITH tpl AS (
+    UPDATE templates SET
+        name=(CASE WHEN $2 != '' THEN $2 ELSE name END),
+        subject=(CASE WHEN $3 != '' THEN $3 ELSE name END),
+        body=(CASE WHEN $4 != '' THEN $4 ELSE body END),
+        body_source=(CASE WHEN $5 != '' THEN $5 ELSE body_source END),
+        version=version + 1,
+        updated_at=NOW()
+    WHERE id = $1 RETURNING *
+),
+ver AS (
+    INSERT INTO template_versions (template_id, version, name, subject, body, body_source, user_id, username)
+        SELECT id, version, name, subject, body, body_source, NULLIF($6, 0), $7 FROM tpl
+)
+SELECT id FROM tpl;
+
+-- name: get-template-versions
+-- Versions are returned without their bodies, latest first.
+SELECT COUNT(*) OVER () AS total, id, template_id, version, name, subject, user_id, username, created_at
+    FROM template_versions WHERE template_id = $1
+    ORDER BY version DESC OFFSET $2 LIMIT (CASE WHEN $3 < 1 THEN NULL ELSE $3 END);
+
+-- name: get-template-version
+SELECT * FROM template_versions WHERE template_id = $1 AND version = $2;
+
+-- name: rollback-template
+-- Restores a template to one of its versions, which is recorded as its next version.
+-- $3 and $4 are the ID and name of the author.
+WITH v AS (
+    SELECT * FROM template_versions WHERE template_id = $1 AND version = $2
+),
+tpl AS (
+    UPDATE templates SET
+        name=v.name,
+        subject=v.subject,
+        body=v.body,
+        body_source=v.body_source,
+        version=templates.version + 1,
+        updated_at=NOW()
+    FROM v WHERE templates.id = v.template_id RETURNING templates.*
+),
+ver AS (
+    INSERT INTO template_versions (template_id, version, name, subject, body, body_source, user_id, username)
+        SELECT id, version, name, subject, body, body_source, NULLIF($3, 0), $4 FROM tpl
+)
+SELECT id FROM tpl;
 
 -- name: set-default-template
 WITH u AS (
@@ -1035,6 +1846,108 @@ up AS (
 SELECT id FROM tpl;
 
 
+-- tx messages
+-- name: get-tx-message
+-- Get a single tx message by id or UUID.
+SELECT * FROM tx_messages WHERE
+    CASE
+        WHEN $1 > 0 THEN id = $1
+        WHEN $2 != '' THEN uuid = $2::UUID
+    END;
+
+-- name: get-tx-messages-by-key
+-- Unsets idempotency keys ($1) that are older than the idempotency window ($2 seconds) so that
+-- they can be reused and returns the messages sent with the key within the window, optionally
+-- to a given e-mail ($3).
+WITH exp AS (
+    UPDATE tx_messages SET idempotency_key=NULL
+        WHERE idempotency_key=$1 AND created_at < NOW() - MAKE_INTERVAL(secs => $2)
+)
+SELECT * FROM tx_messages WHERE idempotency_key=$1 AND created_at >= NOW() - MAKE_INTERVAL(secs => $2)
+    AND ($3 = '' OR email = $3) ORDER BY id;
+
+-- name: insert-tx-message
+-- Returns no rows if a message with the same idempotency key has already been sent to the e-mail.
+INSERT INTO tx_messages (uuid, idempotency_key, template_id, subscriber_id, email, subject, messenger, status, error, batch_id, batch_index, template_version)
+    VALUES($1, NULLIF($2, ''), NULLIF($3, 0), NULLIF($4, 0), $5, $6, $7, $8, $9, NULLIF($10, 0), $11, NULLIF($12, 0))
+    ON CONFLICT (idempotency_key, email) WHERE idempotency_key IS NOT NULL DO NOTHING
+    RETURNING *;
+
+-- name: update-tx-message-status
+-- A bounce may be recorded before the messenger reports the message as sent.
+UPDATE tx_messages SET status=$2, error=$3, updated_at=NOW() WHERE id=$1 AND status != 'bounced';
+
+-- name: bounce-tx-message
+UPDATE tx_messages SET status='bounced', updated_at=NOW() WHERE uuid=$1::UUID;
+
+-- name: get-tx-batch
+-- Get a tx batch by id or UUID along with the number of its messages in each status.
+SELECT b.id, b.uuid, b.idempotency_key, b.template_id, b.status, b.total, b.created_at, b.updated_at, COALESCE((
+        SELECT JSON_OBJECT_AGG(status, num) FROM (
+            SELECT status, COUNT(*) AS num FROM tx_messages WHERE batch_id = b.id GROUP BY status
+        ) s
+    ), '{}') AS counts
+    FROM tx_batches b WHERE
+    CASE
+        WHEN $1 > 0 THEN b.id = $1
+        WHEN $2 != '' THEN b.uuid = $2::UUID
+    END;
+
+-- name: get-tx-batch-by-key
+-- Unsets idempotency keys ($1) that are older than the idempotency window ($2 seconds) so that
+-- they can be reused and returns the ID of the batch created with the key within the window.
+WITH exp AS (
+    UPDATE tx_batches SET idempotency_key=NULL
+        WHERE idempotency_key=$1 AND created_at < NOW() - MAKE_INTERVAL(secs => $2)
+)
+SELECT id FROM tx_batches WHERE idempotency_key=$1 AND created_at >= NOW() - MAKE_INTERVAL(secs => $2);
+
+-- name: insert-tx-batch
+-- Returns no rows if a batch with the same idempotency key exists.
+INSERT INTO tx_batches (uuid, idempotency_key, template_id, total, payload) VALUES($1, NULLIF($2, ''), $3, $4, $5)
+    ON CONFLICT (idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
+    RETURNING id;
+
+-- name: touch-tx-batch
+-- Renews the lease of a running batch that's being sent.
+UPDATE tx_batches SET updated_at=NOW() WHERE id=$1 AND status='running';
+
+-- name: next-tx-batch
+-- Claims a running batch that hasn't been renewed in $1 seconds, ie: one that was interrupted
+-- by a crash or a restart, by renewing its lease. SKIP LOCKED lets multiple instances
+-- claim batches concurrently without picking up the same batch.
+UPDATE tx_batches SET updated_at=NOW()
+    WHERE id = (
+        SELECT id FROM tx_batches
+            WHERE status='running' AND updated_at < NOW() - MAKE_INTERVAL(secs => $1)
+            ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED
+    )
+    RETURNING id, payload;
+
+-- name: get-tx-batch-done
+-- Returns the indices of the entries in a batch that have been processed.
+SELECT batch_index FROM tx_messages WHERE batch_id=$1 AND batch_index IS NOT NULL;
+
+-- name: finish-tx-batch
+UPDATE tx_batches SET status='finished', payload='{}', updated_at=NOW() WHERE id=$1;
+
+-- name: delete-tx-logs
+-- Deletes transactional messages and finished batches older than a given date. The messages
+-- of running batches are retained as they're used to resume the batches.
+WITH b AS (
+    DELETE FROM tx_batches WHERE status='finished' AND updated_at < $1
+),
+m AS (
+    DELETE FROM tx_messages WHERE created_at < $1
+        AND (batch_id IS NULL OR batch_id NOT IN (SELECT id FROM tx_batches WHERE status='running'))
+    RETURNING 1
+)
+SELECT COUNT(*) FROM m;
+
+-- name: get-tx-batch-messages
+SELECT COUNT(*) OVER () AS total, * FROM tx_messages WHERE batch_id=$1
+    ORDER BY batch_index OFFSET $2 LIMIT (CASE WHEN $3 < 1 THEN NULL ELSE $3 END);
+
 -- media
 -- name: insert-media
 INSERT INTO media (uuid, filename, thumb, content_type, provider, meta, created_at) VALUES($1, $2, $3, $4, $5, $6, NOW()) RETURNING id;
@@ -1172,9 +2085,7 @@ INSERT INTO users (username, password_login, password, email, name, type, user_r
             -- For user types with password_login enabled, bcrypt and store the hash of the password.
             WHEN $6::user_type != 'api' AND $2 AND $3 != ''
                 THEN CRYPT($3, GEN_SALT('bf'))
-            WHEN $6 = 'api'
-            -- For APIs, store the password (token) as-is.
-                THEN $3
+            -- API users authenticate with tokens in api_tokens.
             ELSE NULL
         END
     ), $4, $5, $6, (SELECT id FROM roles WHERE id = $7 AND type = 'user'), (SELECT id FROM roles WHERE id = $8 AND type = 'list'), $9) RETURNING id;
@@ -1216,7 +2127,7 @@ DELETE FROM users WHERE id = ALL($1) AND (SELECT num FROM u) > 0;
 
 -- name: get-users
 WITH ur AS (
-    SELECT id, name, permissions FROM roles WHERE type = 'user' AND parent_id IS NULL
+    SELECT id, name, permissions, require_2fa FROM roles WHERE type = 'user' AND parent_id IS NULL
 ),
 lr AS (
     SELECT r.id, r.name, r.permissions, r.list_id, l.name AS list_name
@@ -1243,6 +2154,7 @@ SELECT
     ur.id AS user_role_id,
     ur.name AS user_role_name,
     ur.permissions AS user_role_permissions,
+    COALESCE(ur.require_2fa, false) AS user_role_require_2fa,
     lp.list_role_id,
     lr.name AS list_role_name,
     lp.list_role_perms
@@ -1269,6 +2181,7 @@ SELECT
     ur.id AS user_role_id,
     ur.name AS user_role_name,
     ur.permissions AS user_role_permissions,
+    COALESCE(ur.require_2fa, false) AS user_role_require_2fa,
     lr.id AS list_role_id,
     lr.name AS list_role_name,
     lp.list_role_perms
@@ -1296,7 +2209,19 @@ FROM sel
 
 
 -- name: get-api-tokens
-SELECT username, password FROM users WHERE status='enabled' AND type='api';
+-- Returns the tokens of all API users or of the given API user ($1).
+SELECT * FROM api_tokens WHERE ($1 = 0 OR user_id = $1) ORDER BY id;
+
+-- name: create-api-token
+INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, permissions, ip_allowlist, expires_at)
+    SELECT id, $2, $3, $4, $5, $6, $7 FROM users WHERE id = $1 AND type = 'api'
+    RETURNING id;
+
+-- name: delete-api-token
+DELETE FROM api_tokens WHERE id = $1 AND user_id = $2;
+
+-- name: touch-api-token
+UPDATE api_tokens SET last_used_at = NOW() WHERE id = $1;
 
 -- name: login-user
 WITH u AS (
@@ -1305,7 +2230,8 @@ WITH u AS (
     WHERE username = $1 AND status != 'disabled' AND password_login = TRUE
     AND CRYPT($2, password) = password
 )
-UPDATE users SET loggedin_at = NOW() WHERE id = (SELECT id FROM u) RETURNING *;
+UPDATE users SET loggedin_at = NOW() WHERE id = (SELECT id FROM u)
+    RETURNING *, (SELECT COALESCE(r.require_2fa, false) FROM roles r WHERE r.id = users.user_role_id) AS user_role_require_2fa;
 
 -- name: update-user-profile
 UPDATE users SET name=$2, email=(CASE WHEN password_login THEN $3 ELSE email END),
@@ -1315,6 +2241,24 @@ UPDATE users SET name=$2, email=(CASE WHEN password_login THEN $3 ELSE email END
 -- name: update-user-login
 UPDATE users SET loggedin_at=NOW(), avatar=(CASE WHEN $2 != '' THEN $2 ELSE avatar END) WHERE id=$1;
 
+-- name: set-user-totp
+-- Sets (or with a NULL secret, removes) a user's TOTP secret and recovery codes.
+UPDATE users SET totp_secret=$2, totp_enabled=$3, totp_recovery_codes=$4, updated_at=NOW()
+    WHERE id=$1 AND type='user';
+
+-- name: set-user-totp-recovery-codes
+UPDATE users SET totp_recovery_codes=$2, updated_at=NOW() WHERE id=$1 AND totp_enabled = true;
+
+-- name: use-user-totp-step
+-- Records the time step of a verified TOTP code. It only succeeds (updates a row) if the step
+-- is newer than the last one, which prevents codes from being reused.
+UPDATE users SET totp_last_step=$2 WHERE id=$1 AND totp_last_step < $2;
+
+-- name: use-user-recovery-code
+-- Removes a recovery code (hash). It only succeeds (updates a row) if the code exists.
+UPDATE users SET totp_recovery_codes=ARRAY_REMOVE(totp_recovery_codes, $2), updated_at=NOW()
+    WHERE id=$1 AND totp_enabled = true AND $2 = ANY(totp_recovery_codes);
+
 -- name: get-user-roles
 WITH mainroles AS (
     SELECT ur.* FROM roles ur WHERE type = 'user' AND ur.parent_id IS NULL AND
@@ -1344,7 +2288,7 @@ SELECT p.*, COALESCE(l.listPerms, '[]'::JSONB) AS "list_permissions" FROM mainro
 
 
 -- name: create-role
-INSERT INTO roles (name, type, permissions, created_at, updated_at) VALUES($1, $2, $3, NOW(), NOW()) RETURNING *;
+INSERT INTO roles (name, type, permissions, require_2fa, created_at, updated_at) VALUES($1, $2, $3, $4, NOW(), NOW()) RETURNING *;
 
 -- name: upsert-list-permissions
 WITH d AS (
@@ -1363,7 +2307,7 @@ INSERT INTO roles (parent_id, list_id, permissions, type)
 DELETE FROM roles WHERE parent_id=$1 AND list_id=$2;
 
 -- name: update-role
-UPDATE roles SET name=$2, permissions=$3 WHERE id=$1 and parent_id IS NULL RETURNING *;
+UPDATE roles SET name=$2, permissions=$3, require_2fa=$4 WHERE id=$1 and parent_id IS NULL RETURNING *;
 
 -- name: delete-role
 DELETE FROM roles WHERE id=$1;
@@ -10,6 +10,16 @@ DROP TYPE IF EXISTS template_type CASCADE; CREATE TYPE template_type AS ENUM ('c
 DROP TYPE IF EXISTS user_type CASCADE; CREATE TYPE user_type AS ENUM ('user', 'api');
 DROP TYPE IF EXISTS user_status CASCADE; CREATE TYPE user_status AS ENUM ('enabled', 'disabled');
 DROP TYPE IF EXISTS role_type CASCADE; CREATE TYPE role_type AS ENUM ('user', 'list');
+DROP TYPE IF EXISTS delivery_status CASCADE; CREATE TYPE delivery_status AS ENUM ('sent', 'failed', 'skipped');
+DROP TYPE IF EXISTS ab_test_metric CASCADE; CREATE TYPE ab_test_metric AS ENUM ('views', 'clicks');
+DROP TYPE IF EXISTS sequence_status CASCADE; CREATE TYPE sequence_status AS ENUM ('active', 'disabled');
+DROP TYPE IF EXISTS webhook_delivery_status CASCADE; CREATE TYPE webhook_delivery_status AS ENUM ('pending', 'success', 'failed');
+DROP TYPE IF EXISTS attrib_type CASCADE; CREATE TYPE attrib_type AS ENUM ('string', 'number', 'boolean', 'date', 'list');
+DROP TYPE IF EXISTS import_status CASCADE; CREATE TYPE import_status AS ENUM ('queued', 'importing', 'stopping', 'finished', 'failed', 'stopped');
+DROP TYPE IF EXISTS recurring_type CASCADE; CREATE TYPE recurring_type AS ENUM ('cron', 'rss');
+DROP TYPE IF EXISTS recurring_status CASCADE; CREATE TYPE recurring_status AS ENUM ('active', 'disabled');
+DROP TYPE IF EXISTS tx_status CASCADE; CREATE TYPE tx_status AS ENUM ('queued', 'sent', 'failed', 'bounced');
+DROP TYPE IF EXISTS tx_batch_status CASCADE; CREATE TYPE tx_batch_status AS ENUM ('running', 'finished');
 
 CREATE EXTENSION IF NOT EXISTS pgcrypto;
 
@@ -32,6 +42,22 @@ DROP INDEX IF EXISTS idx_subs_id_status; CREATE INDEX idx_subs_id_status ON subs
 DROP INDEX IF EXISTS idx_subs_created_at; CREATE INDEX idx_subs_created_at ON subscribers(created_at);
 DROP INDEX IF EXISTS idx_subs_updated_at; CREATE INDEX idx_subs_updated_at ON subscribers(updated_at);
 
+-- subscriber_attribs is the optional schema of top-level keys in subscriber attributes.
+DROP TABLE IF EXISTS subscriber_attribs CASCADE;
+CREATE TABLE subscriber_attribs (
+    id              SERIAL PRIMARY KEY,
+    key             TEXT NOT NULL UNIQUE,
+    name            TEXT NOT NULL DEFAULT '',
+    type            attrib_type NOT NULL DEFAULT 'string',
+    required        BOOLEAN NOT NULL DEFAULT false,
+    enum            TEXT[] NOT NULL DEFAULT '{}',
+    default_value   JSONB NULL,
+    description     TEXT NOT NULL DEFAULT '',
+
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
 -- lists
 DROP TABLE IF EXISTS lists CASCADE;
 CREATE TABLE lists (
@@ -80,11 +106,67 @@ CREATE TABLE templates (
     body_source     TEXT NULL,
     is_default      BOOLEAN NOT NULL DEFAULT false,
 
+    -- The current version of the template in template_versions.
+    version         INTEGER NOT NULL DEFAULT 1,
+
     created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 CREATE UNIQUE INDEX ON templates (is_default) WHERE is_default = true;
 
+-- segments are saved subscriber filters (lists + an arbitrary SQL expression)
+-- that can be used as campaign targets.
+DROP TABLE IF EXISTS segments CASCADE;
+CREATE TABLE segments (
+    id               SERIAL PRIMARY KEY,
+    name             TEXT NOT NULL,
+    description      TEXT NOT NULL DEFAULT '',
+    list_ids         INT[] NOT NULL DEFAULT '{}',
+    query            TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- subscription_forms are named public subscription forms, each with its own lists,
+-- redirects, and opt-in e-mail template.
+DROP TABLE IF EXISTS subscription_forms CASCADE;
+CREATE TABLE subscription_forms (
+    id                SERIAL PRIMARY KEY,
+    uuid              uuid NOT NULL UNIQUE,
+    name              TEXT NOT NULL,
+    description       TEXT NOT NULL DEFAULT '',
+    list_ids          INT[] NOT NULL DEFAULT '{}',
+    success_url       TEXT NOT NULL DEFAULT '',
+    failure_url       TEXT NOT NULL DEFAULT '',
+    optin_template_id INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    captcha           BOOLEAN NOT NULL DEFAULT true,
+    created_at        TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at        TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- import_jobs is the queue of bulk subscriber imports.
+DROP TABLE IF EXISTS import_jobs CASCADE;
+CREATE TABLE import_jobs (
+    id               SERIAL PRIMARY KEY,
+    name             TEXT NOT NULL,
+    status           import_status NOT NULL DEFAULT 'queued',
+    params           JSONB NOT NULL DEFAULT '{}',
+    file_path        TEXT NOT NULL DEFAULT '',
+    total            INTEGER NOT NULL DEFAULT 0,
+    imported         INTEGER NOT NULL DEFAULT 0,
+    new              INTEGER NOT NULL DEFAULT 0,
+    updated          INTEGER NOT NULL DEFAULT 0,
+    invalid          INTEGER NOT NULL DEFAULT 0,
+    blocklisted      INTEGER NOT NULL DEFAULT 0,
+    log              TEXT NOT NULL DEFAULT '',
+    rejected         TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    started_at       TIMESTAMP WITH TIME ZONE NULL,
+    finished_at      TIMESTAMP WITH TIME ZONE NULL,
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_import_jobs_status; CREATE INDEX idx_import_jobs_status ON import_jobs(status);
+
 
 -- campaigns
 DROP TABLE IF EXISTS campaigns CASCADE;
@@ -123,6 +205,30 @@ CREATE TABLE campaigns (
     archive_template_id INTEGER REFERENCES templates(id) ON DELETE SET NULL,
     archive_meta        JSONB NOT NULL DEFAULT '{}',
 
+    -- A/B testing. A percentage of the audience is split across the campaign's
+    -- variants, and after the wait period, the winning variant is sent to the rest.
+    ab_test_percent     INT NOT NULL DEFAULT 0,
+    ab_test_metric      ab_test_metric NOT NULL DEFAULT 'views',
+    ab_test_wait        TEXT NOT NULL DEFAULT '4h',
+    ab_test_size        INT NOT NULL DEFAULT 0,
+    ab_test_ends_at     TIMESTAMP WITH TIME ZONE NULL,
+    ab_winner_id        INT NULL,
+
+    -- Optional saved segment whose filter is applied to the campaign's lists when it runs.
+    segment_id          INTEGER NULL REFERENCES segments(id) ON DELETE SET NULL,
+
+    -- Deliver at the subscribers' local time. send_at's wall clock time in send_timezone
+    -- is the time at which the campaign goes out in every subscriber's timezone.
+    -- Subscribers are released in windows of release times as their clocks reach it.
+    send_local_time     BOOLEAN NOT NULL DEFAULT false,
+    send_timezone       TEXT NULL,
+    local_window_start  TIMESTAMP WITH TIME ZONE NULL,
+    local_window_end    TIMESTAMP WITH TIME ZONE NULL,
+    local_next_at       TIMESTAMP WITH TIME ZONE NULL,
+
+    -- Feed items that were injected into instances of recurring RSS campaigns.
+    feed                JSONB NOT NULL DEFAULT '[]',
+
     started_at       TIMESTAMP WITH TIME ZONE,
     created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
@@ -160,6 +266,21 @@ DROP INDEX IF EXISTS idx_views_camp_id; CREATE INDEX idx_views_camp_id ON campai
 DROP INDEX IF EXISTS idx_views_subscriber_id; CREATE INDEX idx_views_subscriber_id ON campaign_views(subscriber_id);
 DROP INDEX IF EXISTS idx_views_date; CREATE INDEX idx_views_date ON campaign_views((TIMEZONE('UTC', created_at)::DATE));
 
+-- campaign_deliveries is the log of every message send attempt in a campaign.
+DROP TABLE IF EXISTS campaign_deliveries CASCADE;
+CREATE TABLE campaign_deliveries (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    messenger        TEXT NOT NULL,
+    status           delivery_status NOT NULL,
+    error            TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_deliveries_camp_id; CREATE INDEX idx_deliveries_camp_id ON campaign_deliveries(campaign_id);
+DROP INDEX IF EXISTS idx_deliveries_sub_id; CREATE INDEX idx_deliveries_sub_id ON campaign_deliveries(subscriber_id);
+DROP INDEX IF EXISTS idx_deliveries_created_at; CREATE INDEX idx_deliveries_created_at ON campaign_deliveries(created_at);
+
 -- media
 DROP TABLE IF EXISTS media CASCADE;
 CREATE TABLE media (
@@ -188,6 +309,108 @@ CREATE TABLE campaign_media (
 DROP INDEX IF EXISTS idx_camp_media_id; CREATE UNIQUE INDEX idx_camp_media_id ON campaign_media (campaign_id, media_id);
 DROP INDEX IF EXISTS idx_camp_media_camp_id; CREATE INDEX idx_camp_media_camp_id ON campaign_media(campaign_id);
 
+-- campaign_variants
+DROP TABLE IF EXISTS campaign_variants CASCADE;
+CREATE TABLE campaign_variants (
+    id               SERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    name             TEXT NOT NULL,
+    subject          TEXT NOT NULL,
+    body             TEXT NOT NULL,
+    altbody          TEXT NULL,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_camp_variants_name; CREATE UNIQUE INDEX idx_camp_variants_name ON campaign_variants (campaign_id, name);
+
+-- campaign_variant_subscribers records the variant each subscriber in the
+-- A/B test audience received, for attributing views and clicks to variants.
+DROP TABLE IF EXISTS campaign_variant_subscribers CASCADE;
+CREATE TABLE campaign_variant_subscribers (
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    variant_id       INTEGER NOT NULL REFERENCES campaign_variants(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    PRIMARY KEY (campaign_id, subscriber_id)
+);
+DROP INDEX IF EXISTS idx_camp_variant_subs_variant_id; CREATE INDEX idx_camp_variant_subs_variant_id ON campaign_variant_subscribers(variant_id);
+
+
+-- recurring_campaigns clone a campaign into a new instance on every run of a cron
+-- schedule. RSS campaigns only run when the feed has items that are not in feed_seen_items,
+-- the GUIDs (or links) of the items picked up by previous runs.
+DROP TABLE IF EXISTS recurring_campaigns CASCADE;
+CREATE TABLE recurring_campaigns (
+    id                SERIAL PRIMARY KEY,
+    name              TEXT NOT NULL,
+    campaign_id       INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    type              recurring_type NOT NULL DEFAULT 'cron',
+    status            recurring_status NOT NULL DEFAULT 'active',
+    cron              TEXT NOT NULL,
+    feed_url          TEXT NOT NULL DEFAULT '',
+    feed_last_item_at TIMESTAMP WITH TIME ZONE NULL,
+    feed_seen_items   TEXT[] NOT NULL DEFAULT '{}',
+    runs              INTEGER NOT NULL DEFAULT 0,
+    last_campaign_id  INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL,
+    last_run_at       TIMESTAMP WITH TIME ZONE NULL,
+    next_run_at       TIMESTAMP WITH TIME ZONE NULL,
+    created_at        TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at        TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_recurring_next_run_at; CREATE INDEX idx_recurring_next_run_at ON recurring_campaigns(next_run_at);
+
+-- sequences are automation series of messages sent to subscribers of a list
+-- at intervals after they subscribe to it.
+DROP TABLE IF EXISTS sequences CASCADE;
+CREATE TABLE sequences (
+    id               SERIAL PRIMARY KEY,
+    uuid uuid        NOT NULL UNIQUE,
+    name             TEXT NOT NULL,
+    list_id          INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    status           sequence_status NOT NULL DEFAULT 'active',
+    from_email       TEXT NOT NULL,
+    messenger        TEXT NOT NULL,
+    template_id      INTEGER REFERENCES templates(id) ON DELETE SET NULL,
+    headers          JSONB NOT NULL DEFAULT '[]',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_sequences_list_id; CREATE INDEX idx_sequences_list_id ON sequences(list_id);
+
+DROP TABLE IF EXISTS sequence_steps CASCADE;
+CREATE TABLE sequence_steps (
+    id               SERIAL PRIMARY KEY,
+    sequence_id      INTEGER NOT NULL REFERENCES sequences(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    position         INT NOT NULL,
+
+    -- Hours after the subscription to the sequence's list that the step is sent.
+    delay_hours      INT NOT NULL DEFAULT 0,
+
+    subject          TEXT NOT NULL,
+    body             TEXT NOT NULL,
+    altbody          TEXT NULL,
+    content_type     content_type NOT NULL DEFAULT 'richtext',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_sequence_steps_pos; CREATE UNIQUE INDEX idx_sequence_steps_pos ON sequence_steps(sequence_id, position);
+
+-- sequence_subscribers tracks the progress of each subscriber in a sequence.
+DROP TABLE IF EXISTS sequence_subscribers CASCADE;
+CREATE TABLE sequence_subscribers (
+    sequence_id      INTEGER NOT NULL REFERENCES sequences(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    -- Position and delay of the last step sent to the subscriber.
+    last_position    INT NOT NULL DEFAULT 0,
+    last_delay_hours INT NOT NULL DEFAULT 0,
+
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (sequence_id, subscriber_id)
+);
+DROP INDEX IF EXISTS idx_sequence_subs_sub_id; CREATE INDEX idx_sequence_subs_sub_id ON sequence_subscribers(subscriber_id);
 
 -- links
 DROP TABLE IF EXISTS links CASCADE;
@@ -234,10 +457,14 @@ INSERT INTO settings (key, value) VALUES
     ('app.message_sliding_window', 'false'),
     ('app.message_sliding_window_duration', '"1h"'),
     ('app.message_sliding_window_rate', '10000'),
+    ('app.delivery_log', 'true'),
+    ('app.import_concurrency', '1'),
+    ('app.tx_idempotency_window', '"24h"'),
     ('app.cache_slow_queries', 'false'),
     ('app.cache_slow_queries_interval', '"0 3 * * *"'),
     ('app.enable_public_archive', 'true'),
     ('app.enable_public_subscription_page', 'true'),
+    ('app.public_form_fields', '[]'),
     ('app.enable_public_archive_rss_content', 'true'),
     ('app.send_optin_confirmation', 'true'),
     ('app.check_updates', 'true'),
@@ -256,6 +483,7 @@ INSERT INTO settings (key, value) VALUES
     ('security.captcha', '{"altcha": {"enabled": false, "complexity": 300000}, "hcaptcha": {"enabled": false, "key": "", "secret": ""}}'),
     ('security.oidc', '{"enabled": false, "provider_url": "", "provider_name": "", "client_id": "", "client_secret": "", "auto_create_users": false, "default_user_role_id": null, "default_list_role_id": null}'),
     ('security.cors_origins', '[]'),
+    ('security.rate_limit', '{"enabled": false, "backend": "memory", "window": "1m", "ip_rate": 10, "domain_rate": 50, "block_threshold": 20, "block_duration": "1h"}'),
     ('upload.provider', '"filesystem"'),
     ('upload.max_file_size', '5000'),
     ('upload.extensions', '["jpg","jpeg","png","gif","svg","*"]'),
@@ -306,6 +534,87 @@ DROP INDEX IF EXISTS idx_bounces_camp_id; CREATE INDEX idx_bounces_camp_id ON bo
 DROP INDEX IF EXISTS idx_bounces_source; CREATE INDEX idx_bounces_source ON bounces(source);
 DROP INDEX IF EXISTS idx_bounces_date; CREATE INDEX idx_bounces_date ON bounces((TIMEZONE('UTC', created_at)::DATE));
 
+-- tx_batches are batches of transactional messages with per-recipient data that are
+-- sent asynchronously. The result of every entry in a batch is logged in tx_messages.
+DROP TABLE IF EXISTS tx_batches CASCADE;
+CREATE TABLE tx_batches (
+    id               BIGSERIAL PRIMARY KEY,
+    uuid uuid        NOT NULL UNIQUE,
+    idempotency_key  TEXT NULL,
+    template_id      INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    status           tx_batch_status NOT NULL DEFAULT 'running',
+    total            INTEGER NOT NULL DEFAULT 0,
+
+    -- The batch's message and entries, which are needed to resume an interrupted batch.
+    -- It's cleared once the batch finishes.
+    payload          JSONB NOT NULL DEFAULT '{}',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    -- Renewed periodically while a batch is being sent. A running batch that's not
+    -- been updated recently was interrupted and is resumed.
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_tx_batches_key; CREATE UNIQUE INDEX idx_tx_batches_key ON tx_batches(idempotency_key) WHERE idempotency_key IS NOT NULL;
+DROP INDEX IF EXISTS idx_tx_batches_running; CREATE INDEX idx_tx_batches_running ON tx_batches(updated_at) WHERE status = 'running';
+
+-- tx_messages is the log of transactional messages and their delivery status.
+-- idempotency_key is unset once it's older than the idempotency window.
+DROP TABLE IF EXISTS tx_messages CASCADE;
+CREATE TABLE tx_messages (
+    id               BIGSERIAL PRIMARY KEY,
+    uuid uuid        NOT NULL UNIQUE,
+    idempotency_key  TEXT NULL,
+    template_id      INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    template_version INTEGER NULL,
+    subscriber_id    INTEGER NULL REFERENCES subscribers(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    email            TEXT NOT NULL,
+    subject          TEXT NOT NULL DEFAULT '',
+    messenger        TEXT NOT NULL,
+    status           tx_status NOT NULL DEFAULT 'queued',
+    error            TEXT NOT NULL DEFAULT '',
+
+    -- Batch and the position of the entry in the batch, if the message was sent in one.
+    batch_id         BIGINT NULL REFERENCES tx_batches(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    batch_index      INTEGER NULL,
+
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_tx_messages_batch_id; CREATE INDEX idx_tx_messages_batch_id ON tx_messages(batch_id);
+DROP INDEX IF EXISTS idx_tx_messages_key; CREATE UNIQUE INDEX idx_tx_messages_key ON tx_messages(idempotency_key, email) WHERE idempotency_key IS NOT NULL;
+DROP INDEX IF EXISTS idx_tx_messages_created_at; CREATE INDEX idx_tx_messages_created_at ON tx_messages(created_at);
+
+-- webhooks are outbound HTTP endpoints that are notified of events.
+DROP TABLE IF EXISTS webhooks CASCADE;
+CREATE TABLE webhooks (
+    id               SERIAL PRIMARY KEY,
+    name             TEXT NOT NULL,
+    url              TEXT NOT NULL,
+    secret           TEXT NOT NULL,
+    events           TEXT[] NOT NULL DEFAULT '{}',
+    enabled          BOOLEAN NOT NULL DEFAULT true,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- webhook_deliveries is the queue and log of event payloads posted to webhooks.
+DROP TABLE IF EXISTS webhook_deliveries CASCADE;
+CREATE TABLE webhook_deliveries (
+    id               BIGSERIAL PRIMARY KEY,
+    webhook_id       INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    event            TEXT NOT NULL,
+    payload          JSONB NOT NULL DEFAULT '{}',
+    status           webhook_delivery_status NOT NULL DEFAULT 'pending',
+    attempts         INT NOT NULL DEFAULT 0,
+    response_code    INT NULL,
+    response         TEXT NOT NULL DEFAULT '',
+    next_attempt_at  TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_webhook_deliveries_webhook_id; CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
+DROP INDEX IF EXISTS idx_webhook_deliveries_pending; CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
 -- roles
 DROP TABLE IF EXISTS roles CASCADE;
 CREATE TABLE roles (
@@ -315,6 +624,9 @@ CREATE TABLE roles (
     list_id          INTEGER NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
     permissions      TEXT[] NOT NULL DEFAULT '{}',
     name             TEXT NULL,
+
+    -- Users with the role have to log in with TOTP 2FA.
+    require_2fa      BOOLEAN NOT NULL DEFAULT false,
     created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
@@ -336,10 +648,38 @@ CREATE TABLE users (
     list_role_id     INTEGER NULL REFERENCES roles(id) ON DELETE CASCADE,
     status           user_status NOT NULL DEFAULT 'disabled',
     loggedin_at      TIMESTAMP WITH TIME ZONE NULL,
+
+    -- TOTP 2FA. totp_secret is set on enrolment and totp_enabled once a code is verified.
+    -- Recovery codes are stored as SHA256 hashes. totp_last_step is the time step of the last
+    -- used code that prevents codes from being replayed.
+    totp_secret         TEXT NULL,
+    totp_enabled        BOOLEAN NOT NULL DEFAULT false,
+    totp_recovery_codes TEXT[] NOT NULL DEFAULT '{}',
+    totp_last_step      BIGINT NOT NULL DEFAULT 0,
+
     created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- api_tokens are the access tokens of API users. Only the SHA256 hash of a token is stored.
+-- permissions, if set, restrict a token to a subset of the user's role permissions and
+-- ip_allowlist, if set, to the given IPs and CIDR ranges.
+DROP TABLE IF EXISTS api_tokens CASCADE;
+CREATE TABLE api_tokens (
+    id               SERIAL PRIMARY KEY,
+    user_id          INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    name             TEXT NOT NULL,
+    token_hash       TEXT NOT NULL UNIQUE,
+    token_prefix     TEXT NOT NULL DEFAULT '',
+    permissions      TEXT[] NOT NULL DEFAULT '{}',
+    ip_allowlist     TEXT[] NOT NULL DEFAULT '{}',
+    expires_at       TIMESTAMP WITH TIME ZONE NULL,
+    last_used_at     TIMESTAMP WITH TIME ZONE NULL,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_api_tokens_user_id; CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+
 -- user sessions
 DROP TABLE IF EXISTS sessions CASCADE;
 CREATE TABLE sessions (
@@ -349,6 +689,80 @@ CREATE TABLE sessions (
 );
 DROP INDEX IF EXISTS idx_sessions; CREATE INDEX idx_sessions ON sessions (id, created_at);
 
+-- audit_log records mutating admin and API actions. username is retained for
+-- deleted users. before and after hold the changed fields of the target where available.
+DROP TABLE IF EXISTS audit_log CASCADE;
+CREATE TABLE audit_log (
+    id               BIGSERIAL PRIMARY KEY,
+    user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    username         TEXT NOT NULL DEFAULT '',
+    action           TEXT NOT NULL,
+    target_type      TEXT NOT NULL DEFAULT '',
+    target_id        INTEGER NULL,
+    before           JSONB NULL,
+    after            JSONB NULL,
+    meta             JSONB NOT NULL DEFAULT '{}',
+    ip               TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_audit_log_created_at; CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+DROP INDEX IF EXISTS idx_audit_log_user_id; CREATE INDEX idx_audit_log_user_id ON audit_log(user_id);
+DROP INDEX IF EXISTS idx_audit_log_target; CREATE INDEX idx_audit_log_target ON audit_log(target_type, target_id);
+
+-- template_versions are immutable snapshots of templates that are recorded on every save.
+-- username is retained for deleted users.
+DROP TABLE IF EXISTS template_versions CASCADE;
+CREATE TABLE template_versions (
+    id               SERIAL PRIMARY KEY,
+    template_id      INTEGER NOT NULL REFERENCES templates(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    version          INTEGER NOT NULL,
+    name             TEXT NOT NULL,
+    subject          TEXT NOT NULL,
+    body             TEXT NOT NULL,
+    body_source      TEXT NULL,
+    user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    username         TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    UNIQUE (template_id, version)
+);
+
+-- rate_limit_counters are the fixed window request counters of rate limited keys (eg: ip:1.2.3.4)
+-- that are shared by multiple instances with the postgres rate limit backend.
+DROP TABLE IF EXISTS rate_limit_counters CASCADE;
+CREATE UNLOGGED TABLE rate_limit_counters (
+    key              TEXT NOT NULL,
+    window_start     TIMESTAMP WITH TIME ZONE NOT NULL,
+    hits             INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (key, window_start)
+);
+
+-- rate_limit_blocks are the IPs and e-mail domains that are temporarily blocked
+-- from the public subscription endpoints.
+DROP TABLE IF EXISTS rate_limit_blocks CASCADE;
+CREATE TABLE rate_limit_blocks (
+    id               SERIAL PRIMARY KEY,
+    scope            TEXT NOT NULL,
+    value            TEXT NOT NULL,
+    expires_at       TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    UNIQUE (scope, value)
+);
+
+-- abuse_events records requests to public endpoints that exceeded rate limits or led to blocks.
+DROP TABLE IF EXISTS abuse_events CASCADE;
+CREATE TABLE abuse_events (
+    id               BIGSERIAL PRIMARY KEY,
+    type             TEXT NOT NULL,
+    scope            TEXT NOT NULL,
+    value            TEXT NOT NULL,
+    ip               TEXT NOT NULL DEFAULT '',
+    route            TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_abuse_events_created_at; CREATE INDEX idx_abuse_events_created_at ON abuse_events(created_at);
+
 -- materialized views
 
 -- dashboard stats